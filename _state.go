@@ -22,7 +22,8 @@ type ApiError struct {
 	Type       ApiErrorType
 	Object     LValue
 	StackTrace string
-	// Underlying error. This attribute is set only if the Type is ApiErrorFile or ApiErrorSyntax
+	// Underlying error. This attribute is set for ApiErrorFile and ApiErrorSyntax, and
+	// holds a *RevertError when a TOL revert raised the error.
 	Cause error
 }
 
@@ -38,6 +39,11 @@ func newApiErrorE(code ApiErrorType, err error) *ApiError {
 	return &ApiError{code, LString(err.Error()), "", err}
 }
 
+// Unwrap returns the underlying error, if any.
+func (e *ApiError) Unwrap() error {
+	return e.Cause
+}
+
 func (e *ApiError) Error() string {
 	if len(e.StackTrace) > 0 {
 		return fmt.Sprintf("%s\n%s", e.Object.String(), e.StackTrace)
@@ -1132,6 +1138,7 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 		tb, istable := curobj.(*LTable)
 		if istable {
 			if tb.RawGetString(key) != LNil {
+				ls.checkTableWriteString(tb, key)
 				tb.RawSetString(key, value)
 				return
 			}
@@ -1141,6 +1148,7 @@ func (ls *LState) setFieldString(obj LValue, key string, value LValue) {
 			if !istable {
 				ls.RaiseError("attempt to index a non-table object(%v) with key '%s'", curobj.Type().String(), key)
 			}
+			ls.checkTableWriteString(tb, key)
 			tb.RawSetString(key, value)
 			return
 		}
@@ -1667,13 +1675,33 @@ func (ls *LState) RawSet(tb *LTable, key LValue, value LValue) {
 	if key == LNil {
 		ls.RaiseError("table index is nil")
 	}
+	ls.checkTableWrite(tb, key)
 	tb.RawSet(key, value)
 }
 
 func (ls *LState) RawSetInt(tb *LTable, key int, value LValue) {
+	ls.checkTableWrite(tb, nil)
 	tb.RawSetInt(key, value)
 }
 
+// checkTableWrite raises an error if tb is frozen or key is sealed in tb;
+// see LTable.Freeze and LTable.SealField.
+func (ls *LState) checkTableWrite(tb *LTable, key LValue) {
+	if !tb.frozen && tb.sealed == nil {
+		return
+	}
+	if msg := tb.writeViolation(key); msg != "" {
+		ls.RaiseError("%s", msg)
+	}
+}
+
+func (ls *LState) checkTableWriteString(tb *LTable, key string) {
+	if !tb.frozen && tb.sealed == nil {
+		return
+	}
+	ls.checkTableWrite(tb, LString(key))
+}
+
 func (ls *LState) SetField(obj LValue, key string, value LValue) {
 	ls.setFieldString(obj, key, value)
 }
@@ -1690,7 +1718,13 @@ func (ls *LState) GetGlobal(name string) LValue {
 	return ls.GetField(ls.Get(GlobalsIndex), name)
 }
 
+// SetGlobal sets a global variable. As a host API it may replace a global
+// sealed by OpenLibs or a TOL module; Lua code cannot.
 func (ls *LState) SetGlobal(name string, value LValue) {
+	if tb, ok := ls.Get(GlobalsIndex).(*LTable); ok && !tb.frozen && tb.IsFieldSealed(name) {
+		tb.rawSetString(name, value)
+		return
+	}
 	ls.SetField(ls.Get(GlobalsIndex), name, value)
 }
 
@@ -1703,8 +1737,11 @@ func (ls *LState) Next(tb *LTable, key LValue) (LValue, LValue) {
 /* unary operations {{{ */
 
 func (ls *LState) ObjLen(v1 LValue) int {
-	if v1.Type() == LTString {
-		return len(string(v1.(LString)))
+	switch lv := v1.(type) {
+	case LString:
+		return len(lv)
+	case LBytes:
+		return len(lv)
 	}
 	op := ls.metaOp1(v1, "__len")
 	if op.Type() == LTFunction {
@@ -1838,8 +1875,12 @@ func (ls *LState) PCall(nargs, nret int, errfunc *LFunction) (err error) {
 						ls.reg.SetTop(base)
 					}
 				}()
+				// The handler only rewrites the error object; the Go error it
+				// was raised with (e.g. a *RevertError) stays the cause.
+				cause := err.(*ApiError).Cause
 				ls.Call(1, 1)
 				err = newApiError(ApiErrorError, ls.Get(-1))
+				err.(*ApiError).Cause = cause
 			} else if len(err.(*ApiError).StackTrace) == 0 {
 				err.(*ApiError).StackTrace = ls.stackTrace(0)
 			}
@@ -1894,6 +1935,7 @@ func (ls *LState) SetMetatable(obj LValue, mt LValue) {
 
 	switch v := obj.(type) {
 	case *LTable:
+		ls.checkTableWrite(v, nil)
 		v.Metatable = mt
 	case *LUserData:
 		v.Metatable = mt
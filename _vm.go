@@ -344,6 +344,8 @@ func init() {
 			switch lv := L.rkValue(B).(type) {
 			case LString:
 				// +inline-call reg.SetNumber RA LNumber(intToDecStr(len(lv)))
+			case LBytes:
+				// +inline-call reg.SetNumber RA LNumber(intToDecStr(len(lv)))
 			default:
 				op := L.metaOp1(lv, "__len")
 				if op.Type() == LTFunction {
@@ -856,6 +858,14 @@ func stringConcat(L *LState, total, last int) LValue {
 	total--
 	for i := last - 1; total > 0; {
 		lhs := L.reg.Get(i)
+		if lb, ok := lhs.(LBytes); ok {
+			if rb, ok := rhs.(LBytes); ok {
+				rhs = lb + rb
+				total--
+				i--
+				continue
+			}
+		}
 		if !(LVCanConvToString(lhs) && LVCanConvToString(rhs)) {
 			op := L.metaOp2(lhs, rhs, "__concat")
 			if op.Type() == LTFunction {
@@ -28,7 +28,15 @@ func parseAddressValue(v LValue) (LAddress, error) {
 		return parseAddressString(string(lv))
 	case LString:
 		return parseAddressString(string(lv))
+	case LBytes:
+		return lv.Address()
 	default:
 		return "", fmt.Errorf("expected address string")
 	}
 }
+
+// ParseAddress parses a 0x-prefixed 32-byte hex address into its canonical
+// lower-case form.
+func ParseAddress(raw string) (LAddress, error) {
+	return parseAddressString(raw)
+}
@@ -11,11 +11,14 @@ func TestAddressConstructorAndType(t *testing.T) {
 		assert(type(a) == "address")
 		assert(tostring(a) == "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 		assert(a == address("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+		assert(a == address(bytes.fromhex(tostring(a))))
 
 		local ok = pcall(function() address("0x1234") end)
 		assert(ok == false)
 		ok = pcall(function() address(1) end)
 		assert(ok == false)
+		ok = pcall(function() address(bytes.fromhex("0x1234")) end)
+		assert(ok == false)
 	`)
 	if err != nil {
 		t.Fatal(err)
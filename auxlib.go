@@ -79,12 +79,34 @@ func (ls *LState) CheckAddress(n int) LAddress {
 			ls.ArgError(n, err.Error())
 		}
 		return addr
+	case LBytes:
+		addr, err := lv.Address()
+		if err != nil {
+			ls.ArgError(n, err.Error())
+		}
+		return addr
 	default:
 		ls.TypeError(n, LTAddress)
 	}
 	return LAddress("")
 }
 
+// CheckBytes returns argument n as LBytes. Bytes values are returned
+// without copying; addresses and "0x" hex strings are decoded.
+func (ls *LState) CheckBytes(n int) LBytes {
+	switch lv := ls.Get(n).(type) {
+	case LBytes, LAddress, LString:
+		bt, err := toBytesValue(lv)
+		if err != nil {
+			ls.ArgError(n, err.Error())
+		}
+		return bt
+	default:
+		ls.TypeError(n, LTBytes)
+	}
+	return LBytes("")
+}
+
 func (ls *LState) CheckBool(n int) bool {
 	v := ls.Get(n)
 	if lv, ok := v.(LBool); ok {
@@ -229,6 +251,12 @@ func (ls *LState) OptAddress(n int, d LAddress) LAddress {
 			ls.ArgError(n, err.Error())
 		}
 		return addr
+	case LBytes:
+		addr, err := lv.Address()
+		if err != nil {
+			ls.ArgError(n, err.Error())
+		}
+		return addr
 	default:
 		ls.TypeError(n, LTAddress)
 	}
@@ -0,0 +1,236 @@
+package lua
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Rounding modes of math.binaryLog and math.pow2, in the order of the TOL
+// EstimationMode enum (spec §10.1).
+const (
+	EstimateLowerBound = iota
+	EstimateMidpoint
+	EstimateUpperBound
+)
+
+// fixedMaxBits caps the working precision of binaryLog and pow2. Results
+// that are not exact are irrational, and for u256 operands the rounding is
+// decided within the first refinement round or two; the cap bounds the work
+// a pathological input can cause.
+const fixedMaxBits = 2048
+
+var (
+	errFixedPrecision = errors.New("precision limit exceeded")
+	errFixedOverflow  = errors.New("result out of range")
+	int256Min         = new(big.Int).Neg(uint256SignBit)
+)
+
+// binaryLog returns log2(x / scale) * scale rounded according to mode:
+// down for EstimateLowerBound, up for EstimateUpperBound and to the
+// nearest integer for EstimateMidpoint. It uses integer arithmetic only:
+// the result is bracketed with interval bounds whose precision doubles
+// until the rounding is decided. round, when not nil, is called before each
+// refinement round with its working precision in bits, e.g. to charge gas.
+func binaryLog(x, scale *big.Int, mode int, round func(bits uint)) (*big.Int, error) {
+	if x.Sign() <= 0 {
+		return nil, errors.New("x must be positive")
+	}
+	if scale.Sign() <= 0 {
+		return nil, errors.New("scale must be positive")
+	}
+	// n = floor(log2(x / scale)), so x / (scale * 2^n) is in [1, 2).
+	n := x.BitLen() - scale.BitLen()
+	if cmpScaledPow2(x, scale, n) < 0 {
+		n--
+	}
+	if cmpScaledPow2(x, scale, n) == 0 {
+		return checkInt256(new(big.Int).Mul(big.NewInt(int64(n)), scale))
+	}
+	for w := uint(scale.BitLen() + 64); w <= fixedMaxBits; w *= 2 {
+		if round != nil {
+			round(w)
+		}
+		fracLo, fracHi := log2FracBounds(x, scale, n, w)
+		// log2(x / scale) lies in [n + fracLo/2^w, n + fracHi/2^w].
+		base := new(big.Int).Lsh(big.NewInt(int64(n)), w)
+		lo := new(big.Int).Mul(scale, fracLo.Add(fracLo, base))
+		hi := new(big.Int).Mul(scale, fracHi.Add(fracHi, base))
+		if v, ok := roundBracket(lo, hi, w, mode); ok {
+			return checkInt256(v)
+		}
+	}
+	return nil, errFixedPrecision
+}
+
+// pow2 returns 2^(x / scale) * scale rounded according to mode, with the
+// same modes and integer-only refinement as binaryLog. Exact halves are
+// rounded up by EstimateMidpoint.
+func pow2(x, scale *big.Int, mode int, round func(bits uint)) (*big.Int, error) {
+	if scale.Sign() <= 0 {
+		return nil, errors.New("scale must be positive")
+	}
+	// x / scale = q + rem / scale with 0 <= rem < scale.
+	q, rem := new(big.Int).DivMod(x, scale, new(big.Int))
+	sbits := scale.BitLen()
+	// scale * 2^q >= 2^(sbits-1+q) overflows once sbits-1+q >= 256.
+	if q.Cmp(big.NewInt(int64(257-sbits))) >= 0 {
+		return nil, errFixedOverflow
+	}
+	// The result is below scale * 2^(q+1) < 1/2 once q <= -sbits-2.
+	if q.Cmp(big.NewInt(int64(-sbits-2))) <= 0 {
+		if mode == EstimateUpperBound {
+			return big.NewInt(1), nil
+		}
+		return new(big.Int), nil
+	}
+	qi := int(q.Int64())
+	if rem.Sign() == 0 {
+		if qi >= 0 {
+			return checkUint256(new(big.Int).Lsh(scale, uint(qi)))
+		}
+		v, _ := roundBracket(scale, scale, uint(-qi), mode)
+		return v, nil
+	}
+	for w := uint(sbits + 64); w <= fixedMaxBits; w *= 2 {
+		if round != nil {
+			round(w)
+		}
+		tLo, tHi := pow2FracBounds(rem, scale, w)
+		// 2^(x / scale) * scale lies in [scale*tLo, scale*tHi] * 2^(q-w).
+		lo := tLo.Mul(tLo, scale)
+		hi := tHi.Mul(tHi, scale)
+		shift := int(w) - qi
+		if shift < 0 {
+			lo.Lsh(lo, uint(-shift))
+			hi.Lsh(hi, uint(-shift))
+			shift = 0
+		}
+		if v, ok := roundBracket(lo, hi, uint(shift), mode); ok {
+			return checkUint256(v)
+		}
+	}
+	return nil, errFixedPrecision
+}
+
+// cmpScaledPow2 compares x with scale * 2^n.
+func cmpScaledPow2(x, scale *big.Int, n int) int {
+	if n >= 0 {
+		return x.Cmp(new(big.Int).Lsh(scale, uint(n)))
+	}
+	return new(big.Int).Lsh(x, uint(-n)).Cmp(scale)
+}
+
+// log2FracBounds returns lo and hi with lo/2^w <= log2(m) <= hi/2^w for
+// m = x / (scale * 2^n) in [1, 2). The fraction bits are extracted by
+// repeated squaring, once with every intermediate rounded down and once
+// with every intermediate rounded up.
+func log2FracBounds(x, scale *big.Int, n int, w uint) (*big.Int, *big.Int) {
+	// m as a w-bit fixed-point number.
+	num := new(big.Int).Lsh(x, w)
+	den := new(big.Int).Set(scale)
+	if n >= 0 {
+		den.Lsh(den, uint(n))
+	} else {
+		num.Lsh(num, uint(-n))
+	}
+	mLo := num.Quo(num, den)
+	mHi := new(big.Int).Add(mLo, big.NewInt(1))
+	two := new(big.Int).Lsh(big.NewInt(2), w)
+	lo, hi := new(big.Int), new(big.Int)
+	for i := uint(0); i < w; i++ {
+		mLo = fixedMulFloor(mLo, mLo, w)
+		mHi = fixedMulCeil(mHi, mHi, w)
+		lo.Lsh(lo, 1)
+		hi.Lsh(hi, 1)
+		if mLo.Cmp(two) >= 0 {
+			mLo.Rsh(mLo, 1)
+			lo.SetBit(lo, 0, 1)
+		}
+		if mHi.Cmp(two) >= 0 {
+			mHi.Add(mHi, big.NewInt(1)).Rsh(mHi, 1)
+			hi.SetBit(hi, 0, 1)
+		}
+	}
+	return lo, hi.Add(hi, big.NewInt(1))
+}
+
+// pow2FracBounds returns w-bit fixed-point bounds of 2^(rem / scale) for
+// 0 < rem < scale. The exponent is truncated to w bits, k/2^w, and 2^(k/2^w)
+// is the product of the roots 2^(1/2^i) selected by the bits of k.
+func pow2FracBounds(rem, scale *big.Int, w uint) (*big.Int, *big.Int) {
+	k := new(big.Int).Lsh(rem, w)
+	k.Quo(k, scale)
+	one := new(big.Int).Lsh(big.NewInt(1), w)
+	tLo, tHi := new(big.Int).Set(one), new(big.Int).Set(one)
+	// rem/scale is in [k/2^w, (k+1)/2^w]; the upper bound multiplies in one
+	// more smallest root instead of computing 2^((k+1)/2^w).
+	rootLo := new(big.Int).Sqrt(new(big.Int).Lsh(big.NewInt(2), 2*w))
+	rootHi := new(big.Int).Add(rootLo, big.NewInt(1))
+	for i := uint(1); i <= w; i++ {
+		if k.Bit(int(w-i)) == 1 {
+			tLo = fixedMulFloor(tLo, rootLo, w)
+			tHi = fixedMulCeil(tHi, rootHi, w)
+		}
+		if i == w {
+			tHi = fixedMulCeil(tHi, rootHi, w)
+			break
+		}
+		rootLo = new(big.Int).Sqrt(new(big.Int).Lsh(rootLo, w))
+		rootHi = new(big.Int).Sqrt(new(big.Int).Lsh(rootHi, w))
+		rootHi.Add(rootHi, big.NewInt(1))
+	}
+	return tLo, tHi
+}
+
+func fixedMulFloor(a, b *big.Int, w uint) *big.Int {
+	p := new(big.Int).Mul(a, b)
+	return p.Rsh(p, w)
+}
+
+func fixedMulCeil(a, b *big.Int, w uint) *big.Int {
+	p := new(big.Int).Mul(a, b)
+	p.Add(p, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), w), big.NewInt(1)))
+	return p.Rsh(p, w)
+}
+
+// roundBracket rounds a value v known to lie in [lo/2^shift, hi/2^shift]
+// according to mode. It reports false when the bracket is too wide to
+// decide. For lo == hi it rounds the exact value lo/2^shift.
+func roundBracket(lo, hi *big.Int, shift uint, mode int) (*big.Int, bool) {
+	switch mode {
+	case EstimateMidpoint:
+		// round(v) = floor((floor(2v) + 1) / 2), rounding halves up.
+		f := new(big.Int).Rsh(new(big.Int).Lsh(lo, 1), shift)
+		if f.Cmp(new(big.Int).Rsh(new(big.Int).Lsh(hi, 1), shift)) != 0 {
+			return nil, false
+		}
+		return f.Add(f, big.NewInt(1)).Rsh(f, 1), true
+	case EstimateUpperBound:
+		// ceil(v) = -floor(-v).
+		c := new(big.Int).Rsh(new(big.Int).Neg(hi), shift)
+		if c.Cmp(new(big.Int).Rsh(new(big.Int).Neg(lo), shift)) != 0 {
+			return nil, false
+		}
+		return c.Neg(c), true
+	default:
+		f := new(big.Int).Rsh(lo, shift)
+		if f.Cmp(new(big.Int).Rsh(hi, shift)) != 0 {
+			return nil, false
+		}
+		return f, true
+	}
+}
+
+func checkInt256(v *big.Int) (*big.Int, error) {
+	if v.Cmp(int256Min) < 0 || v.Cmp(uint256SignBit) >= 0 {
+		return nil, errFixedOverflow
+	}
+	return v, nil
+}
+
+func checkUint256(v *big.Int) (*big.Int, error) {
+	if v.Cmp(uint256Max) > 0 {
+		return nil, errFixedOverflow
+	}
+	return v, nil
+}
@@ -22,11 +22,16 @@ const (
 	bcConstNumber
 	bcConstString
 	bcConstAddress
+	bcConstBytes
+
+	// bcConstKinds counts the constant tags. It is part of the VM ID, so
+	// loaders that predate a new tag reject bytecode using it.
+	bcConstKinds
 )
 
 func bytecodeVMID() string {
-	return fmt.Sprintf("pkg=%s-%s;lua=%s;numbit=%d;opmax=%d",
-		PackageName, PackageVersion, LuaVersion, LNumberBit, opCodeMax)
+	return fmt.Sprintf("pkg=%s-%s;lua=%s;numbit=%d;opmax=%d;consts=%d",
+		PackageName, PackageVersion, LuaVersion, LNumberBit, opCodeMax, bcConstKinds)
 }
 
 // IsBytecode reports whether the input starts with tolang bytecode magic bytes.
@@ -498,6 +503,11 @@ func writeConst(w io.Writer, v LValue) error {
 			return err
 		}
 		return writeString(w, string(lv))
+	case LBytes:
+		if err := writeU8(w, bcConstBytes); err != nil {
+			return err
+		}
+		return writeString(w, string(lv))
 	default:
 		if v == LNil {
 			return writeU8(w, bcConstNil)
@@ -545,6 +555,12 @@ func readConst(r *byteReader) (LValue, error) {
 			return nil, err
 		}
 		return addr, nil
+	case bcConstBytes:
+		s, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		return LBytes(s), nil
 	default:
 		return nil, fmt.Errorf("unknown constant tag: %d", tag)
 	}
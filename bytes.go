@@ -0,0 +1,84 @@
+package lua
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BytesFromHex decodes a "0x"-prefixed hex string into an LBytes value.
+func BytesFromHex(s string) (LBytes, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return "", fmt.Errorf("expected bytes with 0x prefix, got %q", s)
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return "", fmt.Errorf("invalid bytes hex string: %v", err)
+	}
+	return LBytes(b), nil
+}
+
+// BytesFromNumber returns the size-byte big-endian encoding of the
+// non-negative number n.
+func BytesFromNumber(n LNumber, size int) (LBytes, error) {
+	if size < 1 || size > 32 {
+		return "", fmt.Errorf("bytes size must be between 1 and 32, got %d", size)
+	}
+	if _, err := parseNumber(string(n)); err != nil {
+		return "", fmt.Errorf("cannot encode %q as bytes: %v", string(n), err)
+	}
+	b := lNumberToBigInt(n)
+	if (b.BitLen()+7)/8 > size {
+		return "", fmt.Errorf("number does not fit in %d bytes", size)
+	}
+	out := make([]byte, size)
+	b.FillBytes(out)
+	return LBytes(out), nil
+}
+
+// BytesFromAddress returns the 32 raw bytes of addr.
+func BytesFromAddress(addr LAddress) (LBytes, error) {
+	canon, err := parseAddressString(string(addr))
+	if err != nil {
+		return "", err
+	}
+	return BytesFromHex(string(canon))
+}
+
+// Number decodes bt as a big-endian unsigned integer of at most 32 bytes.
+func (bt LBytes) Number() (LNumber, error) {
+	if len(bt) > 32 {
+		return "", fmt.Errorf("bytes value exceeds 32 bytes (%d bytes)", len(bt))
+	}
+	return bigToLNum(new(big.Int).SetBytes(bt.readOnly())), nil
+}
+
+// Address returns bt as an address; bt must be exactly 32 bytes long.
+func (bt LBytes) Address() (LAddress, error) {
+	if len(bt) != 32 {
+		return "", fmt.Errorf("address must be 32 bytes, got %d", len(bt))
+	}
+	return LAddress(bt.String()), nil
+}
+
+// readOnly returns the bytes of bt without copying; callers must not
+// modify the result.
+func (bt LBytes) readOnly() []byte {
+	return unsafeFastStringToReadOnlyBytes(string(bt))
+}
+
+// toBytesValue converts v to LBytes: LBytes values are returned as they
+// are, addresses and "0x" hex strings are decoded.
+func toBytesValue(v LValue) (LBytes, error) {
+	switch lv := v.(type) {
+	case LBytes:
+		return lv, nil
+	case LAddress:
+		return BytesFromAddress(lv)
+	case LString:
+		return BytesFromHex(string(lv))
+	}
+	return "", fmt.Errorf("expected bytes, got %s", v.Type())
+}
@@ -0,0 +1,195 @@
+package lua
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tos-network/tolang/parse"
+)
+
+func TestBytesValueType(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	err := L.DoString(`
+		local b = bytes.fromhex("0x0102030405")
+		assert(type(b) == "bytes")
+		assert(tostring(b) == "0x0102030405")
+		assert(#b == 5 and b:len() == 5)
+		assert(b:sub(2, 3) == bytes.fromhex("0x0203"))
+		assert(b:sub(4) == bytes.fromhex("0x0405"))
+		assert(b .. b:sub(1, 1) == bytes.fromhex("0x010203040501"))
+		assert(bytes.concat(b, "0xff") == bytes.fromhex("0x0102030405ff"))
+		assert(b ~= "0x0102030405")
+		assert(b:hex() == "0x0102030405")
+
+		local t = {}
+		t[bytes.fromhex("0xaa")] = 1
+		assert(t[bytes.fromhex("0xaa")] == 1)
+
+		local w = bytes.fromnumber(258, 4)
+		assert(w == bytes.fromhex("0x00000102") and bytes.tonumber(w) == 258)
+		assert(#bytes.fromnumber(1) == 32)
+		assert(pcall(bytes.fromnumber, 65536, 2) == false)
+
+		local a = address("0x1111111111111111111111111111111111111111111111111111111111111111")
+		assert(bytes.toaddress(bytes.fromaddress(a)) == a)
+		assert(pcall(bytes.toaddress, b) == false)
+		assert(pcall(bytes.fromhex, "0102") == false)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBytesSliceSharesMemory(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	data, _ := BytesFromHex("0x" + strings.Repeat("ab", 68))
+	L.SetGlobal("data", data)
+	if err := L.DoString(`tail = __tol_slice(data, 4, nil)`); err != nil {
+		t.Fatal(err)
+	}
+	tail := L.GetGlobal("tail").(LBytes)
+	if len(tail) != 64 || tail != data[4:] {
+		t.Fatalf("unexpected slice %s", tail)
+	}
+	if &tail.readOnly()[0] != &data.readOnly()[4] {
+		t.Fatal("slice copied the underlying bytes")
+	}
+	for _, bad := range []string{`__tol_slice(data, 0, 69)`, `__tol_slice(data, 5, 4)`} {
+		if err := L.DoString(bad); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Fatalf("%s: expected a range error, got %v", bad, err)
+		}
+	}
+}
+
+func TestBytesInCryptoBuiltins(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	err := L.DoString(`
+		local raw = bytes.fromhex("0x68656c6c6f")
+		assert(keccak256(raw) == keccak256("0x68656c6c6f"))
+		assert(sha256(raw) == sha256("0x68656c6c6f"))
+		assert(__tol_enc(bytes.fromhex("0x01")) == __tol_enc(1))
+
+		-- The native mapping key matches the hex-text derivation it replaced.
+		local base = keccak256("0x00")
+		local want = tostring(keccak256("0x" .. __tol_enc(7) .. tostring(base):sub(3)))
+		assert(__tol_mkey(7, base) == want)
+		assert(__tol_mkey(bytes.fromnumber(7), tostring(base)) == want)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBytesConstantRoundTrip(t *testing.T) {
+	chunk, err := parse.Parse(strings.NewReader(`return 1`), "<bytes>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := Compile(chunk, "<bytes>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto.Constants = append(proto.Constants, LBytes("\x00\xffraw"))
+	bc, err := EncodeFunctionProto(proto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeFunctionProto(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoded.Constants[len(decoded.Constants)-1]; got != LBytes("\x00\xffraw") {
+		t.Fatalf("unexpected constant %#v", got)
+	}
+}
+
+const calldataSource = `
+tol 0.2
+contract Calldata {
+  fn argsHash(a: u256, b: u256) -> (h: bytes32) public view {
+    return keccak256(msg.data[4:]);
+  }
+  fn second(a: u256, b: u256) -> (w: bytes32) public view {
+    return msg.data[36:68];
+  }
+}
+`
+
+func TestCalldataSliceFromTOL(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(calldataSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewMemoryContractHost()
+	h.SetCode(hostCounterAddr, bc)
+	call := func(sig string, args ...LValue) string {
+		t.Helper()
+		res := h.Call(&ContractCall{Kind: CallKindCall, To: hostCounterAddr, Data: string(mustCallData(t, sig, args...)), Depth: 1})
+		if !res.OK {
+			t.Fatalf("%s: %v", sig, res.Err)
+		}
+		return res.ReturnData
+	}
+
+	data := string(mustCallData(t, "argsHash(u256,u256)", LNumber("1"), LNumber("2")))
+	want, _ := BytesFromHex("0x" + data[10:])
+	if got := call("argsHash(u256,u256)", LNumber("1"), LNumber("2")); got != "0x"+hex.EncodeToString(keccak256Bytes(want.readOnly())) {
+		t.Fatalf("unexpected argument hash %s", got)
+	}
+	word, _ := tolEncodeKey(LNumber("300"))
+	if got := call("second(u256,u256)", LNumber("1"), LNumber("300")); got != "0x"+word {
+		t.Fatalf("unexpected second word %s", got)
+	}
+}
+
+const selectorCheckSource = `
+tol 0.2
+contract Selectors {
+  const F: bytes4 = selector("f()");
+  fn f() -> (ok: bool) public view {
+    require(msg.data[0:4] == selector("f()"), "selector mismatch");
+    require(msg.data[0:4] == F, "constant mismatch");
+    require(msg.data[0:4] == this.f.selector, "member mismatch");
+    require(msg.data[0:4] == "%s", "literal mismatch");
+    require(keccak256(msg.data[0:4]) == keccak256(selector("f()")), "hash mismatch");
+    return true;
+  }
+  fn g() -> (ok: bool) public view {
+    require(msg.data[0:4] == selector("f()"), "selector mismatch");
+    return true;
+  }
+}
+`
+
+func TestCalldataSelectorFromTOL(t *testing.T) {
+	src := fmt.Sprintf(selectorCheckSource, FunctionSelector("f()"))
+	bc, err := CompileTOLToBytecode([]byte(src), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewMemoryContractHost()
+	h.SetCode(hostCounterAddr, bc)
+	call := func(sig string) CallResult {
+		t.Helper()
+		data, err := EncodeCallData(FunctionSelector(sig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.Call(&ContractCall{Kind: CallKindCall, To: hostCounterAddr, Data: data, Depth: 1})
+	}
+	if res := call("f()"); !res.OK {
+		t.Fatalf("f(): %v", res.Err)
+	}
+	res := call("g()")
+	if rerr, ok := AsRevertError(res.Err); res.OK || !ok || rerr.Reason != "selector mismatch" {
+		t.Fatalf("expected a selector mismatch from g(), got %v", res.Err)
+	}
+}
@@ -0,0 +1,136 @@
+package lua
+
+import (
+	"strings"
+)
+
+// OpenBytes opens the bytes library and installs it as the metatable of
+// LBytes values, so b:sub(1, 4) and b:hex() work like string methods.
+// It also registers __tol_slice, the lowering of TOL slice expressions.
+func OpenBytes(L *LState) int {
+	mod := L.RegisterModule(BytesLibName, bytesFuncs).(*LTable)
+	mod.RawSetString("__index", mod)
+	L.G.builtinMts[int(LTBytes)] = mod
+	L.SetGlobal("__tol_slice", L.NewFunction(bytesTolSlice))
+	L.Push(mod)
+	return 1
+}
+
+var bytesFuncs = map[string]LGFunction{
+	"concat":      bytesConcat,
+	"fromaddress": bytesFromAddress,
+	"fromhex":     bytesFromHex,
+	"fromnumber":  bytesFromNumber,
+	"hex":         bytesHex,
+	"len":         bytesLen,
+	"sub":         bytesSub,
+	"toaddress":   bytesToAddress,
+	"tonumber":    bytesToNumber,
+}
+
+// bytesConcat implements bytes.concat(...) -> bytes.
+func bytesConcat(L *LState) int {
+	var sb strings.Builder
+	for i := 1; i <= L.GetTop(); i++ {
+		sb.WriteString(string(L.CheckBytes(i)))
+	}
+	L.Push(LBytes(sb.String()))
+	return 1
+}
+
+// bytesFromAddress implements bytes.fromaddress(addr) -> bytes (32 bytes).
+func bytesFromAddress(L *LState) int {
+	bt, err := BytesFromAddress(L.CheckAddress(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(bt)
+	return 1
+}
+
+// bytesFromHex implements bytes.fromhex(hex) -> bytes.
+func bytesFromHex(L *LState) int {
+	bt, err := BytesFromHex(L.CheckString(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(bt)
+	return 1
+}
+
+// bytesFromNumber implements bytes.fromnumber(n [, size]) -> bytes, the
+// size-byte (default 32) big-endian encoding of n.
+func bytesFromNumber(L *LState) int {
+	bt, err := BytesFromNumber(L.CheckNumber(1), L.OptInt(2, 32))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(bt)
+	return 1
+}
+
+// bytesHex implements bytes.hex(b) -> "0x"-prefixed hex string.
+func bytesHex(L *LState) int {
+	L.Push(LString(L.CheckBytes(1).String()))
+	return 1
+}
+
+func bytesLen(L *LState) int {
+	L.Push(lNumberFromInt(len(L.CheckBytes(1))))
+	return 1
+}
+
+// bytesSub implements bytes.sub(b, i [, j]) with string.sub index rules
+// (1-based, inclusive). The result shares b's memory.
+func bytesSub(L *LState) int {
+	bt := L.CheckBytes(1)
+	start := luaIndex2StringIndex(string(bt), L.CheckInt(2), true)
+	end := luaIndex2StringIndex(string(bt), L.OptInt(3, -1), false)
+	if start >= len(bt) || end < start {
+		L.Push(LBytes(""))
+	} else {
+		L.Push(bt[start:end])
+	}
+	return 1
+}
+
+// bytesToAddress implements bytes.toaddress(b) -> address; b must be 32
+// bytes long.
+func bytesToAddress(L *LState) int {
+	addr, err := L.CheckBytes(1).Address()
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(addr)
+	return 1
+}
+
+// bytesToNumber implements bytes.tonumber(b) -> u256, decoding at most 32
+// bytes big-endian.
+func bytesToNumber(L *LState) int {
+	n, err := L.CheckBytes(1).Number()
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	L.Push(n)
+	return 1
+}
+
+// bytesTolSlice implements __tol_slice(b, start, end), the lowering of the
+// TOL slice b[start:end]: zero-based and end-exclusive, with nil bounds
+// meaning the start and end of b. Out-of-range bounds raise an error.
+func bytesTolSlice(L *LState) int {
+	bt := L.CheckBytes(1)
+	start, end := 0, len(bt)
+	if L.Get(2) != LNil {
+		start = L.CheckInt(2)
+	}
+	if L.Get(3) != LNil {
+		end = L.CheckInt(3)
+	}
+	if start < 0 || end < start || end > len(bt) {
+		L.RaiseError("slice [%d:%d] out of range for %d bytes", start, end, len(bt))
+	}
+	L.Push(bt[start:end])
+	return 1
+}
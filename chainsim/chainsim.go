@@ -0,0 +1,362 @@
+// Package chainsim is an in-memory local chain for end-to-end testing of
+// TOL contracts. It models accounts with balances, nonces, deployed code and
+// per-contract storage, executes transactions against the TOL runtime and
+// seals them into blocks with receipts. Nothing touches the network or disk.
+package chainsim
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+
+	lua "github.com/tos-network/tolang"
+)
+
+// Config configures a new Chain. Zero fields take the defaults below.
+type Config struct {
+	// GenesisTimestamp is the timestamp of block 0.
+	GenesisTimestamp uint64 `json:"genesis_timestamp"`
+	// BlockTime is the timestamp increment between blocks (default 1).
+	BlockTime uint64 `json:"block_time"`
+	// GasLimit is the per-transaction gas limit used when a Tx sets none
+	// (default DefaultGasLimit).
+	GasLimit uint64 `json:"gas_limit"`
+}
+
+// DefaultGasLimit is the default per-transaction gas limit.
+const DefaultGasLimit uint64 = 30_000_000
+
+// Tx is a transaction. A Tx with an empty To deploys Code; otherwise it
+// invokes To with calldata Data (see lua.EncodeCallData), or is a plain
+// value transfer when To has no code.
+type Tx struct {
+	From  lua.LAddress
+	To    lua.LAddress
+	Value lua.LNumber
+	Data  string
+	// Code is the deployed code (a .toc artifact or tolang bytecode) and
+	// Args the constructor arguments, for deployments.
+	Code []byte
+	Args []lua.LValue
+	Gas  uint64
+}
+
+// Receipt is the result of an executed transaction.
+type Receipt struct {
+	TxHash      string
+	BlockNumber uint64
+	TxIndex     int
+	From        lua.LAddress
+	To          lua.LAddress
+	// ContractAddress is the deployed address for a successful deployment.
+	ContractAddress lua.LAddress
+	Status          bool
+	GasUsed         uint64
+	ReturnData      string
+	Logs            []lua.LogEntry
+	// RevertReason is the error raised by a failed transaction.
+	RevertReason string
+}
+
+// Block is a sealed block.
+type Block struct {
+	Number     uint64
+	Timestamp  uint64
+	Hash       string
+	ParentHash string
+	Receipts   []*Receipt
+}
+
+// Chain is an in-memory chain. Transactions execute immediately against
+// the pending block; Mine seals the pending block.
+type Chain struct {
+	cfg      Config
+	host     *lua.MemoryContractHost
+	blocks   []*Block
+	pending  []*Receipt
+	receipts map[string]*Receipt
+	origin   lua.LAddress
+	tracer   lua.Tracer
+
+	snapshots []*chainState
+}
+
+// New returns a chain holding only the genesis block.
+func New(cfg Config) *Chain {
+	if cfg.BlockTime == 0 {
+		cfg.BlockTime = 1
+	}
+	if cfg.GasLimit == 0 {
+		cfg.GasLimit = DefaultGasLimit
+	}
+	c := &Chain{
+		cfg:      cfg,
+		host:     lua.NewMemoryContractHost(),
+		receipts: map[string]*Receipt{},
+	}
+	genesis := &Block{Timestamp: cfg.GenesisTimestamp, ParentHash: zeroHash}
+	genesis.Hash = blockHash(genesis)
+	c.blocks = []*Block{genesis}
+	c.host.SetFrameHook(c.setEnvironment)
+	return c
+}
+
+// DevAccounts returns n deterministic development account addresses:
+// keccak256("tol.dev.account.<i>") for i = 0..n-1.
+func DevAccounts(n int) []lua.LAddress {
+	out := make([]lua.LAddress, n)
+	for i := range out {
+		h := sha3.NewLegacyKeccak256()
+		h.Write([]byte(fmt.Sprintf("tol.dev.account.%d", i)))
+		out[i] = lua.LAddress("0x" + hex.EncodeToString(h.Sum(nil)))
+	}
+	return out
+}
+
+const zeroHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// Host returns the contract host backing the chain's state.
+func (c *Chain) Host() *lua.MemoryContractHost { return c.host }
+
+// SetTracer traces every transaction and call executed from now on with t;
+// nil disables tracing.
+func (c *Chain) SetTracer(t lua.Tracer) { c.tracer = t }
+
+// SetBlockTime sets the timestamp increment of the blocks sealed from now
+// on; zero restores the default.
+func (c *Chain) SetBlockTime(t uint64) {
+	if t == 0 {
+		t = 1
+	}
+	c.cfg.BlockTime = t
+}
+
+// SetGasLimit sets the per-transaction gas limit used when a Tx sets none;
+// zero restores DefaultGasLimit.
+func (c *Chain) SetGasLimit(n uint64) {
+	if n == 0 {
+		n = DefaultGasLimit
+	}
+	c.cfg.GasLimit = n
+}
+
+// SetBalance sets the balance of addr.
+func (c *Chain) SetBalance(addr lua.LAddress, amount lua.LNumber) { c.host.SetBalance(addr, amount) }
+
+// Balance returns the balance of addr.
+func (c *Chain) Balance(addr lua.LAddress) lua.LNumber { return c.host.Balance(addr) }
+
+// Nonce returns the number of transactions sent by addr (for contracts, the
+// number of contracts it created).
+func (c *Chain) Nonce(addr lua.LAddress) uint64 { return c.host.Nonce(addr) }
+
+// Code returns the bytecode deployed at addr, or nil.
+func (c *Chain) Code(addr lua.LAddress) []byte { return c.host.Code(addr) }
+
+// Storage returns the storage table of addr, or nil when there is no
+// account at addr. Callers must not modify it.
+func (c *Chain) Storage(addr lua.LAddress) *lua.LTable { return c.host.Storage(addr) }
+
+// Head returns the latest sealed block.
+func (c *Chain) Head() *Block { return c.blocks[len(c.blocks)-1] }
+
+// BlockByNumber returns a sealed block.
+func (c *Chain) BlockByNumber(n uint64) (*Block, bool) {
+	if n >= uint64(len(c.blocks)) {
+		return nil, false
+	}
+	return c.blocks[n], true
+}
+
+// Receipt returns the receipt of a transaction by hash.
+func (c *Chain) Receipt(txHash string) (*Receipt, bool) {
+	r, ok := c.receipts[txHash]
+	return r, ok
+}
+
+// PendingNumber returns the number of the block the next transaction
+// executes in.
+func (c *Chain) PendingNumber() uint64 { return c.Head().Number + 1 }
+
+// PendingTimestamp returns the timestamp of the pending block.
+func (c *Chain) PendingTimestamp() uint64 { return c.Head().Timestamp + c.cfg.BlockTime }
+
+// SendTransaction executes tx in the pending block and returns its receipt.
+// A reverted transaction still produces a receipt (with Status false) and
+// consumes the sender's nonce; malformed transactions return an error.
+func (c *Chain) SendTransaction(tx *Tx) (*Receipt, error) {
+	from, err := lua.ParseAddress(string(tx.From))
+	if err != nil {
+		return nil, fmt.Errorf("chainsim: invalid sender: %v", err)
+	}
+	var to lua.LAddress
+	if tx.To != "" {
+		if to, err = lua.ParseAddress(string(tx.To)); err != nil {
+			return nil, fmt.Errorf("chainsim: invalid recipient: %v", err)
+		}
+		if tx.Data == "" && len(c.host.Code(to)) > 0 {
+			return nil, errors.New("chainsim: call to a contract without calldata")
+		}
+	} else if len(tx.Code) == 0 {
+		return nil, errors.New("chainsim: deployment without code")
+	}
+	value := tx.Value
+	if value == "" {
+		value = lua.LNumberZero
+	}
+	gas := tx.Gas
+	if gas == 0 {
+		gas = c.cfg.GasLimit
+	}
+	nonce := c.host.Nonce(from)
+	r := &Receipt{
+		TxHash:      txHash(from, to, value, tx, nonce),
+		BlockNumber: c.PendingNumber(),
+		TxIndex:     len(c.pending),
+		From:        from,
+		To:          to,
+	}
+
+	journal := c.host.Journal()
+	journal.Reset()
+	c.origin = from
+	if to == "" {
+		res := c.host.Create(&lua.ContractCreate{
+			Kind:     lua.CallKindCreate,
+			Creator:  from,
+			Value:    value,
+			InitCode: tx.Code,
+			Args:     tx.Args,
+			Gas:      gas,
+			Tracer:   c.tracer,
+		})
+		r.Status, r.GasUsed = res.OK, res.GasUsed
+		if res.OK {
+			r.ContractAddress = res.Address
+		} else {
+			r.RevertReason = revertReason(res.Err)
+		}
+	} else {
+		c.host.SetNonce(from, nonce+1)
+		res := c.host.Call(&lua.ContractCall{
+			Kind:   lua.CallKindCall,
+			Caller: from,
+			To:     to,
+			Sender: from,
+			Value:  value,
+			Data:   tx.Data,
+			Gas:    gas,
+			Tracer: c.tracer,
+		})
+		r.Status, r.GasUsed, r.ReturnData = res.OK, res.GasUsed, res.ReturnData
+		if !res.OK {
+			r.RevertReason = revertReason(res.Err)
+		}
+	}
+	r.Logs = journal.Logs()
+	journal.Reset()
+	c.origin = ""
+
+	c.pending = append(c.pending, r)
+	c.receipts[r.TxHash] = r
+	return r, nil
+}
+
+// Call executes a read-only invocation against the current state, as of
+// the pending block, and returns the hex return data. State changes are
+// rejected with STATIC_CALL_VIOLATION.
+func (c *Chain) Call(from, to lua.LAddress, data string) (string, error) {
+	journal := c.host.Journal()
+	journal.Reset()
+	c.origin = from
+	res := c.host.Call(&lua.ContractCall{
+		Kind:   lua.CallKindStaticCall,
+		Caller: from,
+		To:     to,
+		Sender: from,
+		Data:   data,
+		Gas:    c.cfg.GasLimit,
+		Static: true,
+		Tracer: c.tracer,
+	})
+	journal.Reset()
+	c.origin = ""
+	if !res.OK {
+		return "", fmt.Errorf("chainsim: call reverted: %s", revertReason(res.Err))
+	}
+	return res.ReturnData, nil
+}
+
+// Mine seals the pending transactions into a new block and returns it.
+func (c *Chain) Mine() *Block {
+	b := &Block{
+		Number:     c.PendingNumber(),
+		Timestamp:  c.PendingTimestamp(),
+		ParentHash: c.Head().Hash,
+		Receipts:   c.pending,
+	}
+	b.Hash = blockHash(b)
+	c.blocks = append(c.blocks, b)
+	c.pending = nil
+	return b
+}
+
+// setEnvironment installs the `block` and `tx` tables on every frame.
+func (c *Chain) setEnvironment(L *lua.LState) {
+	block := L.NewTable()
+	block.RawSetString("number", lua.LNumber(fmt.Sprint(c.PendingNumber())))
+	block.RawSetString("timestamp", lua.LNumber(fmt.Sprint(c.PendingTimestamp())))
+	L.SetGlobal("block", block)
+	tx := L.NewTable()
+	tx.RawSetString("origin", c.origin)
+	tx.RawSetString("gasprice", lua.LNumberZero)
+	L.SetGlobal("tx", tx)
+}
+
+// revertReason renders a frame error: the reason of a revert, or the raised
+// value for other Lua errors.
+func revertReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if rerr, ok := lua.AsRevertError(err); ok {
+		return rerr.Reason
+	}
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) && apiErr.Object != nil {
+		return lua.LVAsString(apiErr.Object)
+	}
+	return err.Error()
+}
+
+// txHash hashes the parsed sender, recipient and value rather than the raw
+// fields of tx, so spellings of the same transaction share one hash.
+func txHash(from, to lua.LAddress, value lua.LNumber, tx *Tx, nonce uint64) string {
+	h := sha3.NewLegacyKeccak256()
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], nonce)
+	h.Write([]byte(from))
+	h.Write(n[:])
+	h.Write([]byte(to))
+	h.Write([]byte(value))
+	h.Write([]byte(strings.ToLower(tx.Data)))
+	h.Write(tx.Code)
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
+
+func blockHash(b *Block) string {
+	h := sha3.NewLegacyKeccak256()
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], b.Number)
+	binary.BigEndian.PutUint64(buf[8:], b.Timestamp)
+	h.Write([]byte(b.ParentHash))
+	h.Write(buf[:])
+	for _, r := range b.Receipts {
+		h.Write([]byte(r.TxHash))
+	}
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,183 @@
+package chainsim
+
+import (
+	"strings"
+	"testing"
+
+	lua "github.com/tos-network/tolang"
+)
+
+const ledgerSource = `
+tol 0.2
+contract Ledger {
+  storage {
+    slot total: u256;
+    slot lastBlock: u256;
+  }
+  event Deposited(who: address, amount: u256)
+  constructor(seed: u256) {
+    set total = seed;
+  }
+  fn deposit() public payable {
+    set total = total + msg.value;
+    set lastBlock = block.number;
+    emit Deposited(msg.sender, msg.value);
+    return;
+  }
+  fn fail() public {
+    set total = 0;
+    emit Deposited(msg.sender, 0);
+    revert "nope";
+  }
+  fn get() -> (t: u256) public view {
+    return total;
+  }
+  fn seen() -> (b: u256) public view {
+    return lastBlock;
+  }
+}
+`
+
+var (
+	alice = lua.LAddress("0x" + strings.Repeat("0", 62) + "a1")
+	bob   = lua.LAddress("0x" + strings.Repeat("0", 62) + "b0")
+)
+
+func calldata(t *testing.T, sig string, args ...lua.LValue) string {
+	t.Helper()
+	data, err := lua.EncodeCallData(lua.FunctionSelector(sig), args...)
+	if err != nil {
+		t.Fatalf("calldata %s: %v", sig, err)
+	}
+	return data
+}
+
+func word(n string) string {
+	data, _ := lua.EncodeCallData("0x00000000", lua.LNumber(n))
+	return "0x" + data[10:]
+}
+
+func TestChainDeployInvokeAndMine(t *testing.T) {
+	toc, err := lua.CompileTOLToTOC([]byte(ledgerSource), "ledger.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(Config{GenesisTimestamp: 1000, BlockTime: 12})
+	c.SetBalance(alice, "100")
+
+	r, err := c.SendTransaction(&Tx{From: alice, Code: toc, Args: []lua.LValue{lua.LNumber("5")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Status || r.ContractAddress != lua.CreateAddress(alice, 0) || c.Nonce(alice) != 1 {
+		t.Fatalf("unexpected deploy receipt: %+v", r)
+	}
+	ledger := r.ContractAddress
+	b1 := c.Mine()
+	if b1.Number != 1 || b1.Timestamp != 1012 || len(b1.Receipts) != 1 || b1.ParentHash != c.blocks[0].Hash {
+		t.Fatalf("unexpected block 1: %+v", b1)
+	}
+
+	r, err = c.SendTransaction(&Tx{From: alice, To: ledger, Value: "30", Data: calldata(t, "deposit()")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Status || r.BlockNumber != 2 || r.GasUsed == 0 {
+		t.Fatalf("unexpected deposit receipt: %+v", r)
+	}
+	if len(r.Logs) != 1 || r.Logs[0].Event != "Deposited" || r.Logs[0].Address != ledger || r.Logs[0].Args[0] != alice {
+		t.Fatalf("unexpected logs: %+v", r.Logs)
+	}
+	if c.Balance(alice) != "70" || c.Balance(ledger) != "30" || c.Nonce(alice) != 2 {
+		t.Fatalf("unexpected balances/nonce: alice=%s ledger=%s nonce=%d", c.Balance(alice), c.Balance(ledger), c.Nonce(alice))
+	}
+
+	r, err = c.SendTransaction(&Tx{From: alice, To: ledger, Data: calldata(t, "fail()")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status || !strings.Contains(r.RevertReason, "nope") || len(r.Logs) != 0 || c.Nonce(alice) != 3 {
+		t.Fatalf("unexpected revert receipt: %+v", r)
+	}
+	c.Mine()
+
+	if got, err := c.Call(bob, ledger, calldata(t, "get()")); err != nil || got != word("35") {
+		t.Fatalf("unexpected total %s (%v)", got, err)
+	}
+	if got, err := c.Call(bob, ledger, calldata(t, "seen()")); err != nil || got != word("2") {
+		t.Fatalf("expected block.number 2 to be recorded, got %s (%v)", got, err)
+	}
+	if _, err := c.Call(bob, ledger, calldata(t, "deposit()")); err == nil || !strings.Contains(err.Error(), "STATIC_CALL_VIOLATION") {
+		t.Fatalf("expected read-only call to reject writes, got %v", err)
+	}
+	if rec, ok := c.Receipt(r.TxHash); !ok || rec != r {
+		t.Fatalf("expected receipt lookup by hash")
+	}
+}
+
+func TestChainValueTransferAndFailures(t *testing.T) {
+	c := New(Config{})
+	c.SetBalance(alice, "10")
+	r, err := c.SendTransaction(&Tx{From: alice, To: bob, Value: "4"})
+	if err != nil || !r.Status {
+		t.Fatalf("unexpected transfer result: %+v %v", r, err)
+	}
+	r, err = c.SendTransaction(&Tx{From: alice, To: bob, Value: "40"})
+	if err != nil || r.Status || !strings.Contains(r.RevertReason, "insufficient balance") {
+		t.Fatalf("expected insufficient balance receipt, got %+v %v", r, err)
+	}
+	if c.Balance(alice) != "6" || c.Balance(bob) != "4" || c.Nonce(alice) != 2 {
+		t.Fatalf("unexpected state: alice=%s bob=%s nonce=%d", c.Balance(alice), c.Balance(bob), c.Nonce(alice))
+	}
+	r, err = c.SendTransaction(&Tx{From: alice, Code: []byte("junk")})
+	if err != nil || r.Status || r.ContractAddress != "" {
+		t.Fatalf("expected invalid code deployment to fail, got %+v %v", r, err)
+	}
+	if _, err := c.SendTransaction(&Tx{From: "nobody", To: bob}); err == nil {
+		t.Fatalf("expected malformed sender error")
+	}
+}
+
+func TestChainTxHashIgnoresAddressSpelling(t *testing.T) {
+	var hashes []string
+	for _, to := range []lua.LAddress{bob, lua.LAddress("0X" + strings.ToUpper(string(bob[2:])))} {
+		c := New(Config{})
+		c.SetBalance(alice, "10")
+		r, err := c.SendTransaction(&Tx{From: lua.LAddress("0x" + strings.ToUpper(string(alice[2:]))), To: to, Value: "4"})
+		if err != nil || !r.Status {
+			t.Fatalf("unexpected transfer result: %+v %v", r, err)
+		}
+		hashes = append(hashes, r.TxHash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Fatalf("same transaction hashed differently: %v", hashes)
+	}
+}
+
+func TestChainTracesTransactions(t *testing.T) {
+	toc, err := lua.CompileTOLToTOC([]byte(ledgerSource), "ledger.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(Config{})
+	c.SetBalance(alice, "100")
+	tracer := lua.NewCallTracer(nil)
+	c.SetTracer(tracer)
+	r, err := c.SendTransaction(&Tx{From: alice, Code: toc, Args: []lua.LValue{lua.LNumber("5")}})
+	if err != nil || !r.Status {
+		t.Fatalf("deploy failed: %v %+v", err, r)
+	}
+	if _, err := c.SendTransaction(&Tx{From: alice, To: r.ContractAddress, Value: "3", Data: calldata(t, "deposit()")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call(alice, r.ContractAddress, calldata(t, "get()")); err != nil {
+		t.Fatal(err)
+	}
+	calls := tracer.Calls()
+	if len(calls) != 3 || calls[0].Type != "create" || calls[1].Type != "call" || calls[2].Type != "staticcall" {
+		t.Fatalf("unexpected traced frames: %+v", calls)
+	}
+	if calls[0].To != r.ContractAddress || len(calls[1].Logs) != 1 || calls[2].Output != word("8") {
+		t.Fatalf("unexpected frame details: %+v %+v %+v", calls[0], calls[1], calls[2])
+	}
+}
@@ -0,0 +1,467 @@
+package chainsim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	lua "github.com/tos-network/tolang"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// maxMineBlocks caps the block count of one `tol_mine` request.
+const maxMineBlocks = 10000
+
+// RPCServer serves a Chain over JSON-RPC 2.0 (HTTP POST). Methods live in
+// the `tol_` namespace; see the method table in Handle.
+type RPCServer struct {
+	mu       sync.Mutex
+	chain    *Chain
+	accounts []lua.LAddress
+	autoMine bool
+	onChange func(*Chain) error
+}
+
+// NewRPCServer returns a server for chain that reports accounts from
+// `tol_accounts`. Transactions are mined into their own block immediately.
+func NewRPCServer(chain *Chain, accounts []lua.LAddress) *RPCServer {
+	return &RPCServer{chain: chain, accounts: accounts, autoMine: true}
+}
+
+// SetAutoMine controls whether each transaction is sealed into its own
+// block. When off, blocks are sealed only by `tol_mine`.
+func (s *RPCServer) SetAutoMine(on bool) { s.autoMine = on }
+
+// OnStateChange installs fn to run after every method that changes chain
+// state, e.g. to persist it.
+func (s *RPCServer) OnStateChange(fn func(*Chain) error) { s.onChange = fn }
+
+// RPCError is a JSON-RPC error object.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+func invalidParams(format string, args ...any) *RPCError {
+	return &RPCError{Code: rpcInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		resp.Error = &RPCError{Code: rpcParseError, Message: err.Error()}
+	} else if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &RPCError{Code: rpcInvalidRequest, Message: "invalid JSON-RPC 2.0 request"}
+	} else {
+		if len(req.ID) > 0 {
+			resp.ID = req.ID
+		}
+		result, err := s.Handle(req.Method, req.Params)
+		if err != nil {
+			rerr, ok := err.(*RPCError)
+			if !ok {
+				rerr = &RPCError{Code: rpcServerError, Message: err.Error()}
+			}
+			resp.Error = rerr
+		} else if result == nil {
+			resp.Result = json.RawMessage("null")
+		} else {
+			resp.Result = result
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Handle executes one method with its JSON params array.
+func (s *RPCServer) Handle(method string, params json.RawMessage) (any, error) {
+	var args []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, invalidParams("params must be an array")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		result  any
+		err     error
+		changed bool
+	)
+	switch method {
+	case "tol_accounts":
+		out := make([]string, len(s.accounts))
+		for i, a := range s.accounts {
+			out[i] = string(a)
+		}
+		result = out
+	case "tol_blockNumber":
+		result = s.chain.Head().Number
+	case "tol_getBalance":
+		var addr lua.LAddress
+		if addr, err = addressParam(args, 0); err == nil {
+			result = string(s.chain.Balance(addr))
+		}
+	case "tol_getTransactionCount":
+		var addr lua.LAddress
+		if addr, err = addressParam(args, 0); err == nil {
+			result = s.chain.Nonce(addr)
+		}
+	case "tol_getCode":
+		var addr lua.LAddress
+		if addr, err = addressParam(args, 0); err == nil {
+			result = "0x" + hex.EncodeToString(s.chain.Code(addr))
+		}
+	case "tol_getStorageAt":
+		result, err = s.getStorageAt(args)
+	case "tol_deploy", "tol_sendTransaction":
+		result, err = s.sendTransaction(args, method == "tol_deploy")
+		changed = err == nil
+	case "tol_call":
+		result, err = s.call(args)
+	case "tol_getReceipt":
+		var hash string
+		if err = stringParam(args, 0, &hash); err == nil {
+			if r, ok := s.chain.Receipt(hash); ok {
+				result = newRPCReceipt(r)
+			}
+		}
+	case "tol_getLogs":
+		result, err = s.getLogs(args)
+	case "tol_mine":
+		n := uint64(1)
+		if len(args) > 0 {
+			if err = json.Unmarshal(args[0], &n); err != nil {
+				err = invalidParams("block count must be a number")
+			} else if n > maxMineBlocks {
+				err = invalidParams("block count must be at most %d", maxMineBlocks)
+			}
+		}
+		if err == nil {
+			for i := uint64(0); i < n; i++ {
+				s.chain.Mine()
+			}
+			result = s.chain.Head().Number
+			changed = true
+		}
+	case "tol_snapshot":
+		result, err = s.chain.Snapshot()
+	case "tol_revert":
+		var id int
+		if len(args) != 1 || json.Unmarshal(args[0], &id) != nil {
+			err = invalidParams("expected [snapshotId]")
+		} else {
+			result, err = s.chain.RevertToSnapshot(id)
+			changed = err == nil
+		}
+	default:
+		return nil, &RPCError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", method)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if changed && s.onChange != nil {
+		if err := s.onChange(s.chain); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// rpcTx is the transaction object of tol_deploy, tol_sendTransaction and
+// tol_call. Calldata is either Data or Signature plus Args.
+type rpcTx struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Value     string            `json:"value"`
+	Data      string            `json:"data"`
+	Signature string            `json:"signature"`
+	Args      []json.RawMessage `json:"args"`
+	Code      string            `json:"code"`
+	Gas       uint64            `json:"gas"`
+}
+
+func txParam(args []json.RawMessage) (*rpcTx, []lua.LValue, error) {
+	if len(args) != 1 {
+		return nil, nil, invalidParams("expected [transaction]")
+	}
+	var tx rpcTx
+	if err := json.Unmarshal(args[0], &tx); err != nil {
+		return nil, nil, invalidParams("invalid transaction: %v", err)
+	}
+	vals := make([]lua.LValue, len(tx.Args))
+	for i, raw := range tx.Args {
+		v, err := decodeRPCArg(raw)
+		if err != nil {
+			return nil, nil, invalidParams("args[%d]: %v", i, err)
+		}
+		vals[i] = v
+	}
+	if tx.Data == "" && tx.Signature != "" {
+		data, err := lua.EncodeCallData(lua.FunctionSelector(tx.Signature), vals...)
+		if err != nil {
+			return nil, nil, invalidParams("%v", err)
+		}
+		tx.Data = data
+	}
+	return &tx, vals, nil
+}
+
+// decodeRPCArg converts a JSON argument: booleans stay booleans, numbers
+// and decimal or short hex strings become u256 numbers, 32-byte hex
+// strings become addresses and other strings stay strings.
+func decodeRPCArg(raw json.RawMessage) (lua.LValue, error) {
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return lua.LBool(b), nil
+	}
+	var num json.Number
+	if json.Unmarshal(raw, &num) == nil && !strings.HasPrefix(strings.TrimSpace(string(raw)), `"`) {
+		n, ok := parseRPCNumber(num.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid u256 number %s", num)
+		}
+		return n, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return nil, fmt.Errorf("unsupported argument %s", string(raw))
+	}
+	if addr, err := lua.ParseAddress(str); err == nil {
+		return addr, nil
+	}
+	if n, ok := parseRPCNumber(str); ok {
+		return n, nil
+	}
+	return lua.LString(str), nil
+}
+
+// parseRPCNumber parses a non-negative decimal or 0x-prefixed hex string
+// as a u256 number.
+func parseRPCNumber(s string) (lua.LNumber, bool) {
+	if s == "" || strings.HasPrefix(s, "0") && len(s) > 1 && !strings.HasPrefix(s, "0x") {
+		return "", false
+	}
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok || n.Sign() < 0 || n.BitLen() > 256 {
+		return "", false
+	}
+	return lua.LNumber(n.Text(10)), true
+}
+
+func addressParam(args []json.RawMessage, i int) (lua.LAddress, error) {
+	var s string
+	if err := stringParam(args, i, &s); err != nil {
+		return "", err
+	}
+	addr, err := lua.ParseAddress(s)
+	if err != nil {
+		return "", invalidParams("params[%d]: %v", i, err)
+	}
+	return addr, nil
+}
+
+func stringParam(args []json.RawMessage, i int, out *string) error {
+	if i >= len(args) || json.Unmarshal(args[i], out) != nil {
+		return invalidParams("params[%d] must be a string", i)
+	}
+	return nil
+}
+
+func (s *RPCServer) sendTransaction(args []json.RawMessage, deploy bool) (any, error) {
+	rtx, vals, err := txParam(args)
+	if err != nil {
+		return nil, err
+	}
+	tx := &Tx{
+		From:  lua.LAddress(rtx.From),
+		Value: lua.LNumber(rtx.Value),
+		Gas:   rtx.Gas,
+	}
+	if deploy {
+		code, err := hex.DecodeString(strings.TrimPrefix(rtx.Code, "0x"))
+		if err != nil || len(code) == 0 {
+			return nil, invalidParams("code must be non-empty hex")
+		}
+		tx.Code, tx.Args = code, vals
+	} else {
+		tx.To, tx.Data = lua.LAddress(rtx.To), rtx.Data
+	}
+	r, err := s.chain.SendTransaction(tx)
+	if err != nil {
+		return nil, invalidParams("%v", err)
+	}
+	if s.autoMine {
+		s.chain.Mine()
+	}
+	return newRPCReceipt(r), nil
+}
+
+func (s *RPCServer) call(args []json.RawMessage) (any, error) {
+	rtx, _, err := txParam(args)
+	if err != nil {
+		return nil, err
+	}
+	to, err := lua.ParseAddress(rtx.To)
+	if err != nil {
+		return nil, invalidParams("to: %v", err)
+	}
+	from := lua.LAddress(rtx.From)
+	if from == "" && len(s.accounts) > 0 {
+		from = s.accounts[0]
+	}
+	return s.chain.Call(from, to, rtx.Data)
+}
+
+func (s *RPCServer) getStorageAt(args []json.RawMessage) (any, error) {
+	addr, err := addressParam(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var key string
+	if err := stringParam(args, 1, &key); err != nil {
+		return nil, err
+	}
+	storage := s.chain.Storage(addr)
+	if storage == nil {
+		return nil, nil
+	}
+	v := storage.RawGetString(strings.ToLower(key))
+	if v == lua.LNil {
+		return nil, nil
+	}
+	return EncodeValue(v)
+}
+
+type rpcLogFilter struct {
+	FromBlock *uint64 `json:"fromBlock"`
+	ToBlock   *uint64 `json:"toBlock"`
+	Address   string  `json:"address"`
+	Event     string  `json:"event"`
+}
+
+func (s *RPCServer) getLogs(args []json.RawMessage) (any, error) {
+	var f rpcLogFilter
+	if len(args) > 0 {
+		if err := json.Unmarshal(args[0], &f); err != nil {
+			return nil, invalidParams("invalid filter: %v", err)
+		}
+	}
+	from, to := uint64(0), s.chain.Head().Number
+	if f.FromBlock != nil {
+		from = *f.FromBlock
+	}
+	if f.ToBlock != nil && *f.ToBlock < to {
+		to = *f.ToBlock
+	}
+	addr := strings.ToLower(f.Address)
+	out := []rpcLog{}
+	for n := from; n <= to; n++ {
+		b, ok := s.chain.BlockByNumber(n)
+		if !ok {
+			break
+		}
+		for _, r := range b.Receipts {
+			for i, l := range r.Logs {
+				if (addr != "" && string(l.Address) != addr) || (f.Event != "" && l.Event != f.Event) {
+					continue
+				}
+				out = append(out, newRPCLog(r, i, l))
+			}
+		}
+	}
+	return out, nil
+}
+
+type rpcReceipt struct {
+	TransactionHash string   `json:"transactionHash"`
+	BlockNumber     uint64   `json:"blockNumber"`
+	TransactionIdx  int      `json:"transactionIndex"`
+	From            string   `json:"from"`
+	To              string   `json:"to,omitempty"`
+	ContractAddress string   `json:"contractAddress,omitempty"`
+	Status          bool     `json:"status"`
+	GasUsed         uint64   `json:"gasUsed"`
+	ReturnData      string   `json:"returnData,omitempty"`
+	RevertReason    string   `json:"revertReason,omitempty"`
+	Logs            []rpcLog `json:"logs"`
+}
+
+type rpcLog struct {
+	Address         string   `json:"address"`
+	Event           string   `json:"event"`
+	Args            []string `json:"args"`
+	BlockNumber     uint64   `json:"blockNumber"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        int      `json:"logIndex"`
+}
+
+func newRPCReceipt(r *Receipt) *rpcReceipt {
+	out := &rpcReceipt{
+		TransactionHash: r.TxHash,
+		BlockNumber:     r.BlockNumber,
+		TransactionIdx:  r.TxIndex,
+		From:            string(r.From),
+		To:              string(r.To),
+		ContractAddress: string(r.ContractAddress),
+		Status:          r.Status,
+		GasUsed:         r.GasUsed,
+		ReturnData:      r.ReturnData,
+		RevertReason:    r.RevertReason,
+		Logs:            []rpcLog{},
+	}
+	for i, l := range r.Logs {
+		out.Logs = append(out.Logs, newRPCLog(r, i, l))
+	}
+	return out
+}
+
+func newRPCLog(r *Receipt, i int, l lua.LogEntry) rpcLog {
+	args := make([]string, len(l.Args))
+	for j, a := range l.Args {
+		args[j] = lua.LVAsString(a)
+	}
+	return rpcLog{
+		Address:         string(l.Address),
+		Event:           l.Event,
+		Args:            args,
+		BlockNumber:     r.BlockNumber,
+		TransactionHash: r.TxHash,
+		LogIndex:        i,
+	}
+}
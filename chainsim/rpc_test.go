@@ -0,0 +1,175 @@
+package chainsim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+
+	lua "github.com/tos-network/tolang"
+)
+
+func rpcCall(t *testing.T, s *RPCServer, method string, params ...any) json.RawMessage {
+	t.Helper()
+	raw, _ := json.Marshal(params)
+	res, err := s.Handle(method, raw)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	out, _ := json.Marshal(res)
+	return out
+}
+
+func slotKey(contract, name string) string {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte("tol.slot." + contract + "." + name))
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
+
+func TestRPCServerEndToEnd(t *testing.T) {
+	toc, err := lua.CompileTOLToTOC([]byte(ledgerSource), "ledger.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := DevAccounts(2)
+	c := New(Config{})
+	for _, a := range accounts {
+		c.SetBalance(a, "1000")
+	}
+	s := NewRPCServer(c, accounts)
+	changes := 0
+	s.OnStateChange(func(*Chain) error { changes++; return nil })
+	from := string(accounts[0])
+
+	var deployed rpcReceipt
+	json.Unmarshal(rpcCall(t, s, "tol_deploy", map[string]any{
+		"from": from, "code": "0x" + hex.EncodeToString(toc), "args": []any{5},
+	}), &deployed)
+	if !deployed.Status || deployed.ContractAddress == "" || deployed.BlockNumber != 1 {
+		t.Fatalf("unexpected deploy receipt: %+v", deployed)
+	}
+	ledger := deployed.ContractAddress
+
+	snap := rpcCall(t, s, "tol_snapshot")
+	var sent rpcReceipt
+	json.Unmarshal(rpcCall(t, s, "tol_sendTransaction", map[string]any{
+		"from": from, "to": ledger, "value": "30", "signature": "deposit()",
+	}), &sent)
+	if !sent.Status || len(sent.Logs) != 1 || sent.Logs[0].Args[1] != "30" {
+		t.Fatalf("unexpected deposit receipt: %+v", sent)
+	}
+	if got := string(rpcCall(t, s, "tol_getReceipt", sent.TransactionHash)); !strings.Contains(got, sent.TransactionHash) {
+		t.Fatalf("unexpected receipt lookup %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_call", map[string]any{"to": ledger, "signature": "get()"})); got != `"`+word("35")+`"` {
+		t.Fatalf("unexpected call result %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_getStorageAt", ledger, slotKey("Ledger", "total"))); got != `{"type":"number","value":"35"}` {
+		t.Fatalf("unexpected storage value %s", got)
+	}
+	unknown := "0x" + strings.Repeat("99", 32)
+	if got := string(rpcCall(t, s, "tol_getStorageAt", unknown, slotKey("Ledger", "total"))); got != "null" {
+		t.Fatalf("unexpected storage of an unknown account %s", got)
+	}
+	if s.chain.Storage(lua.LAddress(unknown)) != nil {
+		t.Fatal("tol_getStorageAt created an account")
+	}
+	if got := string(rpcCall(t, s, "tol_getLogs", map[string]any{"event": "Deposited", "fromBlock": 2})); !strings.Contains(got, `"blockNumber":2`) {
+		t.Fatalf("unexpected logs %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_getLogs", map[string]any{"event": "Missing"})); got != "[]" {
+		t.Fatalf("expected no logs, got %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_mine", 3)); got != "5" {
+		t.Fatalf("unexpected head after mining %s", got)
+	}
+
+	if got := string(rpcCall(t, s, "tol_revert", json.RawMessage(snap))); got != "true" {
+		t.Fatalf("unexpected revert result %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_blockNumber")); got != "1" {
+		t.Fatalf("expected revert to restore block 1, got %s", got)
+	}
+	if got := string(rpcCall(t, s, "tol_getBalance", from)); got != `"1000"` {
+		t.Fatalf("expected revert to restore balance, got %s", got)
+	}
+	if changes != 4 {
+		t.Fatalf("expected 4 state changes, got %d", changes)
+	}
+
+	if _, err := s.Handle("tol_unknown", nil); err == nil || err.(*RPCError).Code != rpcMethodNotFound {
+		t.Fatalf("expected method not found, got %v", err)
+	}
+	if _, err := s.Handle("tol_mine", json.RawMessage(`[1000000000000000000]`)); err == nil || err.(*RPCError).Code != rpcInvalidParams {
+		t.Fatalf("expected an oversized tol_mine to be rejected, got %v", err)
+	}
+	if _, err := s.Handle("tol_getBalance", json.RawMessage(`["nobody"]`)); err == nil || err.(*RPCError).Code != rpcInvalidParams {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+}
+
+func TestRPCServeHTTP(t *testing.T) {
+	s := NewRPCServer(New(Config{}), DevAccounts(1))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tol_accounts"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		ID     int      `json:"id"`
+		Result []string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 7 || len(out.Result) != 1 || out.Result[0] != string(DevAccounts(1)[0]) {
+		t.Fatalf("unexpected response %+v", out)
+	}
+	if resp, err := http.Get(srv.URL); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %v %v", resp, err)
+	}
+}
+
+func TestChainSaveLoad(t *testing.T) {
+	toc, err := lua.CompileTOLToTOC([]byte(ledgerSource), "ledger.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(Config{GenesisTimestamp: 50})
+	c.SetBalance(alice, "100")
+	r, err := c.SendTransaction(&Tx{From: alice, Code: toc, Args: []lua.LValue{lua.LNumber("9")}})
+	if err != nil || !r.Status {
+		t.Fatalf("deploy failed: %+v %v", r, err)
+	}
+	c.Mine()
+	if _, err := c.SendTransaction(&Tx{From: alice, To: r.ContractAddress, Value: "1", Data: calldata(t, "deposit()")}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Head().Hash != c.Head().Hash || loaded.Nonce(alice) != 2 || loaded.Balance(alice) != "99" {
+		t.Fatalf("unexpected loaded chain: head=%+v nonce=%d balance=%s", loaded.Head(), loaded.Nonce(alice), loaded.Balance(alice))
+	}
+	b := loaded.Mine()
+	if b.Number != 2 || len(b.Receipts) != 1 || len(b.Receipts[0].Logs) != 1 {
+		t.Fatalf("expected pending receipt to survive a reload, got %+v", b)
+	}
+	if got, err := loaded.Call(bob, r.ContractAddress, calldata(t, "get()")); err != nil || got != word("10") {
+		t.Fatalf("unexpected total after reload %s (%v)", got, err)
+	}
+}
@@ -0,0 +1,321 @@
+package chainsim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	lua "github.com/tos-network/tolang"
+)
+
+// chainState is the serializable form of a Chain: its configuration,
+// account state, sealed blocks and pending receipts.
+type chainState struct {
+	Config   Config         `json:"config"`
+	Accounts []accountState `json:"accounts"`
+	Blocks   []blockState   `json:"blocks"`
+	Pending  []receiptState `json:"pending,omitempty"`
+}
+
+type accountState struct {
+	Address string         `json:"address"`
+	Balance string         `json:"balance"`
+	Nonce   uint64         `json:"nonce,omitempty"`
+	Code    string         `json:"code,omitempty"`
+	Storage []storageEntry `json:"storage,omitempty"`
+}
+
+type storageEntry struct {
+	Key   string `json:"key"`
+	Value Value  `json:"value"`
+}
+
+type blockState struct {
+	Number     uint64         `json:"number"`
+	Timestamp  uint64         `json:"timestamp"`
+	Hash       string         `json:"hash"`
+	ParentHash string         `json:"parent_hash"`
+	Receipts   []receiptState `json:"receipts,omitempty"`
+}
+
+type receiptState struct {
+	TxHash          string     `json:"tx_hash"`
+	BlockNumber     uint64     `json:"block_number"`
+	TxIndex         int        `json:"tx_index"`
+	From            string     `json:"from"`
+	To              string     `json:"to,omitempty"`
+	ContractAddress string     `json:"contract_address,omitempty"`
+	Status          bool       `json:"status"`
+	GasUsed         uint64     `json:"gas_used"`
+	ReturnData      string     `json:"return_data,omitempty"`
+	Logs            []logState `json:"logs,omitempty"`
+	RevertReason    string     `json:"revert_reason,omitempty"`
+}
+
+type logState struct {
+	Address string  `json:"address"`
+	Event   string  `json:"event"`
+	Args    []Value `json:"args,omitempty"`
+}
+
+// Value is the JSON form of a scalar TOL runtime value.
+type Value struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// EncodeValue converts a storage or log value to its JSON form. Only
+// scalar values (nil, bool, number, string, address, bytes) are supported.
+func EncodeValue(v lua.LValue) (Value, error) {
+	switch lv := v.(type) {
+	case *lua.LNilType:
+		return Value{Type: "nil"}, nil
+	case lua.LBool:
+		return Value{Type: "bool", Value: lv.String()}, nil
+	case lua.LNumber:
+		return Value{Type: "number", Value: string(lv)}, nil
+	case lua.LString:
+		return Value{Type: "string", Value: string(lv)}, nil
+	case lua.LAddress:
+		return Value{Type: "address", Value: string(lv)}, nil
+	case lua.LBytes:
+		return Value{Type: "bytes", Value: lv.String()}, nil
+	}
+	return Value{}, fmt.Errorf("chainsim: cannot encode %s value", v.Type())
+}
+
+// Decode converts v back to a runtime value.
+func (v Value) Decode() (lua.LValue, error) {
+	switch v.Type {
+	case "nil":
+		return lua.LNil, nil
+	case "bool":
+		return lua.LBool(v.Value == "true"), nil
+	case "number":
+		return lua.LNumber(v.Value), nil
+	case "string":
+		return lua.LString(v.Value), nil
+	case "address":
+		return lua.ParseAddress(v.Value)
+	case "bytes":
+		return lua.BytesFromHex(v.Value)
+	}
+	return nil, fmt.Errorf("chainsim: unknown value type %q", v.Type)
+}
+
+func (c *Chain) dump() (*chainState, error) {
+	st := &chainState{Config: c.cfg}
+	for _, addr := range c.host.Addresses() {
+		acc := accountState{
+			Address: string(addr),
+			Balance: string(c.host.Balance(addr)),
+			Nonce:   c.host.Nonce(addr),
+		}
+		if code := c.host.Code(addr); len(code) > 0 {
+			acc.Code = "0x" + hex.EncodeToString(code)
+		}
+		var err error
+		c.host.Storage(addr).ForEach(func(k, v lua.LValue) {
+			if err != nil {
+				return
+			}
+			var val Value
+			if val, err = EncodeValue(v); err == nil {
+				acc.Storage = append(acc.Storage, storageEntry{Key: lua.LVAsString(k), Value: val})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(acc.Storage, func(i, j int) bool { return acc.Storage[i].Key < acc.Storage[j].Key })
+		st.Accounts = append(st.Accounts, acc)
+	}
+	for _, b := range c.blocks {
+		bs := blockState{Number: b.Number, Timestamp: b.Timestamp, Hash: b.Hash, ParentHash: b.ParentHash}
+		for _, r := range b.Receipts {
+			rs, err := encodeReceipt(r)
+			if err != nil {
+				return nil, err
+			}
+			bs.Receipts = append(bs.Receipts, rs)
+		}
+		st.Blocks = append(st.Blocks, bs)
+	}
+	for _, r := range c.pending {
+		rs, err := encodeReceipt(r)
+		if err != nil {
+			return nil, err
+		}
+		st.Pending = append(st.Pending, rs)
+	}
+	return st, nil
+}
+
+// restore replaces the chain's state with st.
+func (c *Chain) restore(st *chainState) error {
+	host := lua.NewMemoryContractHost()
+	for _, acc := range st.Accounts {
+		addr, err := lua.ParseAddress(acc.Address)
+		if err != nil {
+			return fmt.Errorf("chainsim: account %q: %v", acc.Address, err)
+		}
+		host.SetBalance(addr, lua.LNumber(acc.Balance))
+		host.SetNonce(addr, acc.Nonce)
+		if acc.Code != "" {
+			code, err := hex.DecodeString(strings.TrimPrefix(acc.Code, "0x"))
+			if err != nil {
+				return fmt.Errorf("chainsim: account %s code: %v", addr, err)
+			}
+			host.SetCode(addr, code)
+		}
+		storage := host.Storage(addr)
+		for _, e := range acc.Storage {
+			v, err := e.Value.Decode()
+			if err != nil {
+				return err
+			}
+			storage.RawSetString(e.Key, v)
+		}
+	}
+	if len(st.Blocks) == 0 {
+		return fmt.Errorf("chainsim: state has no genesis block")
+	}
+	var blocks []*Block
+	receipts := map[string]*Receipt{}
+	for _, bs := range st.Blocks {
+		b := &Block{Number: bs.Number, Timestamp: bs.Timestamp, Hash: bs.Hash, ParentHash: bs.ParentHash}
+		for _, rs := range bs.Receipts {
+			r, err := decodeReceipt(rs)
+			if err != nil {
+				return err
+			}
+			b.Receipts = append(b.Receipts, r)
+			receipts[r.TxHash] = r
+		}
+		blocks = append(blocks, b)
+	}
+	var pending []*Receipt
+	for _, rs := range st.Pending {
+		r, err := decodeReceipt(rs)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, r)
+		receipts[r.TxHash] = r
+	}
+
+	c.cfg = st.Config
+	c.host = host
+	c.host.SetFrameHook(c.setEnvironment)
+	c.blocks = blocks
+	c.pending = pending
+	c.receipts = receipts
+	return nil
+}
+
+func encodeReceipt(r *Receipt) (receiptState, error) {
+	rs := receiptState{
+		TxHash:          r.TxHash,
+		BlockNumber:     r.BlockNumber,
+		TxIndex:         r.TxIndex,
+		From:            string(r.From),
+		To:              string(r.To),
+		ContractAddress: string(r.ContractAddress),
+		Status:          r.Status,
+		GasUsed:         r.GasUsed,
+		ReturnData:      r.ReturnData,
+		RevertReason:    r.RevertReason,
+	}
+	for _, l := range r.Logs {
+		ls := logState{Address: string(l.Address), Event: l.Event}
+		for _, a := range l.Args {
+			v, err := EncodeValue(a)
+			if err != nil {
+				return rs, err
+			}
+			ls.Args = append(ls.Args, v)
+		}
+		rs.Logs = append(rs.Logs, ls)
+	}
+	return rs, nil
+}
+
+func decodeReceipt(rs receiptState) (*Receipt, error) {
+	r := &Receipt{
+		TxHash:          rs.TxHash,
+		BlockNumber:     rs.BlockNumber,
+		TxIndex:         rs.TxIndex,
+		From:            lua.LAddress(rs.From),
+		To:              lua.LAddress(rs.To),
+		ContractAddress: lua.LAddress(rs.ContractAddress),
+		Status:          rs.Status,
+		GasUsed:         rs.GasUsed,
+		ReturnData:      rs.ReturnData,
+		RevertReason:    rs.RevertReason,
+	}
+	for _, ls := range rs.Logs {
+		l := lua.LogEntry{Address: lua.LAddress(ls.Address), Event: ls.Event}
+		for _, a := range ls.Args {
+			v, err := a.Decode()
+			if err != nil {
+				return nil, err
+			}
+			l.Args = append(l.Args, v)
+		}
+		r.Logs = append(r.Logs, l)
+	}
+	return r, nil
+}
+
+// Snapshot records the full chain state and returns an id for
+// RevertToSnapshot.
+func (c *Chain) Snapshot() (int, error) {
+	st, err := c.dump()
+	if err != nil {
+		return 0, err
+	}
+	c.snapshots = append(c.snapshots, st)
+	return len(c.snapshots) - 1, nil
+}
+
+// RevertToSnapshot restores the state recorded by Snapshot, including the
+// block height. The snapshot and every later one are consumed. It reports
+// false for unknown ids.
+func (c *Chain) RevertToSnapshot(id int) (bool, error) {
+	if id < 0 || id >= len(c.snapshots) {
+		return false, nil
+	}
+	st := c.snapshots[id]
+	c.snapshots = c.snapshots[:id]
+	if err := c.restore(st); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Save writes the chain state as JSON. Snapshots are not saved.
+func (c *Chain) Save(w io.Writer) error {
+	st, err := c.dump()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+// Load reads a chain saved with Save.
+func Load(r io.Reader) (*Chain, error) {
+	var st chainState
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return nil, fmt.Errorf("chainsim: decode state: %v", err)
+	}
+	c := New(st.Config)
+	if err := c.restore(&st); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
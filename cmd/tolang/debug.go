@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	lua "github.com/tos-network/tolang"
+	"github.com/tos-network/tolang/chainsim"
+)
+
+func cmdDebug(args []string) int {
+	return runDebug(args, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// runDebug deploys a contract in a fresh simulator and invokes one of its
+// functions under the debugger, reading commands from stdin unless
+// --script names a command file. Errors and a failed call are reported on
+// stderr with exit code 1.
+func runDebug(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var scriptPath, ctorArgs, value string
+	var gas uint64
+	fs.StringVar(&scriptPath, "script", "", "read debugger commands from this file instead of the terminal ('-' for stdin); execution runs to completion once they are exhausted")
+	fs.StringVar(&ctorArgs, "constructor-args", "", "comma-separated constructor arguments")
+	fs.StringVar(&value, "value", "0", "value sent with the call")
+	fs.Uint64Var(&gas, "gas", chainsim.DefaultGasLimit, "gas limit of the call")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: tol debug [options] <input.tol|input.toc> <function(types)> [args...]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(stderr, "debug requires an input .tol/.toc file and a function signature")
+		fs.Usage()
+		return 1
+	}
+	if n, ok := new(big.Int).SetString(value, 10); !ok || n.Sign() < 0 {
+		fmt.Fprintf(stderr, "invalid --value %q\n", value)
+		return 1
+	}
+	input, signature := fs.Arg(0), strings.Join(strings.Fields(fs.Arg(1)), "")
+
+	code, toc, err := loadDebugContract(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	sm, err := toc.SourceMap()
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	sess := &debugSession{
+		out:     stdout,
+		sources: map[string][]string{},
+	}
+	if err := sess.loadStorageLayout(toc.StorageLayoutJSON); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	if scriptPath != "" && scriptPath != "-" {
+		f, err := os.Open(scriptPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return 1
+		}
+		defer f.Close()
+		stdin = f
+	}
+	sess.in = bufio.NewScanner(stdin)
+	sess.interactive = scriptPath == ""
+
+	chain := chainsim.New(chainsim.Config{})
+	from := chainsim.DevAccounts(1)[0]
+	chain.SetBalance(from, lua.LNumber(defaultDevBalance))
+	var ctor []string
+	if strings.TrimSpace(ctorArgs) != "" {
+		ctor = strings.Split(ctorArgs, ",")
+	}
+	deployed, err := chain.SendTransaction(&chainsim.Tx{From: from, Code: code, Args: parseDebugArgs(ctor)})
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	if !deployed.Status {
+		fmt.Fprintf(stderr, "deployment reverted: %s\n", deployed.RevertReason)
+		return 1
+	}
+	data, err := lua.EncodeCallData(lua.FunctionSelector(signature), parseDebugArgs(fs.Args()[2:])...)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	sess.dbg = lua.NewDebugger(nil)
+	if sm != nil {
+		sess.dbg.Positions = sm
+	} else {
+		fmt.Fprintf(stderr, "warning: %s has no source map; positions come from bytecode line info\n", input)
+	}
+	sess.dbg.StopOnEntry = true
+	sess.dbg.Pause = sess.pause
+	fmt.Fprintf(stdout, "deployed %s at %s\n", toc.ContractName, deployed.ContractAddress)
+	fmt.Fprintf(stdout, "calling %s\n", signature)
+	chain.SetTracer(sess.dbg)
+	r, err := chain.SendTransaction(&chainsim.Tx{
+		From:  from,
+		To:    deployed.ContractAddress,
+		Value: lua.LNumber(value),
+		Data:  data,
+		Gas:   gas,
+	})
+	chain.SetTracer(nil)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	fmt.Fprintf(stdout, "gas used %d\n", r.GasUsed)
+	if !r.Status {
+		fmt.Fprintf(stderr, "reverted: %s\n", r.RevertReason)
+		return 1
+	}
+	fmt.Fprintf(stdout, "returned %s\n", r.ReturnData)
+	return 0
+}
+
+// loadDebugContract returns the deployable code of input, compiling .tol
+// sources with a source map, and its decoded .toc artifact.
+func loadDebugContract(input string) ([]byte, *lua.TOCArtifact, error) {
+	body, err := os.ReadFile(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !lua.IsTOC(body) {
+		body, err = lua.CompileTOLToTOCWithLoaderOptions(lua.DirSourceLoader{}, filepath.ToSlash(input), &lua.TOCCompileOptions{
+			SourceMap: true,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	toc, err := lua.DecodeTOC(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, toc, nil
+}
+
+// parseDebugArgs maps command-line arguments to call arguments: true and
+// false are booleans, anything else a decimal or hex word.
+func parseDebugArgs(args []string) []lua.LValue {
+	out := make([]lua.LValue, 0, len(args))
+	for _, a := range args {
+		out = append(out, parseDebugArg(a))
+	}
+	return out
+}
+
+func parseDebugArg(a string) lua.LValue {
+	switch a = strings.TrimSpace(a); a {
+	case "true":
+		return lua.LTrue
+	case "false":
+		return lua.LFalse
+	}
+	return lua.LString(a)
+}
+
+// debugSession runs the command loop of `tol debug` at every pause.
+type debugSession struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	interactive bool
+	// done is set once the commands are exhausted; execution then runs to
+	// completion, still reporting the breakpoints it passes.
+	done bool
+	dbg  *lua.Debugger
+
+	slots     []debugSlot
+	slotsByID map[string]debugSlot
+	sources   map[string][]string
+}
+
+type debugSlot struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	CanonicalHash string `json:"canonical_hash"`
+}
+
+func (s *debugSession) loadStorageLayout(layoutJSON []byte) error {
+	s.slotsByID = map[string]debugSlot{}
+	if len(layoutJSON) == 0 {
+		return nil
+	}
+	var layout struct {
+		Slots []debugSlot `json:"slots"`
+	}
+	if err := json.Unmarshal(layoutJSON, &layout); err != nil {
+		return fmt.Errorf("invalid storage layout: %v", err)
+	}
+	s.slots = layout.Slots
+	for _, slot := range layout.Slots {
+		s.slotsByID[slot.Name] = slot
+	}
+	return nil
+}
+
+func (s *debugSession) pause(p *lua.DebugPause) lua.DebugAction {
+	where := fmt.Sprintf("%s:%d", p.Position.File, p.Position.Line)
+	if p.Position.Function != "" {
+		where += " in " + p.Position.Function
+	}
+	fmt.Fprintf(s.out, "stopped at %s (%s)\n", where, p.Reason)
+	s.printSource(p.Position, 0)
+	for !s.done {
+		if s.interactive {
+			fmt.Fprint(s.out, "(tol) ")
+		}
+		if !s.in.Scan() {
+			s.done = true
+			break
+		}
+		line := strings.TrimSpace(s.in.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !s.interactive {
+			fmt.Fprintf(s.out, "(tol) %s\n", line)
+		}
+		if action, resume := s.exec(p, line); resume {
+			return action
+		}
+	}
+	return lua.DebugContinue
+}
+
+// exec runs one command and reports whether it resumes execution, and how.
+func (s *debugSession) exec(p *lua.DebugPause, line string) (lua.DebugAction, bool) {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "c", "continue":
+		return lua.DebugContinue, true
+	case "s", "step":
+		return lua.DebugStepIn, true
+	case "n", "next":
+		return lua.DebugStepOver, true
+	case "finish", "out":
+		return lua.DebugStepOut, true
+	case "q", "quit":
+		return lua.DebugAbort, true
+	case "b", "break", "delete", "clear":
+		if len(args) != 1 {
+			fmt.Fprintf(s.out, "usage: %s [file:]line\n", cmd)
+			break
+		}
+		file, ln, err := parseDebugLocation(args[0])
+		if err != nil {
+			fmt.Fprintln(s.out, err.Error())
+			break
+		}
+		if cmd == "b" || cmd == "break" {
+			s.dbg.SetBreakpoint(file, ln)
+			fmt.Fprintf(s.out, "breakpoint at %s\n", args[0])
+		} else if s.dbg.ClearBreakpoint(file, ln) {
+			fmt.Fprintf(s.out, "deleted breakpoint at %s\n", args[0])
+		} else {
+			fmt.Fprintf(s.out, "no breakpoint at %s\n", args[0])
+		}
+	case "breakpoints":
+		for _, bp := range s.dbg.Breakpoints() {
+			if bp.File == "" {
+				fmt.Fprintf(s.out, "  %d\n", bp.Line)
+			} else {
+				fmt.Fprintf(s.out, "  %s:%d\n", bp.File, bp.Line)
+			}
+		}
+	case "locals":
+		for _, v := range p.Locals() {
+			fmt.Fprintf(s.out, "  %s = %s\n", v.Name, v.Value.String())
+		}
+	case "p", "print":
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, "usage: print <local|slot[key]...>")
+			break
+		}
+		if v, ok := p.Local(args[0]); ok {
+			fmt.Fprintf(s.out, "%s = %s\n", args[0], v.String())
+			break
+		}
+		s.printStorage(p, args[0])
+	case "storage":
+		if len(args) == 1 {
+			s.printStorage(p, args[0])
+			break
+		}
+		for _, slot := range s.slots {
+			if strings.HasPrefix(slot.Type, "mapping") || strings.HasSuffix(slot.Type, "]") {
+				fmt.Fprintf(s.out, "  %s: %s\n", slot.Name, slot.Type)
+				continue
+			}
+			v, _ := p.Storage(slot.CanonicalHash)
+			fmt.Fprintf(s.out, "  %s = %s\n", slot.Name, v.String())
+		}
+	case "gas":
+		fmt.Fprintf(s.out, "gas left %d, used %d\n", p.Step.Gas, p.Step.GasUsed)
+	case "bt", "backtrace", "where":
+		for i, pos := range p.Backtrace() {
+			fmt.Fprintf(s.out, "  #%d %s:%d %s\n", i, pos.File, pos.Line, pos.Function)
+		}
+	case "l", "list":
+		s.printSource(p.Position, 3)
+	case "h", "help":
+		fmt.Fprint(s.out, debugHelp)
+	default:
+		fmt.Fprintf(s.out, "unknown command %q (try help)\n", cmd)
+	}
+	return lua.DebugContinue, false
+}
+
+const debugHelp = `  break [file:]line   set a breakpoint (b)
+  delete [file:]line  remove a breakpoint (clear)
+  breakpoints         list breakpoints
+  continue            run to the next breakpoint (c)
+  step                step to the next line, entering calls (s)
+  next                step to the next line of this function (n)
+  finish              step out of this function (out)
+  locals              print local variables
+  print name          print a local, or a storage slot like balances[0x..] (p)
+  storage [slot]      print storage slots by name
+  gas                 print gas left and used
+  backtrace           print the call stack (bt, where)
+  list                print the source around the current line (l)
+  quit                abort execution (q)
+`
+
+// printStorage prints a storage slot named like "total" or "balances[k]".
+func (s *debugSession) printStorage(p *lua.DebugPause, expr string) {
+	name, keys := expr, []lua.LValue(nil)
+	if i := strings.IndexByte(expr, '['); i >= 0 {
+		name = expr[:i]
+		rest := expr[i:]
+		for rest != "" {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				fmt.Fprintf(s.out, "invalid slot expression %q\n", expr)
+				return
+			}
+			keys = append(keys, parseDebugArg(rest[1:end]))
+			rest = rest[end+1:]
+		}
+	}
+	slot, ok := s.slotsByID[name]
+	if !ok {
+		fmt.Fprintf(s.out, "no local or storage slot named %q\n", name)
+		return
+	}
+	key := slot.CanonicalHash
+	if len(keys) > 0 {
+		var err error
+		if key, err = lua.MappingSlot(key, keys...); err != nil {
+			fmt.Fprintln(s.out, err.Error())
+			return
+		}
+	}
+	v, ok := p.Storage(key)
+	if !ok {
+		fmt.Fprintln(s.out, "no storage in this function")
+		return
+	}
+	fmt.Fprintf(s.out, "%s = %s\n", expr, v.String())
+}
+
+// printSource prints line pos.Line of its file with context lines around
+// it; files that cannot be read are skipped.
+func (s *debugSession) printSource(pos lua.SourcePosition, context int) {
+	lines, ok := s.sources[pos.File]
+	if !ok {
+		if body, err := os.ReadFile(filepath.FromSlash(pos.File)); err == nil {
+			lines = strings.Split(string(body), "\n")
+		}
+		s.sources[pos.File] = lines
+	}
+	for n := pos.Line - context; n <= pos.Line+context; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		marker := "  "
+		if context > 0 && n == pos.Line {
+			marker = "=>"
+		}
+		fmt.Fprintf(s.out, "%s %4d  %s\n", marker, n, lines[n-1])
+	}
+}
+
+// parseDebugLocation parses "line" or "file:line".
+func parseDebugLocation(loc string) (string, int, error) {
+	file, lineStr := "", loc
+	if i := strings.LastIndexByte(loc, ':'); i >= 0 {
+		file, lineStr = loc[:i], loc[i+1:]
+	}
+	line, err := strconv.Atoi(lineStr)
+	if err != nil || line <= 0 {
+		return "", 0, fmt.Errorf("invalid line %q", lineStr)
+	}
+	return file, line, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	lua "github.com/tos-network/tolang"
+	"github.com/tos-network/tolang/chainsim"
+)
+
+// nodeStateFileName is the chain state file inside --state-dir.
+const nodeStateFileName = "state.json"
+
+// defaultDevBalance is 10^24, the initial balance of every dev account.
+const defaultDevBalance = "1000000000000000000000000"
+
+func cmdNode(args []string) int {
+	fs := flag.NewFlagSet("node", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var host, balance, stateDir, tracePath, tracerKind string
+	var port, accounts int
+	var blockTime, gasLimit uint64
+	var noAutoMine bool
+	fs.StringVar(&host, "host", "127.0.0.1", "listen host")
+	fs.IntVar(&port, "port", 8545, "listen port")
+	fs.IntVar(&accounts, "accounts", 10, "number of prefunded dev accounts")
+	fs.StringVar(&balance, "balance", defaultDevBalance, "initial balance of each dev account")
+	fs.Uint64Var(&blockTime, "block-time", 1, "timestamp increment between blocks")
+	fs.Uint64Var(&gasLimit, "gas-limit", chainsim.DefaultGasLimit, "default per-transaction gas limit")
+	fs.StringVar(&stateDir, "state-dir", "", "directory to persist chain state in between runs")
+	fs.BoolVar(&noAutoMine, "no-automine", false, "seal blocks only on tol_mine instead of once per transaction")
+	fs.StringVar(&tracePath, "trace", "", "trace every transaction and call to this file ('-' for stderr)")
+	fs.StringVar(&tracerKind, "tracer", "json", "trace format: json (one record per step and event) or calltree (one call tree per transaction)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: tol node [--host <host>] [--port <port>] [--accounts <n>] [--state-dir <dir>] [options]")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "node takes no positional arguments")
+		fs.Usage()
+		return 1
+	}
+	if accounts < 0 {
+		fmt.Fprintln(os.Stderr, "--accounts must not be negative")
+		return 1
+	}
+	if n, ok := new(big.Int).SetString(balance, 10); !ok || n.Sign() < 0 {
+		fmt.Fprintf(os.Stderr, "invalid --balance %q\n", balance)
+		return 1
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	devAccounts := chainsim.DevAccounts(accounts)
+	cfg := chainsim.Config{BlockTime: blockTime, GasLimit: gasLimit}
+	chain, loaded, err := openNodeChain(stateDir, cfg, explicit, devAccounts, lua.LNumber(balance))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	if tracePath != "" {
+		tracer, closeTrace, err := openTracer(tracePath, tracerKind)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer closeTrace()
+		chain.SetTracer(tracer)
+	}
+	server := chainsim.NewRPCServer(chain, devAccounts)
+	server.SetAutoMine(!noAutoMine)
+	if stateDir != "" {
+		server.OnStateChange(func(c *chainsim.Chain) error { return saveNodeState(stateDir, c) })
+		if !loaded {
+			if err := saveNodeState(stateDir, chain); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return 1
+			}
+		}
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Println("Dev accounts:")
+	for i, a := range devAccounts {
+		fmt.Printf("  (%d) %s (%s)\n", i, a, chain.Balance(a))
+	}
+	if loaded {
+		fmt.Printf("Loaded state from %s at block %d\n", filepath.Join(stateDir, nodeStateFileName), chain.Head().Number)
+	}
+	fmt.Printf("Listening on http://%s\n", ln.Addr())
+	if err := http.Serve(ln, server); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// openNodeChain loads the chain saved in stateDir, or creates a new one from
+// cfg with each dev account prefunded with balance. It reports whether
+// state was loaded. A loaded chain keeps its saved configuration, except for
+// the --block-time and --gas-limit flags named in explicit.
+func openNodeChain(stateDir string, cfg chainsim.Config, explicit map[string]bool, devAccounts []lua.LAddress, balance lua.LNumber) (*chainsim.Chain, bool, error) {
+	if stateDir != "" {
+		f, err := os.Open(filepath.Join(stateDir, nodeStateFileName))
+		if err == nil {
+			defer f.Close()
+			chain, err := chainsim.Load(f)
+			if err != nil {
+				return nil, false, fmt.Errorf("load %s: %v", f.Name(), err)
+			}
+			if explicit["block-time"] {
+				chain.SetBlockTime(cfg.BlockTime)
+			}
+			if explicit["gas-limit"] {
+				chain.SetGasLimit(cfg.GasLimit)
+			}
+			return chain, true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+	chain := chainsim.New(cfg)
+	for _, a := range devAccounts {
+		chain.SetBalance(a, balance)
+	}
+	return chain, false, nil
+}
+
+// saveNodeState writes the chain state to stateDir, replacing the previous
+// file atomically.
+func saveNodeState(stateDir string, chain *chainsim.Chain) error {
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(stateDir, nodeStateFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := chain.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(stateDir, nodeStateFileName))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -17,7 +18,7 @@ func dispatchSubcommand(args []string) (bool, int) {
 		return false, 0
 	}
 	switch name := args[0]; name {
-	case "compile", "pack", "inspect", "verify":
+	case "compile", "pack", "inspect", "verify", "node", "debug":
 		return true, runNamedSubcommand(name, args[1:])
 	case "--version", "version":
 		fmt.Println(lua.PackageCopyRight)
@@ -46,6 +47,10 @@ func runNamedSubcommand(name string, args []string) int {
 		return cmdInspect(args)
 	case "verify":
 		return cmdVerify(args)
+	case "node":
+		return cmdNode(args)
+	case "debug":
+		return cmdDebug(args)
 	default:
 		fmt.Printf("unknown subcommand %q\n", name)
 		return 1
@@ -62,6 +67,8 @@ Subcommands:
   pack      package a directory with manifest.json into .tor
   inspect   inspect .toc/.toi/.tor metadata
   verify    verify .toc/.toi/.tor integrity
+  node      run a local JSON-RPC dev chain
+  debug     step through a contract call in the local simulator
 
 Global:
   --version print version
@@ -75,7 +82,8 @@ func cmdCompile(args []string) int {
 	fs.SetOutput(os.Stderr)
 
 	var emit, output, name, packageName, packageVersion string
-	var includeSource, emitABI, dumpAST bool
+	var pkgCache, lockPath string
+	var includeSource, emitABI, dumpAST, frozenLock, sourceMap bool
 	fs.StringVar(&emit, "emit", "toc", "emit format: toc|toi|tor")
 	fs.StringVar(&output, "o", "", "output artifact path")
 	fs.StringVar(&output, "output", "", "output artifact path")
@@ -84,7 +92,11 @@ func cmdCompile(args []string) int {
 	fs.StringVar(&packageVersion, "package-version", "0.0.0", "package version override (tor)")
 	fs.BoolVar(&includeSource, "include-source", false, "include source in .tor")
 	fs.BoolVar(&emitABI, "abi", false, "write .abi.json alongside .toc")
+	fs.BoolVar(&sourceMap, "sourcemap", false, "embed the TOL source map in .toc")
 	fs.BoolVar(&dumpAST, "ast", false, "dump parsed TOL module")
+	fs.StringVar(&pkgCache, "pkg-cache", "", "local .tor package cache directory for tor:// and toc:// imports")
+	fs.StringVar(&lockPath, "lock", "", "tor.lock path (default: tor.lock next to the input)")
+	fs.BoolVar(&frozenLock, "frozen-lock", false, "reject package imports that are not pinned in tor.lock")
 	fs.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: tol compile [--emit toc|toi|tor] [-o <output>] [options] <input.tol>")
 		fs.PrintDefaults()
@@ -102,15 +114,37 @@ func cmdCompile(args []string) int {
 		return 1
 	}
 
+	// Imports are resolved relative to the input file on the local filesystem.
 	input := fs.Arg(0)
-	source, err := os.ReadFile(input)
-	if err != nil {
-		fmt.Println(err.Error())
+	var loader lua.SourceLoader = lua.DirSourceLoader{}
+	entry := filepath.ToSlash(input)
+
+	var pkgLoader *lua.TORPackageLoader
+	pinned := 0
+	if strings.TrimSpace(pkgCache) != "" {
+		if lockPath == "" {
+			lockPath = filepath.Join(filepath.Dir(input), lua.TORLockFileName)
+		}
+		lock, err := readTORLock(lockPath)
+		if err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+		pinned = len(lock.Imports)
+		pkgLoader = &lua.TORPackageLoader{
+			SourceLoader: lua.DirSourceLoader{},
+			CacheDir:     pkgCache,
+			Lock:         lock,
+			Frozen:       frozenLock,
+		}
+		loader = pkgLoader
+	} else if lockPath != "" || frozenLock {
+		fmt.Println("--lock/--frozen-lock require --pkg-cache")
 		return 1
 	}
 
 	if dumpAST {
-		mod, err := lua.ParseTOLModule(source, input)
+		mod, err := lua.ParseTOLModuleWithLoader(loader, entry)
 		if err != nil {
 			fmt.Println(err.Error())
 			return 1
@@ -144,6 +178,10 @@ func cmdCompile(args []string) int {
 		fmt.Println("--abi is only valid with --emit toc")
 		return 1
 	}
+	if sourceMap && emit != "toc" {
+		fmt.Println("--sourcemap is only valid with --emit toc")
+		return 1
+	}
 	if emit != "tor" && (strings.TrimSpace(packageName) != "" || includeSource || fs.Lookup("package-version").Value.String() != "0.0.0") {
 		fmt.Println("--package-name/--package-version/--include-source are only valid with --emit tor")
 		return 1
@@ -151,7 +189,9 @@ func cmdCompile(args []string) int {
 
 	switch emit {
 	case "toc":
-		toc, err := lua.CompileTOLToTOC(source, input)
+		toc, err := lua.CompileTOLToTOCWithLoaderOptions(loader, entry, &lua.TOCCompileOptions{
+			SourceMap: sourceMap,
+		})
 		if err != nil {
 			fmt.Println(err.Error())
 			return 1
@@ -177,7 +217,7 @@ func cmdCompile(args []string) int {
 			}
 		}
 	case "toi":
-		toi, err := lua.CompileTOLToTOIWithOptions(source, input, &lua.TOICompileOptions{
+		toi, err := lua.CompileTOLToTOIWithLoader(loader, entry, &lua.TOICompileOptions{
 			InterfaceName: strings.TrimSpace(name),
 		})
 		if err != nil {
@@ -192,7 +232,7 @@ func cmdCompile(args []string) int {
 		if strings.TrimSpace(packageName) == "" {
 			packageName = inputStem(input)
 		}
-		tor, err := lua.CompileTOLToTOR(source, input, &lua.TORCompileOptions{
+		tor, err := lua.CompileTOLToTORWithLoader(loader, entry, &lua.TORCompileOptions{
 			PackageName:      strings.TrimSpace(packageName),
 			PackageVersion:   strings.TrimSpace(packageVersion),
 			TOIInterfaceName: strings.TrimSpace(name),
@@ -207,9 +247,32 @@ func cmdCompile(args []string) int {
 			return 1
 		}
 	}
+	if pkgLoader != nil && len(pkgLoader.Lock.Imports) != pinned {
+		body, err := lua.EncodeTORLock(pkgLoader.Lock)
+		if err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+		if err := os.WriteFile(lockPath, body, 0o644); err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+	}
 	return 0
 }
 
+// readTORLock loads an existing lockfile, or returns an empty one.
+func readTORLock(path string) (*lua.TORLock, error) {
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &lua.TORLock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lua.DecodeTORLock(body)
+}
+
 func cmdPack(args []string) int {
 	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
@@ -444,6 +507,7 @@ func inspectTOC(body []byte, asJSON bool) int {
 			BytecodeHash  string          `json:"bytecode_hash"`
 			ABIJSON       json.RawMessage `json:"abi_json,omitempty"`
 			StorageJSON   json.RawMessage `json:"storage_json,omitempty"`
+			SourceMap     json.RawMessage `json:"source_map,omitempty"`
 		}{
 			Version:       toc.Version,
 			Compiler:      toc.Compiler,
@@ -458,6 +522,9 @@ func inspectTOC(body []byte, asJSON bool) int {
 		if len(toc.StorageLayoutJSON) > 0 {
 			out.StorageJSON = json.RawMessage(toc.StorageLayoutJSON)
 		}
+		if len(toc.SourceMapJSON) > 0 {
+			out.SourceMap = json.RawMessage(toc.SourceMapJSON)
+		}
 		b, err := json.MarshalIndent(out, "", "  ")
 		if err != nil {
 			fmt.Println(err.Error())
@@ -480,6 +547,12 @@ func inspectTOC(body []byte, asJSON bool) int {
 	if len(toc.StorageLayoutJSON) > 0 {
 		fmt.Printf("Storage JSON: %s\n", string(toc.StorageLayoutJSON))
 	}
+	if sm, err := toc.SourceMap(); err != nil {
+		fmt.Printf("Source map: invalid: %v\n", err)
+		return 1
+	} else if sm != nil {
+		fmt.Printf("Source map: %d positions over %d functions\n", len(sm.Positions), len(sm.Functions))
+	}
 	return 0
 }
 
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	lua "github.com/tos-network/tolang"
+	"github.com/tos-network/tolang/chainsim"
 )
 
 func TestDefaultArtifactPath(t *testing.T) {
@@ -64,6 +65,9 @@ func TestSubcommandHelpExitCodes(t *testing.T) {
 	if code := cmdVerify([]string{"--help"}); code != 0 {
 		t.Fatalf("verify --help: got=%d want=0", code)
 	}
+	if code := cmdNode([]string{"--help"}); code != 0 {
+		t.Fatalf("node --help: got=%d want=0", code)
+	}
 }
 
 func TestCompileHelpIncludesNameOverrideDescription(t *testing.T) {
@@ -259,6 +263,120 @@ func TestCmdCompileTOCWithABISidecar(t *testing.T) {
 	}
 }
 
+func TestCmdCompileTOCWithSourceMap(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "sample.tol")
+	if err := os.WriteFile(input, []byte("tol 0.2\n\ncontract Sample {\n  fn ping() public {\n    return;\n  }\n}\n"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	out := filepath.Join(dir, "out.toc")
+	if code := cmdCompile([]string{"--sourcemap", "-o", out, input}); code != 0 {
+		t.Fatalf("compile with --sourcemap exit code: got=%d want=0", code)
+	}
+	body, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("toc output missing: %v", err)
+	}
+	toc, err := lua.DecodeTOC(body)
+	if err != nil {
+		t.Fatalf("decode toc: %v", err)
+	}
+	sm, err := toc.SourceMap()
+	if err != nil || sm == nil {
+		t.Fatalf("expected an embedded source map: %v", err)
+	}
+	found := false
+	for _, p := range sm.Positions {
+		if p.Line == 5 && p.Function == "Sample.ping" && strings.HasSuffix(p.File, "sample.tol") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("return statement missing from source map: %+v", sm.Positions)
+	}
+	if code := cmdCompile([]string{"--emit", "toi", "--sourcemap", input}); code != 1 {
+		t.Fatalf("--sourcemap with emit=toi: got=%d want=1", code)
+	}
+}
+
+func TestCmdCompileResolvesRelativeImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	base := "tol 0.2\n\ncontract Base {\n  fn ping() public {\n  }\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "lib", "base.tol"), []byte(base), 0o644); err != nil {
+		t.Fatalf("write base source: %v", err)
+	}
+	input := filepath.Join(dir, "token.tol")
+	src := "tol 0.2\nimport Base from \"./lib/base.tol\";\n\ncontract Token is Base {\n  fn pong() public {\n  }\n}\n"
+	if err := os.WriteFile(input, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	out := filepath.Join(dir, "token.toc")
+	if code := cmdCompile([]string{"-o", out, input}); code != 0 {
+		t.Fatalf("compile exit code: got=%d want=0", code)
+	}
+	body, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read toc: %v", err)
+	}
+	toc, err := lua.DecodeTOC(body)
+	if err != nil {
+		t.Fatalf("decode toc: %v", err)
+	}
+	if !strings.Contains(string(toc.ABIJSON), `"ping"`) {
+		t.Fatalf("expected inherited function in abi: %s", string(toc.ABIJSON))
+	}
+}
+
+func TestCmdCompilePackageImportWritesAndHonorsLock(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache")
+	if err := os.MkdirAll(cache, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	tor, err := lua.CompileTOLToTOR([]byte("tol 0.2\n\ncontract Base {\n  fn ping() public {\n  }\n}\n"), "base.tol", &lua.TORCompileOptions{
+		PackageName:    "base",
+		PackageVersion: "1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("build package: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cache, "base.tor"), tor, 0o644); err != nil {
+		t.Fatalf("write package: %v", err)
+	}
+	input := filepath.Join(dir, "main.tol")
+	src := "tol 0.2\nimport IBase from \"tor://base@1.0.0\";\n\ncontract Main {\n  fn pong() public {\n  }\n}\n"
+	if err := os.WriteFile(input, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	out := filepath.Join(dir, "main.toc")
+	if code := cmdCompile([]string{"--frozen-lock", "--pkg-cache", cache, "-o", out, input}); code != 1 {
+		t.Fatalf("frozen compile without lock: got=%d want=1", code)
+	}
+	if code := cmdCompile([]string{"--pkg-cache", cache, "-o", out, input}); code != 0 {
+		t.Fatalf("compile exit code: got=%d want=0", code)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, lua.TORLockFileName))
+	if err != nil {
+		t.Fatalf("tor.lock not written: %v", err)
+	}
+	lock, err := lua.DecodeTORLock(body)
+	if err != nil {
+		t.Fatalf("decode tor.lock: %v", err)
+	}
+	if pin, ok := lock.Pin("base", "1.0.0"); !ok || pin.PackageHash != lua.TORPackageHash(tor) {
+		t.Fatalf("unexpected tor.lock content: %s", string(body))
+	}
+	if code := cmdCompile([]string{"--frozen-lock", "--pkg-cache", cache, "-o", out, input}); code != 0 {
+		t.Fatalf("frozen compile with lock: got=%d want=0", code)
+	}
+}
+
 func TestCmdCompileTOINameOverride(t *testing.T) {
 	dir := t.TempDir()
 	input := filepath.Join(dir, "sample.tol")
@@ -481,3 +599,125 @@ func TestCmdVerifyRejectsUnknownArtifact(t *testing.T) {
 		t.Fatalf("verify unknown artifact should fail: got=%d want=1", code)
 	}
 }
+
+func TestCmdNodeRejectsInvalidBalance(t *testing.T) {
+	if code := cmdNode([]string{"--balance", "-5"}); code != 1 {
+		t.Fatalf("node with negative balance should fail: got=%d want=1", code)
+	}
+}
+
+func TestNodeStatePersistsAcrossRuns(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	accounts := chainsim.DevAccounts(2)
+	chain, loaded, err := openNodeChain(dir, chainsim.Config{BlockTime: 5}, nil, accounts, "100")
+	if err != nil || loaded {
+		t.Fatalf("expected a fresh chain, got loaded=%v err=%v", loaded, err)
+	}
+	if _, err := chain.SendTransaction(&chainsim.Tx{From: accounts[0], To: accounts[1], Value: "40"}); err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	chain.Mine()
+	if err := saveNodeState(dir, chain); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+
+	reloaded, loaded, err := openNodeChain(dir, chainsim.Config{BlockTime: 9}, nil, accounts, "100")
+	if err != nil || !loaded {
+		t.Fatalf("expected saved state to load, got loaded=%v err=%v", loaded, err)
+	}
+	if got := reloaded.PendingTimestamp() - reloaded.Head().Timestamp; got != 5 {
+		t.Fatalf("expected the saved block time to be kept, got %d", got)
+	}
+	if reloaded.Head().Number != 1 || reloaded.Balance(accounts[1]) != "140" || reloaded.Nonce(accounts[0]) != 1 {
+		t.Fatalf("unexpected reloaded state: head=%d balance=%s nonce=%d", reloaded.Head().Number, reloaded.Balance(accounts[1]), reloaded.Nonce(accounts[0]))
+	}
+	// Explicit flags override the saved configuration.
+	reloaded, _, err = openNodeChain(dir, chainsim.Config{BlockTime: 9}, map[string]bool{"block-time": true}, accounts, "100")
+	if err != nil {
+		t.Fatalf("reload state: %v", err)
+	}
+	if got := reloaded.PendingTimestamp() - reloaded.Head().Timestamp; got != 9 {
+		t.Fatalf("expected --block-time to override the saved block time, got %d", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only %s in the state dir, got %v (%v)", nodeStateFileName, entries, err)
+	}
+}
+
+func TestCmdDebugScript(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "vault.tol")
+	src := `tol 0.2
+contract Vault {
+  storage {
+    slot total: u256;
+    slot balances: mapping(address => u256);
+  }
+  fn double(x: u256) -> (r: u256) internal {
+    let y: u256 = x + x;
+    return y;
+  }
+  fn deposit(who: address, amount: u256) public {
+    let twice: u256 = double(amount);
+    set balances[who] = twice;
+    set total = total + twice;
+    return;
+  }
+}
+`
+	if err := os.WriteFile(input, []byte(src), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	who := "0x" + strings.Repeat("11", 32)
+	script := filepath.Join(dir, "session.txt")
+	commands := "break 15\nstep\nlocals\nfinish\nnext\ncontinue\nprint total\nprint balances[" + who + "]\nstorage\ngas\ncontinue\n"
+	if err := os.WriteFile(script, []byte(commands), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	var out strings.Builder
+	var errOut strings.Builder
+	if code := runDebug([]string{"--script", script, input, "deposit(address, u256)", who, "5"}, nil, &out, &errOut); code != 0 {
+		t.Fatalf("debug exit code: got=%d want=0\n%s", code, out.String())
+	}
+	got := out.String()
+	for _, want := range []string{
+		"vault.tol:12 in Vault.deposit (entry)",
+		"vault.tol:8 in Vault.double (step)",
+		"  x = 5\n",
+		"vault.tol:13 in Vault.deposit (step)",
+		"vault.tol:14 in Vault.deposit (step)",
+		"vault.tol:15 in Vault.deposit (breakpoint)",
+		"total = 10\n",
+		"balances[" + who + "] = 10\n",
+		"  balances: mapping (address=>u256)\n",
+		"gas left ",
+		"returned ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("debug output missing %q:\n%s", want, got)
+		}
+	}
+
+	out.Reset()
+	quit := filepath.Join(dir, "quit.txt")
+	if err := os.WriteFile(quit, []byte("quit\n"), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	if code := runDebug([]string{"--script", quit, input, "deposit(address,u256)", who, "5"}, nil, &out, &errOut); code != 1 {
+		t.Fatalf("debug quit exit code: got=%d want=1\n%s", code, out.String())
+	}
+	if !strings.Contains(errOut.String(), "vault.tol:12: debugger: execution aborted") || strings.Contains(out.String(), "reverted") {
+		t.Fatalf("expected an aborted call on stderr:\nstdout:\n%s\nstderr:\n%s", out.String(), errOut.String())
+	}
+	errOut.Reset()
+	if code := runDebug([]string{input}, nil, &out, &errOut); code != 1 {
+		t.Fatalf("debug without a function: got=%d want=1", code)
+	}
+	out.Reset()
+	errOut.Reset()
+	if code := runDebug([]string{filepath.Join(dir, "missing.tol"), "f()"}, nil, &out, &errOut); code != 1 || out.Len() != 0 || errOut.Len() == 0 {
+		t.Fatalf("debug of a missing file: code=%d stdout=%q stderr=%q", code, out.String(), errOut.String())
+	}
+}
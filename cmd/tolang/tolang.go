@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io/fs"
+	"math"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -25,12 +26,16 @@ func mainAux() int {
 		return status
 	}
 
-	var opt_e, opt_l, opt_p, opt_c string
+	var opt_e, opt_l, opt_p, opt_c, opt_trace, opt_tracer, opt_gasprof, opt_gastext string
 	var opt_i, opt_v, opt_dt, opt_dc, opt_di, opt_bc bool
 	flag.StringVar(&opt_e, "e", "", "")
 	flag.StringVar(&opt_l, "l", "", "")
 	flag.StringVar(&opt_p, "p", "", "")
 	flag.StringVar(&opt_c, "c", "", "")
+	flag.StringVar(&opt_trace, "trace", "", "")
+	flag.StringVar(&opt_tracer, "tracer", "json", "")
+	flag.StringVar(&opt_gasprof, "gasprof", "", "")
+	flag.StringVar(&opt_gastext, "gasprof-text", "", "")
 	flag.BoolVar(&opt_i, "i", false, "")
 	flag.BoolVar(&opt_v, "v", false, "")
 	flag.BoolVar(&opt_dt, "dt", false, "")
@@ -47,6 +52,8 @@ Subcommands:
   pack      package a directory with manifest.json into .tor
   inspect   inspect .toc/.toi/.tor metadata
   verify    verify .toc/.toi/.tor integrity
+  node      run a local JSON-RPC dev chain
+  debug     step through a contract call in the local simulator
 
 Lua/VM options:
 	Available options are:
@@ -58,6 +65,10 @@ Lua/VM options:
 	  -dc      dump VM codes
 	  -di      dump IR
 	  -i       enter interactive mode after executing 'script'
+	  -trace file    trace execution to file ('-' for stderr)
+	  -tracer kind   trace format: json (default) or calltree
+	  -gasprof file       write a pprof gas profile to file
+	  -gasprof-text file  write a text gas summary to file ('-' for stderr)
   -p file  write cpu profiles to the file
   -v       show version information`)
 	}
@@ -80,6 +91,39 @@ Lua/VM options:
 	L := lua.NewState()
 	defer L.Close()
 
+	var tracers []lua.Tracer
+	if len(opt_trace) > 0 {
+		tracer, closeTrace, err := openTracer(opt_trace, opt_tracer)
+		if err != nil {
+			fmt.Println(err.Error())
+			return 1
+		}
+		tracers = append(tracers, tracer)
+		defer func() {
+			if err := closeTrace(); err != nil {
+				fmt.Println(err.Error())
+			}
+		}()
+	}
+	if len(opt_gasprof) > 0 || len(opt_gastext) > 0 {
+		prof := lua.NewGasProfiler()
+		tracers = append(tracers, prof)
+		// Only metered states are charged.
+		L.SetGasLimit(math.MaxUint64)
+		defer func() {
+			if err := writeGasProfile(prof, opt_gasprof, opt_gastext); err != nil {
+				fmt.Println(err.Error())
+			}
+		}()
+	}
+	switch len(tracers) {
+	case 0:
+	case 1:
+		L.SetTracer(tracers[0])
+	default:
+		L.SetTracer(lua.MultiTracer(tracers...))
+	}
+
 	if opt_v || opt_i {
 		fmt.Println(lua.PackageCopyRight)
 	}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	lua "github.com/tos-network/tolang"
+)
+
+// openTracer returns the tracer selected by --tracer writing to path, "-"
+// meaning stderr, and a function that flushes and closes the output.
+func openTracer(path, kind string) (lua.Tracer, func() error, error) {
+	var w io.Writer = os.Stderr
+	closeFn := func() error { return nil }
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closeFn = f, f.Close
+	}
+	switch kind {
+	case "json":
+		t := lua.NewJSONTracer(w)
+		return t, func() error { return firstError(t.Err(), closeFn()) }, nil
+	case "calltree":
+		t := lua.NewCallTracer(w)
+		return t, func() error { return firstError(t.Err(), closeFn()) }, nil
+	}
+	closeFn()
+	return nil, nil, fmt.Errorf("unknown tracer %q (want json or calltree)", kind)
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGasProfile writes the pprof profile to pprofPath and the text
+// summary to textPath ("-" for stderr); empty paths are skipped.
+func writeGasProfile(prof *lua.GasProfiler, pprofPath, textPath string) error {
+	if pprofPath != "" {
+		f, err := os.Create(pprofPath)
+		if err != nil {
+			return err
+		}
+		if err := firstError(prof.WriteProfile(f), f.Close()); err != nil {
+			return err
+		}
+	}
+	if textPath == "" {
+		return nil
+	}
+	if textPath == "-" {
+		return prof.WriteSummary(os.Stderr, 20)
+	}
+	f, err := os.Create(textPath)
+	if err != nil {
+		return err
+	}
+	return firstError(prof.WriteSummary(f, 20), f.Close())
+}
@@ -131,7 +131,8 @@ func lnumberValue(expr ast.Expr) (LNumber, bool) {
 		}
 		return lv, true
 	} else if ex, ok := expr.(*constLValueExpr); ok {
-		return ex.Value.(LNumber), true
+		lv, ok := ex.Value.(LNumber)
+		return lv, ok
 	}
 	return LNumberZero, false
 }
@@ -0,0 +1,111 @@
+package lua
+
+// NewEnv returns a fresh environment for loading a contract into this
+// LState next to others. Reads of names the environment does not define
+// fall through to the global table, so builtins stay visible, while
+// assignments stay private to the environment. Names sealed in the global
+// table (see OpenLibs) are sealed in the environment as well, `_G` refers
+// to the environment itself and its metatable is protected, so code
+// loaded into it cannot reach or modify the shared global table. Tables
+// reached through the fall-through, such as the host's `msg`, `block` and
+// `tx`, are returned as read-only views: field reads see the host's
+// current contents, writes raise an error, and the host keeps updating
+// the tables themselves. Frozen tables, such as the libraries, are
+// returned as they are. Contracts in different environments can only
+// interact through the host call interface.
+func (ls *LState) NewEnv() *LTable {
+	views := &readOnlyViews{views: map[*LTable]*LTable{}}
+	env := newLTable(0, 0)
+	env.RawSetString("_G", env)
+	mt := newLTable(0, 2)
+	mt.RawSetString("__index", views.indexer(ls, ls.G.Global))
+	mt.RawSetString("__metatable", LString("protected"))
+	mt.Freeze()
+	env.Metatable = mt
+	for name := range ls.G.Global.sealed {
+		env.SealField(name)
+	}
+	return env
+}
+
+// readOnlyViews hands out one read-only view per shared table, so a view
+// compares equal to itself across reads.
+type readOnlyViews struct {
+	views map[*LTable]*LTable
+}
+
+// indexer returns an __index metamethod reading tb and wrapping the tables
+// it finds.
+func (r *readOnlyViews) indexer(ls *LState, tb *LTable) *LFunction {
+	return ls.NewFunction(func(L *LState) int {
+		L.Push(r.wrap(L, L.GetTable(tb, L.CheckAny(2))))
+		return 1
+	})
+}
+
+// wrap returns the read-only view of v when it is a table that is not
+// frozen, and v otherwise. A view is a frozen empty table whose protected
+// metatable forwards reads to the shared table.
+func (r *readOnlyViews) wrap(L *LState, v LValue) LValue {
+	tb, ok := v.(*LTable)
+	if !ok || tb.frozen {
+		return v
+	}
+	if view, ok := r.views[tb]; ok {
+		return view
+	}
+	view := newLTable(0, 0)
+	mt := newLTable(0, 2)
+	mt.RawSetString("__index", r.indexer(L, tb))
+	mt.RawSetString("__metatable", LString("protected"))
+	mt.Freeze()
+	view.Metatable = mt
+	view.Freeze()
+	r.views[tb] = view
+	return view
+}
+
+// LoadBytecodeEnv loads a precompiled bytecode blob as a function whose
+// globals are env, as returned by NewEnv. Closures created by the chunk
+// inherit env.
+func (ls *LState) LoadBytecodeEnv(data []byte, env *LTable) (*LFunction, error) {
+	fn, err := ls.LoadBytecode(data)
+	if err != nil {
+		return nil, err
+	}
+	fn.Env = env
+	return fn, nil
+}
+
+// DoBytecodeEnv loads and runs a precompiled bytecode blob in env.
+func (ls *LState) DoBytecodeEnv(data []byte, env *LTable) error {
+	fn, err := ls.LoadBytecodeEnv(data, env)
+	if err != nil {
+		return err
+	}
+	ls.Push(fn)
+	return ls.PCall(0, MultRet, nil)
+}
+
+// callerEnv returns the globals of the innermost running Lua function,
+// that is the environment of the contract calling a builtin. Outside of
+// Lua code it returns the global table.
+func (ls *LState) callerEnv() *LTable {
+	for cf := ls.currentFrame; cf != nil; cf = cf.Parent {
+		if cf.Fn != nil && !cf.Fn.IsG && cf.Fn.Env != nil {
+			return cf.Fn.Env
+		}
+	}
+	return ls.G.Global
+}
+
+// callerGlobal reads the global `name` of the calling contract's
+// environment, falling back to the global table like Lua code does but
+// without the read-only views NewEnv hands to Lua code.
+func (ls *LState) callerGlobal(name string) LValue {
+	env := ls.callerEnv()
+	if v := env.RawGetString(name); v != LNil || env == ls.G.Global {
+		return v
+	}
+	return ls.GetField(ls.G.Global, name)
+}
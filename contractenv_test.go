@@ -0,0 +1,209 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+func invokeInEnv(t *testing.T, L *LState, env *LTable, sig string, args ...LValue) (LValue, error) {
+	t.Helper()
+	L.Push(L.GetField(env.RawGetString("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature(sig)))
+	for _, a := range args {
+		L.Push(a)
+	}
+	if err := L.PCall(len(args)+1, 1, nil); err != nil {
+		return LNil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return ret, nil
+}
+
+func TestContractEnvsIsolateGlobals(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(hostCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	a, b := L.NewEnv(), L.NewEnv()
+	for _, env := range []*LTable{a, b} {
+		if err := L.DoBytecodeEnv(bc, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.RawGetString("tos") == b.RawGetString("tos") || a.RawGetString("__tol_storage") == b.RawGetString("__tol_storage") {
+		t.Fatal("contracts share their entry or storage tables")
+	}
+	if L.GetGlobal("tos") != LNil || L.GetGlobal("__tol_storage") != LNil {
+		t.Fatal("contract globals leaked into the global table")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := invokeInEnv(t, L, a, "bump(u256)", LNumber("1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := invokeInEnv(t, L, b, "peek()"); err != nil || got != LNumber("0") {
+		t.Fatalf("storage leaked between environments: %v, %v", got, err)
+	}
+
+	run := func(env *LTable, src string) error {
+		fn, err := L.LoadString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn.Env = env
+		L.Push(fn)
+		return L.PCall(0, 0, nil)
+	}
+	if err := run(a, `
+		shared = 1
+		_G.viaG = 1
+		rawset(_G, "viaRawset", 1)
+		assert(type(keccak256) == "function")
+		assert(getmetatable(_G) == "protected")
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for src, want := range map[string]string{
+		`keccak256 = nil`:           "sealed field 'keccak256'",
+		`_G = {}`:                   "sealed field '_G'",
+		`__tol_sstore = nil`:        "sealed field '__tol_sstore'",
+		`tos.oninvoke = nil`:        "frozen table",
+		`setmetatable(_G, nil)`:     "protected metatable",
+		`string.len = nil`:          "frozen table",
+		`rawset(_G, "assert", nil)`: "sealed field 'assert'",
+	} {
+		if err := run(a, src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+	if err := run(b, `assert(shared == nil and viaG == nil and viaRawset == nil)`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("shared") != LNil || L.GetGlobal("viaG") != LNil {
+		t.Fatal("environment globals leaked into the global table")
+	}
+}
+
+func TestContractEnvsWithHost(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(hostCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewMemoryContractHost()
+	addrA := hostCounterAddr
+	addrB := LAddress("0x" + strings.Repeat("22", 32))
+	L := NewState()
+	defer L.Close()
+	envs := map[LAddress]*LTable{addrA: L.NewEnv(), addrB: L.NewEnv()}
+	for addr, env := range envs {
+		h.AttachEnv(L, env, addr)
+		if err := L.DoBytecodeEnv(bc, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invoke := func(addr LAddress, sig string, args ...LValue) (LValue, error) {
+		t.Helper()
+		h.AttachEnv(L, envs[addr], addr)
+		return invokeInEnv(t, L, envs[addr], sig, args...)
+	}
+	if _, err := invoke(addrA, "bump(u256)", LNumber("4")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoke(addrB, "bump(u256)", LNumber("9")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := invoke(addrA, "peek()"); got != LNumber("4") {
+		t.Fatalf("unexpected storage of A: %v", got)
+	}
+	if got, _ := invoke(addrB, "peek()"); got != LNumber("9") {
+		t.Fatalf("unexpected storage of B: %v", got)
+	}
+
+	// Builtins read the call context of the calling environment.
+	msg := L.NewTable()
+	msg.RawSetString("value", LNumber("5"))
+	envs[addrA].RawSetString("msg", msg)
+	if _, err := invoke(addrA, "bump(u256)", LNumber("1")); err == nil {
+		t.Fatal("expected NON_PAYABLE from A")
+	} else if rerr, ok := AsRevertError(err); !ok || rerr.Reason != "NON_PAYABLE" {
+		t.Fatalf("expected NON_PAYABLE from A, got %v", err)
+	}
+	if _, err := invoke(addrB, "bump(u256)", LNumber("1")); err != nil {
+		t.Fatalf("B saw A's call context: %v", err)
+	}
+
+	// A host updating one shared msg table between calls.
+	shared := L.NewTable()
+	shared.RawSetString("value", LNumber("0"))
+	L.SetGlobal("msg", shared)
+	if _, err := invoke(addrB, "bump(u256)", LNumber("1")); err != nil {
+		t.Fatal(err)
+	}
+	shared.RawSetString("value", LNumber("5"))
+	if _, err := invoke(addrB, "bump(u256)", LNumber("1")); err == nil {
+		t.Fatal("expected NON_PAYABLE after the host raised msg.value")
+	}
+	shared.RawSetString("value", LNumber("0"))
+	if got, err := invoke(addrB, "peek()"); err != nil || got != LNumber("11") {
+		t.Fatalf("unexpected storage of B: %v, %v", got, err)
+	}
+}
+
+func TestContractEnvsReadSharedTablesThroughViews(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	msg := L.NewTable()
+	msg.RawSetString("sender", LAddress("0x"+strings.Repeat("11", 32)))
+	L.SetGlobal("msg", msg)
+	limits := L.NewTable()
+	limits.RawSetString("max", LNumber("10"))
+	config := L.NewTable()
+	config.RawSetString("limits", limits)
+	L.SetGlobal("config", config)
+
+	run := func(env *LTable, src string) error {
+		fn, err := L.LoadString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn.Env = env
+		L.Push(fn)
+		return L.PCall(0, 0, nil)
+	}
+	a, b := L.NewEnv(), L.NewEnv()
+	for _, src := range []string{
+		`msg.sender = "0x00"`,
+		`rawset(msg, "value", 1)`,
+		`config.limits.max = 0`,
+		`config.extra = {}`,
+	} {
+		if err := run(a, src); err == nil || !strings.Contains(err.Error(), "frozen table") {
+			t.Errorf("%s: expected a frozen table error, got %v", src, err)
+		}
+	}
+	if err := run(b, `
+		assert(tostring(msg.sender) == "0x`+strings.Repeat("11", 32)+`" and msg.value == nil)
+		assert(config.limits.max == 10 and config.extra == nil)
+	`); err != nil {
+		t.Fatalf("writes leaked between environments: %v", err)
+	}
+	// Reads leave the shared tables writable for the host, and later reads
+	// see its updates.
+	if msg.IsFrozen() || config.IsFrozen() || limits.IsFrozen() {
+		t.Fatal("reading through an environment froze a shared table")
+	}
+	msg.RawSetString("value", LNumber("7"))
+	limits.RawSetString("max", LNumber("20"))
+	if err := run(b, `assert(msg.value == 7 and config.limits.max == 20 and msg == msg)`); err != nil {
+		t.Fatalf("host update not visible: %v", err)
+	}
+	// A table shadowed by the environment stays writable.
+	if err := run(a, `msg = {sender = "0x00"}; msg.value = 1`); err != nil {
+		t.Fatal(err)
+	}
+}
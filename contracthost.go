@@ -0,0 +1,452 @@
+package lua
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CallKind selects the semantics of a cross-contract call.
+type CallKind int
+
+const (
+	// CallKindCall runs the callee's code against the callee's storage and
+	// may transfer value.
+	CallKindCall CallKind = iota
+	// CallKindStaticCall is a call that may not change state.
+	CallKindStaticCall
+	// CallKindDelegateCall runs the callee's code against the caller's
+	// storage, keeping the caller's msg.sender and msg.value.
+	CallKindDelegateCall
+	// CallKindCreate deploys code at an address derived from the creator's
+	// nonce.
+	CallKindCreate
+	// CallKindCreate2 deploys code at an address derived from a salt and the
+	// init-code hash.
+	CallKindCreate2
+)
+
+func (k CallKind) String() string {
+	switch k {
+	case CallKindCall:
+		return "call"
+	case CallKindStaticCall:
+		return "staticcall"
+	case CallKindDelegateCall:
+		return "delegatecall"
+	case CallKindCreate:
+		return "create"
+	case CallKindCreate2:
+		return "create2"
+	}
+	return fmt.Sprintf("CallKind(%d)", int(k))
+}
+
+const (
+	// MaxCallDepth is the maximum nesting depth of contract frames. Calls
+	// made at this depth fail without reaching the host.
+	MaxCallDepth = 1024
+	// CallStipend is the gas added to a value-carrying call on top of the
+	// forwarded amount. It is not charged to the caller.
+	CallStipend uint64 = 2300
+)
+
+// ContractCall describes one cross-contract call issued by a contract frame.
+type ContractCall struct {
+	Kind CallKind
+	// Caller is the address of the contract issuing the call.
+	Caller LAddress
+	// To is the account whose code runs. For delegatecall the code runs in
+	// the caller's context (storage and address).
+	To LAddress
+	// Sender and Value become msg.sender and msg.value in the callee frame.
+	// Value is transferred from Caller to To only for CallKindCall.
+	Sender LAddress
+	Value  LNumber
+	// Data is hex calldata: "0x" + 4-byte selector + 32-byte argument words.
+	Data string
+	// Gas is the callee's gas limit (forwarded gas plus any stipend).
+	// Zero means unlimited.
+	Gas uint64
+	// Depth is the callee frame's depth (the caller's depth plus one).
+	Depth int
+	// Static is set when the callee must not change state, either because
+	// this is a staticcall or because the caller is already static.
+	Static bool
+	// Tracer, when set, traces the callee frame; see Tracer.
+	Tracer Tracer
+}
+
+// CallResult is the outcome of a ContractCall.
+type CallResult struct {
+	OK bool
+	// ReturnData is hex-encoded: "0x" followed by one 32-byte word per
+	// returned value. For a reverted call it is the revert payload (see
+	// RevertError).
+	ReturnData string
+	// GasUsed is the gas consumed by the callee, including any stipend.
+	GasUsed uint64
+	// Err describes why the call failed; nil when OK.
+	Err error
+}
+
+// ContractHost executes cross-contract calls on behalf of the `call`,
+// `staticcall` and `delegatecall` builtins. A host must leave no trace of a
+// failed call: storage writes and value transfers made by the callee (and
+// by any frames it called) are rolled back before the result is returned.
+type ContractHost interface {
+	Call(call *ContractCall) CallResult
+}
+
+// ContractCreate describes a contract deployment issued by a contract frame.
+type ContractCreate struct {
+	// Kind is CallKindCreate or CallKindCreate2.
+	Kind    CallKind
+	Creator LAddress
+	// Value is transferred from Creator to the new account and is the
+	// constructor's msg.value.
+	Value LNumber
+	// InitCode is the deployed code: tolang bytecode or a .toc artifact.
+	InitCode []byte
+	// Salt is the create2 salt; unused for create.
+	Salt [32]byte
+	// Args are passed to the constructor (`tos.oncreate`).
+	Args []LValue
+	// Gas, Depth and Tracer are as for ContractCall.
+	Gas    uint64
+	Depth  int
+	Tracer Tracer
+}
+
+// CreateResult is the outcome of a ContractCreate. Address is the zero
+// address when the deployment failed.
+type CreateResult struct {
+	OK      bool
+	Address LAddress
+	GasUsed uint64
+	// Err describes why the deployment failed; nil when OK.
+	Err error
+}
+
+// ContractDeployer is implemented by hosts that serve the `create` and
+// `create2` builtins. A deployment runs the new contract's `tos.oncreate`;
+// a failed deployment leaves no account behind.
+type ContractDeployer interface {
+	Create(create *ContractCreate) CreateResult
+}
+
+// CreateAddress derives the address of a contract deployed by sender with
+// `create`: keccak256(sender ++ u256(nonce)).
+func CreateAddress(sender LAddress, nonce uint64) LAddress {
+	var buf [64]byte
+	copy(buf[:32], addressBytes(sender))
+	binary.BigEndian.PutUint64(buf[56:], nonce)
+	return LAddress("0x" + hex.EncodeToString(keccak256Bytes(buf[:])))
+}
+
+// Create2Address derives the address of a contract deployed by sender with
+// `create2`: keccak256(0xff ++ sender ++ salt ++ initCodeHash).
+func Create2Address(sender LAddress, salt [32]byte, initCodeHash [32]byte) LAddress {
+	buf := make([]byte, 0, 97)
+	buf = append(buf, 0xff)
+	buf = append(buf, addressBytes(sender)...)
+	buf = append(buf, salt[:]...)
+	buf = append(buf, initCodeHash[:]...)
+	return LAddress("0x" + hex.EncodeToString(keccak256Bytes(buf)))
+}
+
+// addressBytes returns the 32 address bytes of addr; malformed addresses
+// map to the zero address.
+func addressBytes(addr LAddress) []byte {
+	b := make([]byte, 32)
+	norm, err := parseAddressString(string(addr))
+	if err != nil {
+		return b
+	}
+	raw, _ := hex.DecodeString(string(norm)[2:])
+	copy(b, raw)
+	return b
+}
+
+// SetContractHost attaches the host that serves cross-contract calls made
+// from this state. A nil host makes the call builtins raise an error.
+func (ls *LState) SetContractHost(host ContractHost) { ls.contractHost = host }
+
+// ContractHost returns the attached host, or nil.
+func (ls *LState) ContractHost() ContractHost { return ls.contractHost }
+
+// SetContractFrame records the address of the contract executing in this
+// state and the depth of its frame (zero for a top-level invocation).
+func (ls *LState) SetContractFrame(addr LAddress, depth int) {
+	ls.contractAddr = addr
+	ls.callDepth = depth
+}
+
+// ContractAddress returns the address of the executing contract.
+func (ls *LState) ContractAddress() LAddress { return ls.contractAddr }
+
+// CallDepth returns the depth of the executing contract frame.
+func (ls *LState) CallDepth() int { return ls.callDepth }
+
+// callGasCap returns the gas to forward for a call requesting `requested`
+// gas (zero meaning "all available"): at most all but one 64th of the
+// remaining gas. Unmetered states forward the request unchanged.
+func (ls *LState) callGasCap(requested uint64) uint64 {
+	if ls.gasLimit == 0 {
+		return requested
+	}
+	var remaining uint64
+	if ls.gasUsed < ls.gasLimit {
+		remaining = ls.gasLimit - ls.gasUsed
+	}
+	available := remaining - remaining/64
+	if requested == 0 || requested > available {
+		return available
+	}
+	return requested
+}
+
+// openContractHost registers the cross-contract call builtins.
+func openContractHost(L *LState) {
+	L.SetGlobal("call", L.NewFunction(hostCall))
+	L.SetGlobal("staticcall", L.NewFunction(hostStaticCall))
+	L.SetGlobal("delegatecall", L.NewFunction(hostDelegateCall))
+	L.SetGlobal("create", L.NewFunction(hostCreate))
+	L.SetGlobal("create2", L.NewFunction(hostCreate2))
+}
+
+// hostCall implements call(addr, value, data [, gas]) -> (ok, retdata).
+func hostCall(L *LState) int { return hostContractCall(L, CallKindCall) }
+
+// hostStaticCall implements staticcall(addr, data [, gas]) -> (ok, retdata).
+func hostStaticCall(L *LState) int { return hostContractCall(L, CallKindStaticCall) }
+
+// hostDelegateCall implements delegatecall(addr, data [, gas]) -> (ok, retdata).
+func hostDelegateCall(L *LState) int { return hostContractCall(L, CallKindDelegateCall) }
+
+func hostContractCall(L *LState, kind CallKind) int {
+	to, err := parseAddressValue(L.CheckAny(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+	}
+	argi := 2
+	value := LNumberZero
+	if kind == CallKindCall {
+		value = checkCallValue(L, argi)
+		argi++
+	}
+	data := L.CheckString(argi)
+	gas := checkCallGas(L, argi+1)
+
+	host := L.contractHost
+	if host == nil {
+		L.RaiseError("%s: no contract host attached", kind)
+	}
+	static := L.static || kind == CallKindStaticCall
+	if L.static && !lNumberIsZero(value) {
+		L.RaiseError("STATIC_CALL_VIOLATION: call with value")
+	}
+	if L.callDepth >= MaxCallDepth {
+		L.Push(LFalse)
+		L.Push(LString("0x"))
+		return 2
+	}
+
+	c := &ContractCall{
+		Kind:   kind,
+		Caller: L.contractAddr,
+		To:     to,
+		Sender: L.contractAddr,
+		Value:  value,
+		Data:   data,
+		Gas:    L.callGasCap(gas),
+		Depth:  L.callDepth + 1,
+		Static: static,
+		Tracer: L.tracer,
+	}
+	if kind == CallKindDelegateCall {
+		c.Sender, c.Value = callerMsgContext(L)
+	}
+	stipend := uint64(0)
+	if kind == CallKindCall && !lNumberIsZero(value) && c.Gas > 0 {
+		stipend = CallStipend
+		c.Gas += stipend
+	}
+
+	res := host.Call(c)
+	if res.GasUsed > stipend {
+		L.chargeGas(res.GasUsed - stipend)
+	}
+	ret := res.ReturnData
+	if ret == "" {
+		ret = "0x"
+	}
+	L.Push(LBool(res.OK))
+	L.Push(LString(ret))
+	return 2
+}
+
+// hostCreate implements create(value, init_code [, gas]) -> addr.
+func hostCreate(L *LState) int { return hostContractCreate(L, CallKindCreate) }
+
+// hostCreate2 implements create2(value, salt, init_code [, gas]) -> addr.
+func hostCreate2(L *LState) int { return hostContractCreate(L, CallKindCreate2) }
+
+func hostContractCreate(L *LState, kind CallKind) int {
+	c := &ContractCreate{Kind: kind, Value: checkCallValue(L, 1)}
+	argi := 2
+	if kind == CallKindCreate2 {
+		word, err := tolEncodeKey(L.CheckAny(argi))
+		if err != nil {
+			L.ArgError(argi, "invalid salt: "+err.Error())
+		}
+		raw, _ := hex.DecodeString(word)
+		copy(c.Salt[:], raw)
+		argi++
+	}
+	code, err := hex.DecodeString(strings.TrimPrefix(L.CheckString(argi), "0x"))
+	if err != nil {
+		L.ArgError(argi, "init code must be hex")
+	}
+	c.InitCode = code
+	gas := checkCallGas(L, argi+1)
+
+	deployer, ok := L.contractHost.(ContractDeployer)
+	if !ok {
+		L.RaiseError("%s: no contract host supporting deployment attached", kind)
+	}
+	if L.static {
+		L.RaiseError("STATIC_CALL_VIOLATION: %s", kind)
+	}
+	if L.callDepth >= MaxCallDepth {
+		L.Push(LAddress(zeroAddress))
+		return 1
+	}
+	c.Creator = L.contractAddr
+	c.Gas = L.callGasCap(gas)
+	c.Depth = L.callDepth + 1
+	c.Tracer = L.tracer
+
+	res := deployer.Create(c)
+	L.chargeGas(res.GasUsed)
+	if !res.OK {
+		L.Push(LAddress(zeroAddress))
+		return 1
+	}
+	L.Push(res.Address)
+	return 1
+}
+
+func checkCallValue(L *LState, n int) LNumber {
+	switch v := L.Get(n).(type) {
+	case LNumber:
+		return v
+	case LString:
+		num, err := parseNumber(string(v))
+		if err != nil {
+			L.ArgError(n, "invalid call value")
+		}
+		return num
+	case *LNilType:
+		return LNumberZero
+	}
+	L.TypeError(n, LTNumber)
+	return LNumberZero
+}
+
+func checkCallGas(L *LState, n int) uint64 {
+	v := L.OptNumber(n, LNumberZero)
+	gas, err := strconv.ParseUint(string(v), 10, 64)
+	if err != nil {
+		// Requests beyond uint64 are capped by callGasCap anyway.
+		return 0
+	}
+	return gas
+}
+
+// callerMsgContext returns msg.sender and msg.value of the executing frame,
+// which delegatecall passes through to the callee.
+func callerMsgContext(L *LState) (LAddress, LNumber) {
+	msg, ok := L.callerGlobal("msg").(*LTable)
+	if !ok {
+		return "", LNumberZero
+	}
+	sender, _ := parseAddressValue(msg.RawGetString("sender"))
+	value := LNumberZero
+	switch v := msg.RawGetString("value").(type) {
+	case LNumber:
+		value = v
+	case LString:
+		if n, err := parseNumber(string(v)); err == nil {
+			value = n
+		}
+	}
+	return sender, value
+}
+
+// FunctionSelector returns the 4-byte selector ("0x" + 8 hex chars) of a
+// canonical TOL signature such as "transfer(address,u256)".
+func FunctionSelector(signature string) string {
+	return selectorHexFromSignature(signature)
+}
+
+// EncodeCallData builds hex calldata for a call: the 4-byte selector (as
+// produced for `selector("f(u256)")`) followed by one 32-byte word per
+// argument, encoded as for TOL storage keys.
+func EncodeCallData(selector string, args ...LValue) (string, error) {
+	sel := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(selector)), "0x")
+	if b, err := hex.DecodeString(sel); err != nil || len(b) != 4 {
+		return "", fmt.Errorf("calldata: invalid selector %q", selector)
+	}
+	var sb strings.Builder
+	sb.WriteString("0x")
+	sb.WriteString(sel)
+	for i, a := range args {
+		word, err := tolEncodeKey(a)
+		if err != nil {
+			return "", fmt.Errorf("calldata: argument %d: %v", i+1, err)
+		}
+		sb.WriteString(word)
+	}
+	return sb.String(), nil
+}
+
+// DecodeCallData splits hex calldata into its selector ("0x" + 8 hex chars)
+// and its argument words, each decoded as a u256 number.
+func DecodeCallData(data string) (string, []LValue, error) {
+	body := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(data)), "0x")
+	if len(body) < 8 || (len(body)-8)%64 != 0 {
+		return "", nil, fmt.Errorf("calldata: malformed length %d", len(body))
+	}
+	if _, err := hex.DecodeString(body); err != nil {
+		return "", nil, fmt.Errorf("calldata: %v", err)
+	}
+	var args []LValue
+	for off := 8; off < len(body); off += 64 {
+		n, err := parseNumber("0x" + body[off:off+64])
+		if err != nil {
+			return "", nil, fmt.Errorf("calldata: %v", err)
+		}
+		args = append(args, n)
+	}
+	return "0x" + body[:8], args, nil
+}
+
+// encodeReturnData encodes returned values as hex words; nil encodes as zero.
+func encodeReturnData(values []LValue) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("0x")
+	for i, v := range values {
+		if v == LNil {
+			v = LNumberZero
+		}
+		word, err := tolEncodeKey(v)
+		if err != nil {
+			return "", fmt.Errorf("return value %d: %v", i+1, err)
+		}
+		sb.WriteString(word)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,371 @@
+package lua
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// MemoryContractHost is a reference ContractHost that keeps accounts in
+// memory. Each call runs the callee's bytecode in a fresh LState whose
+// `__tol_storage` table is the callee's persistent storage table, so
+// storage is shared by every frame that runs against the same account.
+// All frames share the host's journal, so a failed frame reverts its own
+// writes, transfers, deployments and logs together with those of every
+// frame it called.
+type MemoryContractHost struct {
+	accounts  map[LAddress]*memoryAccount
+	journal   *StorageJournal
+	frameHook func(L *LState)
+}
+
+type memoryAccount struct {
+	code    []byte
+	storage *LTable
+	balance LNumber
+	nonce   uint64
+}
+
+// NewMemoryContractHost returns an empty in-memory host.
+func NewMemoryContractHost() *MemoryContractHost {
+	return &MemoryContractHost{
+		accounts: map[LAddress]*memoryAccount{},
+		journal:  NewStorageJournal(),
+	}
+}
+
+// SetFrameHook installs fn to run on every frame's LState after the frame
+// is attached and before contract code runs, e.g. to set the `block` and
+// `tx` environment tables.
+func (h *MemoryContractHost) SetFrameHook(fn func(L *LState)) { h.frameHook = fn }
+
+// Journal returns the journal shared by every frame run by the host.
+func (h *MemoryContractHost) Journal() *StorageJournal { return h.journal }
+
+func newMemoryAccount() *memoryAccount {
+	return &memoryAccount{storage: newLTable(0, 0), balance: LNumberZero}
+}
+
+// account returns the account at addr, creating it outside the journal. It
+// backs the host's setters; execution paths use touch.
+func (h *MemoryContractHost) account(addr LAddress) *memoryAccount {
+	acc, ok := h.accounts[addr]
+	if !ok {
+		acc = newMemoryAccount()
+		h.accounts[addr] = acc
+	}
+	return acc
+}
+
+// touch returns the account at addr, creating it with a journal entry so
+// that reverting the frame that created it removes it again.
+func (h *MemoryContractHost) touch(addr LAddress) *memoryAccount {
+	if acc, ok := h.accounts[addr]; ok {
+		return acc
+	}
+	acc := newMemoryAccount()
+	h.accounts[addr] = acc
+	h.journal.RecordUndo(func() { delete(h.accounts, addr) })
+	return acc
+}
+
+// SetCode installs compiled contract bytecode at addr.
+func (h *MemoryContractHost) SetCode(addr LAddress, code []byte) {
+	h.account(addr).code = append([]byte(nil), code...)
+}
+
+// Code returns the bytecode installed at addr, or nil.
+func (h *MemoryContractHost) Code(addr LAddress) []byte {
+	if acc, ok := h.accounts[addr]; ok {
+		return acc.code
+	}
+	return nil
+}
+
+// SetBalance sets the balance of addr.
+func (h *MemoryContractHost) SetBalance(addr LAddress, balance LNumber) {
+	h.account(addr).balance = balance
+}
+
+// Balance returns the balance of addr.
+func (h *MemoryContractHost) Balance(addr LAddress) LNumber {
+	if acc, ok := h.accounts[addr]; ok {
+		return acc.balance
+	}
+	return LNumberZero
+}
+
+// SetNonce sets the deployment nonce of addr.
+func (h *MemoryContractHost) SetNonce(addr LAddress, nonce uint64) {
+	h.account(addr).nonce = nonce
+}
+
+// Nonce returns the deployment nonce of addr: the number of contracts it
+// has attempted to create.
+func (h *MemoryContractHost) Nonce(addr LAddress) uint64 {
+	if acc, ok := h.accounts[addr]; ok {
+		return acc.nonce
+	}
+	return 0
+}
+
+// Addresses returns the addresses of all known accounts in sorted order.
+func (h *MemoryContractHost) Addresses() []LAddress {
+	out := make([]LAddress, 0, len(h.accounts))
+	for addr := range h.accounts {
+		out = append(out, addr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// Storage returns the storage table of addr, keyed by TOL storage slot
+// hashes as written by `__tol_sstore`, or nil when there is no account at
+// addr.
+func (h *MemoryContractHost) Storage(addr LAddress) *LTable {
+	if acc, ok := h.accounts[addr]; ok {
+		return acc.storage
+	}
+	return nil
+}
+
+// Attach prepares L to execute as a top-level frame of the contract at addr:
+// it sets the host, the contract frame, the journal and the contract's
+// storage table. Invoke the entry point with AtomicPCall so a failed
+// invocation is reverted as a whole.
+func (h *MemoryContractHost) Attach(L *LState, addr LAddress) {
+	h.attachFrame(L, addr, 0)
+}
+
+// AttachEnv is Attach for a contract loaded into env with DoBytecodeEnv:
+// the contract's storage table is bound in env instead of the globals.
+// Re-attach before invoking a different environment of the same state.
+func (h *MemoryContractHost) AttachEnv(L *LState, env *LTable, addr LAddress) {
+	h.attachFrameEnv(L, env, addr, 0)
+}
+
+func (h *MemoryContractHost) attachFrame(L *LState, addr LAddress, depth int) {
+	h.attachFrameEnv(L, nil, addr, depth)
+}
+
+func (h *MemoryContractHost) attachFrameEnv(L *LState, env *LTable, addr LAddress, depth int) {
+	L.SetContractHost(h)
+	L.SetContractFrame(addr, depth)
+	L.SetJournal(h.journal)
+	if env != nil {
+		env.RawSetString("__tol_storage", h.account(addr).storage)
+	} else {
+		L.SetGlobal("__tol_storage", h.account(addr).storage)
+	}
+	if h.frameHook != nil {
+		h.frameHook(L)
+	}
+}
+
+// Call implements ContractHost. A call to an account without code succeeds
+// with empty return data after any value transfer.
+func (h *MemoryContractHost) Call(c *ContractCall) (res CallResult) {
+	value := c.Value
+	if value == "" {
+		value = LNumberZero
+	}
+	if c.Tracer != nil {
+		call := &TraceCall{Kind: c.Kind, From: c.Caller, To: c.To, Value: value, Input: c.Data, Gas: c.Gas, Depth: c.Depth}
+		c.Tracer.OnEnter(call)
+		defer func() {
+			c.Tracer.OnExit(call, &TraceResult{OK: res.OK, Output: res.ReturnData, GasUsed: res.GasUsed, Err: res.Err})
+		}()
+	}
+	snap := h.journal.Snapshot()
+	fail := func(gasUsed uint64, err error) CallResult {
+		h.journal.RevertToSnapshot(snap)
+		ret := "0x"
+		if rerr, ok := AsRevertError(err); ok {
+			ret = rerr.Payload
+		}
+		return CallResult{ReturnData: ret, GasUsed: gasUsed, Err: err}
+	}
+
+	if c.Kind == CallKindCall && !lNumberIsZero(value) {
+		if err := h.transfer(c.Caller, c.To, value); err != nil {
+			return fail(0, err)
+		}
+	}
+	code := h.Code(c.To)
+	if len(code) == 0 {
+		return CallResult{OK: true, ReturnData: "0x"}
+	}
+	selector, args, err := DecodeCallData(c.Data)
+	if err != nil {
+		return fail(0, err)
+	}
+
+	self := c.To
+	if c.Kind == CallKindDelegateCall {
+		self = c.Caller
+	}
+	L := NewState()
+	defer L.Close()
+	L.SetGasLimit(c.Gas)
+	L.SetTracer(c.Tracer)
+	h.attachFrame(L, self, c.Depth)
+	msg := L.NewTable()
+	msg.RawSetString("sender", c.Sender)
+	msg.RawSetString("value", value)
+	data, _ := BytesFromHex(c.Data)
+	msg.RawSetString("data", data)
+	L.SetGlobal("msg", msg)
+
+	if err := L.DoBytecode(code); err != nil {
+		return fail(L.GasUsed(), err)
+	}
+	tos, ok := L.GetGlobal("tos").(*LTable)
+	if !ok {
+		return fail(L.GasUsed(), fmt.Errorf("contract %s has no tos entry table", c.To))
+	}
+	L.Push(L.GetField(tos, "oninvoke"))
+	L.Push(LString(selector))
+	for _, a := range args {
+		L.Push(a)
+	}
+	if c.Static {
+		err = L.StaticPCall(len(args)+1, MultRet, nil)
+	} else {
+		err = L.PCall(len(args)+1, MultRet, nil)
+	}
+	if err != nil {
+		return fail(L.GasUsed(), err)
+	}
+	rets := make([]LValue, 0, L.GetTop())
+	for i := 1; i <= L.GetTop(); i++ {
+		rets = append(rets, L.Get(i))
+	}
+	ret, err := encodeReturnData(rets)
+	if err != nil {
+		return fail(L.GasUsed(), err)
+	}
+	return CallResult{OK: true, ReturnData: ret, GasUsed: L.GasUsed()}
+}
+
+// Create implements ContractDeployer. The creator's nonce is consumed even
+// when the deployment fails; everything else is rolled back.
+func (h *MemoryContractHost) Create(c *ContractCreate) (res CreateResult) {
+	value := c.Value
+	if value == "" {
+		value = LNumberZero
+	}
+	creator := h.touch(c.Creator)
+	nonce := creator.nonce
+	creator.nonce++
+	h.journal.RecordUndo(func() { creator.nonce = nonce })
+
+	var addr LAddress
+	switch c.Kind {
+	case CallKindCreate:
+		addr = CreateAddress(c.Creator, nonce)
+	case CallKindCreate2:
+		var codeHash [32]byte
+		copy(codeHash[:], keccak256Bytes(c.InitCode))
+		addr = Create2Address(c.Creator, c.Salt, codeHash)
+	default:
+		return CreateResult{Address: LAddress(zeroAddress), Err: fmt.Errorf("unsupported deployment kind %s", c.Kind)}
+	}
+	if c.Tracer != nil {
+		call := &TraceCall{Kind: c.Kind, From: c.Creator, To: addr, Value: value, Input: "0x" + hex.EncodeToString(c.InitCode), Gas: c.Gas, Depth: c.Depth}
+		c.Tracer.OnEnter(call)
+		defer func() {
+			out := "0x"
+			if rerr, ok := AsRevertError(res.Err); ok {
+				out = rerr.Payload
+			}
+			c.Tracer.OnExit(call, &TraceResult{OK: res.OK, Output: out, GasUsed: res.GasUsed, Err: res.Err})
+		}()
+	}
+	code, err := deployableCode(c.InitCode)
+	if err != nil {
+		return CreateResult{Address: LAddress(zeroAddress), Err: err}
+	}
+	if existing, ok := h.accounts[addr]; ok && (len(existing.code) > 0 || existing.nonce > 0) {
+		return CreateResult{Address: LAddress(zeroAddress), Err: fmt.Errorf("address collision at %s", addr)}
+	}
+
+	snap := h.journal.Snapshot()
+	fail := func(gasUsed uint64, err error) CreateResult {
+		h.journal.RevertToSnapshot(snap)
+		return CreateResult{Address: LAddress(zeroAddress), GasUsed: gasUsed, Err: err}
+	}
+	prev, existed := h.accounts[addr]
+	acc := &memoryAccount{code: code, storage: newLTable(0, 0), balance: LNumberZero, nonce: 1}
+	if existed {
+		acc.balance = prev.balance
+	}
+	h.accounts[addr] = acc
+	h.journal.RecordUndo(func() {
+		if existed {
+			h.accounts[addr] = prev
+		} else {
+			delete(h.accounts, addr)
+		}
+	})
+	if !lNumberIsZero(value) {
+		if err := h.transfer(c.Creator, addr, value); err != nil {
+			return fail(0, err)
+		}
+	}
+
+	L := NewState()
+	defer L.Close()
+	L.SetGasLimit(c.Gas)
+	L.SetTracer(c.Tracer)
+	h.attachFrame(L, addr, c.Depth)
+	msg := L.NewTable()
+	msg.RawSetString("sender", c.Creator)
+	msg.RawSetString("value", value)
+	L.SetGlobal("msg", msg)
+	if err := L.DoBytecode(code); err != nil {
+		return fail(L.GasUsed(), err)
+	}
+	if tos, ok := L.GetGlobal("tos").(*LTable); ok {
+		if oncreate := L.GetField(tos, "oncreate"); oncreate != LNil {
+			L.Push(oncreate)
+			for _, a := range c.Args {
+				L.Push(a)
+			}
+			if err := L.PCall(len(c.Args), 0, nil); err != nil {
+				return fail(L.GasUsed(), err)
+			}
+		}
+	}
+	return CreateResult{OK: true, Address: addr, GasUsed: L.GasUsed()}
+}
+
+// deployableCode returns the executable bytecode of init code given either
+// as tolang bytecode or as a .toc artifact (whose hashes are verified).
+func deployableCode(initCode []byte) ([]byte, error) {
+	if IsTOC(initCode) {
+		art, err := DecodeTOC(initCode)
+		if err != nil {
+			return nil, err
+		}
+		initCode = art.Bytecode
+	}
+	if !IsBytecode(initCode) {
+		return nil, fmt.Errorf("init code is not tolang bytecode")
+	}
+	return append([]byte(nil), initCode...), nil
+}
+
+func (h *MemoryContractHost) transfer(from, to LAddress, value LNumber) error {
+	src, ok := h.accounts[from]
+	if !ok || lNumberCmp(src.balance, value) < 0 {
+		return fmt.Errorf("insufficient balance")
+	}
+	dst := h.touch(to)
+	srcPrev, dstPrev := src.balance, dst.balance
+	src.balance = lNumberSub(src.balance, value)
+	dst.balance = lNumberAdd(dst.balance, value)
+	h.journal.RecordUndo(func() {
+		src.balance, dst.balance = srcPrev, dstPrev
+	})
+	return nil
+}
@@ -0,0 +1,397 @@
+package lua
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const hostCounterSource = `
+tol 0.2
+contract Counter {
+  storage {
+    slot count: u256;
+  }
+  fn bump(n: u256) -> (r: u256) public {
+    set count = count + n;
+    return count;
+  }
+  fn bumpAndFail(n: u256) public {
+    set count = count + n;
+    revert "boom";
+  }
+  fn peek() -> (r: u256) public view {
+    return count;
+  }
+  fn deposit() public payable {
+    return;
+  }
+}
+`
+
+const hostCallerSource = `
+tol 0.2
+contract Caller {
+  storage {
+    slot count: u256;
+  }
+  fn forward(target: address, data: bytes) -> (ok: bool) public {
+    return call(target, 0, data);
+  }
+  fn forwardStatic(target: address, data: bytes) -> (ok: bool) public view {
+    return staticcall(target, data);
+  }
+  fn forwardDelegate(target: address, data: bytes) -> (ok: bool) public {
+    return delegatecall(target, data);
+  }
+  fn peek() -> (r: u256) public view {
+    return count;
+  }
+}
+`
+
+var (
+	hostCallerAddr  = LAddress("0x" + strings.Repeat("0", 62) + "0a")
+	hostCounterAddr = LAddress("0x" + strings.Repeat("0", 62) + "0b")
+)
+
+func newTestContractHost(t *testing.T) *MemoryContractHost {
+	t.Helper()
+	h := NewMemoryContractHost()
+	for addr, src := range map[LAddress]string{hostCallerAddr: hostCallerSource, hostCounterAddr: hostCounterSource} {
+		bc, err := CompileTOLToBytecode([]byte(src), "<tol>")
+		if err != nil {
+			t.Fatalf("compile: %v", err)
+		}
+		h.SetCode(addr, bc)
+	}
+	return h
+}
+
+func mustCallData(t *testing.T, sig string, args ...LValue) LString {
+	t.Helper()
+	data, err := EncodeCallData(selectorHexFromSignature(sig), args...)
+	if err != nil {
+		t.Fatalf("encode calldata: %v", err)
+	}
+	return LString(data)
+}
+
+// invokeCaller runs a Caller entry point as a top-level frame and returns
+// the `ok` flag of the call it forwards.
+func invokeCaller(t *testing.T, h *MemoryContractHost, sig string, args ...LValue) LValue {
+	t.Helper()
+	L := NewState()
+	defer L.Close()
+	h.Attach(L, hostCallerAddr)
+	if err := L.DoBytecode(h.Code(hostCallerAddr)); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature(sig)))
+	for _, a := range args {
+		L.Push(a)
+	}
+	if err := L.PCall(len(args)+1, 1, nil); err != nil {
+		t.Fatalf("%s failed: %v", sig, err)
+	}
+	return L.Get(1)
+}
+
+func peekCount(t *testing.T, h *MemoryContractHost, addr LAddress) string {
+	t.Helper()
+	res := h.Call(&ContractCall{Kind: CallKindStaticCall, To: addr, Data: string(mustCallData(t, "peek()")), Depth: 1, Static: true})
+	if !res.OK {
+		t.Fatalf("peek failed")
+	}
+	return res.ReturnData
+}
+
+func word(n int) string {
+	w, _ := tolEncodeKey(lNumberFromInt(n))
+	return "0x" + w
+}
+
+func TestContractHostCallRunsCalleeAndReturnsData(t *testing.T) {
+	h := newTestContractHost(t)
+	if ok := invokeCaller(t, h, "forward(address,bytes)", hostCounterAddr, mustCallData(t, "bump(u256)", lNumberFromInt(5))); ok != LTrue {
+		t.Fatalf("expected call to succeed")
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(5) {
+		t.Fatalf("unexpected callee storage: %s", got)
+	}
+
+	L := NewState()
+	defer L.Close()
+	h.Attach(L, hostCallerAddr)
+	L.SetGlobal("target", hostCounterAddr)
+	L.SetGlobal("data", mustCallData(t, "bump(u256)", lNumberFromInt(2)))
+	if err := L.DoString(`ok, ret = call(target, 0, data)`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("ok") != LTrue || LVAsString(L.GetGlobal("ret")) != word(7) {
+		t.Fatalf("unexpected call result: ok=%v ret=%v", L.GetGlobal("ok"), L.GetGlobal("ret"))
+	}
+}
+
+func TestContractHostCallRevertRollsBackCalleeStorage(t *testing.T) {
+	h := newTestContractHost(t)
+	invokeCaller(t, h, "forward(address,bytes)", hostCounterAddr, mustCallData(t, "bump(u256)", lNumberFromInt(3)))
+	if ok := invokeCaller(t, h, "forward(address,bytes)", hostCounterAddr, mustCallData(t, "bumpAndFail(u256)", lNumberFromInt(10))); ok != LFalse {
+		t.Fatalf("expected reverting call to fail")
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(3) {
+		t.Fatalf("expected reverted write to be rolled back, got %s", got)
+	}
+}
+
+func TestContractHostStaticCallRejectsStateChanges(t *testing.T) {
+	h := newTestContractHost(t)
+	if ok := invokeCaller(t, h, "forwardStatic(address,bytes)", hostCounterAddr, mustCallData(t, "bump(u256)", lNumberFromInt(1))); ok != LFalse {
+		t.Fatalf("expected staticcall to a writer to fail")
+	}
+	if ok := invokeCaller(t, h, "forwardStatic(address,bytes)", hostCounterAddr, mustCallData(t, "peek()")); ok != LTrue {
+		t.Fatalf("expected staticcall to a view to succeed")
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(0) {
+		t.Fatalf("expected callee storage to be untouched, got %s", got)
+	}
+}
+
+func TestContractHostDelegateCallUsesCallerStorage(t *testing.T) {
+	h := newTestContractHost(t)
+	if ok := invokeCaller(t, h, "forwardDelegate(address,bytes)", hostCounterAddr, mustCallData(t, "bump(u256)", lNumberFromInt(4))); ok != LTrue {
+		t.Fatalf("expected delegatecall to succeed")
+	}
+	// Slot hashes are derived from the declaring contract, so the callee's
+	// slot appears in the caller's storage.
+	slot := keccak256Hex([]byte("tol.slot.Counter.count"))
+	if got := h.Storage(hostCallerAddr).RawGetString(slot); LVAsString(got) != "4" {
+		t.Fatalf("expected caller storage to be written, got %v", got)
+	}
+	if got := h.Storage(hostCounterAddr).RawGetString(slot); got != LNil {
+		t.Fatalf("expected callee storage to be untouched, got %v", got)
+	}
+}
+
+func TestContractHostCallTransfersValue(t *testing.T) {
+	h := newTestContractHost(t)
+	h.SetBalance(hostCallerAddr, lNumberFromInt(10))
+	L := NewState()
+	defer L.Close()
+	h.Attach(L, hostCallerAddr)
+	L.SetGlobal("target", hostCounterAddr)
+	L.SetGlobal("deposit", mustCallData(t, "deposit()"))
+	L.SetGlobal("bump", mustCallData(t, "bump(u256)", lNumberFromInt(1)))
+	if err := L.DoString(`ok1 = call(target, 4, deposit); ok2 = call(target, 7, deposit); ok3 = call(target, 1, bump)`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("ok1") != LTrue || L.GetGlobal("ok2") != LFalse || L.GetGlobal("ok3") != LFalse {
+		t.Fatalf("unexpected results: %v %v %v", L.GetGlobal("ok1"), L.GetGlobal("ok2"), L.GetGlobal("ok3"))
+	}
+	if h.Balance(hostCallerAddr) != "6" || h.Balance(hostCounterAddr) != "4" {
+		t.Fatalf("unexpected balances: caller=%s counter=%s", h.Balance(hostCallerAddr), h.Balance(hostCounterAddr))
+	}
+	L.SetStaticMode(true)
+	if err := L.DoString(`call(target, 1, deposit)`); err == nil || !strings.Contains(err.Error(), "STATIC_CALL_VIOLATION") {
+		t.Fatalf("expected value call in static mode to fail, got %v", err)
+	}
+}
+
+func TestContractHostReadsAndRevertedTransfersLeaveNoAccounts(t *testing.T) {
+	h := newTestContractHost(t)
+	h.SetBalance(hostCallerAddr, lNumberFromInt(10))
+	fresh := LAddress("0x" + strings.Repeat("77", 32))
+	before := len(h.Addresses())
+	if h.Storage(fresh) != nil || h.Balance(fresh) != LNumberZero || len(h.Addresses()) != before {
+		t.Fatal("reading an unknown account must not create it")
+	}
+	snap := h.Journal().Snapshot()
+	res := h.Call(&ContractCall{Kind: CallKindCall, Caller: hostCallerAddr, Sender: hostCallerAddr, To: fresh, Value: lNumberFromInt(3)})
+	if !res.OK || h.Balance(fresh) != "3" {
+		t.Fatalf("unexpected transfer result: %+v balance=%s", res, h.Balance(fresh))
+	}
+	h.Journal().RevertToSnapshot(snap)
+	if h.Storage(fresh) != nil || len(h.Addresses()) != before || h.Balance(hostCallerAddr) != "10" {
+		t.Fatalf("reverted transfer left state behind: %v", h.Addresses())
+	}
+}
+
+type recordingContractHost struct {
+	calls []ContractCall
+	used  uint64
+}
+
+func (r *recordingContractHost) Call(c *ContractCall) CallResult {
+	r.calls = append(r.calls, *c)
+	return CallResult{OK: true, ReturnData: "0x", GasUsed: r.used}
+}
+
+func TestContractHostGasForwardingAndDepthLimit(t *testing.T) {
+	rec := &recordingContractHost{used: 3000}
+	L := NewState()
+	defer L.Close()
+	L.SetContractHost(rec)
+	L.SetContractFrame(hostCallerAddr, 3)
+	L.SetGlobal("target", hostCounterAddr)
+	L.SetGasLimit(1_000_000)
+	if err := L.DoString(`call(target, 0, "0x00000000", 500); call(target, 1, "0x00000000"); staticcall(target, "0x00000000")`); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.calls) != 3 {
+		t.Fatalf("expected 3 host calls, got %d", len(rec.calls))
+	}
+	if c := rec.calls[0]; c.Gas != 500 || c.Depth != 4 || c.Caller != hostCallerAddr || c.Static {
+		t.Fatalf("unexpected first call: %+v", c)
+	}
+	if c := rec.calls[1]; c.Gas <= CallStipend || c.Gas-CallStipend > 1_000_000-1_000_000/64 {
+		t.Fatalf("expected all-but-1/64 gas plus stipend, got %d", c.Gas)
+	}
+	if c := rec.calls[2]; !c.Static || c.Kind != CallKindStaticCall {
+		t.Fatalf("expected static call, got %+v", c)
+	}
+	// Callee gas is charged to the caller, minus the stipend.
+	if used := L.GasUsed(); used < 3*3000-CallStipend {
+		t.Fatalf("expected callee gas to be charged, used=%d", used)
+	}
+
+	L.SetContractFrame(hostCallerAddr, MaxCallDepth)
+	if err := L.DoString(`ok, ret = call(target, 0, "0x00000000")`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("ok") != LFalse || len(rec.calls) != 3 {
+		t.Fatalf("expected call beyond max depth to fail without reaching the host")
+	}
+}
+
+func (r *recordingContractHost) Create(c *ContractCreate) CreateResult {
+	return CreateResult{OK: true, Address: hostCounterAddr, GasUsed: r.used}
+}
+
+func TestContractHostNestedGasExceedsCallerLimit(t *testing.T) {
+	for name, args := range map[string][]LValue{
+		"call":   {hostCounterAddr, LNumber("0"), LString("0x00000000")},
+		"create": {LNumber("0"), LString("0x00")},
+	} {
+		L := NewState()
+		L.SetContractHost(&recordingContractHost{used: 50_000})
+		L.SetContractFrame(hostCallerAddr, 0)
+		L.SetGasLimit(10_000)
+		// Called from Go: no later instruction would notice the overrun.
+		L.Push(L.GetGlobal(name))
+		for _, a := range args {
+			L.Push(a)
+		}
+		if err := L.PCall(len(args), MultRet, nil); err == nil || !strings.Contains(err.Error(), "gas limit exceeded") {
+			t.Errorf("%s: expected gas exhaustion, got %v", name, err)
+		}
+		L.Close()
+	}
+}
+
+const hostFactorySource = `
+tol 0.2
+contract Factory {
+  fn make(code: bytes) -> (a: address) public {
+    return create(0, code);
+  }
+  fn make2(salt: bytes32, code: bytes) -> (a: address) public {
+    return create2(0, salt, code);
+  }
+}
+`
+
+const hostSeededCounterSource = `
+tol 0.2
+contract Counter {
+  storage {
+    slot count: u256;
+  }
+  constructor() {
+    set count = 9;
+  }
+  fn peek() -> (r: u256) public view {
+    return count;
+  }
+}
+`
+
+func TestContractHostCreateDerivesAddresses(t *testing.T) {
+	a0 := CreateAddress(hostCallerAddr, 0)
+	if a0 == CreateAddress(hostCallerAddr, 1) || a0 == CreateAddress(hostCounterAddr, 0) {
+		t.Fatalf("expected distinct create addresses")
+	}
+	if _, err := parseAddressString(string(a0)); err != nil {
+		t.Fatalf("invalid derived address %s: %v", a0, err)
+	}
+	var salt, codeHash [32]byte
+	salt[31] = 1
+	copy(codeHash[:], keccak256Bytes([]byte("code")))
+	want := keccak256Hex(append(append(append([]byte{0xff}, addressBytes(hostCallerAddr)...), salt[:]...), codeHash[:]...))
+	if got := Create2Address(hostCallerAddr, salt, codeHash); string(got) != want {
+		t.Fatalf("unexpected create2 address: got %s want %s", got, want)
+	}
+}
+
+func TestContractHostCreateDeploysAndRunsConstructor(t *testing.T) {
+	h := NewMemoryContractHost()
+	factory, err := CompileTOLToBytecode([]byte(hostFactorySource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetCode(hostCallerAddr, factory)
+	bc, err := CompileTOLToBytecode([]byte(hostSeededCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toc, err := CompileTOLToTOC([]byte(hostSeededCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverting, err := CompileTOLToBytecode([]byte("tol 0.2\ncontract Bad {\n  constructor() {\n    revert \"no\";\n  }\n}\n"), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := invokeCaller(t, h, "make(bytes)", LString("0x"+hex.EncodeToString(bc)))
+	if created != CreateAddress(hostCallerAddr, 0) || h.Nonce(hostCallerAddr) != 1 {
+		t.Fatalf("unexpected create result %v (nonce %d)", created, h.Nonce(hostCallerAddr))
+	}
+	if got := peekCount(t, h, created.(LAddress)); got != word(9) {
+		t.Fatalf("expected constructor to run, got %s", got)
+	}
+
+	salt := LNumber("7")
+	var saltWord, codeHash [32]byte
+	saltWord[31] = 7
+	copy(codeHash[:], keccak256Bytes(toc))
+	created = invokeCaller(t, h, "make2(bytes32,bytes)", salt, LString("0x"+hex.EncodeToString(toc)))
+	if created != Create2Address(hostCallerAddr, saltWord, codeHash) {
+		t.Fatalf("unexpected create2 result %v", created)
+	}
+	if got := peekCount(t, h, created.(LAddress)); got != word(9) {
+		t.Fatalf("expected .toc deployment to run constructor, got %s", got)
+	}
+	if again := invokeCaller(t, h, "make2(bytes32,bytes)", salt, LString("0x"+hex.EncodeToString(toc))); again != LAddress(zeroAddress) {
+		t.Fatalf("expected create2 address collision to fail, got %v", again)
+	}
+
+	for name, code := range map[string][]byte{"reverting constructor": reverting, "invalid code": []byte("not bytecode")} {
+		nonce := h.Nonce(hostCallerAddr)
+		if got := invokeCaller(t, h, "make(bytes)", LString("0x"+hex.EncodeToString(code))); got != LAddress(zeroAddress) {
+			t.Fatalf("%s: expected zero address, got %v", name, got)
+		}
+		if h.Code(CreateAddress(hostCallerAddr, nonce)) != nil {
+			t.Fatalf("%s: expected no account to be left behind", name)
+		}
+	}
+
+	L := NewState()
+	defer L.Close()
+	h.Attach(L, hostCallerAddr)
+	L.SetStaticMode(true)
+	L.SetGlobal("code", LString("0x"+hex.EncodeToString(bc)))
+	if err := L.DoString(`create(0, code)`); err == nil || !strings.Contains(err.Error(), "STATIC_CALL_VIOLATION") {
+		t.Fatalf("expected create in static mode to fail, got %v", err)
+	}
+}
@@ -1,43 +1,245 @@
 package lua
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strings"
 
-	"golang.org/x/crypto/sha3"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Gas prices of the hashing and signature builtins, charged on metered
+// states in addition to the instruction count. Hashes cost a base price
+// plus a price per started 32-byte word of input. Signature checks take
+// the VM time of roughly 100 (ed25519) and 200 (secp256k1) gas units (see
+// the benchmarks in cryptolib_test.go); their prices follow the EVM's
+// ecrecover price and leave a wide margin for slower hosts.
+const (
+	GasSha256Base    uint64 = 60
+	GasSha256Word    uint64 = 12
+	GasRipemd160Base uint64 = 600
+	GasRipemd160Word uint64 = 120
+	GasEcrecover     uint64 = 3000
+
+	GasEd25519Verify   uint64 = 2000
+	GasSecp256k1Verify uint64 = 3000
+
+	GasMerkleVerifyBase uint64 = 10
+	GasMerkleVerifyStep uint64 = 6
 )
 
 // openCrypto registers deterministic crypto builtins as Lua globals.
 // These are required for TOL canonical storage key derivation (spec §8.3).
 func openCrypto(L *LState) {
 	L.SetGlobal("keccak256", L.NewFunction(cryptoKeccak256))
+	L.SetGlobal("sha256", L.NewFunction(cryptoSha256))
+	L.SetGlobal("ripemd160", L.NewFunction(cryptoRipemd160))
+	L.SetGlobal("ecrecover", L.NewFunction(cryptoEcrecover))
+	L.SetGlobal("ed25519_verify", L.NewFunction(cryptoEd25519Verify))
+	L.SetGlobal("secp256k1_verify", L.NewFunction(cryptoSecp256k1Verify))
+	L.SetGlobal("merkle_verify", L.NewFunction(cryptoMerkleVerify))
 	L.SetGlobal("__tol_enc", L.NewFunction(cryptoTolEnc))
+	L.SetGlobal("__tol_mkey", L.NewFunction(cryptoTolMkey))
 	L.SetGlobal("uint256_add_hex", L.NewFunction(cryptoUint256AddHex))
 }
 
-// cryptoKeccak256 implements keccak256(hex_input: string) -> bytes32_hex.
-// hex_input must be "0x" followed by even hex chars; the raw bytes are hashed.
-// Returns "0x" + 64 hex chars.
+// cryptoKeccak256 implements keccak256(data) -> bytes32. data is a bytes
+// value or a "0x"-prefixed hex string; the raw bytes are hashed.
 func cryptoKeccak256(L *LState) int {
-	s := strings.TrimSpace(L.CheckString(1))
+	data := cryptoHexArg(L, 1, "keccak256")
+	L.Push(LBytes(keccak256Bytes(data)))
+	return 1
+}
+
+// cryptoHexArg returns the raw bytes of argument n, a bytes value (read
+// without copying) or a "0x"-prefixed hex string.
+func cryptoHexArg(L *LState, n int, fname string) []byte {
+	if bt, ok := L.Get(n).(LBytes); ok {
+		return bt.readOnly()
+	}
+	s := strings.TrimSpace(L.CheckString(n))
 	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
-		L.RaiseError("keccak256: input must start with 0x, got: %q", s)
+		L.RaiseError("%s: input must start with 0x, got: %q", fname, s)
 	}
 	data, err := hex.DecodeString(s[2:])
 	if err != nil {
-		L.RaiseError("keccak256: invalid hex input: %s", err)
+		L.RaiseError("%s: invalid hex input: %s", fname, err)
 	}
-	h := sha3.NewLegacyKeccak256()
+	return data
+}
+
+// cryptoWordArg returns argument n as a 32-byte word; it accepts the same
+// values as __tol_enc (hex strings of at most 32 bytes, numbers, addresses).
+func cryptoWordArg(L *LState, n int, fname string) []byte {
+	word, err := tolEncodeWord(L.CheckAny(n))
+	if err != nil {
+		L.ArgError(n, fmt.Sprintf("%s: %s", fname, err))
+	}
+	return word[:]
+}
+
+// hashGas returns base + word * ceil(size / 32).
+func hashGas(base, word uint64, size int) uint64 {
+	return base + word*uint64((size+31)/32)
+}
+
+// cryptoSha256 implements sha256(data) -> bytes32.
+func cryptoSha256(L *LState) int {
+	data := cryptoHexArg(L, 1, "sha256")
+	L.chargeGas(hashGas(GasSha256Base, GasSha256Word, len(data)))
+	sum := sha256.Sum256(data)
+	L.Push(LBytes(sum[:]))
+	return 1
+}
+
+// cryptoRipemd160 implements ripemd160(data) -> bytes32.
+// The 20-byte digest is left-padded with zeros to 32 bytes.
+func cryptoRipemd160(L *LState) int {
+	data := cryptoHexArg(L, 1, "ripemd160")
+	L.chargeGas(hashGas(GasRipemd160Base, GasRipemd160Word, len(data)))
+	h := ripemd160.New()
 	h.Write(data)
-	L.Push(LString("0x" + hex.EncodeToString(h.Sum(nil))))
+	var out [32]byte
+	copy(out[12:], h.Sum(nil))
+	L.Push(LBytes(out[:]))
+	return 1
+}
+
+// cryptoEcrecover implements ecrecover(hash, v, r, s) -> address. v is the
+// recovery id, either 27/28 or 0/1. The result is PublicKeyAddress of the
+// recovered secp256k1 key, or the zero address if the signature is invalid.
+func cryptoEcrecover(L *LState) int {
+	hash := cryptoWordArg(L, 1, "ecrecover")
+	v := cryptoWordArg(L, 2, "ecrecover")
+	r := new(big.Int).SetBytes(cryptoWordArg(L, 3, "ecrecover"))
+	s := new(big.Int).SetBytes(cryptoWordArg(L, 4, "ecrecover"))
+	L.chargeGas(GasEcrecover)
+
+	addr := LAddress(zeroAddress)
+	recID := new(big.Int).SetBytes(v)
+	if recID.IsUint64() && recID.Uint64() >= 27 {
+		recID.Sub(recID, big.NewInt(27))
+	}
+	if recID.IsUint64() && recID.Uint64() <= 1 {
+		if pub, ok := secp256k1Recover(hash, byte(recID.Uint64()), r, s); ok {
+			addr = PublicKeyAddress(pub)
+		}
+	}
+	L.Push(addr)
+	return 1
+}
+
+// cryptoEd25519Verify implements ed25519_verify(pubkey, msg, sig) -> bool
+// (RFC 8032). Keys and signatures of the wrong length, with a non-canonical
+// point encoding or an S value not below the group order verify as false;
+// arguments that are not bytes or hex strings raise an error.
+func cryptoEd25519Verify(L *LState) int {
+	pub := cryptoHexArg(L, 1, "ed25519_verify")
+	msg := cryptoHexArg(L, 2, "ed25519_verify")
+	sig := cryptoHexArg(L, 3, "ed25519_verify")
+	L.chargeGas(GasEd25519Verify)
+	ok := len(pub) == ed25519.PublicKeySize && len(sig) == ed25519.SignatureSize &&
+		ed25519CanonicalPoint(pub) && ed25519CanonicalPoint(sig[:32]) &&
+		ed25519.Verify(pub, msg, sig)
+	L.Push(LBool(ok))
+	return 1
+}
+
+// ed25519P is the field prime 2^255 - 19.
+var ed25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// ed25519CanonicalPoint reports whether the 32-byte point encoding b has a
+// y coordinate below p; crypto/ed25519 accepts the non-canonical forms.
+func ed25519CanonicalPoint(b []byte) bool {
+	be := make([]byte, 32)
+	for i := range be {
+		be[i] = b[31-i]
+	}
+	be[0] &= 0x7f
+	return new(big.Int).SetBytes(be).Cmp(ed25519P) < 0
+}
+
+// cryptoSecp256k1Verify implements secp256k1_verify(pubkey, hash, sig) ->
+// bool. pubkey is a compressed, uncompressed or raw 64-byte key; sig is
+// r ++ s (64 bytes) and must have a low S value. Other keys and signatures
+// verify as false; arguments that are not bytes or hex strings raise an
+// error.
+func cryptoSecp256k1Verify(L *LState) int {
+	pub := cryptoHexArg(L, 1, "secp256k1_verify")
+	hash := cryptoWordArg(L, 2, "secp256k1_verify")
+	sig := cryptoHexArg(L, 3, "secp256k1_verify")
+	L.chargeGas(GasSecp256k1Verify)
+	L.Push(LBool(secp256k1Verify(pub, hash, sig)))
+	return 1
+}
+
+// cryptoMerkleVerify implements merkle_verify(root, leaf, proof) -> bool,
+// compatible with OpenZeppelin MerkleProof.verify: each step hashes the
+// sorted pair keccak256(min(a, b) ++ max(a, b)). proof is an array table
+// of bytes32 values, or bytes or a hex string of concatenated 32-byte words.
+func cryptoMerkleVerify(L *LState) int {
+	root := cryptoWordArg(L, 1, "merkle_verify")
+	leaf := cryptoWordArg(L, 2, "merkle_verify")
+	var proof [][]byte
+	switch p := L.CheckAny(3).(type) {
+	case *LTable:
+		n := p.Len()
+		proof = make([][]byte, n)
+		for i := 1; i <= n; i++ {
+			word, err := tolEncodeWord(p.RawGetInt(i))
+			if err != nil {
+				L.ArgError(3, fmt.Sprintf("merkle_verify: proof[%d]: %s", i, err))
+			}
+			proof[i-1] = word[:]
+		}
+	case LString, LBytes:
+		data := cryptoHexArg(L, 3, "merkle_verify")
+		if len(data)%32 != 0 {
+			L.ArgError(3, "merkle_verify: proof must be a multiple of 32 bytes")
+		}
+		for off := 0; off < len(data); off += 32 {
+			proof = append(proof, data[off:off+32])
+		}
+	default:
+		L.TypeError(3, LTTable)
+	}
+	L.chargeGas(GasMerkleVerifyBase + GasMerkleVerifyStep*uint64(len(proof)))
+	L.Push(LBool(bytes.Equal(merkleProcessProof(leaf, proof), root)))
 	return 1
 }
 
+// merkleProcessProof folds proof into leaf with sorted-pair keccak256.
+func merkleProcessProof(leaf []byte, proof [][]byte) []byte {
+	computed := leaf
+	pair := make([]byte, 64)
+	for _, sibling := range proof {
+		if bytes.Compare(computed, sibling) < 0 {
+			copy(pair, computed)
+			copy(pair[32:], sibling)
+		} else {
+			copy(pair, sibling)
+			copy(pair[32:], computed)
+		}
+		computed = keccak256Bytes(pair)
+	}
+	return computed
+}
+
+// PublicKeyAddress returns the address of a secp256k1 public key given as
+// its 64-byte uncompressed encoding (X ++ Y, without the 0x04 prefix):
+// keccak256 of those bytes.
+func PublicKeyAddress(pub []byte) LAddress {
+	return LAddress("0x" + hex.EncodeToString(keccak256Bytes(pub)))
+}
+
 // cryptoTolEnc implements __tol_enc(value) -> 64-char hex string (no 0x, 32 bytes).
 // Encodes a TOL key value for canonical mapping slot derivation (spec §8.3):
 //   - LAddress / LString "0x...": hex decode, right-align in 32 bytes
+//   - LBytes (at most 32 bytes): right-align in 32 bytes
 //   - LNumber / LString decimal: big-endian 32-byte u256
 //   - LBool: 32 zero bytes with LSB = 1 (true) or 0 (false)
 func cryptoTolEnc(L *LState) int {
@@ -50,19 +252,56 @@ func cryptoTolEnc(L *LState) int {
 	return 1
 }
 
-// cryptoUint256AddHex implements uint256_add_hex(base_hex, offset) -> bytes32_hex.
-// Adds a non-negative integer offset to a hex-encoded u256, wrapping mod 2^256.
-// Used for array element slot computation: H(base_slot) + index.
-func cryptoUint256AddHex(L *LState) int {
-	baseStr := strings.TrimSpace(L.CheckString(1))
-	if strings.HasPrefix(baseStr, "0x") || strings.HasPrefix(baseStr, "0X") {
-		baseStr = baseStr[2:]
+// cryptoTolMkey implements __tol_mkey(key, base) -> bytes32_hex, the
+// mapping slot derivation keccak256(encode(key) ++ base) of spec §8.3.
+// The preimage is assembled as raw bytes rather than as hex text.
+func cryptoTolMkey(L *LState) int {
+	var preimage [64]byte
+	copy(preimage[:32], cryptoWordArg(L, 1, "__tol_mkey"))
+	copy(preimage[32:], cryptoWordArg(L, 2, "__tol_mkey"))
+	L.Push(LString("0x" + hex.EncodeToString(keccak256Bytes(preimage[:]))))
+	return 1
+}
+
+// MappingSlot returns the storage slot of the mapping entry base[keys[0]]...
+// as `__tol_mkey` derives it, base being the mapping's base slot hash.
+func MappingSlot(base string, keys ...LValue) (string, error) {
+	slot, err := tolEncodeWord(LString(base))
+	if err != nil {
+		return "", fmt.Errorf("mapping base: %v", err)
 	}
-	base, ok := new(big.Int).SetString(baseStr, 16)
-	if !ok {
-		L.RaiseError("uint256_add_hex: invalid hex base: %q", baseStr)
+	for i, k := range keys {
+		word, err := tolEncodeWord(k)
+		if err != nil {
+			return "", fmt.Errorf("mapping key %d: %v", i+1, err)
+		}
+		var preimage [64]byte
+		copy(preimage[:32], word[:])
+		copy(preimage[32:], slot[:])
+		copy(slot[:], keccak256Bytes(preimage[:]))
+	}
+	return "0x" + hex.EncodeToString(slot[:]), nil
+}
+
+// cryptoUint256AddHex implements uint256_add_hex(base, offset) -> bytes32_hex.
+// Adds a non-negative integer offset to a u256 given as bytes or as hex,
+// wrapping mod 2^256. Used for array element slot computation:
+// H(base_slot) + index.
+func cryptoUint256AddHex(L *LState) int {
+	var base *big.Int
+	if bt, ok := L.Get(1).(LBytes); ok && len(bt) <= 32 {
+		base = new(big.Int).SetBytes(bt.readOnly())
+	} else {
+		baseStr := strings.TrimSpace(L.CheckString(1))
+		if strings.HasPrefix(baseStr, "0x") || strings.HasPrefix(baseStr, "0X") {
+			baseStr = baseStr[2:]
+		}
+		if base, ok = new(big.Int).SetString(baseStr, 16); !ok {
+			L.RaiseError("uint256_add_hex: invalid hex base: %q", baseStr)
+		}
 	}
 	var offset *big.Int
+	var ok bool
 	switch v := L.CheckAny(2).(type) {
 	case LNumber:
 		offset, ok = new(big.Int).SetString(string(v), 10)
@@ -85,13 +324,29 @@ func cryptoUint256AddHex(L *LState) int {
 // tolEncodeKey encodes a Lua value to a 64-char hex string (no 0x prefix) for
 // use in TOL canonical storage key derivation per spec §8.3.
 func tolEncodeKey(v LValue) (string, error) {
+	word, err := tolEncodeWord(v)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(word[:]), nil
+}
+
+// tolEncodeWord encodes a Lua value as the 32-byte word of tolEncodeKey.
+// Bytes values of at most 32 bytes are right-aligned like hex strings.
+func tolEncodeWord(v LValue) ([32]byte, error) {
 	var buf [32]byte
 	switch val := v.(type) {
 	case LBool:
 		if bool(val) {
 			buf[31] = 1
 		}
-		return hex.EncodeToString(buf[:]), nil
+		return buf, nil
+	case LBytes:
+		if len(val) > 32 {
+			return buf, fmt.Errorf("bytes value exceeds 32 bytes (%d bytes)", len(val))
+		}
+		copy(buf[32-len(val):], val)
+		return buf, nil
 	case LAddress:
 		return encodeHexTo32(string(val))
 	case LString:
@@ -103,39 +358,38 @@ func tolEncodeKey(v LValue) (string, error) {
 	case LNumber:
 		return encodeDecimalTo32(string(val))
 	default:
-		return "", fmt.Errorf("unsupported key type %T", v)
+		return buf, fmt.Errorf("unsupported key type %T", v)
 	}
 }
 
-func encodeHexTo32(s string) (string, error) {
+func encodeHexTo32(s string) ([32]byte, error) {
+	var buf [32]byte
 	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
 		s = s[2:]
 	}
 	b, err := hex.DecodeString(s)
 	if err != nil {
-		return "", fmt.Errorf("invalid hex value: %s", err)
+		return buf, fmt.Errorf("invalid hex value: %s", err)
 	}
 	if len(b) > 32 {
-		return "", fmt.Errorf("hex value exceeds 32 bytes (%d bytes)", len(b))
+		return buf, fmt.Errorf("hex value exceeds 32 bytes (%d bytes)", len(b))
 	}
-	var buf [32]byte
 	copy(buf[32-len(b):], b)
-	return hex.EncodeToString(buf[:]), nil
+	return buf, nil
 }
 
-func encodeDecimalTo32(s string) (string, error) {
+func encodeDecimalTo32(s string) ([32]byte, error) {
+	var buf [32]byte
 	n, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
 	if !ok {
-		return "", fmt.Errorf("cannot parse as u256 decimal: %q", s)
+		return buf, fmt.Errorf("cannot parse as u256 decimal: %q", s)
 	}
 	if n.Sign() < 0 {
-		return "", fmt.Errorf("negative values not supported in key encoding")
+		return buf, fmt.Errorf("negative values not supported in key encoding")
 	}
-	b := n.Bytes()
-	if len(b) > 32 {
-		return "", fmt.Errorf("value overflows 32 bytes")
+	if n.BitLen() > 256 {
+		return buf, fmt.Errorf("value overflows 32 bytes")
 	}
-	var buf [32]byte
-	copy(buf[32-len(b):], b)
-	return hex.EncodeToString(buf[:]), nil
+	n.FillBytes(buf[:])
+	return buf, nil
 }
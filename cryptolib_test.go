@@ -0,0 +1,473 @@
+package lua
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestHashBuiltins(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	err := L.DoString(`
+		assert(tostring(sha256("0x")) == "0xe3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		assert(tostring(sha256("0x616263")) == "0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+		assert(tostring(ripemd160("0x")) == "0x0000000000000000000000009c1185a5c5e9fc54612808977ee8f548b2258d31")
+		assert(tostring(ripemd160("0x616263")) == "0x0000000000000000000000008eb208f7e05d987a9b044a8e98c6b087f15a0bfc")
+		assert(not pcall(sha256, "616263"))
+		assert(not pcall(ripemd160, "0xzz"))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashBuiltinGasByInputLength(t *testing.T) {
+	gasFor := func(fn string, words int) uint64 {
+		L := NewState()
+		defer L.Close()
+		L.SetGlobal("input", LString("0x"+strings.Repeat("00", 32*words)))
+		L.SetGasLimit(1_000_000)
+		if err := L.DoString(`local h = ` + fn + `(input)`); err != nil {
+			t.Fatal(err)
+		}
+		return L.GasUsed()
+	}
+	if d := gasFor("sha256", 3) - gasFor("sha256", 1); d != 2*GasSha256Word {
+		t.Fatalf("unexpected sha256 gas per word: %d", d)
+	}
+	if d := gasFor("ripemd160", 2) - gasFor("ripemd160", 0); d != 2*GasRipemd160Word {
+		t.Fatalf("unexpected ripemd160 gas per word: %d", d)
+	}
+	if d := gasFor("ripemd160", 0) - gasFor("sha256", 0); d != GasRipemd160Base-GasSha256Base {
+		t.Fatalf("unexpected base price difference: %d", d)
+	}
+}
+
+// secpTestSign produces a (recID, r, s) signature of hash with private key
+// d, with a low S value.
+func secpTestSign(hash []byte, d *big.Int) (byte, *big.Int, *big.Int) {
+	sig := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(d.FillBytes(make([]byte, 32))), hash, false)
+	return sig[0] - 27, new(big.Int).SetBytes(sig[1:33]), new(big.Int).SetBytes(sig[33:])
+}
+
+func TestEcrecover(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetGlobal("zero", LAddress(zeroAddress))
+
+	// Standard vector (go-ethereum crypto tests): testsig over testmsg
+	// recovers testpubkey.
+	pub, _ := hex.DecodeString("e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652")
+	L.SetGlobal("want", PublicKeyAddress(pub))
+	err := L.DoString(`
+		local h = "0xce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008"
+		local r = "0x90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e54998"
+		local s = "0x4a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc93"
+		assert(type(ecrecover(h, 28, r, s)) == "address")
+		assert(ecrecover(h, 28, r, s) == want)
+		assert(ecrecover(h, 1, r, s) == want)
+		assert(ecrecover(h, 27, r, s) ~= want)
+		assert(ecrecover(h, 29, r, s) == zero)
+		assert(ecrecover(h, 28, 0, s) == zero)
+		assert(ecrecover(h, 28, r, "0xfffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141") == zero)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Round trip through a locally produced signature, with a key whose
+	// Ethereum address (the low 20 bytes of the hash) is known.
+	d, _ := new(big.Int).SetString("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032", 16)
+	hash := keccak256Bytes([]byte("tol ecrecover"))
+	recID, r, s := secpTestSign(hash, d)
+	key, ok := secp256k1Recover(hash, recID, r, s)
+	if !ok {
+		t.Fatalf("expected recovery to succeed")
+	}
+	if got := string(PublicKeyAddress(key)); !strings.HasSuffix(got, "970e8128ab834e8eac17ab8e3812f010678cf791") {
+		t.Fatalf("unexpected recovered address %s", got)
+	}
+}
+
+const cryptoBuiltinsSource = `
+tol 0.2
+contract Signer {
+  fn digest(data: bytes) -> (r: bytes32) public pure {
+    return sha256(data);
+  }
+  fn short(data: bytes) -> (r: bytes32) public pure {
+    return ripemd160(data);
+  }
+  fn signer(h: bytes32, v: u8, r: bytes32, s: bytes32) -> (a: address) public pure {
+    return ecrecover(h, v, r, s);
+  }
+  fn approved(pk: bytes32, m: bytes, sig: bytes) -> (ok: bool) public pure {
+    return ed25519_verify(pk, m, sig);
+  }
+  fn listed(root: bytes32, leaf: bytes32, proof: bytes32[]) -> (ok: bool) public pure {
+    return merkle_verify(root, leaf, proof);
+  }
+}
+`
+
+func TestCryptoBuiltinsFromTOL(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(cryptoBuiltinsSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	call := func(sig string, args ...LValue) LValue {
+		t.Helper()
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		for _, a := range args {
+			L.Push(a)
+		}
+		if err := L.PCall(len(args)+1, 1, nil); err != nil {
+			t.Fatalf("%s: %v", sig, err)
+		}
+		ret := L.Get(-1)
+		L.Pop(1)
+		return ret
+	}
+	if got, _ := call("digest(bytes)", LString("0x616263")).(LBytes); got.String() != "0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("unexpected sha256 %v", got)
+	}
+	if got, _ := call("short(bytes)", LString("0x616263")).(LBytes); got.String() != "0x0000000000000000000000008eb208f7e05d987a9b044a8e98c6b087f15a0bfc" {
+		t.Fatalf("unexpected ripemd160 %v", got)
+	}
+	pub, _ := hex.DecodeString("e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652")
+	got := call("signer(bytes32,u8,bytes32,bytes32)",
+		LString("0xce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008"), LNumber("28"),
+		LString("0x90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e54998"),
+		LString("0x4a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc93"))
+	if got != PublicKeyAddress(pub) {
+		t.Fatalf("unexpected ecrecover %v", got)
+	}
+	got = call("approved(bytes32,bytes,bytes)",
+		LString("0xd75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"), LString("0x"),
+		LString("0xe5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b"))
+	if got != LTrue {
+		t.Fatalf("unexpected ed25519_verify %v", got)
+	}
+	a, b := keccak256Bytes([]byte("a")), keccak256Bytes([]byte("b"))
+	proof := L.NewTable()
+	proof.Append(LString("0x" + hex.EncodeToString(b)))
+	got = call("listed(bytes32,bytes32,bytes32[])",
+		LString("0x"+hex.EncodeToString(merkleProcessProof(a, [][]byte{b}))), LString("0x"+hex.EncodeToString(a)), proof)
+	if got != LTrue {
+		t.Fatalf("unexpected merkle_verify %v", got)
+	}
+}
+
+func TestCryptoBuiltinsSema(t *testing.T) {
+	cases := map[string]string{
+		"fn f(d: bytes) -> (r: bytes32) public pure { return sha256(d, d); }": "builtin 'sha256(bytes) -> bytes32' expects 1 argument(s), got 2",
+		"fn ecrecover() public { return; }":                                   "function name 'ecrecover' is reserved for a builtin",
+	}
+	for body, want := range cases {
+		src := "tol 0.2\ncontract C {\n  " + body + "\n}\n"
+		if _, err := CompileTOLToBytecode([]byte(src), "<tol>"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+}
+
+func TestEd25519Verify(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	// RFC 8032 §7.1, test 1 (empty message).
+	pub := "0xd75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	sig := "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b"
+	sigBytes, _ := hex.DecodeString(sig)
+
+	// S + L encodes the same scalar non-canonically.
+	l, _ := new(big.Int).SetString("1000000000000000000000000000000014def9dea2f79cd65812631a5cf5d3ed", 16)
+	sLE := sigBytes[32:]
+	sBE := make([]byte, 32)
+	for i := range sBE {
+		sBE[i] = sLE[31-i]
+	}
+	malleable := new(big.Int).Add(new(big.Int).SetBytes(sBE), l).FillBytes(make([]byte, 32))
+	for i := range sBE {
+		sBE[i] = malleable[31-i]
+	}
+	// A y coordinate of p + 1 is the non-canonical encoding of y = 1.
+	nonCanonical := "0xeeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"
+
+	L.SetGlobal("pub", LString(pub))
+	L.SetGlobal("sig", LString("0x"+sig))
+	L.SetGlobal("malleable", LString("0x"+hex.EncodeToString(sigBytes[:32])+hex.EncodeToString(sBE)))
+	L.SetGlobal("noncanonical", LString(nonCanonical))
+	err := L.DoString(`
+		assert(ed25519_verify(pub, "0x", sig) == true)
+		assert(ed25519_verify(pub, "0x00", sig) == false)
+		assert(ed25519_verify(pub, "0x", malleable) == false)
+		assert(ed25519_verify(noncanonical, "0x", sig) == false)
+		assert(ed25519_verify("0x1234", "0x", sig) == false)
+		assert(ed25519_verify(pub, "0x", "0x1234") == false)
+		assert(not pcall(ed25519_verify, pub, "0xzz", sig))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSecp256k1Verify(t *testing.T) {
+	d, _ := new(big.Int).SetString("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032", 16)
+	pub := secp256k1.PrivKeyFromBytes(d.Bytes()).PubKey()
+	raw := pub.SerializeUncompressed()[1:]
+	compressed := pub.SerializeCompressed()
+	hash := keccak256Bytes([]byte("tol secp256k1_verify"))
+	_, r, s := secpTestSign(hash, d)
+	high := new(big.Int).Sub(secp256k1.S256().N, s)
+	word := func(n *big.Int) string { return hex.EncodeToString(n.FillBytes(make([]byte, 32))) }
+
+	L := NewState()
+	defer L.Close()
+	L.SetGlobal("raw", LString("0x"+hex.EncodeToString(raw)))
+	L.SetGlobal("uncompressed", LString("0x04"+hex.EncodeToString(raw)))
+	L.SetGlobal("compressed", LString("0x"+hex.EncodeToString(compressed)))
+	L.SetGlobal("hash", LString("0x"+hex.EncodeToString(hash)))
+	L.SetGlobal("sig", LString("0x"+word(r)+word(s)))
+	L.SetGlobal("highs", LString("0x"+word(r)+word(high)))
+	err := L.DoString(`
+		assert(secp256k1_verify(raw, hash, sig) == true)
+		assert(secp256k1_verify(uncompressed, hash, sig) == true)
+		assert(secp256k1_verify(compressed, hash, sig) == true)
+		assert(secp256k1_verify(raw, hash, highs) == false)
+		assert(secp256k1_verify(raw, keccak256("0x00"), sig) == false)
+		assert(secp256k1_verify("0x02" .. string.rep("00", 32), hash, sig) == false)
+		assert(secp256k1_verify(raw, hash, sig .. "1b") == false)
+		assert(not pcall(secp256k1_verify, "zz", hash, sig))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignatureVerifyGas(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetGasLimit(1_000_000)
+	if err := L.DoString(`local ok = ed25519_verify("0x", "0x", "0x")`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GasUsed() < GasEd25519Verify {
+		t.Fatalf("expected ed25519_verify to charge %d gas, used %d", GasEd25519Verify, L.GasUsed())
+	}
+	L.SetGasLimit(GasSecp256k1Verify)
+	if err := L.DoString(`local ok = secp256k1_verify("0x", "0x00", "0x")`); err == nil || !strings.Contains(err.Error(), "gas limit exceeded") {
+		t.Fatalf("expected secp256k1_verify to exhaust a %d gas limit, got %v", GasSecp256k1Verify, err)
+	}
+}
+
+// merkleTestTree builds an OpenZeppelin-compatible sorted-pair tree and
+// returns its root and the proof of every leaf. Odd nodes are promoted.
+func merkleTestTree(leaves [][]byte) ([]byte, [][][]byte) {
+	proofs := make([][][]byte, len(leaves))
+	idx := make([]int, len(leaves))
+	for i := range idx {
+		idx[i] = i
+	}
+	level := leaves
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleProcessProof(level[i], [][]byte{level[i+1]}))
+		}
+		for leaf, pos := range idx {
+			if sib := pos ^ 1; sib < len(level) {
+				proofs[leaf] = append(proofs[leaf], level[sib])
+			}
+			idx[leaf] = pos / 2
+		}
+		level = next
+	}
+	return level[0], proofs
+}
+
+func TestMerkleVerify(t *testing.T) {
+	var leaves [][]byte
+	for i := 0; i < 11; i++ {
+		leaves = append(leaves, keccak256Bytes([]byte(fmt.Sprintf("tol.whitelist.%d", i))))
+	}
+	root, proofs := merkleTestTree(leaves)
+
+	L := NewState()
+	defer L.Close()
+	// Reference implementation as an interpreted keccak loop.
+	if err := L.DoString(`
+		function lua_verify(root, leaf, proof)
+			local h = leaf
+			for i = 1, #proof do
+				local p = proof[i]
+				if tostring(h) < tostring(p) then h = keccak256(h .. p) else h = keccak256(p .. h) end
+			end
+			return h == root
+		end
+	`); err != nil {
+		t.Fatal(err)
+	}
+	word := func(b []byte) LBytes { return LBytes(b) }
+	verify := func(fn string, leaf []byte, proof [][]byte, flat bool) (bool, uint64) {
+		t.Helper()
+		var arg LValue
+		if flat {
+			var sb strings.Builder
+			sb.WriteString("0x")
+			for _, p := range proof {
+				sb.WriteString(hex.EncodeToString(p))
+			}
+			arg = LString(sb.String())
+		} else {
+			tbl := L.NewTable()
+			for _, p := range proof {
+				tbl.Append(word(p))
+			}
+			arg = tbl
+		}
+		L.SetGasLimit(10_000_000)
+		if err := L.CallByParam(P{Fn: L.GetGlobal(fn), NRet: 1, Protect: true}, word(root), word(leaf), arg); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+		ok := L.Get(-1) == LTrue
+		L.Pop(1)
+		return ok, L.GasUsed()
+	}
+
+	for i, leaf := range leaves {
+		native, nativeGas := verify("merkle_verify", leaf, proofs[i], false)
+		flat, _ := verify("merkle_verify", leaf, proofs[i], true)
+		ref, refGas := verify("lua_verify", leaf, proofs[i], false)
+		if !native || !flat || !ref {
+			t.Fatalf("leaf %d: expected valid proof (native=%v flat=%v ref=%v)", i, native, flat, ref)
+		}
+		if nativeGas >= refGas {
+			t.Fatalf("leaf %d: expected native verification to be cheaper (%d >= %d)", i, nativeGas, refGas)
+		}
+		wrong := keccak256Bytes([]byte("not in tree"))
+		if native, _ := verify("merkle_verify", wrong, proofs[i], false); native {
+			t.Fatalf("leaf %d: expected a foreign leaf to be rejected", i)
+		}
+		if ref, _ := verify("lua_verify", wrong, proofs[i], false); ref {
+			t.Fatalf("leaf %d: reference accepted a foreign leaf", i)
+		}
+	}
+	if ok, _ := verify("merkle_verify", root, nil, false); !ok {
+		t.Fatalf("expected an empty proof to verify the root itself")
+	}
+	_, short := verify("merkle_verify", leaves[0], proofs[0][:1], false)
+	_, long := verify("merkle_verify", leaves[0], proofs[0], false)
+	if long-short != GasMerkleVerifyStep*uint64(len(proofs[0])-1) {
+		t.Fatalf("expected %d gas per proof element, got %d over %d elements", GasMerkleVerifyStep, long-short, len(proofs[0])-1)
+	}
+	if err := L.DoString(`merkle_verify("0x00", "0x00", "0x1234")`); err == nil {
+		t.Fatalf("expected a ragged flat proof to be rejected")
+	}
+}
+
+// TestMerkleVerifyOpenZeppelinVector checks the StandardMerkleTree example of
+// the @openzeppelin/merkle-tree README: leaves are
+// keccak256(keccak256(abi.encode(address, uint256))) of
+// [0x1111…1111, 5 ether] and [0x2222…2222, 2.5 ether].
+func TestMerkleVerifyOpenZeppelinVector(t *testing.T) {
+	const (
+		root  = "0xd4dee0beab2d53f2cc83e567171bd2820e49898130a22622b10ead383e90bd77"
+		leaf0 = "0xeb02c421cfa48976e66dfb29120745909ea3a0f843456c263cf8f1253483e283"
+		leaf1 = "0xb92c48e9d7abe27fd8dfd6b5dfdbfb1c9a463f80c712b66f3a5180a090cccafc"
+	)
+	encoded, _ := hex.DecodeString("0000000000000000000000001111111111111111111111111111111111111111" +
+		"0000000000000000000000000000000000000000000000004563918244f40000")
+	if got := "0x" + hex.EncodeToString(keccak256Bytes(keccak256Bytes(encoded))); got != leaf0 {
+		t.Fatalf("unexpected leaf hash %s", got)
+	}
+
+	L := NewState()
+	defer L.Close()
+	L.SetGlobal("root", LString(root))
+	L.SetGlobal("leaf0", LString(leaf0))
+	L.SetGlobal("leaf1", LString(leaf1))
+	if err := L.DoString(`
+		assert(merkle_verify(root, leaf0, {leaf1}) == true)
+		assert(merkle_verify(root, leaf1, {leaf0}) == true)
+		assert(merkle_verify(root, leaf0, {leaf0}) == false)
+	`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The signature benchmarks calibrate GasEcrecover and GasSecp256k1Verify
+// against BenchmarkGasUnit, the cost of one metered VM instruction.
+func BenchmarkEcrecover(b *testing.B) {
+	d, _ := new(big.Int).SetString("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032", 16)
+	hash := keccak256Bytes([]byte("tol ecrecover"))
+	recID, r, s := secpTestSign(hash, d)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := secp256k1Recover(hash, recID, r, s); !ok {
+			b.Fatal("recovery failed")
+		}
+	}
+}
+
+func BenchmarkSecp256k1Verify(b *testing.B) {
+	d, _ := new(big.Int).SetString("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032", 16)
+	pub := secp256k1.PrivKeyFromBytes(d.Bytes()).PubKey().SerializeCompressed()
+	hash := keccak256Bytes([]byte("tol secp256k1_verify"))
+	_, r, s := secpTestSign(hash, d)
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !secp256k1Verify(pub, hash, sig) {
+			b.Fatal("verification failed")
+		}
+	}
+}
+
+func BenchmarkEd25519Verify(b *testing.B) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	msg := []byte("tol ed25519_verify")
+	sig := ed25519.Sign(priv, msg)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !ed25519.Verify(pub, msg, sig) {
+			b.Fatal("verification failed")
+		}
+	}
+}
+
+// BenchmarkGasUnit measures the time of one unit of gas spent on VM
+// instructions, reported as ns/gas.
+func BenchmarkGasUnit(b *testing.B) {
+	L := NewState()
+	defer L.Close()
+	fn, err := L.LoadString(`local n = ... local x = 0 for i = 1, n do x = x + i end`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	L.SetGasLimit(1 << 62)
+	L.Push(fn)
+	L.Push(LNumber(fmt.Sprint(b.N)))
+	b.ResetTimer()
+	if err := L.PCall(1, 0, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(L.GasUsed()), "ns/gas")
+}
@@ -0,0 +1,262 @@
+package lua
+
+import (
+	"sort"
+	"strings"
+)
+
+// DebugAction tells a Debugger how to resume after a pause.
+type DebugAction int
+
+const (
+	// DebugContinue runs to the next breakpoint.
+	DebugContinue DebugAction = iota
+	// DebugStepIn pauses at the next source line, entering calls.
+	DebugStepIn
+	// DebugStepOver pauses at the next source line of the current function,
+	// or of a caller once it returns.
+	DebugStepOver
+	// DebugStepOut pauses at the next source line of a caller.
+	DebugStepOut
+	// DebugAbort stops execution with a "debugger: execution aborted" error.
+	DebugAbort
+)
+
+// Debugger is a Tracer pausing execution at breakpoints and after steps.
+// Execution pauses at the first instruction of a source line; while paused,
+// Pause inspects the state through the DebugPause it is given and returns
+// how to resume. Frames of nested contract calls are stepped into like
+// function calls.
+type Debugger struct {
+	NopTracer
+	// Positions, when set, resolves instructions to source positions, e.g.
+	// a TOL SourceMap; otherwise proto line information is used.
+	// Instructions without a position are never paused at.
+	Positions PositionResolver
+	// StopOnEntry pauses at the first positioned instruction.
+	StopOnEntry bool
+	// Pause is called at every pause; nil resumes with DebugContinue.
+	Pause func(p *DebugPause) DebugAction
+
+	breakpoints map[debugBreakpoint]struct{}
+	started     bool
+	action      DebugAction
+	from        debugLevel
+	last        map[*callFrame]SourcePosition
+}
+
+type debugBreakpoint struct {
+	file string
+	line int
+}
+
+// debugLevel orders steps by call depth: contract frame depth first, then
+// the function calls active in the state.
+type debugLevel struct {
+	depth  int
+	frames int
+}
+
+func (l debugLevel) less(o debugLevel) bool {
+	if l.depth != o.depth {
+		return l.depth < o.depth
+	}
+	return l.frames < o.frames
+}
+
+// DebugPause describes a paused execution. It is only valid during the
+// Pause callback.
+type DebugPause struct {
+	// Reason is "entry", "breakpoint" or "step".
+	Reason   string
+	Position SourcePosition
+	L        *LState
+	Step     *TraceStep
+
+	d *Debugger
+}
+
+// DebugVariable is a named value visible at a pause.
+type DebugVariable struct {
+	Name  string
+	Value LValue
+}
+
+// NewDebugger returns a debugger resolving positions with positions, which
+// may be nil.
+func NewDebugger(positions PositionResolver) *Debugger {
+	return &Debugger{Positions: positions}
+}
+
+// SetBreakpoint pauses execution at line of file. An empty file matches
+// every file; otherwise file matches positions in that file, or ending in
+// "/" + file.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	if d.breakpoints == nil {
+		d.breakpoints = map[debugBreakpoint]struct{}{}
+	}
+	d.breakpoints[debugBreakpoint{file: file, line: line}] = struct{}{}
+}
+
+// ClearBreakpoint removes a breakpoint set with the same arguments and
+// reports whether there was one.
+func (d *Debugger) ClearBreakpoint(file string, line int) bool {
+	bp := debugBreakpoint{file: file, line: line}
+	if _, ok := d.breakpoints[bp]; !ok {
+		return false
+	}
+	delete(d.breakpoints, bp)
+	return true
+}
+
+// Breakpoints returns the breakpoints, by file and line.
+func (d *Debugger) Breakpoints() []SourcePosition {
+	out := make([]SourcePosition, 0, len(d.breakpoints))
+	for bp := range d.breakpoints {
+		out = append(out, SourcePosition{File: bp.file, Line: bp.line})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].Line < out[j].Line
+	})
+	return out
+}
+
+func (d *Debugger) OnStep(L *LState, step *TraceStep) {
+	pos, ok := d.position(step.Proto, step.Pc)
+	if !ok {
+		return
+	}
+	// Only the first instruction of a line in a call may pause; a call
+	// always starts at pc 0, so entries of reused frames are not stale.
+	if d.last == nil {
+		d.last = map[*callFrame]SourcePosition{}
+	}
+	prev, seen := d.last[step.frame]
+	d.last[step.frame] = pos
+	if seen && step.Pc != 0 && prev == pos {
+		return
+	}
+
+	level := debugLevel{depth: step.Depth, frames: step.Frames}
+	reason := d.pauseReason(pos, level)
+	if reason == "" {
+		return
+	}
+	action := DebugContinue
+	if d.Pause != nil {
+		action = d.Pause(&DebugPause{Reason: reason, Position: pos, L: L, Step: step, d: d})
+	}
+	d.action, d.from = action, level
+	if action == DebugAbort {
+		// Fail like the paused instruction would, so that the error points
+		// at its line.
+		step.frame.Pc++
+		L.RaiseError("debugger: execution aborted")
+	}
+}
+
+func (d *Debugger) pauseReason(pos SourcePosition, level debugLevel) string {
+	entry := !d.started
+	d.started = true
+	switch {
+	case entry && d.StopOnEntry:
+		return "entry"
+	case d.hasBreakpoint(pos):
+		return "breakpoint"
+	case d.action == DebugStepIn:
+		return "step"
+	case d.action == DebugStepOver && !d.from.less(level):
+		return "step"
+	case d.action == DebugStepOut && level.less(d.from):
+		return "step"
+	}
+	return ""
+}
+
+func (d *Debugger) hasBreakpoint(pos SourcePosition) bool {
+	for bp := range d.breakpoints {
+		if bp.line == pos.Line && (bp.file == "" || bp.file == pos.File || strings.HasSuffix(pos.File, "/"+bp.file)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) position(proto *FunctionProto, pc int) (SourcePosition, bool) {
+	if d.Positions != nil {
+		return d.Positions.ResolvePosition(proto, pc)
+	}
+	if pc < 0 || pc >= len(proto.DbgSourcePositions) || proto.DbgSourcePositions[pc] <= 0 {
+		return SourcePosition{}, false
+	}
+	return SourcePosition{File: proto.SourceName, Line: proto.DbgSourcePositions[pc]}, true
+}
+
+// Locals returns the local variables in scope in the paused function, in
+// declaration order. Compiler temporaries and TOL runtime names are left
+// out.
+func (p *DebugPause) Locals() []DebugVariable {
+	regs := p.Step.Registers()
+	pc := p.Step.Pc
+	var out []DebugVariable
+	byReg := map[int]int{}
+	for _, li := range p.Step.Proto.DbgLocals {
+		if li.StartPc > pc || (li.EndPc > 0 && pc > li.EndPc) || li.Reg >= len(regs) {
+			continue
+		}
+		if strings.HasPrefix(li.Name, "(") || strings.HasPrefix(li.Name, "__tol") {
+			continue
+		}
+		v := DebugVariable{Name: li.Name, Value: regs[li.Reg]}
+		// A later declaration in the same register shadows the earlier.
+		if i, ok := byReg[li.Reg]; ok {
+			out[i] = v
+			continue
+		}
+		byReg[li.Reg] = len(out)
+		out = append(out, v)
+	}
+	return out
+}
+
+// Local returns the value of the local variable name in scope.
+func (p *DebugPause) Local(name string) (LValue, bool) {
+	locals := p.Locals()
+	for i := len(locals) - 1; i >= 0; i-- {
+		if locals[i].Name == name {
+			return locals[i].Value, true
+		}
+	}
+	return LNil, false
+}
+
+// Storage returns the value of a slot of the paused contract's TOL storage,
+// zero for unset slots, and false when the function sees no storage.
+func (p *DebugPause) Storage(slot string) (LValue, bool) {
+	tb := p.L.frameStorage(p.Step.frame)
+	if tb == nil {
+		return LNil, false
+	}
+	return storageValue(tb.RawGetString(strings.ToLower(slot))), true
+}
+
+// Backtrace returns the positions of the active calls of the paused state,
+// innermost first. Calls without a position are left out.
+func (p *DebugPause) Backtrace() []SourcePosition {
+	var out []SourcePosition
+	pc := p.Step.Pc
+	for cf := p.Step.frame; cf != nil; cf = cf.Parent {
+		if !cf.Fn.IsG {
+			if pos, ok := p.d.position(cf.Fn.Proto, pc); ok {
+				out = append(out, pos)
+			}
+		}
+		if cf.Parent != nil {
+			pc = cf.Parent.Pc - 1
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+const debugVaultSource = `
+tol 0.2
+contract Vault {
+  storage {
+    slot total: u256;
+    slot balances: mapping(address => u256);
+  }
+  fn double(x: u256) -> (r: u256) internal {
+    let y: u256 = x + x;
+    return y;
+  }
+  fn deposit(who: address, amount: u256) public {
+    let twice: u256 = double(amount);
+    set balances[who] = twice;
+    set total = total + twice;
+    return;
+  }
+}
+`
+
+type debugStop struct {
+	reason   string
+	line     int
+	function string
+	locals   map[string]string
+	total    string
+	balance  string
+	frames   int
+}
+
+func TestDebuggerStepsThroughTOL(t *testing.T) {
+	bc, sm, err := CompileTOLToBytecodeWithSourceMap([]byte(debugVaultSource), "vault.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	L.SetContractFrame(hostCounterAddr, 0)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+
+	totalSlot := computeBaseSlotHash("Vault", "total")
+	balanceSlot, err := MappingSlot(computeBaseSlotHash("Vault", "balances"), hostCallerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := []DebugAction{DebugStepIn, DebugStepOver, DebugStepOut, DebugStepOver, DebugContinue, DebugContinue}
+	var stops []debugStop
+	d := NewDebugger(sm)
+	d.StopOnEntry = true
+	d.SetBreakpoint("vault.tol", 16)
+	d.Pause = func(p *DebugPause) DebugAction {
+		stop := debugStop{reason: p.Reason, line: p.Position.Line, function: p.Position.Function, locals: map[string]string{}, frames: len(p.Backtrace())}
+		for _, v := range p.Locals() {
+			stop.locals[v.Name] = v.Value.String()
+		}
+		total, _ := p.Storage(totalSlot)
+		balance, _ := p.Storage(balanceSlot)
+		stop.total, stop.balance = total.String(), balance.String()
+		stops = append(stops, stop)
+		if len(actions) == 0 {
+			return DebugContinue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+	L.SetTracer(d)
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("deposit(address,u256)")))
+	L.Push(hostCallerAddr)
+	L.Push(LNumber("5"))
+	if err := L.PCall(3, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []debugStop{
+		{reason: "entry", line: 13, function: "Vault.deposit", total: "0", balance: "0", frames: 1},
+		{reason: "step", line: 9, function: "Vault.double", total: "0", balance: "0", frames: 2},
+		{reason: "step", line: 10, function: "Vault.double", total: "0", balance: "0", frames: 2},
+		{reason: "step", line: 14, function: "Vault.deposit", total: "0", balance: "0", frames: 1},
+		{reason: "step", line: 15, function: "Vault.deposit", total: "0", balance: "10", frames: 1},
+		{reason: "breakpoint", line: 16, function: "Vault.deposit", total: "10", balance: "10", frames: 1},
+	}
+	if len(stops) != len(want) {
+		t.Fatalf("got %d stops, want %d: %+v", len(stops), len(want), stops)
+	}
+	for i, w := range want {
+		got := stops[i]
+		if got.reason != w.reason || got.line != w.line || got.function != w.function || got.total != w.total || got.balance != w.balance || got.frames != w.frames {
+			t.Fatalf("stop %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if stops[0].locals["amount"] != "5" || stops[1].locals["x"] != "5" || stops[2].locals["y"] != "10" || stops[3].locals["twice"] != "10" {
+		t.Fatalf("unexpected locals: %+v", stops)
+	}
+	if _, ok := stops[1].locals["twice"]; ok {
+		t.Fatalf("caller locals leaked into the callee: %+v", stops[1].locals)
+	}
+}
+
+func TestDebuggerAbort(t *testing.T) {
+	bc, sm, err := CompileTOLToBytecodeWithSourceMap([]byte(debugVaultSource), "vault.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	L.SetContractFrame(hostCounterAddr, 0)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDebugger(sm)
+	d.SetBreakpoint("", 15)
+	d.Pause = func(p *DebugPause) DebugAction { return DebugAbort }
+	L.SetTracer(d)
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("deposit(address,u256)")))
+	L.Push(hostCallerAddr)
+	L.Push(LNumber("5"))
+	err = L.PCall(3, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "vault.tol:15: debugger: execution aborted") {
+		t.Fatalf("expected the debugger to abort execution, got %v", err)
+	}
+	if !d.ClearBreakpoint("", 15) || d.ClearBreakpoint("", 15) || len(d.Breakpoints()) != 0 {
+		t.Fatal("unexpected breakpoint bookkeeping")
+	}
+}
@@ -0,0 +1,388 @@
+package lua
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SourcePosition is a location in a source file, optionally naming the
+// enclosing function.
+type SourcePosition struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function,omitempty"`
+}
+
+// PositionResolver maps instructions to source positions, e.g. to the TOL
+// source a function was lowered from.
+type PositionResolver interface {
+	// ResolvePosition returns the position of instruction pc of proto, and
+	// false when it has none.
+	ResolvePosition(proto *FunctionProto, pc int) (SourcePosition, bool)
+}
+
+// GasProfiler is a Tracer attributing the gas used by each instruction to
+// the function and source line executing it, together with the call stack
+// leading there. Frames of nested contract calls are nested below the
+// caller's call site. Only metered states (see SetGasLimit) are charged.
+//
+// Positions come from the line information of each FunctionProto unless
+// Positions resolves them; resolve TOL bytecode through its source map to
+// attribute gas to `.tol` lines.
+type GasProfiler struct {
+	NopTracer
+	// Positions, when set, takes precedence over proto line information.
+	Positions PositionResolver
+
+	funcs     map[profFunc]uint64
+	funcList  []profFunc
+	locs      map[profLoc]uint64
+	locList   []profLoc
+	samples   map[string]*profSample
+	sampleIDs []string
+	states    map[*LState]*profState
+	frames    []*profFrame
+	last      *profState
+}
+
+type profFunc struct {
+	name      string
+	file      string
+	startLine int
+}
+
+type profLoc struct {
+	fn   uint64
+	line int
+}
+
+type profSample struct {
+	stack []uint64 // location ids, leaf first
+	gas   uint64
+	steps uint64
+}
+
+// profState tracks the instruction of a state whose cost is not known yet:
+// it is the gas used between its step and the state's next step, less the
+// gas of the contract frames it called.
+type profState struct {
+	L          *LState
+	prefix     []uint64
+	pending    []uint64
+	hasPending bool
+	pendingGas uint64
+	childGas   uint64
+}
+
+type profFrame struct {
+	prefix []uint64
+	caller *profState
+	state  *profState
+}
+
+// NewGasProfiler returns an empty profiler; attach it with SetTracer or
+// pass it to a host as a call's tracer.
+func NewGasProfiler() *GasProfiler {
+	return &GasProfiler{
+		funcs:   map[profFunc]uint64{},
+		locs:    map[profLoc]uint64{},
+		samples: map[string]*profSample{},
+		states:  map[*LState]*profState{},
+	}
+}
+
+func (p *GasProfiler) OnStep(L *LState, step *TraceStep) {
+	st := p.states[L]
+	if st == nil {
+		st = &profState{L: L}
+		if n := len(p.frames); n > 0 && p.frames[n-1].state == nil {
+			st.prefix = p.frames[n-1].prefix
+			p.frames[n-1].state = st
+		}
+		p.states[L] = st
+	}
+	p.settle(st, step.GasUsed)
+	st.pending = p.stack(L, step, st.prefix)
+	st.pendingGas = step.GasUsed
+	st.hasPending = true
+	p.last = st
+}
+
+func (p *GasProfiler) OnEnter(call *TraceCall) {
+	prefix := []uint64{p.location(profFunc{name: fmt.Sprintf("%s %s", call.Kind, call.To)}, 0)}
+	if p.last != nil && p.last.hasPending {
+		prefix = append(prefix, p.last.pending...)
+	}
+	p.frames = append(p.frames, &profFrame{prefix: prefix, caller: p.last})
+}
+
+func (p *GasProfiler) OnExit(call *TraceCall, res *TraceResult) {
+	n := len(p.frames)
+	if n == 0 {
+		return
+	}
+	f := p.frames[n-1]
+	p.frames = p.frames[:n-1]
+	if f.state != nil {
+		p.settle(f.state, f.state.L.gasUsed)
+		delete(p.states, f.state.L)
+	}
+	if f.caller != nil {
+		f.caller.childGas += res.GasUsed
+	}
+	p.last = f.caller
+}
+
+// Flush attributes the last instruction of every traced top-level state.
+// Call it once execution has finished; the report methods flush as well.
+func (p *GasProfiler) Flush() {
+	for _, st := range p.states {
+		p.settle(st, st.L.gasUsed)
+	}
+}
+
+func (p *GasProfiler) settle(st *profState, gasUsed uint64) {
+	if !st.hasPending {
+		return
+	}
+	st.hasPending = false
+	var cost uint64
+	if gasUsed > st.pendingGas {
+		cost = gasUsed - st.pendingGas
+	}
+	if st.childGas >= cost {
+		cost = 0
+	} else {
+		cost -= st.childGas
+	}
+	st.childGas = 0
+
+	var key strings.Builder
+	for _, id := range st.pending {
+		fmt.Fprintf(&key, "%d,", id)
+	}
+	s := p.samples[key.String()]
+	if s == nil {
+		s = &profSample{stack: st.pending}
+		p.samples[key.String()] = s
+		p.sampleIDs = append(p.sampleIDs, key.String())
+	}
+	s.gas += cost
+	s.steps++
+}
+
+// stack returns the location ids of the call stack of step, leaf first.
+func (p *GasProfiler) stack(L *LState, step *TraceStep, prefix []uint64) []uint64 {
+	var out []uint64
+	pc := step.Pc
+	for cf := step.frame; cf != nil; cf = cf.Parent {
+		if cf.Fn.IsG {
+			out = append(out, p.location(profFunc{name: L.rawFrameFuncName(cf), file: "[G]"}, 0))
+		} else {
+			fn, line := p.position(L, cf, pc)
+			out = append(out, p.location(fn, line))
+		}
+		if cf.Parent != nil {
+			pc = cf.Parent.Pc - 1
+		}
+	}
+	return append(out, prefix...)
+}
+
+func (p *GasProfiler) position(L *LState, cf *callFrame, pc int) (profFunc, int) {
+	proto := cf.Fn.Proto
+	fn := profFunc{name: L.rawFrameFuncName(cf), file: proto.SourceName, startLine: proto.LineDefined}
+	line := 0
+	if pc >= 0 && pc < len(proto.DbgSourcePositions) {
+		line = proto.DbgSourcePositions[pc]
+	}
+	if p.Positions != nil {
+		if pos, ok := p.Positions.ResolvePosition(proto, pc); ok {
+			fn.file, line = pos.File, pos.Line
+			if pos.Function != "" {
+				fn.name, fn.startLine = pos.Function, 0
+			}
+		}
+	}
+	return fn, line
+}
+
+func (p *GasProfiler) location(fn profFunc, line int) uint64 {
+	fid, ok := p.funcs[fn]
+	if !ok {
+		p.funcList = append(p.funcList, fn)
+		fid = uint64(len(p.funcList))
+		p.funcs[fn] = fid
+	}
+	loc := profLoc{fn: fid, line: line}
+	lid, ok := p.locs[loc]
+	if !ok {
+		p.locList = append(p.locList, loc)
+		lid = uint64(len(p.locList))
+		p.locs[loc] = lid
+	}
+	return lid
+}
+
+// GasProfileEntry is the gas attributed to a function or a source line.
+// Flat counts the entry's own instructions, Cum also those of the
+// functions it called.
+type GasProfileEntry struct {
+	Function string
+	File     string
+	Line     int
+	Flat     uint64
+	Cum      uint64
+	Steps    uint64
+}
+
+// Total returns the gas and the number of instructions profiled.
+func (p *GasProfiler) Total() (gas, steps uint64) {
+	p.Flush()
+	for _, s := range p.samples {
+		gas += s.gas
+		steps += s.steps
+	}
+	return gas, steps
+}
+
+// Functions returns the gas per function, by decreasing flat gas.
+func (p *GasProfiler) Functions() []GasProfileEntry {
+	return p.entries(func(loc profLoc) profLoc { return profLoc{fn: loc.fn} })
+}
+
+// Lines returns the gas per source line, by decreasing flat gas.
+func (p *GasProfiler) Lines() []GasProfileEntry {
+	return p.entries(func(loc profLoc) profLoc { return loc })
+}
+
+func (p *GasProfiler) entries(key func(profLoc) profLoc) []GasProfileEntry {
+	p.Flush()
+	byKey := map[profLoc]*GasProfileEntry{}
+	get := func(k profLoc) *GasProfileEntry {
+		e := byKey[k]
+		if e == nil {
+			fn := p.funcList[k.fn-1]
+			e = &GasProfileEntry{Function: fn.name, File: fn.file, Line: k.line}
+			byKey[k] = e
+		}
+		return e
+	}
+	for _, id := range p.sampleIDs {
+		s := p.samples[id]
+		if len(s.stack) == 0 {
+			continue
+		}
+		leaf := get(key(p.locList[s.stack[0]-1]))
+		leaf.Flat += s.gas
+		leaf.Steps += s.steps
+		seen := map[profLoc]bool{}
+		for _, lid := range s.stack {
+			k := key(p.locList[lid-1])
+			if !seen[k] {
+				seen[k] = true
+				get(k).Cum += s.gas
+			}
+		}
+	}
+	out := make([]GasProfileEntry, 0, len(byKey))
+	for _, e := range byKey {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Flat != b.Flat {
+			return a.Flat > b.Flat
+		}
+		if a.Cum != b.Cum {
+			return a.Cum > b.Cum
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		return a.Line < b.Line
+	})
+	return out
+}
+
+// WriteFolded writes one line per call stack in the folded format read by
+// flame graph tools: frames from the root, separated by ';', then the gas.
+func (p *GasProfiler) WriteFolded(w io.Writer) error {
+	p.Flush()
+	lines := make([]string, 0, len(p.samples))
+	for _, id := range p.sampleIDs {
+		s := p.samples[id]
+		if s.gas == 0 {
+			continue
+		}
+		frames := make([]string, len(s.stack))
+		for i, lid := range s.stack {
+			frames[len(s.stack)-1-i] = p.frameLabel(lid)
+		}
+		lines = append(lines, fmt.Sprintf("%s %d", strings.Join(frames, ";"), s.gas))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *GasProfiler) frameLabel(lid uint64) string {
+	loc := p.locList[lid-1]
+	fn := p.funcList[loc.fn-1]
+	if fn.file == "" || fn.file == "[G]" {
+		return fn.name
+	}
+	return fmt.Sprintf("%s (%s:%d)", fn.name, fn.file, loc.line)
+}
+
+// WriteSummary writes a text report: the total, the functions and source
+// lines using the most gas (at most top of each; zero means all), and the
+// folded call stacks.
+func (p *GasProfiler) WriteSummary(w io.Writer, top int) error {
+	gas, steps := p.Total()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "total gas %d over %d instructions\n", gas, steps)
+	percent := func(n uint64) float64 {
+		if gas == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(gas)
+	}
+	limit := func(entries []GasProfileEntry) []GasProfileEntry {
+		if top > 0 && len(entries) > top {
+			return entries[:top]
+		}
+		return entries
+	}
+
+	fmt.Fprintf(&sb, "\n%10s %6s %10s %6s  %s\n", "flat", "flat%", "cum", "cum%", "function")
+	for _, e := range limit(p.Functions()) {
+		name := e.Function
+		if e.File != "" && e.File != "[G]" {
+			name = fmt.Sprintf("%s (%s)", e.Function, e.File)
+		}
+		fmt.Fprintf(&sb, "%10d %5.1f%% %10d %5.1f%%  %s\n", e.Flat, percent(e.Flat), e.Cum, percent(e.Cum), name)
+	}
+	fmt.Fprintf(&sb, "\n%10s %6s %8s  %s\n", "flat", "flat%", "steps", "line")
+	for _, e := range limit(p.Lines()) {
+		if e.Flat == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%10d %5.1f%% %8d  %s:%d (%s)\n", e.Flat, percent(e.Flat), e.Steps, e.File, e.Line, e.Function)
+	}
+	sb.WriteString("\n")
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+	return p.WriteFolded(w)
+}
@@ -0,0 +1,118 @@
+package lua
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// WriteProfile writes the profile in the gzipped protobuf format of pprof,
+// with two sample values per call stack: "gas" and "instructions". Read it
+// with `go tool pprof`.
+func (p *GasProfiler) WriteProfile(w io.Writer) error {
+	p.Flush()
+	var b protoBuf
+	strs := map[string]int64{}
+	var strList []string
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = int64(len(strList))
+		strList = append(strList, s)
+		return strs[s]
+	}
+	str("")
+
+	valueType := func(typ, unit string) []byte {
+		var vt protoBuf
+		vt.int64(1, str(typ))
+		vt.int64(2, str(unit))
+		return vt.data
+	}
+	b.message(1, valueType("gas", "gas"))            // sample_type
+	b.message(1, valueType("instructions", "count")) // sample_type
+	for _, id := range p.sampleIDs {
+		s := p.samples[id]
+		var sb protoBuf
+		sb.packedUint64(1, s.stack)                              // location_id
+		sb.packedInt64(2, []int64{int64(s.gas), int64(s.steps)}) // value
+		b.message(2, sb.data)                                    // sample
+	}
+	for i, loc := range p.locList {
+		var line protoBuf
+		line.uint64(1, loc.fn)         // function_id
+		line.int64(2, int64(loc.line)) // line
+		var lb protoBuf
+		lb.uint64(1, uint64(i+1)) // id
+		lb.message(4, line.data)  // line
+		b.message(4, lb.data)     // location
+	}
+	for i, fn := range p.funcList {
+		var fb protoBuf
+		fb.uint64(1, uint64(i+1))        // id
+		fb.int64(2, str(fn.name))        // name
+		fb.int64(3, str(fn.name))        // system_name
+		fb.int64(4, str(fn.file))        // filename
+		fb.int64(5, int64(fn.startLine)) // start_line
+		b.message(5, fb.data)            // function
+	}
+	b.message(11, valueType("gas", "gas")) // period_type
+	b.int64(12, 1)                         // period
+	b.int64(14, str("gas"))                // default_sample_type
+	for _, s := range strList {
+		b.bytes(6, []byte(s)) // string_table
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuf encodes protocol buffer fields. Zero scalars are omitted, as
+// proto3 does.
+type protoBuf struct {
+	data []byte
+}
+
+func (b *protoBuf) key(field, wire int) {
+	b.data = binary.AppendUvarint(b.data, uint64(field)<<3|uint64(wire))
+}
+
+func (b *protoBuf) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+func (b *protoBuf) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protoBuf) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.data = binary.AppendUvarint(b.data, uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuf) message(field int, v []byte) { b.bytes(field, v) }
+
+func (b *protoBuf) packedUint64(field int, vs []uint64) {
+	var p protoBuf
+	for _, v := range vs {
+		p.data = binary.AppendUvarint(p.data, v)
+	}
+	b.bytes(field, p.data)
+}
+
+func (b *protoBuf) packedInt64(field int, vs []int64) {
+	var p protoBuf
+	for _, v := range vs {
+		p.data = binary.AppendUvarint(p.data, uint64(v))
+	}
+	b.bytes(field, p.data)
+}
@@ -0,0 +1,138 @@
+package lua
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+const gasProfileScript = `
+local function fib(n)
+  if n < 2 then return n end
+  return fib(n - 1) + fib(n - 2)
+end
+local function sum(n)
+  local s = 0
+  for i = 1, n do s = s + i end
+  return s
+end
+fib(10)
+sum(100)
+`
+
+func TestGasProfilerAttributesFunctionsAndLines(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	prof := NewGasProfiler()
+	L.SetTracer(prof)
+	L.SetGasLimit(1_000_000)
+	if err := L.DoString(gasProfileScript); err != nil {
+		t.Fatal(err)
+	}
+	gas, steps := prof.Total()
+	if gas != L.GasUsed() || steps != L.GasUsed() {
+		t.Fatalf("profiled %d gas over %d steps, state used %d", gas, steps, L.GasUsed())
+	}
+
+	funcs := map[string]GasProfileEntry{}
+	for _, e := range prof.Functions() {
+		funcs[e.Function] = e
+	}
+	fib, sum, main := funcs["fib"], funcs["sum"], funcs["main chunk"]
+	if fib.Flat == 0 || fib.Flat != fib.Cum || sum.Flat == 0 || main.Cum != gas || fib.Flat+sum.Flat+main.Flat != gas {
+		t.Fatalf("unexpected function profile: %+v", prof.Functions())
+	}
+	if prof.Functions()[0].Function != "fib" {
+		t.Fatalf("expected fib to be the hottest function, got %+v", prof.Functions()[0])
+	}
+	var loopGas uint64
+	for _, e := range prof.Lines() {
+		if e.Line == 8 {
+			loopGas += e.Flat
+		}
+	}
+	if loopGas == 0 || loopGas > sum.Flat {
+		t.Fatalf("unexpected gas on the loop line: %d of %d", loopGas, sum.Flat)
+	}
+
+	var summary bytes.Buffer
+	if err := prof.WriteSummary(&summary, 5); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary.String(), "fib (<string>)") || !strings.Contains(summary.String(), "main chunk (<string>:11);fib (<string>:4);fib (<string>:4) ") {
+		t.Fatalf("unexpected summary:\n%s", summary.String())
+	}
+}
+
+func TestGasProfilerNestsContractFrames(t *testing.T) {
+	h := newTracerTestHost(t)
+	prof := NewGasProfiler()
+	L := NewState()
+	defer L.Close()
+	L.SetTracer(prof)
+	L.SetGasLimit(1_000_000)
+	h.Attach(L, hostCallerAddr)
+	L.SetGlobal("target", hostCounterAddr)
+	L.SetGlobal("data", mustCallData(t, "add(u256)", LNumber("2")))
+	if err := L.DoString(`ok = call(target, 0, data)`); err != nil || L.GetGlobal("ok") != LTrue {
+		t.Fatalf("call failed: %v", err)
+	}
+	gas, _ := prof.Total()
+	if gas != L.GasUsed() {
+		t.Fatalf("profiled %d gas, caller used %d", gas, L.GasUsed())
+	}
+	var frame GasProfileEntry
+	for _, e := range prof.Functions() {
+		if e.Function == "call "+string(hostCounterAddr) {
+			frame = e
+		}
+	}
+	if frame.Cum == 0 || frame.Flat != 0 || frame.Cum >= gas {
+		t.Fatalf("expected the callee frame to be nested, got %+v", prof.Functions())
+	}
+}
+
+type fixedPositions struct{}
+
+func (fixedPositions) ResolvePosition(proto *FunctionProto, pc int) (SourcePosition, bool) {
+	if proto.LineDefined == 0 {
+		return SourcePosition{}, false
+	}
+	return SourcePosition{File: "lib.tol", Line: 7, Function: "Lib.work"}, true
+}
+
+func TestGasProfilerPositionsAndPprofOutput(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	prof := NewGasProfiler()
+	prof.Positions = fixedPositions{}
+	L.SetTracer(prof)
+	L.SetGasLimit(1_000_000)
+	if err := L.DoString(gasProfileScript); err != nil {
+		t.Fatal(err)
+	}
+	lines := prof.Lines()
+	if lines[0].File != "lib.tol" || lines[0].Line != 7 || lines[0].Function != "Lib.work" {
+		t.Fatalf("expected resolved positions, got %+v", lines[0])
+	}
+
+	var buf bytes.Buffer
+	if err := prof.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"gas", "instructions", "Lib.work", "lib.tol", "main chunk"} {
+		if !bytes.Contains(raw, []byte(s)) {
+			t.Fatalf("profile lacks string %q", s)
+		}
+	}
+}
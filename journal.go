@@ -0,0 +1,153 @@
+package lua
+
+// StorageJournal records TOL storage writes and emitted logs so that the
+// effects of a failed frame can be undone. Hosts share one journal across
+// all frames of a transaction: each frame takes a Snapshot on entry and
+// calls RevertToSnapshot when it fails.
+type StorageJournal struct {
+	entries   []journalEntry
+	logs      []LogEntry
+	snapshots []journalMark
+}
+
+// LogEntry is an event emitted by a contract frame.
+type LogEntry struct {
+	Address LAddress
+	Event   string
+	Args    []LValue
+}
+
+type journalEntry struct {
+	table *LTable
+	key   LValue
+	prev  LValue
+	undo  func()
+}
+
+type journalMark struct {
+	entries int
+	logs    int
+}
+
+// NewStorageJournal returns an empty journal.
+func NewStorageJournal() *StorageJournal {
+	return &StorageJournal{}
+}
+
+// Snapshot returns an id identifying the current journal position.
+func (j *StorageJournal) Snapshot() int {
+	j.snapshots = append(j.snapshots, journalMark{entries: len(j.entries), logs: len(j.logs)})
+	return len(j.snapshots) - 1
+}
+
+// RevertToSnapshot undoes every write and discards every log recorded
+// since Snapshot returned id. Snapshots taken after id are invalidated.
+// Unknown ids are ignored.
+func (j *StorageJournal) RevertToSnapshot(id int) {
+	if id < 0 || id >= len(j.snapshots) {
+		return
+	}
+	mark := j.snapshots[id]
+	for i := len(j.entries) - 1; i >= mark.entries; i-- {
+		e := j.entries[i]
+		if e.undo != nil {
+			e.undo()
+			continue
+		}
+		e.table.RawSet(e.key, e.prev)
+	}
+	j.entries = j.entries[:mark.entries]
+	j.logs = j.logs[:mark.logs]
+	j.snapshots = j.snapshots[:id]
+}
+
+// RecordWrite records the current value of tbl[key] ahead of a write.
+func (j *StorageJournal) RecordWrite(tbl *LTable, key LValue) {
+	j.entries = append(j.entries, journalEntry{table: tbl, key: key, prev: tbl.RawGet(key)})
+}
+
+// RecordUndo records a host-defined change (a balance transfer, a new
+// account) together with the function that reverses it.
+func (j *StorageJournal) RecordUndo(undo func()) {
+	j.entries = append(j.entries, journalEntry{undo: undo})
+}
+
+// AddLog records an emitted log.
+func (j *StorageJournal) AddLog(log LogEntry) {
+	j.logs = append(j.logs, log)
+}
+
+// Logs returns the logs emitted and not reverted, in emission order.
+func (j *StorageJournal) Logs() []LogEntry {
+	return append([]LogEntry(nil), j.logs...)
+}
+
+// Reset commits the journal: recorded writes become permanent and the
+// journal is emptied, logs included.
+func (j *StorageJournal) Reset() {
+	j.entries = nil
+	j.logs = nil
+	j.snapshots = nil
+}
+
+// SetJournal attaches a journal that records the state's TOL storage writes
+// and logs. With a journal attached, Lua `pcall`/`xpcall` and AtomicPCall
+// undo the writes of a failed call.
+func (ls *LState) SetJournal(j *StorageJournal) { ls.journal = j }
+
+// Journal returns the attached journal, or nil.
+func (ls *LState) Journal() *StorageJournal { return ls.journal }
+
+// AtomicPCall is PCall that reverts the attached journal to its state
+// before the call when the call fails, as used for a top-level invoke.
+func (ls *LState) AtomicPCall(nargs, nret int, errfunc *LFunction) error {
+	j := ls.journal
+	if j == nil {
+		return ls.PCall(nargs, nret, errfunc)
+	}
+	id := j.Snapshot()
+	err := ls.PCall(nargs, nret, errfunc)
+	if err != nil {
+		j.RevertToSnapshot(id)
+	}
+	return err
+}
+
+// openJournal registers the journaled storage hook and the default log sink.
+func openJournal(L *LState) {
+	L.SetGlobal("__tol_journal_write", L.NewFunction(tolJournalWrite))
+	L.SetGlobal("emit", L.NewFunction(tolEmit))
+}
+
+// tolJournalWrite implements __tol_journal_write(tbl, key), called by the
+// storage prelude before every write.
+func tolJournalWrite(L *LState) int {
+	tbl := L.CheckTable(1)
+	key := L.CheckAny(2)
+	if L.journal != nil {
+		L.journal.RecordWrite(tbl, key)
+	}
+	return 0
+}
+
+// tolEmit implements the default emit(event, args...): it records a log in
+// the attached journal and reports it to the tracer, and is a no-op without
+// either. Hosts may replace it.
+func tolEmit(L *LState) int {
+	event := L.CheckString(1)
+	if L.journal == nil && L.tracer == nil {
+		return 0
+	}
+	args := make([]LValue, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		args = append(args, L.Get(i))
+	}
+	log := LogEntry{Address: L.contractAddr, Event: event, Args: args}
+	if L.tracer != nil {
+		L.tracer.OnLog(L, log)
+	}
+	if L.journal != nil {
+		L.journal.AddLog(log)
+	}
+	return 0
+}
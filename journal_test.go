@@ -0,0 +1,131 @@
+package lua
+
+import (
+	"testing"
+)
+
+func TestStorageJournalSnapshotRevert(t *testing.T) {
+	j := NewStorageJournal()
+	tbl := newLTable(0, 0)
+	write := func(k string, v LValue) {
+		j.RecordWrite(tbl, LString(k))
+		tbl.RawSetString(k, v)
+	}
+	write("a", LNumber("1"))
+	outer := j.Snapshot()
+	write("a", LNumber("2"))
+	write("b", LNumber("3"))
+	j.AddLog(LogEntry{Event: "Outer"})
+	inner := j.Snapshot()
+	write("a", LNumber("4"))
+	j.AddLog(LogEntry{Event: "Inner"})
+
+	j.RevertToSnapshot(inner)
+	if tbl.RawGetString("a") != LNumber("2") || len(j.Logs()) != 1 {
+		t.Fatalf("unexpected state after inner revert: a=%v logs=%v", tbl.RawGetString("a"), j.Logs())
+	}
+	j.RevertToSnapshot(outer)
+	if tbl.RawGetString("a") != LNumber("1") || tbl.RawGetString("b") != LNil || len(j.Logs()) != 0 {
+		t.Fatalf("unexpected state after outer revert: a=%v b=%v logs=%v", tbl.RawGetString("a"), tbl.RawGetString("b"), j.Logs())
+	}
+	// Reverting an invalidated snapshot is a no-op.
+	j.RevertToSnapshot(inner)
+	if tbl.RawGetString("a") != LNumber("1") {
+		t.Fatalf("expected stale revert to be ignored")
+	}
+}
+
+const journalVaultSource = `
+tol 0.2
+contract Vault {
+  storage {
+    slot total: u256;
+  }
+  event Added(amount: u256)
+  fn add(n: u256) public {
+    set total = total + n;
+    emit Added(n);
+    return;
+  }
+  fn addThenFail(n: u256) public {
+    set total = total + n;
+    emit Added(n);
+    revert "nope";
+  }
+  fn peek() -> (r: u256) public view {
+    return total;
+  }
+}
+`
+
+func TestJournalRevertsFailedInvocations(t *testing.T) {
+	h := NewMemoryContractHost()
+	bc, err := CompileTOLToBytecode([]byte(journalVaultSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetCode(hostCounterAddr, bc)
+	L := NewState()
+	defer L.Close()
+	h.Attach(L, hostCounterAddr)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	invoke := func(sig string, args ...LValue) error {
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		for _, a := range args {
+			L.Push(a)
+		}
+		return L.AtomicPCall(len(args)+1, 0, nil)
+	}
+
+	if err := invoke("add(u256)", LNumber("5")); err != nil {
+		t.Fatal(err)
+	}
+	if err := invoke("addThenFail(u256)", LNumber("7")); err == nil {
+		t.Fatalf("expected revert")
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(5) {
+		t.Fatalf("expected failed top-level invoke to be reverted, got %s", got)
+	}
+
+	// A contract cannot keep partial writes by swallowing a revert with pcall.
+	L.SetGlobal("sel", LString(selectorHexFromSignature("addThenFail(u256)")))
+	if err := L.DoString(`ok = pcall(tos.oninvoke, sel, 11)`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("ok") != LFalse {
+		t.Fatalf("expected pcall to report the revert")
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(5) {
+		t.Fatalf("expected pcall-swallowed revert to be reverted, got %s", got)
+	}
+
+	logs := h.Journal().Logs()
+	if len(logs) != 1 || logs[0].Event != "Added" || logs[0].Address != hostCounterAddr || logs[0].Args[0] != LNumber("5") {
+		t.Fatalf("expected only the committed log, got %+v", logs)
+	}
+}
+
+func TestJournalRevertsNestedFrameLogs(t *testing.T) {
+	h := newTestContractHost(t)
+	bc, err := CompileTOLToBytecode([]byte(journalVaultSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetCode(hostCounterAddr, bc)
+	if ok := invokeCaller(t, h, "forward(address,bytes)", hostCounterAddr, mustCallData(t, "add(u256)", LNumber("2"))); ok != LTrue {
+		t.Fatalf("expected nested add to succeed")
+	}
+	if ok := invokeCaller(t, h, "forward(address,bytes)", hostCounterAddr, mustCallData(t, "addThenFail(u256)", LNumber("3"))); ok != LFalse {
+		t.Fatalf("expected nested addThenFail to fail")
+	}
+	logs := h.Journal().Logs()
+	if len(logs) != 1 || logs[0].Args[0] != LNumber("2") {
+		t.Fatalf("expected the reverted frame's log to be discarded, got %+v", logs)
+	}
+	if got := peekCount(t, h, hostCounterAddr); got != word(2) {
+		t.Fatalf("unexpected vault total %s", got)
+	}
+}
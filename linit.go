@@ -13,6 +13,8 @@ const (
 	OsLibName = "os"
 	// StringLibName is the name of the string Library.
 	StringLibName = "string"
+	// BytesLibName is the name of the bytes Library.
+	BytesLibName = "bytes"
 	// MathLibName is the name of the math Library.
 	MathLibName = "math"
 	// DebugLibName is the name of the debug Library.
@@ -30,6 +32,7 @@ var luaLibs = []luaLib{
 	luaLib{BaseLibName, OpenBase},
 	luaLib{TabLibName, OpenTable},
 	luaLib{StringLibName, OpenString},
+	luaLib{BytesLibName, OpenBytes},
 	luaLib{MathLibName, OpenMath},
 	// DebugLibName/OpenDebug    REMOVED: setlocal/setupvalue break all abstraction
 	// CoroutineLibName/OpenCoroutine REMOVED: no EVM analog, non-deterministic complexity
@@ -45,4 +48,21 @@ func (ls *LState) OpenLibs() {
 		ls.Push(LString(lib.libName))
 		ls.Call(1, 0)
 	}
+	ls.sealBuiltins()
+}
+
+// sealBuiltins freezes the library namespaces and seals every global
+// defined by the libraries, so loaded chunks cannot replace builtins.
+func (ls *LState) sealBuiltins() {
+	globals := ls.G.Global
+	for _, lib := range luaLibs {
+		if tb, ok := globals.RawGetString(lib.libName).(*LTable); ok {
+			tb.Freeze()
+		}
+	}
+	globals.ForEach(func(k, _ LValue) {
+		if name, ok := k.(LString); ok {
+			globals.SealField(string(name))
+		}
+	})
 }
@@ -1,20 +1,64 @@
 package lua
 
+import (
+	"errors"
+	"fmt"
+)
+
+// Gas prices of the uint256 number-theory builtins, charged on metered
+// states in addition to the instruction count.
+const (
+	GasAddMod uint64 = 8
+	GasMulMod uint64 = 8
+	GasMulDiv uint64 = 12
+	GasSqrt   uint64 = 40
+	GasLog    uint64 = 6
+)
+
+// Gas prices of math.binaryLog and math.pow2: a base price per call, and
+// per refinement round a price per cubed 64-bit word of working precision,
+// as a round runs a number of fixed-point squarings (binaryLog) or square
+// roots (pow2) proportional to the precision.
+const (
+	GasFixedPoint          uint64 = 20
+	GasBinaryLogRoundWord3 uint64 = 2
+	GasPow2RoundWord3      uint64 = 16
+)
+
+// Domain errors of the u256 number-theory builtins.
+var (
+	errModulusZero    = errors.New("modulus is zero")
+	errDivisionByZero = errors.New("division by zero")
+	errLogZero        = errors.New("x must be positive")
+)
+
 func OpenMath(L *LState) int {
 	mod := L.RegisterModule(MathLibName, mathFuncs).(*LTable)
+	mod.RawSetString("LowerBound", lNumberFromInt(EstimateLowerBound))
+	mod.RawSetString("Midpoint", lNumberFromInt(EstimateMidpoint))
+	mod.RawSetString("UpperBound", lNumberFromInt(EstimateUpperBound))
 	L.Push(mod)
 	return 1
 }
 
 var mathFuncs = map[string]LGFunction{
-	"abs":   mathAbs,
-	"ceil":  mathCeil,
-	"floor": mathFloor,
-	"fmod":  mathFmod,
-	"max":   mathMax,
-	"min":   mathMin,
-	"mod":   mathMod,
-	"pow":   mathPow,
+	"abs":       mathAbs,
+	"addmod":    mathAddMod,
+	"binaryLog": mathBinaryLog,
+	"ceil":      mathCeil,
+	"floor":     mathFloor,
+	"fmod":      mathFmod,
+	"log10":     mathLog10,
+	"log2":      mathLog2,
+	"log256":    mathLog256,
+	"max":       mathMax,
+	"min":       mathMin,
+	"mod":       mathMod,
+	"muldiv":    mathMulDiv,
+	"mulmod":    mathMulMod,
+	"pow":       mathPow,
+	"pow2":      mathPow2,
+	"sqrt":      mathSqrt,
 }
 
 func mathAbs(L *LState) int {
@@ -107,6 +151,154 @@ func mathPow(L *LState) int {
 	return 1
 }
 
+// mathAddMod implements math.addmod(a, b, n) -> u256: (a + b) % n with
+// the sum computed at full precision. A zero modulus reverts.
+func mathAddMod(L *LState) int {
+	a, b, n := L.CheckNumber(1), L.CheckNumber(2), L.CheckNumber(3)
+	L.chargeGas(GasAddMod)
+	if lNumberIsZero(n) {
+		mathRevert(L, "addmod", errModulusZero)
+	}
+	L.Push(lNumberAddMod(a, b, n))
+	return 1
+}
+
+// mathMulMod implements math.mulmod(a, b, n) -> u256: (a * b) % n with
+// the product computed at full precision. A zero modulus reverts.
+func mathMulMod(L *LState) int {
+	a, b, n := L.CheckNumber(1), L.CheckNumber(2), L.CheckNumber(3)
+	L.chargeGas(GasMulMod)
+	if lNumberIsZero(n) {
+		mathRevert(L, "mulmod", errModulusZero)
+	}
+	L.Push(lNumberMulMod(a, b, n))
+	return 1
+}
+
+// mathMulDiv implements math.muldiv(a, b, d [, rounding]) -> u256:
+// a * b / d with a 512-bit intermediate product, rounded down by default
+// or by an EstimationMode. Zero divisors and results above 2^256-1
+// revert.
+func mathMulDiv(L *LState) int {
+	a, b, d := L.CheckNumber(1), L.CheckNumber(2), L.CheckNumber(3)
+	mode := EstimateLowerBound
+	if L.Get(4) != LNil {
+		mode = mathEstimationMode(L, 4)
+	}
+	L.chargeGas(GasMulDiv)
+	if lNumberIsZero(d) {
+		mathRevert(L, "muldiv", errDivisionByZero)
+	}
+	v, ok := lNumberMulDiv(a, b, d, mode)
+	if !ok {
+		mathRevert(L, "muldiv", errFixedOverflow)
+	}
+	L.Push(v)
+	return 1
+}
+
+// mathSqrt implements math.sqrt(x) -> u256, the integer square root of x
+// rounded down.
+func mathSqrt(L *LState) int {
+	x := L.CheckNumber(1)
+	L.chargeGas(GasSqrt)
+	L.Push(lNumberSqrt(x))
+	return 1
+}
+
+// mathIntLog checks the argument shared by math.log2, math.log10 and
+// math.log256; the logarithm of zero is undefined and reverts.
+func mathIntLog(L *LState, fname string, log func(LNumber) LNumber) int {
+	x := L.CheckNumber(1)
+	L.chargeGas(GasLog)
+	if lNumberIsZero(x) {
+		mathRevert(L, fname, errLogZero)
+	}
+	L.Push(log(x))
+	return 1
+}
+
+// mathLog2 implements math.log2(x) -> u256, floor(log2(x)).
+func mathLog2(L *LState) int { return mathIntLog(L, "log2", lNumberLog2) }
+
+// mathLog10 implements math.log10(x) -> u256, floor(log10(x)).
+func mathLog10(L *LState) int { return mathIntLog(L, "log10", lNumberLog10) }
+
+// mathLog256 implements math.log256(x) -> u256, floor(log256(x)).
+func mathLog256(L *LState) int { return mathIntLog(L, "log256", lNumberLog256) }
+
+// mathBinaryLog implements math.binaryLog(x_scaled, scale, mode) -> i256:
+// log2(x_scaled / scale) * scale rounded by mode, as a two's complement
+// u256 (spec §10.1).
+func mathBinaryLog(L *LState) int {
+	x := lNumberToBigInt(L.CheckNumber(1))
+	scale := lNumberToBigInt(L.CheckNumber(2))
+	mode := mathEstimationMode(L, 3)
+	L.chargeGas(GasFixedPoint)
+	v, err := binaryLog(x, scale, mode, mathRoundGas(L, GasBinaryLogRoundWord3))
+	if err != nil {
+		mathRevert(L, "binaryLog", err)
+	}
+	L.Push(wrapUint256(v))
+	return 1
+}
+
+// mathPow2 implements math.pow2(x_scaled, scale, mode) -> u256:
+// 2^(x_scaled / scale) * scale rounded by mode, where x_scaled is a two's
+// complement i256 (spec §10.1).
+func mathPow2(L *LState) int {
+	x := lNumberToBigInt(L.CheckNumber(1))
+	if x.Cmp(uint256SignBit) >= 0 {
+		x.Sub(x, uint256Mod)
+	}
+	scale := lNumberToBigInt(L.CheckNumber(2))
+	mode := mathEstimationMode(L, 3)
+	L.chargeGas(GasFixedPoint)
+	v, err := pow2(x, scale, mode, mathRoundGas(L, GasPow2RoundWord3))
+	if err != nil {
+		mathRevert(L, "pow2", err)
+	}
+	L.Push(bigToLNum(v))
+	return 1
+}
+
+// mathRoundGas returns the round callback of binaryLog and pow2 charging
+// price per cubed 64-bit word of working precision.
+func mathRoundGas(L *LState, price uint64) func(bits uint) {
+	return func(bits uint) {
+		words := uint64(bits+63) / 64
+		L.chargeGas(price * words * words * words)
+	}
+}
+
+// mathRevert reverts with a reason naming the math builtin, for domain and
+// range errors of otherwise well-typed arguments.
+func mathRevert(L *LState, fname string, err error) {
+	L.raiseRevert(newRevertError(L, fmt.Sprintf("math.%s: %v", fname, err), "", ""))
+}
+
+// mathEstimationMode reads an EstimationMode argument: math.LowerBound,
+// math.Midpoint or math.UpperBound, or "lower", "mid" or "upper".
+func mathEstimationMode(L *LState, n int) int {
+	switch lv := L.CheckAny(n).(type) {
+	case LNumber:
+		if m, ok := lNumberToInt(lv); ok && m >= EstimateLowerBound && m <= EstimateUpperBound {
+			return m
+		}
+	case LString:
+		switch lv {
+		case "lower":
+			return EstimateLowerBound
+		case "mid":
+			return EstimateMidpoint
+		case "upper":
+			return EstimateUpperBound
+		}
+	}
+	L.ArgError(n, "invalid estimation mode")
+	return 0
+}
+
 func tableExtremum(L *LState, tb *LTable, wantMax bool) (LNumber, bool) {
 	n := tb.Len()
 	if n == 0 {
@@ -1,6 +1,7 @@
 package lua
 
 import (
+	"math/big"
 	"strings"
 	"testing"
 )
@@ -64,3 +65,256 @@ func TestMathMaxTableArgumentRejectsNonNumber(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+// binaryLogVectors and pow2Vectors hold {x, scale, lower, mid, upper},
+// computed offline with 400-digit decimal arithmetic.
+var binaryLogVectors = [][5]string{
+	{"3000000000000000000", "1000000000000000000", "1584962500721156181", "1584962500721156181", "1584962500721156182"},
+	{"500000000000000000", "1000000000000000000", "-1000000000000000000", "-1000000000000000000", "-1000000000000000000"},
+	{"1", "1000000000000000000", "-59794705707972522262", "-59794705707972522262", "-59794705707972522261"},
+	{"115792089237316195423570985008687907853269984665640564039457584007913129639935", "1000000000000000000", "196205294292027477738", "196205294292027477738", "196205294292027477739"},
+	{"1000001", "1000000", "1", "1", "2"},
+	{"55340232221128654848", "18446744073709551616", "29237397617229858719", "29237397617229858720", "29237397617229858720"},
+	{"5", "3", "2", "2", "3"},
+	{"115792089237316195423570985008687907853269984665640564039457584007913129639935", "1", "255", "256", "256"},
+	{"1000000000000000001", "1000000000000000000", "1", "1", "2"},
+}
+
+var pow2Vectors = [][5]string{
+	{"1500000000000000000", "1000000000000000000", "2828427124746190097", "2828427124746190098", "2828427124746190098"},
+	{"-1000000000000000000", "1000000000000000000", "500000000000000000", "500000000000000000", "500000000000000000"},
+	{"-1", "1", "0", "1", "1"},
+	{"-3", "2", "0", "1", "1"},
+	{"333333333333333333", "1000000000000000000", "1259921049894873164", "1259921049894873164", "1259921049894873165"},
+	{"-333333333333333333", "1000000000000000000", "793700525984099737", "793700525984099738", "793700525984099738"},
+	{"100000000000000000000", "1000000000000000000", "1267650600228229401496703205376000000000000000000", "1267650600228229401496703205376000000000000000000", "1267650600228229401496703205376000000000000000000"},
+	{"1844674407370955161", "18446744073709551616", "19770730768400532066", "19770730768400532066", "19770730768400532067"},
+	{"1", "3", "3", "4", "4"},
+	{"-300000000000000000000", "1000000000000000000", "0", "0", "1"},
+	{"190000000000123456789", "1000000000000000000", "1569275433980958935729431538384630424903088120930201167877205181346635397718", "1569275433980958935729431538384630424903088120930201167877205181346635397719", "1569275433980958935729431538384630424903088120930201167877205181346635397719"},
+}
+
+func TestBinaryLogAndPow2Vectors(t *testing.T) {
+	parse := func(s string) *big.Int {
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			t.Fatalf("bad vector number %q", s)
+		}
+		return v
+	}
+	for name, tc := range map[string]struct {
+		vectors [][5]string
+		fn      func(x, scale *big.Int, mode int, round func(uint)) (*big.Int, error)
+	}{"binaryLog": {binaryLogVectors, binaryLog}, "pow2": {pow2Vectors, pow2}} {
+		for _, vec := range tc.vectors {
+			for mode := EstimateLowerBound; mode <= EstimateUpperBound; mode++ {
+				got, err := tc.fn(parse(vec[0]), parse(vec[1]), mode, nil)
+				if err != nil || got.String() != vec[2+mode] {
+					t.Errorf("%s(%s, %s, %d) = %v, %v; want %s", name, vec[0], vec[1], mode, got, err, vec[2+mode])
+				}
+			}
+		}
+	}
+}
+
+func TestMathBinaryLogAndPow2(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	err := L.DoString(`
+		local ONE = 1000000000000000000
+		assert(math.binaryLog(3 * ONE, ONE, math.LowerBound) == 1584962500721156181)
+		assert(math.binaryLog(3 * ONE, ONE, "upper") == 1584962500721156182)
+		-- Negative logs come back as two's complement i256.
+		assert(math.binaryLog(ONE / 2, ONE, math.Midpoint) == 0 - ONE)
+		assert(math.pow2(0 - ONE, ONE, "mid") == ONE / 2)
+		assert(math.pow2(math.binaryLog(5 * ONE, ONE, "mid"), ONE, "mid") == 5 * ONE)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for src, want := range map[string]string{
+		`math.binaryLog(0, 1, "lower")`:   "math.binaryLog: x must be positive",
+		`math.binaryLog(1, 0, "lower")`:   "math.binaryLog: scale must be positive",
+		`math.pow2(1, 0, "lower")`:        "math.pow2: scale must be positive",
+		`math.pow2(256, 1, "lower")`:      "math.pow2: result out of range",
+		`math.binaryLog(2, 1, "nearest")`: "invalid estimation mode",
+		`math.pow2(1, 1, 3)`:              "invalid estimation mode",
+	} {
+		if err := L.DoString(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestMathBinaryLogGasAndReverts(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	L.SetGasLimit(1_000_000)
+
+	// An 18-decimal scale needs 60 bits, so the first round runs at 124
+	// bits: two words.
+	if err := L.DoString(`return math.binaryLog(3000000000000000000, 1000000000000000000, "lower")`); err != nil {
+		t.Fatal(err)
+	}
+	base := L.GasUsed()
+	L.SetGasLimit(1_000_000)
+	if err := L.DoString(`return math.pow2(500000000000000000, 1000000000000000000, "lower")`); err != nil {
+		t.Fatal(err)
+	}
+	if want := base + (GasPow2RoundWord3-GasBinaryLogRoundWord3)*8; L.GasUsed() != want {
+		t.Errorf("pow2 gas: got %d, want %d", L.GasUsed(), want)
+	}
+	if base < GasFixedPoint+GasBinaryLogRoundWord3*8 {
+		t.Errorf("binaryLog gas %d does not cover the builtin price", base)
+	}
+
+	err := L.DoString(`math.binaryLog(0, 1, "lower")`)
+	rerr, ok := AsRevertError(err)
+	if !ok {
+		t.Fatalf("expected a revert, got %v", err)
+	}
+	if rerr.Reason != "math.binaryLog: x must be positive" || rerr.Payload != EncodeRevertReason(rerr.Reason) {
+		t.Errorf("unexpected revert %+v", rerr)
+	}
+	if err := L.DoString(`
+		local ok, msg = pcall(math.pow2, 256, 1, "lower")
+		assert(not ok and msg == "math.pow2: result out of range")
+	`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMathNumberTheoryBuiltins(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+
+	err := L.DoString(`
+		local MAX = 0 - 1
+		-- Sums and products are reduced at full precision, not mod 2^256.
+		assert(math.addmod(MAX, MAX, 7) == 2)
+		assert(math.mulmod(MAX, MAX, 12345) == 315)
+		assert(math.muldiv(MAX, MAX, MAX) == MAX)
+		assert(math.muldiv(7, 3, 2) == 10)
+		assert(math.muldiv(7, 3, 2, math.UpperBound) == 11)
+		assert(math.muldiv(7, 3, 2, "mid") == 11)
+		assert(math.muldiv(7, 2, 3, "mid") == 5)
+		assert(math.muldiv(6, 2, 3, "upper") == 4)
+		assert(math.sqrt(0) == 0 and math.sqrt(15) == 3 and math.sqrt(16) == 4)
+		assert(math.sqrt(MAX) == 340282366920938463463374607431768211455)
+		assert(math.log2(1) == 0 and math.log2(1023) == 9 and math.log2(MAX) == 255)
+		assert(math.log10(999) == 2 and math.log10(1000) == 3 and math.log10(MAX) == 77)
+		assert(math.log256(255) == 0 and math.log256(256) == 1 and math.log256(MAX) == 31)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for src, want := range map[string]string{
+		`math.addmod(1, 2, 0)`:             "math.addmod: modulus is zero",
+		`math.mulmod(1, 2, 0)`:             "math.mulmod: modulus is zero",
+		`math.muldiv(1, 2, 0)`:             "math.muldiv: division by zero",
+		`math.muldiv(0 - 1, 2, 1)`:         "math.muldiv: result out of range",
+		`math.muldiv(0 - 1, 0 - 1, 0 - 2)`: "math.muldiv: result out of range",
+		`math.muldiv(1, 1, 1, "nearest")`:  "invalid estimation mode",
+		`math.log2(0)`:                     "math.log2: x must be positive",
+		`math.log10(0)`:                    "math.log10: x must be positive",
+		`math.log256(0)`:                   "math.log256: x must be positive",
+	} {
+		err := L.DoString(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+			continue
+		}
+		// Domain errors revert with the message as reason; bad modes are
+		// argument errors.
+		if rerr, ok := AsRevertError(err); ok != strings.HasPrefix(want, "math.") || ok && rerr.Reason != want {
+			t.Errorf("%s: unexpected revert %v", src, rerr)
+		}
+	}
+}
+
+func TestMathNumberTheoryGas(t *testing.T) {
+	gasFor := func(call string) uint64 {
+		L := NewState()
+		defer L.Close()
+		L.SetGasLimit(1_000_000)
+		if err := L.DoString(`local v = ` + call); err != nil {
+			t.Fatal(err)
+		}
+		return L.GasUsed()
+	}
+	if d := gasFor("math.sqrt(16)") - gasFor("math.abs(16)"); d != GasSqrt {
+		t.Fatalf("unexpected sqrt gas: %d", d)
+	}
+	if d := gasFor("math.muldiv(1, 2, 3)") - gasFor("math.mod(1, 2, 3)"); d != GasMulDiv {
+		t.Fatalf("unexpected muldiv gas: %d", d)
+	}
+	if d := gasFor("math.mulmod(1, 2, 3)") - gasFor("math.addmod(1, 2, 3)"); d != GasMulMod-GasAddMod {
+		t.Fatalf("unexpected mulmod/addmod price difference: %d", d)
+	}
+}
+
+const mathBuiltinsSource = `
+tol 0.2
+contract Pricing {
+  fn quote(amount: u256, price: u256, denom: u256) -> (r: u256) public pure {
+    return math.muldiv(amount, price, denom, math.UpperBound);
+  }
+  fn root(x: u256) -> (r: u256) public pure {
+    return math.sqrt(x);
+  }
+  fn digits(x: u256) -> (r: u256) public pure {
+    return math.log10(x) + 1;
+  }
+}
+`
+
+func TestMathBuiltinsFromTOL(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(mathBuiltinsSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	call := func(sig string, args ...LValue) LValue {
+		t.Helper()
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		for _, a := range args {
+			L.Push(a)
+		}
+		if err := L.PCall(len(args)+1, 1, nil); err != nil {
+			t.Fatalf("%s: %v", sig, err)
+		}
+		ret := L.Get(-1)
+		L.Pop(1)
+		return ret
+	}
+	if got := call("quote(u256,u256,u256)", LNumber("10"), LNumber("7"), LNumber("3")); got != LNumber("24") {
+		t.Fatalf("unexpected quote %v", got)
+	}
+	if got := call("root(u256)", LNumber("1000000")); got != LNumber("1000") {
+		t.Fatalf("unexpected root %v", got)
+	}
+	if got := call("digits(u256)", LNumber("12345")); got != LNumber("5") {
+		t.Fatalf("unexpected digits %v", got)
+	}
+}
+
+func TestMathBuiltinsSema(t *testing.T) {
+	cases := map[string]string{
+		"fn f(a: u256) -> (r: u256) public pure { return math.mulmod(a, a); }":          "builtin 'math.mulmod(u256, u256, u256) -> u256' expects 3 argument(s), got 2",
+		"fn f(a: u256) -> (r: u256) public pure { return math.muldiv(a, a, a, 0, 0); }": "builtin 'math.muldiv(u256, u256, u256[, EstimationMode]) -> u256' expects 3 to 4 argument(s), got 5",
+	}
+	for body, want := range cases {
+		src := "tol 0.2\ncontract C {\n  " + body + "\n}\n"
+		if _, err := CompileTOLToBytecode([]byte(src), "<tol>"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+}
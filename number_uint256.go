@@ -205,3 +205,65 @@ func lNumberShr(lhs, rhs LNumber) LNumber {
 	}
 	return LNumber(new(big.Int).Rsh(lNumberToBigInt(lhs), n).Text(10))
 }
+
+// lNumberAddMod returns (lhs + rhs) % mod without wrapping the sum.
+// callers must check for zero modulus before calling
+func lNumberAddMod(lhs, rhs, mod LNumber) LNumber {
+	sum := new(big.Int).Add(lNumberToBigInt(lhs), lNumberToBigInt(rhs))
+	return LNumber(sum.Mod(sum, lNumberToBigInt(mod)).Text(10))
+}
+
+// lNumberMulMod returns (lhs * rhs) % mod without wrapping the product.
+// callers must check for zero modulus before calling
+func lNumberMulMod(lhs, rhs, mod LNumber) LNumber {
+	prod := new(big.Int).Mul(lNumberToBigInt(lhs), lNumberToBigInt(rhs))
+	return LNumber(prod.Mod(prod, lNumberToBigInt(mod)).Text(10))
+}
+
+// lNumberMulDiv returns lhs * rhs / div computed at full precision and
+// rounded by mode (an Estimate* constant). It reports false when the
+// result does not fit in 256 bits.
+// callers must check for zero divisor before calling
+func lNumberMulDiv(lhs, rhs, div LNumber, mode int) (LNumber, bool) {
+	d := lNumberToBigInt(div)
+	q, r := new(big.Int).QuoRem(new(big.Int).Mul(lNumberToBigInt(lhs), lNumberToBigInt(rhs)), d, new(big.Int))
+	switch mode {
+	case EstimateUpperBound:
+		if r.Sign() != 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	case EstimateMidpoint:
+		if r.Lsh(r, 1).Cmp(d) >= 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if q.Cmp(uint256Max) > 0 {
+		return LNumberZero, false
+	}
+	return LNumber(q.Text(10)), true
+}
+
+// lNumberSqrt returns floor(sqrt(v)).
+func lNumberSqrt(v LNumber) LNumber {
+	return LNumber(new(big.Int).Sqrt(lNumberToBigInt(v)).Text(10))
+}
+
+// lNumberLog2 returns floor(log2(v)).
+// callers must check for zero before calling
+func lNumberLog2(v LNumber) LNumber {
+	return lNumberFromInt(lNumberToBigInt(v).BitLen() - 1)
+}
+
+// lNumberLog10 returns floor(log10(v)), the number of decimal digits of v
+// minus one.
+// callers must check for zero before calling
+func lNumberLog10(v LNumber) LNumber {
+	return lNumberFromInt(len(lNumberToBigInt(v).Text(10)) - 1)
+}
+
+// lNumberLog256 returns floor(log256(v)), the number of significant bytes
+// of v minus one.
+// callers must check for zero before calling
+func lNumberLog256(v LNumber) LNumber {
+	return lNumberFromInt((lNumberToBigInt(v).BitLen() - 1) / 8)
+}
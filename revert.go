@@ -0,0 +1,198 @@
+package lua
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorSelector is the selector of Error(string), the payload of reason
+// reverts.
+const ErrorSelector = "0x08c379a0"
+
+// RevertError is a user-level revert raised by TOL `revert` or a failed
+// `require`. PCall returns it wrapped in an *ApiError (use errors.As);
+// runtime failures such as gas exhaustion, stack overflow or an invalid
+// opcode never carry one.
+type RevertError struct {
+	// Payload is the hex revert data: the Error(string) encoding of Reason
+	// for reason reverts, or the selector and argument words of a custom
+	// error.
+	Payload string
+	// Reason is the revert message; empty for custom errors.
+	Reason string
+	// Selector and Args describe a custom error. Selector is empty for
+	// reason reverts.
+	Selector string
+	Args     []LValue
+	// Contract and Function name the TOL function that reverted, when known.
+	Contract string
+	Function string
+	// Address is the executing contract, when a contract frame is set.
+	Address LAddress
+}
+
+// Location returns "Contract.function", or "" when unknown.
+func (e *RevertError) Location() string {
+	switch {
+	case e.Contract != "" && e.Function != "":
+		return e.Contract + "." + e.Function
+	case e.Function != "":
+		return e.Function
+	}
+	return e.Contract
+}
+
+func (e *RevertError) Error() string {
+	msg := e.Reason
+	if e.Selector != "" {
+		msg = "custom error " + e.Selector
+	}
+	if loc := e.Location(); loc != "" {
+		return fmt.Sprintf("revert in %s: %s", loc, msg)
+	}
+	return "revert: " + msg
+}
+
+// AsRevertError reports whether err was caused by a revert and returns it.
+func AsRevertError(err error) (*RevertError, bool) {
+	var rerr *RevertError
+	if errors.As(err, &rerr) {
+		return rerr, true
+	}
+	return nil, false
+}
+
+// EncodeRevertReason returns the Error(string) payload of reason.
+func EncodeRevertReason(reason string) string {
+	var word [32]byte
+	var sb strings.Builder
+	sb.WriteString(ErrorSelector)
+	binary.BigEndian.PutUint64(word[24:], 32)
+	sb.WriteString(hex.EncodeToString(word[:]))
+	binary.BigEndian.PutUint64(word[24:], uint64(len(reason)))
+	sb.WriteString(hex.EncodeToString(word[:]))
+	data := []byte(reason)
+	if pad := len(data) % 32; pad != 0 {
+		data = append(data, make([]byte, 32-pad)...)
+	}
+	sb.WriteString(hex.EncodeToString(data))
+	return sb.String()
+}
+
+// DecodeRevertPayload decodes hex revert data: Error(string) payloads yield
+// a Reason, anything else a custom error whose arguments are decoded as
+// u256 words. Empty data is a revert without a reason.
+func DecodeRevertPayload(payload string) (*RevertError, error) {
+	body := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(payload)), "0x")
+	raw, err := hex.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("revert payload: %v", err)
+	}
+	rerr := &RevertError{Payload: "0x" + body}
+	if len(raw) == 0 {
+		return rerr, nil
+	}
+	if "0x"+body[:min(len(body), 8)] == ErrorSelector {
+		reason, err := decodeRevertReason(raw[4:])
+		if err != nil {
+			return nil, err
+		}
+		rerr.Reason = reason
+		return rerr, nil
+	}
+	selector, args, err := DecodeCallData(body)
+	if err != nil {
+		return nil, fmt.Errorf("revert payload: %v", err)
+	}
+	rerr.Selector, rerr.Args = selector, args
+	return rerr, nil
+}
+
+func decodeRevertReason(data []byte) (string, error) {
+	if len(data) < 64 {
+		return "", errors.New("revert payload: truncated Error(string)")
+	}
+	off, ok := wordToInt(data[:32])
+	if !ok || off+32 > len(data) {
+		return "", errors.New("revert payload: bad string offset")
+	}
+	n, ok := wordToInt(data[off : off+32])
+	if !ok || off+32+n > len(data) {
+		return "", errors.New("revert payload: bad string length")
+	}
+	return string(data[off+32 : off+32+n]), nil
+}
+
+// wordToInt decodes a 32-byte big-endian word that fits in an int32.
+func wordToInt(word []byte) (int, bool) {
+	for _, b := range word[:28] {
+		if b != 0 {
+			return 0, false
+		}
+	}
+	n := binary.BigEndian.Uint32(word[28:])
+	if n > 1<<31-1 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// raiseRevert raises rerr as a Lua error. The error value seen by Lua
+// (e.g. by pcall) is the bare reason string, without position information;
+// the *ApiError seen by Go carries rerr as its Cause.
+func (ls *LState) raiseRevert(rerr *RevertError) {
+	if ls.tracer != nil {
+		ls.tracer.OnRevert(ls, rerr)
+	}
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if apiErr, ok := rcv.(*ApiError); ok && apiErr.Cause == nil {
+				apiErr.Cause = rerr
+			}
+			panic(rcv)
+		}
+	}()
+	ls.Error(LString(rerr.Reason), 0)
+}
+
+func openRevert(L *LState) {
+	L.SetGlobal("__tol_revert", L.NewFunction(tolRevert))
+	L.SetGlobal("__tol_require", L.NewFunction(tolRequire))
+}
+
+// tolRevert implements __tol_revert([reason [, contract [, function]]]),
+// the lowering of TOL `revert`.
+func tolRevert(L *LState) int {
+	L.raiseRevert(newRevertError(L, L.OptString(1, ""), L.OptString(2, ""), L.OptString(3, "")))
+	return 0
+}
+
+// tolRequire implements __tol_require(cond [, reason [, contract
+// [, function]]]), the lowering of TOL `require`: it reverts when cond is
+// false or nil.
+func tolRequire(L *LState) int {
+	if LVAsBool(L.Get(1)) {
+		return 0
+	}
+	L.raiseRevert(newRevertError(L, L.OptString(2, ""), L.OptString(3, ""), L.OptString(4, "")))
+	return 0
+}
+
+// newRevertError builds a reason revert; an empty reason has an empty
+// payload.
+func newRevertError(L *LState, reason, contract, function string) *RevertError {
+	payload := "0x"
+	if reason != "" {
+		payload = EncodeRevertReason(reason)
+	}
+	return &RevertError{
+		Payload:  payload,
+		Reason:   reason,
+		Contract: contract,
+		Function: function,
+		Address:  L.ContractAddress(),
+	}
+}
@@ -0,0 +1,153 @@
+package lua
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRevertPayloadEncoding(t *testing.T) {
+	want := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000001a" +
+		"4e6f7420656e6f7567682045746865722070726f76696465642e000000000000"
+	if got := EncodeRevertReason("Not enough Ether provided."); got != want {
+		t.Fatalf("unexpected Error(string) payload:\n got %s\nwant %s", got, want)
+	}
+	rerr, err := DecodeRevertPayload(want)
+	if err != nil || rerr.Reason != "Not enough Ether provided." || rerr.Selector != "" {
+		t.Fatalf("unexpected decode: %+v %v", rerr, err)
+	}
+
+	custom, _ := EncodeCallData(FunctionSelector("Insufficient(u256)"), LNumber("7"))
+	rerr, err = DecodeRevertPayload(custom)
+	if err != nil || rerr.Selector != FunctionSelector("Insufficient(u256)") || len(rerr.Args) != 1 || rerr.Args[0] != LNumber("7") {
+		t.Fatalf("unexpected custom error decode: %+v %v", rerr, err)
+	}
+	if rerr, err := DecodeRevertPayload("0x"); err != nil || rerr.Reason != "" || rerr.Selector != "" {
+		t.Fatalf("unexpected empty payload decode: %+v %v", rerr, err)
+	}
+	for _, bad := range []string{"0xzz", "0x08c379a0", "0x0102"} {
+		if _, err := DecodeRevertPayload(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+const revertGuardSource = `
+tol 0.2
+contract Guard {
+  storage {
+    slot total: u256;
+  }
+  fn check(n: u256) public {
+    require(n > 1, "too small");
+    set total = n;
+    return;
+  }
+  fn stop() public {
+    revert "stopped";
+  }
+  fn spin() public {
+    while (true) {
+      set total = total + 1;
+    }
+    return;
+  }
+}
+`
+
+func TestRevertErrorFromTOL(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(revertGuardSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	L.SetContractFrame(hostCounterAddr, 0)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	invoke := func(sig string, args ...LValue) error {
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		for _, a := range args {
+			L.Push(a)
+		}
+		return L.PCall(len(args)+1, 0, nil)
+	}
+
+	err = invoke("check(u256)", LNumber("1"))
+	rerr, ok := AsRevertError(err)
+	if !ok {
+		t.Fatalf("expected a RevertError, got %v", err)
+	}
+	if rerr.Reason != "too small" || rerr.Contract != "Guard" || rerr.Function != "check" || rerr.Address != hostCounterAddr {
+		t.Fatalf("unexpected revert: %+v", rerr)
+	}
+	if rerr.Payload != EncodeRevertReason("too small") || rerr.Error() != "revert in Guard.check: too small" {
+		t.Fatalf("unexpected payload/message: %s %q", rerr.Payload, rerr.Error())
+	}
+	if err := invoke("check(u256)", LNumber("2")); err != nil {
+		t.Fatalf("expected require to pass: %v", err)
+	}
+
+	var apiErr *ApiError
+	err = invoke("stop()")
+	if rerr, ok := AsRevertError(err); !ok || rerr.Reason != "stopped" || rerr.Function != "stop" {
+		t.Fatalf("unexpected revert from stop(): %v", err)
+	}
+	if !errors.As(err, &apiErr) || apiErr.Object != LString("stopped") {
+		t.Fatalf("expected the Lua error value to be the bare reason, got %v", err)
+	}
+
+	// An error handler rewrites the error value but keeps the revert.
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("stop()")))
+	err = L.PCall(1, 0, L.NewFunction(func(L *LState) int {
+		L.Push(LString("handled: " + L.ToString(1)))
+		return 1
+	}))
+	if rerr, ok := AsRevertError(err); !ok || rerr.Reason != "stopped" {
+		t.Fatalf("expected the revert to survive the error handler, got %v", err)
+	}
+	if !errors.As(err, &apiErr) || apiErr.Object != LString("handled: stopped") {
+		t.Fatalf("expected the handler's error value, got %v", err)
+	}
+
+	// Lua-level pcall sees the bare reason string.
+	L.SetGlobal("sel", LString(selectorHexFromSignature("stop()")))
+	if err := L.DoString(`ok, msg = pcall(tos.oninvoke, sel)`); err != nil {
+		t.Fatal(err)
+	}
+	if L.GetGlobal("ok") != LFalse || L.GetGlobal("msg") != LString("stopped") {
+		t.Fatalf("unexpected pcall result %v %v", L.GetGlobal("ok"), L.GetGlobal("msg"))
+	}
+
+	// Runtime failures are not reverts.
+	L.SetGasLimit(L.GasUsed() + 5000)
+	err = invoke("spin()")
+	if err == nil || !strings.Contains(err.Error(), "gas limit exceeded") {
+		t.Fatalf("expected gas exhaustion, got %v", err)
+	}
+	if _, ok := AsRevertError(err); ok {
+		t.Fatalf("gas exhaustion must not be reported as a revert")
+	}
+}
+
+func TestRevertPayloadReturnedByHost(t *testing.T) {
+	h := NewMemoryContractHost()
+	bc, err := CompileTOLToBytecode([]byte(journalVaultSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetCode(hostCounterAddr, bc)
+	res := h.Call(&ContractCall{Kind: CallKindCall, To: hostCounterAddr, Data: string(mustCallData(t, "addThenFail(u256)", LNumber("1"))), Depth: 1})
+	if res.OK || res.ReturnData != EncodeRevertReason("nope") {
+		t.Fatalf("expected revert payload as return data, got %+v", res)
+	}
+	rerr, ok := AsRevertError(res.Err)
+	if !ok || rerr.Function != "addThenFail" || rerr.Address != hostCounterAddr {
+		t.Fatalf("unexpected revert error %+v (%v)", rerr, res.Err)
+	}
+}
@@ -0,0 +1,58 @@
+package lua
+
+import (
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1Recover returns the 64-byte uncompressed public key (X ++ Y,
+// without the 0x04 prefix) that produced signature (r, s) with recovery id
+// recID (0 or 1) over hash. It reports false for invalid signatures.
+func secp256k1Recover(hash []byte, recID byte, r, s *big.Int) ([]byte, bool) {
+	if recID > 1 || r.BitLen() > 256 || s.BitLen() > 256 {
+		return nil, false
+	}
+	// Compact signature: header byte 27 + recID (uncompressed key), r, s.
+	var sig [65]byte
+	sig[0] = 27 + recID
+	r.FillBytes(sig[1:33])
+	s.FillBytes(sig[33:])
+	pub, _, err := ecdsa.RecoverCompact(sig[:], hash)
+	if err != nil {
+		return nil, false
+	}
+	return pub.SerializeUncompressed()[1:], true
+}
+
+// secpDecodePubkey decodes a public key in compressed (33 bytes, 0x02/0x03
+// prefix), uncompressed (65 bytes, 0x04 prefix) or raw (64 bytes, X ++ Y)
+// form. Hybrid (0x06/0x07) encodings are rejected.
+func secpDecodePubkey(b []byte) (*secp256k1.PublicKey, bool) {
+	switch {
+	case len(b) == 64:
+		b = append([]byte{4}, b...)
+	case len(b) == 65 && b[0] == 4:
+	case len(b) == 33 && (b[0] == 2 || b[0] == 3):
+	default:
+		return nil, false
+	}
+	pub, err := secp256k1.ParsePubKey(b)
+	return pub, err == nil
+}
+
+// secp256k1Verify reports whether sig (r ++ s, 64 bytes) is a valid ECDSA
+// signature of hash by pubkey. Only canonical low-S signatures
+// (s <= n/2) are accepted.
+func secp256k1Verify(pubkey, hash, sig []byte) bool {
+	pub, ok := secpDecodePubkey(pubkey)
+	if !ok || len(sig) != 64 {
+		return false
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig[:32]) || r.IsZero() || s.SetByteSlice(sig[32:]) || s.IsZero() || s.IsOverHalfOrder() {
+		return false
+	}
+	return ecdsa.NewSignature(&r, &s).Verify(hash, pub)
+}
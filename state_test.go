@@ -832,3 +832,33 @@ func TestNumberLiteralPolicyStillUint256(t *testing.T) {
 		t.Fatal("scientific literal should be rejected")
 	}
 }
+
+func TestOpenLibsSealsBuiltins(t *testing.T) {
+	L := NewState()
+	defer L.Close()
+	for _, script := range []string{
+		`keccak256 = function() return "0x00" end`,
+		`rawset(_G, "keccak256", nil)`,
+		`string = {}`,
+		`__tol_mkey = nil`,
+		`math.sqrt = nil`,
+		`rawset(string, "evil", true)`,
+		`table.insert(bytes, 1)`,
+		`table.sort(math)`,
+		`setmetatable(table, {})`,
+	} {
+		errorIfScriptNotFail(t, L, script, `attempt to modify (sealed field|a frozen table)`)
+	}
+	errorIfScriptNotFail(t, L, `keccak256 = 1`, `^<string>:1: attempt to modify sealed field 'keccak256'\n`)
+	errorIfScriptFail(t, L, `
+		assert(type(keccak256) == "function" and type(string.format) == "function")
+		counter = 1
+		counter = counter + 1
+		local t = setmetatable({}, {__index = string})
+		t.x = 1
+	`)
+
+	// The host API may still replace a builtin before running code.
+	L.SetGlobal("assert", L.NewFunction(func(L *LState) int { return 0 }))
+	errorIfScriptFail(t, L, `assert(false)`)
+}
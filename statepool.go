@@ -0,0 +1,332 @@
+package lua
+
+import (
+	"sync"
+)
+
+// LStatePool hands out states that have already been initialized by a
+// setup function, typically OpenLibs plus the execution of a contract's
+// prelude and module code. Setup runs once per pooled state; afterwards
+// the pool snapshots everything reachable from the globals, the registry
+// and the builtin metatables, and every state returned with Put is reset
+// to that snapshot instead of being rebuilt.
+//
+// The reset restores, in place, the contents, metatables and seals of
+// every snapshotted table, the values of closed upvalues and the environments
+// of functions and userdata. Tables created after the snapshot become
+// unreachable again. Values set outside the snapshot graph after Get,
+// such as a host storage table installed with SetGlobal, are dropped from
+// the state but not modified. Coroutines created by setup are not
+// restored. The stack, gas counters, static mode, contract frame, host,
+// journal and tracer are cleared.
+type LStatePool struct {
+	mu     sync.Mutex
+	setup  func(L *LState) error
+	opts   []Options
+	free   []*LState
+	snaps  map[*LState]*stateSnapshot
+	closed bool
+}
+
+// NewLStatePool returns a pool whose states are created with
+// NewState(opts...) and then initialized by setup, which may be nil.
+// Setup must leave the stack empty and must not attach a contract host.
+func NewLStatePool(setup func(L *LState) error, opts ...Options) *LStatePool {
+	return &LStatePool{
+		setup: setup,
+		opts:  opts,
+		snaps: make(map[*LState]*stateSnapshot),
+	}
+}
+
+// Get returns a state in its post-setup condition, creating and
+// initializing a new one if no pooled state is free.
+func (p *LStatePool) Get() (*LState, error) {
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		L := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return L, nil
+	}
+	p.mu.Unlock()
+
+	L := NewState(p.opts...)
+	if p.setup != nil {
+		if err := p.setup(L); err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	L.SetTop(0)
+	snap := takeStateSnapshot(L)
+	snap.restore(L)
+	p.mu.Lock()
+	p.snaps[L] = snap
+	p.mu.Unlock()
+	return L, nil
+}
+
+// Put resets L to its post-setup snapshot and makes it available to Get.
+// L must not be running. Dead states, states not obtained from this pool
+// and states returned after Close are closed instead.
+func (p *LStatePool) Put(L *LState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snap, ok := p.snaps[L]
+	if !ok || L.Dead || p.closed {
+		delete(p.snaps, L)
+		L.Close()
+		return
+	}
+	snap.restore(L)
+	p.free = append(p.free, L)
+}
+
+// Close closes every free state. States still in use are closed when
+// they are returned.
+func (p *LStatePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, L := range p.free {
+		delete(p.snaps, L)
+		L.Close()
+	}
+	p.free = nil
+	p.closed = true
+}
+
+type tableSnapshot struct {
+	metatable LValue
+	array     []LValue
+	dict      map[LValue]LValue
+	strdict   map[string]LValue
+	keys      []LValue
+	k2i       map[LValue]int
+	frozen    bool
+	sealed    map[string]struct{}
+}
+
+type userDataSnapshot struct {
+	env       *LTable
+	metatable LValue
+}
+
+// stateSnapshot records the mutable parts of the object graph reachable
+// from a state's globals, registry and builtin metatables.
+type stateSnapshot struct {
+	env        *LTable
+	global     *LTable
+	registry   *LTable
+	builtinMts map[int]LValue
+	tables     map[*LTable]*tableSnapshot
+	upvalues   map[*Upvalue]LValue
+	funcEnvs   map[*LFunction]*LTable
+	userData   map[*LUserData]userDataSnapshot
+}
+
+func takeStateSnapshot(L *LState) *stateSnapshot {
+	s := &stateSnapshot{
+		env:        L.Env,
+		global:     L.G.Global,
+		registry:   L.G.Registry,
+		builtinMts: make(map[int]LValue, len(L.G.builtinMts)),
+		tables:     make(map[*LTable]*tableSnapshot),
+		upvalues:   make(map[*Upvalue]LValue),
+		funcEnvs:   make(map[*LFunction]*LTable),
+		userData:   make(map[*LUserData]userDataSnapshot),
+	}
+	pending := []LValue{L.Env, L.G.Global, L.G.Registry}
+	for k, mt := range L.G.builtinMts {
+		s.builtinMts[k] = mt
+		pending = append(pending, mt)
+	}
+	for len(pending) > 0 {
+		v := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		switch o := v.(type) {
+		case *LTable:
+			if o == nil || s.tables[o] != nil {
+				continue
+			}
+			ts := &tableSnapshot{
+				metatable: o.Metatable,
+				array:     restoreValues(nil, o.array),
+				keys:      restoreValues(nil, o.keys),
+				frozen:    o.frozen,
+			}
+			if o.sealed != nil {
+				ts.sealed = make(map[string]struct{}, len(o.sealed))
+				for k := range o.sealed {
+					ts.sealed[k] = struct{}{}
+				}
+			}
+			if o.dict != nil {
+				ts.dict = make(map[LValue]LValue, len(o.dict))
+				for k, v := range o.dict {
+					ts.dict[k] = v
+					pending = append(pending, k, v)
+				}
+			}
+			if o.strdict != nil {
+				ts.strdict = make(map[string]LValue, len(o.strdict))
+				for k, v := range o.strdict {
+					ts.strdict[k] = v
+					pending = append(pending, v)
+				}
+			}
+			if o.k2i != nil {
+				ts.k2i = make(map[LValue]int, len(o.k2i))
+				for k, i := range o.k2i {
+					ts.k2i[k] = i
+				}
+			}
+			s.tables[o] = ts
+			pending = append(pending, o.array...)
+			pending = append(pending, o.Metatable)
+		case *LFunction:
+			if o == nil {
+				continue
+			}
+			if _, seen := s.funcEnvs[o]; seen {
+				continue
+			}
+			s.funcEnvs[o] = o.Env
+			pending = append(pending, o.Env)
+			for _, uv := range o.Upvalues {
+				// Open upvalues live on the stack, which the reset clears.
+				if uv == nil || !(uv.closed || uv.reg == nil) {
+					continue
+				}
+				if _, seen := s.upvalues[uv]; !seen {
+					s.upvalues[uv] = uv.value
+					pending = append(pending, uv.value)
+				}
+			}
+		case *LUserData:
+			if o == nil {
+				continue
+			}
+			if _, seen := s.userData[o]; seen {
+				continue
+			}
+			s.userData[o] = userDataSnapshot{env: o.Env, metatable: o.Metatable}
+			pending = append(pending, o.Env, o.Metatable)
+		}
+	}
+	return s
+}
+
+// restore resets L to the snapshot; see LStatePool.
+func (s *stateSnapshot) restore(L *LState) {
+	L.stack.SetSp(0)
+	L.currentFrame = nil
+	L.reg.SetTop(0)
+	L.uvcache = nil
+	L.hasErrorFunc = false
+	L.gasLimit = 0
+	L.gasUsed = 0
+	L.static = false
+	L.contractHost = nil
+	L.contractAddr = ""
+	L.callDepth = 0
+	L.journal = nil
+	L.SetTracer(nil)
+
+	L.Env = s.env
+	L.G.Global = s.global
+	L.G.Registry = s.registry
+	L.G.CurrentThread = L
+	for k := range L.G.builtinMts {
+		if _, ok := s.builtinMts[k]; !ok {
+			delete(L.G.builtinMts, k)
+		}
+	}
+	for k, mt := range s.builtinMts {
+		L.G.builtinMts[k] = mt
+	}
+
+	for tb, ts := range s.tables {
+		tb.Metatable = ts.metatable
+		tb.array = restoreValues(tb.array, ts.array)
+		tb.keys = restoreValues(tb.keys, ts.keys)
+		tb.dict = restoreDict(tb.dict, ts.dict)
+		tb.strdict = restoreStrDict(tb.strdict, ts.strdict)
+		tb.k2i = restoreKeyIndex(tb.k2i, ts.k2i)
+		tb.frozen = ts.frozen
+		// Seals only accumulate, so a size change means fields were sealed
+		// after the snapshot.
+		if len(tb.sealed) != len(ts.sealed) {
+			tb.sealed = nil
+			for k := range ts.sealed {
+				tb.SealField(k)
+			}
+		}
+	}
+	for uv, v := range s.upvalues {
+		uv.value = v
+	}
+	for fn, env := range s.funcEnvs {
+		fn.Env = env
+	}
+	for ud, us := range s.userData {
+		ud.Env = us.env
+		ud.Metatable = us.metatable
+	}
+}
+
+// restoreValues copies src into dst's storage, keeping a nil src nil:
+// LTable relies on keys and k2i being allocated together.
+func restoreValues(dst, src []LValue) []LValue {
+	if src == nil {
+		return nil
+	}
+	if dst == nil || cap(dst) < len(src) {
+		dst = make([]LValue, len(src))
+	}
+	dst = dst[:len(src)]
+	copy(dst, src)
+	return dst
+}
+
+func restoreDict(dst, src map[LValue]LValue) map[LValue]LValue {
+	if src == nil {
+		return nil
+	}
+	if dst == nil {
+		dst = make(map[LValue]LValue, len(src))
+	}
+	clear(dst)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func restoreStrDict(dst, src map[string]LValue) map[string]LValue {
+	if src == nil {
+		return nil
+	}
+	if dst == nil {
+		dst = make(map[string]LValue, len(src))
+	}
+	clear(dst)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func restoreKeyIndex(dst, src map[LValue]int) map[LValue]int {
+	if src == nil {
+		return nil
+	}
+	if dst == nil {
+		dst = make(map[LValue]int, len(src))
+	}
+	clear(dst)
+	for k, i := range src {
+		dst[k] = i
+	}
+	return dst
+}
@@ -0,0 +1,157 @@
+package lua
+
+import (
+	"testing"
+)
+
+const statePoolSetup = `
+counter = 0
+cfg = {n = 0, list = {1, 2, 3}}
+local hidden = 0
+function bump()
+  hidden = hidden + 1
+  counter = counter + 1
+  cfg.n = cfg.n + 1
+  cfg.list[4] = 4
+  cfg.extra = {}
+  leaked = "yes"
+  setmetatable(cfg, {})
+  return hidden, counter, cfg.n
+end
+`
+
+func TestLStatePoolResetsToSnapshot(t *testing.T) {
+	setups := 0
+	pool := NewLStatePool(func(L *LState) error {
+		setups++
+		return L.DoString(statePoolSetup)
+	})
+	defer pool.Close()
+
+	var first *LState
+	for round := 0; round < 3; round++ {
+		L, err := pool.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = L
+		} else if L != first {
+			t.Fatalf("round %d: expected the pooled state to be reused", round)
+		}
+		if L.GetTop() != 0 || L.GasUsed() != 0 {
+			t.Fatalf("round %d: stack %d, gas %d after reset", round, L.GetTop(), L.GasUsed())
+		}
+		err = L.DoString(`
+			assert(leaked == nil)
+			assert(getmetatable(cfg) == nil and cfg.extra == nil and #cfg.list == 3)
+			local h, c, n = bump()
+			assert(h == 1 and c == 1 and n == 1)
+		`)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		L.SetGasLimit(1_000_000)
+		L.SetContractFrame(hostCounterAddr, 2)
+		L.Push(LString("left on the stack"))
+		pool.Put(L)
+	}
+	if setups != 1 {
+		t.Fatalf("expected setup to run once, ran %d times", setups)
+	}
+	if first.ContractAddress() != "" || first.CallDepth() != 0 {
+		t.Fatal("contract frame survived the reset")
+	}
+}
+
+func TestLStatePoolContractInvocations(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(hostCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewLStatePool(func(L *LState) error { return L.DoBytecode(bc) })
+	defer pool.Close()
+
+	invoke := func(L *LState, sig string, args ...LValue) LValue {
+		t.Helper()
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		for _, a := range args {
+			L.Push(a)
+		}
+		if err := L.PCall(len(args)+1, 1, nil); err != nil {
+			t.Fatalf("%s: %v", sig, err)
+		}
+		ret := L.Get(-1)
+		L.Pop(1)
+		return ret
+	}
+
+	// Without a host, storage lives in the prelude's __tol_storage table,
+	// so it must not survive a round trip through the pool.
+	L, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	L.SetGasLimit(1_000_000)
+	if got := invoke(L, "bump(u256)", LNumber("5")); got != LNumber("5") {
+		t.Fatalf("unexpected bump result %v", got)
+	}
+	gas := L.GasUsed()
+	pool.Put(L)
+
+	L, err = pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := invoke(L, "peek()"); got != LNumber("0") {
+		t.Fatalf("storage leaked between invocations: %v", got)
+	}
+	L.SetGasLimit(1_000_000)
+	if got := invoke(L, "bump(u256)", LNumber("5")); got != LNumber("5") {
+		t.Fatalf("unexpected bump result %v", got)
+	}
+	if L.GasUsed() != gas {
+		t.Fatalf("expected identical gas for identical invocations, got %d and %d", gas, L.GasUsed())
+	}
+	pool.Put(L)
+
+	// With a host attached, writes go to the host's storage table, which
+	// the reset leaves alone.
+	h := NewMemoryContractHost()
+	L, err = pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Attach(L, hostCounterAddr)
+	invoke(L, "bump(u256)", LNumber("7"))
+	pool.Put(L)
+	L, err = pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Put(L)
+	if got := invoke(L, "peek()"); got != LNumber("0") {
+		t.Fatalf("host storage leaked into a detached state: %v", got)
+	}
+	h.Attach(L, hostCounterAddr)
+	if got := invoke(L, "peek()"); got != LNumber("7") {
+		t.Fatalf("expected host storage to persist, got %v", got)
+	}
+}
+
+func TestLStatePoolClosesForeignAndDeadStates(t *testing.T) {
+	pool := NewLStatePool(nil)
+	L, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	L.Dead = true
+	pool.Put(L)
+	other := NewState()
+	pool.Put(other)
+	if len(pool.free) != 0 || len(pool.snaps) != 0 {
+		t.Fatalf("expected dead and foreign states to be dropped, have %d free", len(pool.free))
+	}
+	pool.Close()
+}
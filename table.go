@@ -1,5 +1,9 @@
 package lua
 
+import (
+	"fmt"
+)
+
 const defaultArrayCap = 32
 const defaultHashCap = 32
 
@@ -64,6 +68,7 @@ func (tb *LTable) Len() int {
 
 // Append appends a given LValue to this LTable.
 func (tb *LTable) Append(value LValue) {
+	tb.guardWrite(nil)
 	if value == LNil {
 		return
 	}
@@ -85,6 +90,7 @@ func (tb *LTable) Append(value LValue) {
 
 // Insert inserts a given LValue at position `i` in this table.
 func (tb *LTable) Insert(i int, value LValue) {
+	tb.guardWrite(nil)
 	if tb.array == nil {
 		tb.array = make([]LValue, 0, defaultArrayCap)
 	}
@@ -102,6 +108,66 @@ func (tb *LTable) Insert(i int, value LValue) {
 	tb.array[i] = value
 }
 
+// Freeze makes this LTable read-only: every later write, including rawset,
+// table library changes and setmetatable, raises an error.
+func (tb *LTable) Freeze() {
+	tb.frozen = true
+}
+
+// IsFrozen reports whether this LTable has been frozen.
+func (tb *LTable) IsFrozen() bool {
+	return tb.frozen
+}
+
+// SealField makes the string key `key` of this LTable read-only: its value,
+// nil included, can no longer be changed.
+func (tb *LTable) SealField(key string) {
+	if tb.sealed == nil {
+		tb.sealed = make(map[string]struct{})
+	}
+	tb.sealed[key] = struct{}{}
+}
+
+// IsFieldSealed reports whether the string key `key` has been sealed.
+func (tb *LTable) IsFieldSealed(key string) bool {
+	_, ok := tb.sealed[key]
+	return ok
+}
+
+// writeViolation returns the error message for a write of key to this
+// LTable, or "" if the write is allowed. A nil key stands for any write
+// that does not target a string key.
+func (tb *LTable) writeViolation(key LValue) string {
+	if tb.frozen {
+		return "attempt to modify a frozen table"
+	}
+	if s, ok := key.(LString); ok && tb.sealed != nil {
+		if _, sealed := tb.sealed[string(s)]; sealed {
+			return fmt.Sprintf("attempt to modify sealed field '%s'", string(s))
+		}
+	}
+	return ""
+}
+
+// guardWrite panics with a runtime error if a write of key is not allowed.
+// Writes made from Lua are checked earlier by LState so the error carries
+// a position; this catches Go callers writing to the table directly.
+func (tb *LTable) guardWrite(key LValue) {
+	if !tb.frozen && tb.sealed == nil {
+		return
+	}
+	if msg := tb.writeViolation(key); msg != "" {
+		panic(newApiErrorS(ApiErrorRun, msg))
+	}
+}
+
+func (tb *LTable) guardWriteString(key string) {
+	if !tb.frozen && tb.sealed == nil {
+		return
+	}
+	tb.guardWrite(LString(key))
+}
+
 // MaxN returns a maximum number key that nil value does not exist before it.
 func (tb *LTable) MaxN() int {
 	if tb.array == nil {
@@ -117,6 +183,7 @@ func (tb *LTable) MaxN() int {
 
 // Remove removes from this table the element at a given position.
 func (tb *LTable) Remove(pos int) LValue {
+	tb.guardWrite(nil)
 	if tb.array == nil {
 		return LNil
 	}
@@ -148,6 +215,7 @@ func (tb *LTable) RawSet(key LValue, value LValue) {
 	switch v := key.(type) {
 	case LNumber:
 		if isArrayKey(v) {
+			tb.guardWrite(nil)
 			if tb.array == nil {
 				tb.array = make([]LValue, 0, defaultArrayCap)
 			}
@@ -181,6 +249,7 @@ func (tb *LTable) RawSet(key LValue, value LValue) {
 
 // RawSetInt sets a given LValue at a position `key` without the __newindex metamethod.
 func (tb *LTable) RawSetInt(key int, value LValue) {
+	tb.guardWrite(nil)
 	if key < 1 || key >= MaxArrayIndex {
 		tb.RawSetH(lNumberFromInt(key), value)
 		return
@@ -205,6 +274,11 @@ func (tb *LTable) RawSetInt(key int, value LValue) {
 
 // RawSetString sets a given LValue to a given string index without the __newindex metamethod.
 func (tb *LTable) RawSetString(key string, value LValue) {
+	tb.guardWriteString(key)
+	tb.rawSetString(key, value)
+}
+
+func (tb *LTable) rawSetString(key string, value LValue) {
 	if tb.strdict == nil {
 		tb.strdict = make(map[string]LValue, defaultHashCap)
 	}
@@ -228,6 +302,7 @@ func (tb *LTable) RawSetString(key string, value LValue) {
 
 // RawSetH sets a given LValue to a given index without the __newindex metamethod.
 func (tb *LTable) RawSetH(key LValue, value LValue) {
+	tb.guardWrite(key)
 	if s, ok := key.(LString); ok {
 		tb.RawSetString(string(s), value)
 		return
@@ -234,3 +234,35 @@ func TestTableForEach(t *testing.T) {
 		}
 	})
 }
+
+func TestTableFreezeAndSealField(t *testing.T) {
+	tbl := newLTable(0, 0)
+	tbl.RawSetString("a", LString("a"))
+	tbl.SealField("a")
+	tbl.RawSetString("b", LString("b"))
+	errorIfFalse(t, tbl.IsFieldSealed("a") && !tbl.IsFieldSealed("b"), "unexpected sealed fields")
+
+	expectPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			err, ok := recover().(*ApiError)
+			if !ok || err.Type != ApiErrorRun {
+				t.Errorf("%s: expected a runtime error, got %v", name, err)
+			}
+		}()
+		f()
+	}
+	expectPanic("sealed RawSetString", func() { tbl.RawSetString("a", LNil) })
+	expectPanic("sealed RawSet", func() { tbl.RawSet(LString("a"), LString("x")) })
+	errorIfNotEqual(t, LString("a"), tbl.RawGetString("a"))
+
+	tbl.Freeze()
+	errorIfFalse(t, tbl.IsFrozen(), "expected a frozen table")
+	expectPanic("frozen RawSetString", func() { tbl.RawSetString("b", LNil) })
+	expectPanic("frozen RawSetInt", func() { tbl.RawSetInt(1, LTrue) })
+	expectPanic("frozen RawSetH", func() { tbl.RawSetH(LTrue, LTrue) })
+	expectPanic("frozen Append", func() { tbl.Append(LTrue) })
+	expectPanic("frozen Insert", func() { tbl.Insert(1, LTrue) })
+	expectPanic("frozen Remove", func() { tbl.Remove(1) })
+	errorIfNotEqual(t, LString("b"), tbl.RawGetString("b"))
+}
@@ -21,6 +21,7 @@ var tableFuncs = map[string]LGFunction{
 
 func tableSort(L *LState) int {
 	tbl := L.CheckTable(1)
+	L.checkTableWrite(tbl, nil)
 	sorter := lValueArraySorter{L, nil, tbl.array}
 	if L.GetTop() != 1 {
 		sorter.Fn = L.CheckFunction(2)
@@ -41,6 +42,7 @@ func tableMaxN(L *LState) int {
 
 func tableRemove(L *LState) int {
 	tbl := L.CheckTable(1)
+	L.checkTableWrite(tbl, nil)
 	if L.GetTop() == 1 {
 		L.Push(tbl.Remove(-1))
 	} else {
@@ -88,6 +90,7 @@ func tableInsert(L *LState) int {
 	if nargs == 1 {
 		L.RaiseError("wrong number of arguments")
 	}
+	L.checkTableWrite(tbl, nil)
 
 	if L.GetTop() == 2 {
 		tbl.Append(L.Get(2))
@@ -5,10 +5,45 @@ import "fmt"
 // Module is the root node for a TOL source file.
 type Module struct {
 	Version         string
+	Imports         []ImportDecl
+	Interfaces      []InterfaceDecl
+	Libraries       []LibraryDecl
 	SkippedTopDecls []SkippedTopDecl
 	Contract        *ContractDecl
 }
 
+// ImportDecl is a top-level `import Name from "path";` declaration.
+// Kind and Origin are filled in by the import resolver once the imported
+// symbol has been located; unresolved imports leave them empty.
+type ImportDecl struct {
+	Name   string
+	Path   string
+	Kind   string
+	Origin string
+	// Interface is the imported interface surface when Kind is "interface".
+	Interface *InterfaceDecl
+	// Library is the imported library declaration when Kind is "library".
+	Library *LibraryDecl
+}
+
+// InterfaceDecl is a top-level `interface Name { ... }` declaration.
+// Functions are declaration-only (no Body). Interfaces are also listed in
+// Module.SkippedTopDecls for top-level name checks.
+type InterfaceDecl struct {
+	Name      string
+	Functions []FunctionDecl
+	Events    []EventDecl
+}
+
+// LibraryDecl is a top-level `library Name { ... }` declaration: a
+// storage-free namespace of functions linked into calling contracts and
+// called as `Name.fn(...)`. Libraries are also listed in
+// Module.SkippedTopDecls for top-level name checks.
+type LibraryDecl struct {
+	Name      string
+	Functions []FunctionDecl
+}
+
 type SkippedTopDecl struct {
 	Kind string
 	Name string
@@ -17,8 +52,11 @@ type SkippedTopDecl struct {
 // ContractDecl is a contract declaration node.
 type ContractDecl struct {
 	Name         string
+	Bases        []string
 	SkippedDecls []SkippedContractDecl
 	Storage      *StorageDecl
+	Constants    []ConstantDecl
+	Immutables   []ImmutableDecl
 	Events       []EventDecl
 	Functions    []FunctionDecl
 	Constructor  *ConstructorDecl
@@ -39,12 +77,28 @@ type StorageSlot struct {
 	Type string
 }
 
+// ConstantDecl is a contract-level `const NAME: T = expr;` declaration.
+// The initializer is folded at compile time.
+type ConstantDecl struct {
+	Name  string
+	Type  string
+	Value *Expr
+}
+
+// ImmutableDecl is a contract-level `immutable NAME: T;` declaration.
+// It is assigned once in the constructor and read-only afterwards.
+type ImmutableDecl struct {
+	Name string
+	Type string
+}
+
 type EventDecl struct {
 	Name   string
 	Params []FieldDecl
 }
 
 type FunctionDecl struct {
+	Pos              Pos
 	Name             string
 	SelectorOverride string
 	Params           []FieldDecl
@@ -54,13 +108,16 @@ type FunctionDecl struct {
 }
 
 type ConstructorDecl struct {
+	Pos       Pos
 	Params    []FieldDecl
 	Modifiers []string
 	Body      []Statement
 }
 
 type FallbackDecl struct {
-	Body []Statement
+	Pos       Pos
+	Modifiers []string
+	Body      []Statement
 }
 
 type FieldDecl struct {
@@ -69,7 +126,19 @@ type FieldDecl struct {
 	Indexed bool
 }
 
+// Pos is the position of a declaration or statement's first token. The
+// zero Pos is unknown, e.g. for nodes built by later passes.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
 type Statement struct {
+	Pos    Pos
 	Kind   string
 	Name   string
 	Type   string
@@ -105,10 +174,22 @@ func (m *Module) String() string {
 		return fmt.Sprintf("tol %s\n<no contract>", m.Version)
 	}
 	out := fmt.Sprintf("tol %s\n", m.Version)
+	for _, imp := range m.Imports {
+		out += fmt.Sprintf("import %s from %q;\n", imp.Name, imp.Path)
+	}
 	for _, d := range m.SkippedTopDecls {
 		out += fmt.Sprintf("%s %s { ... }\n", d.Kind, d.Name)
 	}
-	out += fmt.Sprintf("contract %s {\n", m.Contract.Name)
+	out += fmt.Sprintf("contract %s", m.Contract.Name)
+	for i, base := range m.Contract.Bases {
+		if i == 0 {
+			out += " is "
+		} else {
+			out += ", "
+		}
+		out += base
+	}
+	out += " {\n"
 
 	if m.Contract.Storage != nil {
 		out += "  storage {\n"
@@ -118,6 +199,14 @@ func (m *Module) String() string {
 		out += "  }\n"
 	}
 
+	for _, c := range m.Contract.Constants {
+		out += fmt.Sprintf("  const %s: %s = ...;\n", c.Name, c.Type)
+	}
+
+	for _, im := range m.Contract.Immutables {
+		out += fmt.Sprintf("  immutable %s: %s;\n", im.Name, im.Type)
+	}
+
 	for _, d := range m.Contract.SkippedDecls {
 		out += fmt.Sprintf("  %s %s { ... }\n", d.Kind, d.Name)
 	}
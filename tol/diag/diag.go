@@ -38,9 +38,25 @@ const (
 	CodeSemaUnknownCallTarget    = "TOL2031"
 	CodeSemaCallVisibility       = "TOL2032"
 	CodeSemaReservedName         = "TOL2033"
+	CodeSemaConstExpr            = "TOL2034"
+	CodeSemaReadOnlyBinding      = "TOL2035"
+	CodeSemaImmutableInit        = "TOL2036"
+	CodeSemaUnresolvedImport     = "TOL2037"
+	CodeSemaUnknownBase          = "TOL2038"
+	CodeSemaLibraryVisibility    = "TOL2039"
+	CodeSemaLibraryPurity        = "TOL2040"
+	CodeSemaLibraryCall          = "TOL2041"
+	CodeSemaEffectViolation      = "TOL2042"
 	CodeLowerNotImplemented      = "TOL3001"
 	CodeLowerUnsupportedFeature  = "TOL3002"
 	CodeCodegenNotImplemented    = "TOL4001"
+	CodeImportNotFound           = "TOL5001"
+	CodeImportCycle              = "TOL5002"
+	CodeImportUnknownSymbol      = "TOL5003"
+	CodeImportUnsupported        = "TOL5004"
+	CodeImportInheritance        = "TOL5005"
+	CodeImportPackageIntegrity   = "TOL5006"
+	CodeImportLockMismatch       = "TOL5007"
 )
 
 // Position describes a line/column position in a source file.
@@ -43,6 +43,7 @@ const (
 	TokenShl
 	TokenShr
 	TokenKwTol
+	TokenKwImport
 	TokenKwContract
 	TokenKwInterface
 	TokenKwLibrary
@@ -55,6 +56,8 @@ const (
 	TokenKwError
 	TokenKwEnum
 	TokenKwModifier
+	TokenKwConst
+	TokenKwImmutable
 	TokenKwLet
 	TokenKwSet
 	TokenKwIf
@@ -152,6 +155,8 @@ func (t Type) String() string {
 		return ">>"
 	case TokenKwTol:
 		return "tol"
+	case TokenKwImport:
+		return "import"
 	case TokenKwContract:
 		return "contract"
 	case TokenKwInterface:
@@ -176,6 +181,10 @@ func (t Type) String() string {
 		return "enum"
 	case TokenKwModifier:
 		return "modifier"
+	case TokenKwConst:
+		return "const"
+	case TokenKwImmutable:
+		return "immutable"
 	default:
 		return "UNKNOWN"
 	}
@@ -198,6 +207,8 @@ func keywordType(lit string) Type {
 	switch lit {
 	case "tol":
 		return TokenKwTol
+	case "import":
+		return TokenKwImport
 	case "contract":
 		return TokenKwContract
 	case "interface":
@@ -222,6 +233,10 @@ func keywordType(lit string) Type {
 		return TokenKwEnum
 	case "modifier":
 		return TokenKwModifier
+	case "const":
+		return TokenKwConst
+	case "immutable":
+		return TokenKwImmutable
 	case "let":
 		return TokenKwLet
 	case "set":
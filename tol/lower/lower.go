@@ -11,14 +11,21 @@ import (
 
 // Program is the backend-agnostic lowered form.
 type Program struct {
-	ContractName      string
-	StorageSlots      []StorageSlot
-	Functions         []Function
-	HasConstructor    bool
-	ConstructorParams []ast.FieldDecl
-	ConstructorBody   []ast.Statement
-	HasFallback       bool
-	FallbackBody      []ast.Statement
+	ContractName         string
+	StorageSlots         []StorageSlot
+	Constants            []Constant
+	Immutables           []Immutable
+	Functions            []Function
+	Libraries            []Library
+	HasConstructor       bool
+	ConstructorPos       ast.Pos
+	ConstructorParams    []ast.FieldDecl
+	ConstructorModifiers []string
+	ConstructorBody      []ast.Statement
+	HasFallback          bool
+	FallbackPos          ast.Pos
+	FallbackModifiers    []string
+	FallbackBody         []ast.Statement
 }
 
 type StorageSlot struct {
@@ -26,7 +33,29 @@ type StorageSlot struct {
 	Type string
 }
 
+// Constant is a contract constant with its compile-time folded value.
+type Constant struct {
+	Name  string
+	Type  string
+	Kind  string // "number", "string" or "bool"
+	Value string
+}
+
+// Immutable is a constructor-assigned, read-only contract value.
+type Immutable struct {
+	Name string
+	Type string
+}
+
+// Library is a linked library whose functions are emitted alongside the
+// contract and called as `Name.fn(...)`.
+type Library struct {
+	Name      string
+	Functions []Function
+}
+
 type Function struct {
+	Pos              ast.Pos
 	Name             string
 	SelectorOverride string
 	Params           []ast.FieldDecl
@@ -54,29 +83,64 @@ func FromTyped(typed *sema.TypedModule) (*Program, error) {
 		}
 	}
 
-	out.Functions = make([]Function, 0, len(c.Functions))
-	for _, fn := range c.Functions {
-		out.Functions = append(out.Functions, Function{
-			Name:             fn.Name,
-			SelectorOverride: fn.SelectorOverride,
-			Params:           cloneFields(fn.Params),
-			Returns:          cloneFields(fn.Returns),
-			Modifiers:        cloneStrings(fn.Modifiers),
-			Body:             cloneStatements(fn.Body),
+	for _, k := range c.Constants {
+		v, ok := typed.Constants[k.Name]
+		if !ok {
+			return nil, fmt.Errorf("[%s] constant '%s' has no folded value", diag.CodeLowerNotImplemented, k.Name)
+		}
+		out.Constants = append(out.Constants, Constant{
+			Name:  k.Name,
+			Type:  normalizeType(k.Type),
+			Kind:  v.Kind,
+			Value: v.Value,
+		})
+	}
+	for _, im := range c.Immutables {
+		out.Immutables = append(out.Immutables, Immutable{
+			Name: im.Name,
+			Type: normalizeType(im.Type),
+		})
+	}
+
+	out.Functions = lowerFunctions(c.Functions)
+	for _, lib := range typed.Libraries {
+		out.Libraries = append(out.Libraries, Library{
+			Name:      lib.Name,
+			Functions: lowerFunctions(lib.Functions),
 		})
 	}
 	out.HasConstructor = c.Constructor != nil
 	if c.Constructor != nil {
+		out.ConstructorPos = c.Constructor.Pos
 		out.ConstructorParams = cloneFields(c.Constructor.Params)
+		out.ConstructorModifiers = cloneStrings(c.Constructor.Modifiers)
 		out.ConstructorBody = cloneStatements(c.Constructor.Body)
 	}
 	out.HasFallback = c.Fallback != nil
 	if c.Fallback != nil {
+		out.FallbackPos = c.Fallback.Pos
+		out.FallbackModifiers = cloneStrings(c.Fallback.Modifiers)
 		out.FallbackBody = cloneStatements(c.Fallback.Body)
 	}
 	return out, nil
 }
 
+func lowerFunctions(in []ast.FunctionDecl) []Function {
+	out := make([]Function, 0, len(in))
+	for _, fn := range in {
+		out = append(out, Function{
+			Pos:              fn.Pos,
+			Name:             fn.Name,
+			SelectorOverride: fn.SelectorOverride,
+			Params:           cloneFields(fn.Params),
+			Returns:          cloneFields(fn.Returns),
+			Modifiers:        cloneStrings(fn.Modifiers),
+			Body:             cloneStatements(fn.Body),
+		})
+	}
+	return out
+}
+
 func cloneFields(in []ast.FieldDecl) []ast.FieldDecl {
 	if len(in) == 0 {
 		return nil
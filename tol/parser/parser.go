@@ -40,10 +40,20 @@ func (p *Parser) parseModule() *ast.Module {
 	}
 	mod.Version = versionTok.Literal
 
+	for p.cur.Type == lexer.TokenKwImport {
+		p.parseImportDecl(mod)
+	}
+
 	for p.cur.Type == lexer.TokenKwInterface || p.cur.Type == lexer.TokenKwLibrary {
 		p.parseSkippedTopDecl(mod)
 	}
 
+	// Support-only modules (imported interfaces/libraries) may omit the
+	// contract; sema reports the missing contract for compiled entry files.
+	if p.cur.Type == lexer.TokenEOF && (len(mod.Imports) > 0 || len(mod.SkippedTopDecls) > 0) {
+		return mod
+	}
+
 	if !p.expect(lexer.TokenKwContract, diag.CodeParseUnexpected, "expected 'contract' declaration") {
 		return mod
 	}
@@ -54,6 +64,21 @@ func (p *Parser) parseModule() *ast.Module {
 	}
 	mod.Contract = &ast.ContractDecl{Name: contractName.Literal}
 
+	if p.cur.Type == lexer.TokenIdent && p.cur.Literal == "is" {
+		p.next()
+		for {
+			baseTok := p.cur
+			if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected base contract name after 'is'") {
+				return mod
+			}
+			mod.Contract.Bases = append(mod.Contract.Bases, baseTok.Literal)
+			if p.cur.Type != lexer.TokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
 	if !p.expect(lexer.TokenLBrace, diag.CodeParseUnexpected, "expected '{' after contract name") {
 		return mod
 	}
@@ -76,7 +101,71 @@ func (p *Parser) parseModule() *ast.Module {
 	return mod
 }
 
+func (p *Parser) parseImportDecl(mod *ast.Module) {
+	if !p.expect(lexer.TokenKwImport, diag.CodeParseUnexpected, "expected 'import'") {
+		return
+	}
+
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected imported symbol name") {
+		p.syncTopDecl()
+		return
+	}
+	if p.cur.Type != lexer.TokenIdent || p.cur.Literal != "from" {
+		p.addDiag(diag.Diagnostic{
+			Code:    diag.CodeParseUnexpected,
+			Message: "expected 'from' after imported symbol name",
+			Span:    p.span(p.cur),
+		})
+		p.syncTopDecl()
+		return
+	}
+	p.next()
+
+	pathTok := p.cur
+	if !p.expect(lexer.TokenString, diag.CodeParseUnexpected, "expected import path string literal") {
+		return
+	}
+	path, err := strconv.Unquote(pathTok.Literal)
+	if err != nil || strings.TrimSpace(path) == "" {
+		p.addDiag(diag.Diagnostic{
+			Code:    diag.CodeParseUnexpected,
+			Message: "invalid import path string literal",
+			Span:    p.span(pathTok),
+		})
+		path = ""
+	}
+	if p.cur.Type == lexer.TokenSemicolon {
+		p.next()
+	}
+	if path == "" {
+		return
+	}
+
+	mod.Imports = append(mod.Imports, ast.ImportDecl{
+		Name: nameTok.Literal,
+		Path: path,
+	})
+}
+
+// syncTopDecl skips a malformed top-level declaration up to the next
+// top-level keyword (or past a terminating ';').
+func (p *Parser) syncTopDecl() {
+	p.syncUntil(lexer.TokenSemicolon, lexer.TokenKwImport, lexer.TokenKwInterface, lexer.TokenKwLibrary, lexer.TokenKwContract)
+	if p.cur.Type == lexer.TokenSemicolon {
+		p.next()
+	}
+}
+
 func (p *Parser) parseSkippedTopDecl(mod *ast.Module) {
+	if p.cur.Type == lexer.TokenKwInterface {
+		p.parseInterfaceDecl(mod)
+		return
+	}
+	if p.cur.Type == lexer.TokenKwLibrary {
+		p.parseLibraryDecl(mod)
+		return
+	}
 	kind := p.cur.Literal
 	p.next()
 
@@ -95,6 +184,168 @@ func (p *Parser) parseSkippedTopDecl(mod *ast.Module) {
 	})
 }
 
+func (p *Parser) parseInterfaceDecl(mod *ast.Module) {
+	if !p.expect(lexer.TokenKwInterface, diag.CodeParseUnexpected, "expected 'interface'") {
+		return
+	}
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected interface name") {
+		return
+	}
+	if !p.expect(lexer.TokenLBrace, diag.CodeParseUnexpected, "expected '{' before interface body") {
+		return
+	}
+
+	iface := ast.InterfaceDecl{Name: nameTok.Literal}
+	for p.cur.Type != lexer.TokenRBrace && p.cur.Type != lexer.TokenEOF {
+		switch p.cur.Type {
+		case lexer.TokenAt:
+			selectorOverride, ok := p.parseFunctionAttributes()
+			if !ok {
+				return
+			}
+			if p.cur.Type != lexer.TokenKwFn {
+				p.addDiag(diag.Diagnostic{
+					Code:    diag.CodeParseUnsupported,
+					Message: "attributes are currently supported only before function declarations",
+					Span:    p.span(p.cur),
+				})
+				p.syncUnknownMember()
+				continue
+			}
+			if fn := p.parseFunctionSig(selectorOverride); fn != nil {
+				iface.Functions = append(iface.Functions, *fn)
+			}
+		case lexer.TokenKwFn:
+			if fn := p.parseFunctionSig(""); fn != nil {
+				iface.Functions = append(iface.Functions, *fn)
+			}
+		case lexer.TokenKwEvent:
+			if ev := p.parseEventDecl(); ev != nil {
+				iface.Events = append(iface.Events, *ev)
+			}
+		case lexer.TokenKwError:
+			p.next()
+			if p.cur.Type == lexer.TokenIdent {
+				p.next()
+			}
+			if p.cur.Type == lexer.TokenLParen && !p.consumePaired(lexer.TokenLParen, lexer.TokenRParen, "error parameter list") {
+				return
+			}
+			if p.cur.Type == lexer.TokenSemicolon {
+				p.next()
+			}
+		default:
+			p.addDiag(diag.Diagnostic{
+				Code:    diag.CodeParseUnexpected,
+				Message: fmt.Sprintf("unexpected token '%s' in interface body", p.cur.Literal),
+				Span:    p.span(p.cur),
+			})
+			p.next()
+			p.syncUnknownMember()
+		}
+	}
+	if !p.expect(lexer.TokenRBrace, diag.CodeParseUnexpected, "expected '}' to close interface body") {
+		return
+	}
+
+	mod.Interfaces = append(mod.Interfaces, iface)
+	mod.SkippedTopDecls = append(mod.SkippedTopDecls, ast.SkippedTopDecl{
+		Kind: "interface",
+		Name: nameTok.Literal,
+	})
+}
+
+func (p *Parser) parseLibraryDecl(mod *ast.Module) {
+	if !p.expect(lexer.TokenKwLibrary, diag.CodeParseUnexpected, "expected 'library'") {
+		return
+	}
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected library name") {
+		return
+	}
+	if !p.expect(lexer.TokenLBrace, diag.CodeParseUnexpected, "expected '{' before library body") {
+		return
+	}
+
+	lib := ast.LibraryDecl{Name: nameTok.Literal}
+	for p.cur.Type != lexer.TokenRBrace && p.cur.Type != lexer.TokenEOF {
+		if p.cur.Type != lexer.TokenKwFn {
+			p.addDiag(diag.Diagnostic{
+				Code:    diag.CodeParseUnsupported,
+				Message: fmt.Sprintf("unsupported library member starting at token '%s' (libraries contain only functions)", p.cur.Literal),
+				Span:    p.span(p.cur),
+			})
+			p.next()
+			p.syncUnknownMember()
+			continue
+		}
+		if fn := p.parseFunctionDecl(""); fn != nil {
+			lib.Functions = append(lib.Functions, *fn)
+		}
+	}
+	if !p.expect(lexer.TokenRBrace, diag.CodeParseUnexpected, "expected '}' to close library body") {
+		return
+	}
+
+	mod.Libraries = append(mod.Libraries, lib)
+	mod.SkippedTopDecls = append(mod.SkippedTopDecls, ast.SkippedTopDecl{
+		Kind: "library",
+		Name: nameTok.Literal,
+	})
+}
+
+// parseFunctionSig parses a declaration-only `fn` terminated by ';'.
+func (p *Parser) parseFunctionSig(selectorOverride string) *ast.FunctionDecl {
+	if !p.expect(lexer.TokenKwFn, diag.CodeParseUnexpected, "expected 'fn'") {
+		return nil
+	}
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected function name") {
+		return nil
+	}
+
+	params, ok := p.parseFieldList(false)
+	if !ok {
+		return nil
+	}
+	var returns []ast.FieldDecl
+	if p.cur.Type == lexer.TokenArrow {
+		p.next()
+		ret, rok := p.parseFieldList(false)
+		if !rok {
+			return nil
+		}
+		returns = ret
+	}
+
+	var modifiers []string
+	for p.cur.Type != lexer.TokenEOF && p.cur.Type != lexer.TokenSemicolon && p.cur.Type != lexer.TokenRBrace {
+		if p.cur.Type == lexer.TokenLBrace {
+			p.addDiag(diag.Diagnostic{
+				Code:    diag.CodeParseUnsupported,
+				Message: "interface functions cannot have a body",
+				Span:    p.span(p.cur),
+			})
+			_ = p.consumeBlock("function body")
+			return nil
+		}
+		modifiers = append(modifiers, p.cur.Literal)
+		p.next()
+	}
+	if !p.expect(lexer.TokenSemicolon, diag.CodeParseUnexpected, "expected ';' after interface function declaration") {
+		return nil
+	}
+
+	return &ast.FunctionDecl{
+		Name:             nameTok.Literal,
+		SelectorOverride: selectorOverride,
+		Params:           params,
+		Returns:          returns,
+		Modifiers:        modifiers,
+	}
+}
+
 func (p *Parser) parseContractMember(contract *ast.ContractDecl) {
 	if p.cur.Type == lexer.TokenAt {
 		selectorOverride, ok := p.parseFunctionAttributes()
@@ -132,6 +383,16 @@ func (p *Parser) parseContractMember(contract *ast.ContractDecl) {
 			return
 		}
 		contract.Storage = st
+	case lexer.TokenKwConst:
+		c := p.parseConstantDecl()
+		if c != nil {
+			contract.Constants = append(contract.Constants, *c)
+		}
+	case lexer.TokenKwImmutable:
+		im := p.parseImmutableDecl()
+		if im != nil {
+			contract.Immutables = append(contract.Immutables, *im)
+		}
 	case lexer.TokenKwEvent:
 		ev := p.parseEventDecl()
 		if ev != nil {
@@ -339,6 +600,86 @@ func (p *Parser) parseStorageSlot() *ast.StorageSlot {
 	return &ast.StorageSlot{Name: nameTok.Literal, Type: typ}
 }
 
+// parseConstantDecl parses: const NAME: T = expr;
+func (p *Parser) parseConstantDecl() *ast.ConstantDecl {
+	if !p.expect(lexer.TokenKwConst, diag.CodeParseUnexpected, "expected 'const'") {
+		return nil
+	}
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected constant name") {
+		p.syncUnknownMember()
+		return nil
+	}
+	if !p.expect(lexer.TokenColon, diag.CodeParseUnexpected, "expected ':' after constant name") {
+		p.syncUnknownMember()
+		return nil
+	}
+	typ := p.parseTypeUntil(map[lexer.Type]bool{
+		lexer.TokenAssign:    true,
+		lexer.TokenSemicolon: true,
+	})
+	if typ == "" {
+		p.addDiag(diag.Diagnostic{
+			Code:    diag.CodeParseUnexpected,
+			Message: "expected constant type",
+			Span:    p.span(p.cur),
+		})
+	}
+	if !p.expect(lexer.TokenAssign, diag.CodeParseUnexpected, "expected '=' in constant declaration") {
+		p.syncUnknownMember()
+		return nil
+	}
+	value, ok := p.parseExpression(map[lexer.Type]bool{lexer.TokenSemicolon: true})
+	if !ok {
+		p.syncUnknownMember()
+		return nil
+	}
+	if !p.expect(lexer.TokenSemicolon, diag.CodeParseUnexpected, "expected ';' after constant declaration") {
+		return nil
+	}
+	return &ast.ConstantDecl{Name: nameTok.Literal, Type: typ, Value: value}
+}
+
+// parseImmutableDecl parses: immutable NAME: T;
+func (p *Parser) parseImmutableDecl() *ast.ImmutableDecl {
+	if !p.expect(lexer.TokenKwImmutable, diag.CodeParseUnexpected, "expected 'immutable'") {
+		return nil
+	}
+	nameTok := p.cur
+	if !p.expect(lexer.TokenIdent, diag.CodeParseUnexpected, "expected immutable name") {
+		p.syncUnknownMember()
+		return nil
+	}
+	if !p.expect(lexer.TokenColon, diag.CodeParseUnexpected, "expected ':' after immutable name") {
+		p.syncUnknownMember()
+		return nil
+	}
+	typ := p.parseTypeUntil(map[lexer.Type]bool{
+		lexer.TokenAssign:    true,
+		lexer.TokenSemicolon: true,
+	})
+	if typ == "" {
+		p.addDiag(diag.Diagnostic{
+			Code:    diag.CodeParseUnexpected,
+			Message: "expected immutable type",
+			Span:    p.span(p.cur),
+		})
+	}
+	if p.cur.Type == lexer.TokenAssign {
+		p.addDiag(diag.Diagnostic{
+			Code:    diag.CodeParseUnsupported,
+			Message: "immutable declarations cannot have an initializer; assign them in the constructor",
+			Span:    p.span(p.cur),
+		})
+		p.syncUnknownMember()
+		return nil
+	}
+	if !p.expect(lexer.TokenSemicolon, diag.CodeParseUnexpected, "expected ';' after immutable declaration") {
+		return nil
+	}
+	return &ast.ImmutableDecl{Name: nameTok.Literal, Type: typ}
+}
+
 func (p *Parser) parseEventDecl() *ast.EventDecl {
 	if !p.expect(lexer.TokenKwEvent, diag.CodeParseUnexpected, "expected 'event'") {
 		return nil
@@ -361,6 +702,7 @@ func (p *Parser) parseEventDecl() *ast.EventDecl {
 }
 
 func (p *Parser) parseFunctionDecl(selectorOverride string) *ast.FunctionDecl {
+	pos := p.pos(p.cur)
 	if !p.expect(lexer.TokenKwFn, diag.CodeParseUnexpected, "expected 'fn'") {
 		return nil
 	}
@@ -390,6 +732,7 @@ func (p *Parser) parseFunctionDecl(selectorOverride string) *ast.FunctionDecl {
 	}
 
 	return &ast.FunctionDecl{
+		Pos:              pos,
 		Name:             nameTok.Literal,
 		SelectorOverride: selectorOverride,
 		Params:           params,
@@ -400,6 +743,7 @@ func (p *Parser) parseFunctionDecl(selectorOverride string) *ast.FunctionDecl {
 }
 
 func (p *Parser) parseConstructorDecl() *ast.ConstructorDecl {
+	pos := p.pos(p.cur)
 	if !p.expect(lexer.TokenKwConstructor, diag.CodeParseUnexpected, "expected 'constructor'") {
 		return nil
 	}
@@ -420,6 +764,7 @@ func (p *Parser) parseConstructorDecl() *ast.ConstructorDecl {
 	}
 
 	return &ast.ConstructorDecl{
+		Pos:       pos,
 		Params:    params,
 		Modifiers: modifiers,
 		Body:      body,
@@ -427,6 +772,7 @@ func (p *Parser) parseConstructorDecl() *ast.ConstructorDecl {
 }
 
 func (p *Parser) parseFallbackDecl() *ast.FallbackDecl {
+	pos := p.pos(p.cur)
 	if !p.expect(lexer.TokenKwFallback, diag.CodeParseUnexpected, "expected 'fallback'") {
 		return nil
 	}
@@ -443,12 +789,12 @@ func (p *Parser) parseFallbackDecl() *ast.FallbackDecl {
 			})
 		}
 	}
-	_ = p.parseModifiersUntilBlock()
+	modifiers := p.parseModifiersUntilBlock()
 	body, ok := p.parseStatementBlock("fallback body")
 	if !ok {
 		return nil
 	}
-	return &ast.FallbackDecl{Body: body}
+	return &ast.FallbackDecl{Pos: pos, Modifiers: modifiers, Body: body}
 }
 
 func (p *Parser) parseFieldList(allowIndexed bool) ([]ast.FieldDecl, bool) {
@@ -623,6 +969,15 @@ func (p *Parser) parseStatementBlock(what string) ([]ast.Statement, bool) {
 }
 
 func (p *Parser) parseStatement() (ast.Statement, bool) {
+	pos := p.pos(p.cur)
+	stmt, ok := p.parseStatementKind()
+	if ok && !stmt.Pos.IsValid() {
+		stmt.Pos = pos
+	}
+	return stmt, ok
+}
+
+func (p *Parser) parseStatementKind() (ast.Statement, bool) {
 	switch p.cur.Type {
 	case lexer.TokenSemicolon:
 		p.next()
@@ -860,10 +1215,12 @@ func (p *Parser) parseIfStatement() (ast.Statement, bool) {
 	if p.cur.Type == lexer.TokenKwElse {
 		p.next()
 		if p.cur.Type == lexer.TokenKwIf {
+			pos := p.pos(p.cur)
 			nested, ok := p.parseIfStatement()
 			if !ok {
 				return ast.Statement{}, false
 			}
+			nested.Pos = pos
 			stmt.Else = []ast.Statement{nested}
 			return stmt, true
 		}
@@ -907,6 +1264,7 @@ func (p *Parser) parseForStatement() (ast.Statement, bool) {
 
 	var init *ast.Statement
 	if p.cur.Type != lexer.TokenSemicolon {
+		initPos := p.pos(p.cur)
 		switch p.cur.Type {
 		case lexer.TokenKwLet:
 			s, ok := p.parseLetStatement(lexer.TokenSemicolon)
@@ -931,6 +1289,7 @@ func (p *Parser) parseForStatement() (ast.Statement, bool) {
 			s := ast.Statement{Kind: "expr", Expr: expr}
 			init = &s
 		}
+		init.Pos = initPos
 	} else {
 		p.next()
 	}
@@ -1127,9 +1486,28 @@ func (p *Parser) parsePostfixExpr(left *ast.Expr) (*ast.Expr, bool) {
 		return &ast.Expr{Kind: "member", Object: left, Member: memberTok.Literal}, true
 	case lexer.TokenLBracket:
 		p.next()
-		idx, ok := p.parseExpression(map[lexer.Type]bool{lexer.TokenRBracket: true})
-		if !ok {
-			return nil, false
+		stop := map[lexer.Type]bool{lexer.TokenRBracket: true, lexer.TokenColon: true}
+		var idx *ast.Expr
+		if p.cur.Type != lexer.TokenColon {
+			var ok bool
+			if idx, ok = p.parseExpression(stop); !ok {
+				return nil, false
+			}
+		}
+		if p.cur.Type == lexer.TokenColon {
+			// Slice: x[start:end], either bound optional.
+			p.next()
+			var end *ast.Expr
+			if p.cur.Type != lexer.TokenRBracket {
+				var ok bool
+				if end, ok = p.parseExpression(stop); !ok {
+					return nil, false
+				}
+			}
+			if !p.expect(lexer.TokenRBracket, diag.CodeParseUnexpected, "expected ']' after slice expression") {
+				return nil, false
+			}
+			return &ast.Expr{Kind: "slice", Object: left, Left: idx, Right: end}, true
 		}
 		if !p.expect(lexer.TokenRBracket, diag.CodeParseUnexpected, "expected ']' after index expression") {
 			return nil, false
@@ -1265,6 +1643,8 @@ func (p *Parser) syncUnknownMember() {
 func (p *Parser) isContractMemberStart(tt lexer.Type) bool {
 	switch tt {
 	case lexer.TokenKwStorage,
+		lexer.TokenKwConst,
+		lexer.TokenKwImmutable,
 		lexer.TokenKwEvent,
 		lexer.TokenKwFn,
 		lexer.TokenKwConstructor,
@@ -1308,6 +1688,10 @@ func (p *Parser) addDiag(d diag.Diagnostic) {
 	p.diags = append(p.diags, d)
 }
 
+func (p *Parser) pos(tok lexer.Token) ast.Pos {
+	return ast.Pos{File: p.filename, Line: tok.Start.Line, Column: tok.Start.Column}
+}
+
 func (p *Parser) span(tok lexer.Token) diag.Span {
 	return diag.Span{
 		File: p.filename,
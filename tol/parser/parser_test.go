@@ -294,3 +294,230 @@ contract Demo {
 		t.Fatalf("unexpected unary bit-not branch: %#v", setExpr.Left.Left)
 	}
 }
+
+func TestParseConstantAndImmutableDecls(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  const ONE: u256 = 10 ^ 18;
+  const NAME: string = "demo";
+  immutable owner: address;
+  constructor(o: address) { set owner = o; }
+}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if mod == nil || mod.Contract == nil {
+		t.Fatalf("expected contract")
+	}
+	if len(mod.Contract.Constants) != 2 {
+		t.Fatalf("unexpected constant count: %d", len(mod.Contract.Constants))
+	}
+	one := mod.Contract.Constants[0]
+	if one.Name != "ONE" || one.Type != "u256" || one.Value == nil || one.Value.Kind != "binary" || one.Value.Op != "^" {
+		t.Fatalf("unexpected constant decl: %#v", one)
+	}
+	if len(mod.Contract.Immutables) != 1 || mod.Contract.Immutables[0].Name != "owner" || mod.Contract.Immutables[0].Type != "address" {
+		t.Fatalf("unexpected immutables: %#v", mod.Contract.Immutables)
+	}
+}
+
+func TestParseImportsAndBaseContracts(t *testing.T) {
+	src := []byte(`
+tol 0.2
+import ITRC20 from "./itrc20.tol";
+import Ownable from "../access/ownable.tol"
+interface IHook {
+  fn hook() public;
+}
+contract Token is Ownable, Pausable {
+  fn transfer(from: address, to: address) public { return; }
+}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(mod.Imports) != 2 {
+		t.Fatalf("unexpected import count: %d", len(mod.Imports))
+	}
+	if mod.Imports[0].Name != "ITRC20" || mod.Imports[0].Path != "./itrc20.tol" || mod.Imports[1].Path != "../access/ownable.tol" {
+		t.Fatalf("unexpected imports: %#v", mod.Imports)
+	}
+	if len(mod.SkippedTopDecls) != 1 || mod.SkippedTopDecls[0].Name != "IHook" {
+		t.Fatalf("unexpected top decls: %#v", mod.SkippedTopDecls)
+	}
+	if mod.Contract == nil || len(mod.Contract.Bases) != 2 || mod.Contract.Bases[0] != "Ownable" || mod.Contract.Bases[1] != "Pausable" {
+		t.Fatalf("unexpected contract bases: %#v", mod.Contract)
+	}
+}
+
+func TestParseInterfaceMembers(t *testing.T) {
+	src := []byte(`
+tol 0.2
+interface ITRC20 {
+  fn totalSupply() -> (supply: u256) public view;
+  @selector("0x12345678")
+  fn transfer(to: address, amount: u256) -> (ok: bool) external;
+  event Transfer(from: address indexed, to: address indexed, value: u256);
+  error Insufficient(need: u256);
+}
+contract Demo {}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(mod.Interfaces) != 1 || len(mod.SkippedTopDecls) != 1 {
+		t.Fatalf("unexpected interfaces: %#v", mod.Interfaces)
+	}
+	iface := mod.Interfaces[0]
+	if iface.Name != "ITRC20" || len(iface.Functions) != 2 || len(iface.Events) != 1 {
+		t.Fatalf("unexpected interface decl: %#v", iface)
+	}
+	tr := iface.Functions[1]
+	if tr.SelectorOverride != "0x12345678" || len(tr.Params) != 2 || len(tr.Returns) != 1 || tr.Body != nil {
+		t.Fatalf("unexpected interface function: %#v", tr)
+	}
+}
+
+func TestParseRejectsInterfaceFunctionBody(t *testing.T) {
+	src := []byte(`
+tol 0.2
+interface IBad {
+  fn f() public { return; }
+}
+contract Demo {}
+`)
+	_, diags := ParseFile("<test>", src)
+	if !diags.HasErrors() || diags[0].Message != "interface functions cannot have a body" {
+		t.Fatalf("expected interface body diagnostic, got %v", diags)
+	}
+}
+
+func TestParseSupportOnlyModuleWithoutContract(t *testing.T) {
+	src := []byte(`
+tol 0.2
+interface ITRC20 {
+  fn totalSupply() -> (supply: u256) public view;
+}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if mod.Contract != nil || len(mod.SkippedTopDecls) != 1 {
+		t.Fatalf("unexpected module: %#v", mod)
+	}
+}
+
+func TestParseRejectsMalformedImport(t *testing.T) {
+	src := []byte(`
+tol 0.2
+import ITRC20 "./itrc20.tol";
+contract Demo {}
+`)
+	_, diags := ParseFile("<test>", src)
+	if !diags.HasErrors() || diags[0].Message != "expected 'from' after imported symbol name" {
+		t.Fatalf("expected malformed import diagnostic, got %v", diags)
+	}
+}
+
+func TestParseRejectsImmutableInitializer(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  immutable owner: u256 = 1;
+  fn f() public { return; }
+}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if !diags.HasErrors() {
+		t.Fatalf("expected diagnostics")
+	}
+	if mod == nil || mod.Contract == nil || len(mod.Contract.Functions) != 1 {
+		t.Fatalf("expected parser to recover to following members: %#v", mod)
+	}
+}
+
+func TestParseLibraryDecl(t *testing.T) {
+	src := []byte(`
+tol 0.2
+library SafeMath {
+  fn add(a: u256, b: u256) -> (c: u256) internal pure {
+    return a + b;
+  }
+  fn sub(a: u256, b: u256) -> (c: u256) {
+    return a - b;
+  }
+}
+contract Demo {}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(mod.Libraries) != 1 || len(mod.SkippedTopDecls) != 1 || mod.SkippedTopDecls[0].Kind != "library" {
+		t.Fatalf("unexpected libraries: %#v", mod.Libraries)
+	}
+	lib := mod.Libraries[0]
+	if lib.Name != "SafeMath" || len(lib.Functions) != 2 || len(lib.Functions[0].Body) != 1 {
+		t.Fatalf("unexpected library decl: %#v", lib)
+	}
+}
+
+func TestParseRejectsLibraryStorage(t *testing.T) {
+	src := []byte(`
+tol 0.2
+library Bad {
+  storage {
+    slot x: u256;
+  }
+}
+contract Demo {}
+`)
+	_, diags := ParseFile("<test>", src)
+	if !diags.HasErrors() || diags[0].Message != "unsupported library member starting at token 'storage' (libraries contain only functions)" {
+		t.Fatalf("expected library member diagnostic, got %v", diags)
+	}
+}
+
+func TestParseSliceExpressions(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  fn run() public {
+    let a: bytes = msg.data[4:];
+    let b: bytes = a[:n + 1];
+    let c: bytes = a[1:2];
+    let d: u256 = xs[i];
+  }
+}
+`)
+	mod, diags := ParseFile("<test>", src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	body := mod.Contract.Functions[0].Body
+	a := body[0].Expr
+	if a.Kind != "slice" || a.Object.Kind != "member" || a.Left == nil || a.Left.Value != "4" || a.Right != nil {
+		t.Fatalf("unexpected open-ended slice: %#v", a)
+	}
+	b := body[1].Expr
+	if b.Kind != "slice" || b.Left != nil || b.Right == nil || b.Right.Kind != "binary" {
+		t.Fatalf("unexpected prefix slice: %#v", b)
+	}
+	if c := body[2].Expr; c.Kind != "slice" || c.Left == nil || c.Right == nil {
+		t.Fatalf("unexpected bounded slice: %#v", c)
+	}
+	if d := body[3].Expr; d.Kind != "index" || d.Index == nil {
+		t.Fatalf("expected plain index to stay an index: %#v", d)
+	}
+
+	_, diags = ParseFile("<test>", []byte("tol 0.2\ncontract Demo { fn run() public { let a: bytes = x[1:2:3]; } }\n"))
+	if !diags.HasErrors() || diags[0].Message != "expected ']' after slice expression" {
+		t.Fatalf("expected slice diagnostic, got %v", diags)
+	}
+}
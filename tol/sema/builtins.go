@@ -0,0 +1,104 @@
+package sema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// builtinSig is the TOL type of a deterministic host builtin.
+type builtinSig struct {
+	params []string
+	result string
+	// optional is the number of trailing params that may be omitted.
+	optional int
+}
+
+func (s builtinSig) String() string {
+	required := len(s.params) - s.optional
+	out := "(" + strings.Join(s.params[:required], ", ")
+	if s.optional > 0 {
+		sep := "["
+		if required > 0 {
+			sep = "[, "
+		}
+		out += sep + strings.Join(s.params[required:], ", ") + "]"
+	}
+	return out + ") -> " + s.result
+}
+
+func (s builtinSig) accepts(n int) bool {
+	return n >= len(s.params)-s.optional && n <= len(s.params)
+}
+
+func (s builtinSig) arity() string {
+	if s.optional == 0 {
+		return fmt.Sprintf("%d", len(s.params))
+	}
+	return fmt.Sprintf("%d to %d", len(s.params)-s.optional, len(s.params))
+}
+
+// pureBuiltins are the side-effect-free crypto builtins of spec §10. They
+// are callable from `pure` functions and libraries; the names are reserved.
+var pureBuiltins = map[string]builtinSig{
+	"keccak256": {params: []string{"bytes"}, result: "bytes32"},
+	"sha256":    {params: []string{"bytes"}, result: "bytes32"},
+	"ripemd160": {params: []string{"bytes"}, result: "bytes32"},
+	"ecrecover": {params: []string{"bytes32", "u8", "bytes32", "bytes32"}, result: "address"},
+
+	"ed25519_verify":   {params: []string{"bytes32", "bytes", "bytes"}, result: "bool"},
+	"secp256k1_verify": {params: []string{"bytes", "bytes32", "bytes"}, result: "bool"},
+
+	"merkle_verify": {params: []string{"bytes32", "bytes32", "bytes32[]"}, result: "bool"},
+}
+
+// mathBuiltins are the deterministic `math.<name>` intrinsics of spec §10.1,
+// keyed by member name. Like all math members they are pure.
+var mathBuiltins = map[string]builtinSig{
+	"addmod": {params: []string{"u256", "u256", "u256"}, result: "u256"},
+	"mulmod": {params: []string{"u256", "u256", "u256"}, result: "u256"},
+	"muldiv": {params: []string{"u256", "u256", "u256", "EstimationMode"}, result: "u256", optional: 1},
+	"sqrt":   {params: []string{"u256"}, result: "u256"},
+	"log2":   {params: []string{"u256"}, result: "u256"},
+	"log10":  {params: []string{"u256"}, result: "u256"},
+	"log256": {params: []string{"u256"}, result: "u256"},
+
+	"binaryLog": {params: []string{"u256", "u256", "EstimationMode"}, result: "i256"},
+	"pow2":      {params: []string{"i256", "u256", "EstimationMode"}, result: "u256"},
+}
+
+// checkBuiltinCall reports calls to a builtin with the wrong argument count.
+func checkBuiltinCall(filename, name string, e *ast.Expr, diags *diag.Diagnostics) {
+	sig, ok := pureBuiltins[name]
+	if !ok || sig.accepts(len(e.Args)) {
+		return
+	}
+	*diags = append(*diags, diag.Diagnostic{
+		Code:    diag.CodeSemaCallArity,
+		Message: fmt.Sprintf("builtin '%s%s' expects %s argument(s), got %d", name, sig, sig.arity(), len(e.Args)),
+		Span:    defaultSpan(filename),
+	})
+}
+
+// checkMathBuiltinCall reports `math.<name>(...)` calls to a known math
+// intrinsic with the wrong argument count.
+func checkMathBuiltinCall(filename string, e *ast.Expr, diags *diag.Diagnostics) {
+	callee := stripParens(e.Callee)
+	if callee == nil || callee.Kind != "member" {
+		return
+	}
+	if obj := stripParens(callee.Object); obj == nil || obj.Kind != "ident" || strings.TrimSpace(obj.Value) != "math" {
+		return
+	}
+	sig, ok := mathBuiltins[callee.Member]
+	if !ok || sig.accepts(len(e.Args)) {
+		return
+	}
+	*diags = append(*diags, diag.Diagnostic{
+		Code:    diag.CodeSemaCallArity,
+		Message: fmt.Sprintf("builtin 'math.%s%s' expects %s argument(s), got %d", callee.Member, sig, sig.arity(), len(e.Args)),
+		Span:    defaultSpan(filename),
+	})
+}
@@ -0,0 +1,643 @@
+package sema
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// ConstValue is a compile-time folded contract constant.
+type ConstValue struct {
+	Kind  string // "number", "string" or "bool"
+	Value string // decimal digits, unquoted text, or "true"/"false"
+}
+
+var (
+	constUint256Mod = new(big.Int).Lsh(big.NewInt(1), 256)
+	constUint256Max = new(big.Int).Sub(new(big.Int).Set(constUint256Mod), big.NewInt(1))
+	constInt256Max  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(1))
+)
+
+type constEvaluator struct {
+	decls    map[string]ast.ConstantDecl
+	values   map[string]ConstValue
+	visiting map[string]bool
+}
+
+// foldContractConstants evaluates all contract-level constant initializers.
+// Constants may reference each other in any order; cycles are rejected.
+func foldContractConstants(filename string, consts []ast.ConstantDecl, diags *diag.Diagnostics) map[string]ConstValue {
+	ev := &constEvaluator{
+		decls:    map[string]ast.ConstantDecl{},
+		values:   map[string]ConstValue{},
+		visiting: map[string]bool{},
+	}
+	for _, c := range consts {
+		name := strings.TrimSpace(c.Name)
+		if _, exists := ev.decls[name]; !exists {
+			ev.decls[name] = c
+		}
+	}
+	failed := map[string]struct{}{}
+	for _, c := range consts {
+		name := strings.TrimSpace(c.Name)
+		if _, done := ev.values[name]; done {
+			continue
+		}
+		if _, done := failed[name]; done {
+			continue
+		}
+		if _, err := ev.evalNamed(name); err != nil {
+			failed[name] = struct{}{}
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaConstExpr,
+				Message: fmt.Sprintf("constant '%s': %v", name, err),
+				Span:    defaultSpan(filename),
+			})
+		}
+	}
+	return ev.values
+}
+
+func (ev *constEvaluator) evalNamed(name string) (ConstValue, error) {
+	if v, ok := ev.values[name]; ok {
+		return v, nil
+	}
+	decl, ok := ev.decls[name]
+	if !ok {
+		return ConstValue{}, fmt.Errorf("'%s' is not a compile-time constant", name)
+	}
+	if ev.visiting[name] {
+		return ConstValue{}, fmt.Errorf("cyclic constant reference through '%s'", name)
+	}
+	ev.visiting[name] = true
+	defer delete(ev.visiting, name)
+
+	if decl.Value == nil {
+		return ConstValue{}, fmt.Errorf("missing initializer")
+	}
+	v, err := ev.eval(decl.Value)
+	if err != nil {
+		return ConstValue{}, err
+	}
+	v, err = coerceConstValue(decl.Type, v)
+	if err != nil {
+		return ConstValue{}, err
+	}
+	ev.values[name] = v
+	return v, nil
+}
+
+func (ev *constEvaluator) eval(e *ast.Expr) (ConstValue, error) {
+	if e == nil {
+		return ConstValue{}, fmt.Errorf("missing expression")
+	}
+	switch e.Kind {
+	case "paren":
+		return ev.eval(e.Left)
+	case "number":
+		if strings.Contains(e.Value, ".") {
+			return ConstValue{}, fmt.Errorf("fractional literal '%s' is not supported", e.Value)
+		}
+		n, ok := new(big.Int).SetString(strings.TrimSpace(e.Value), 10)
+		if !ok {
+			return ConstValue{}, fmt.Errorf("invalid number literal '%s'", e.Value)
+		}
+		if n.Cmp(constUint256Max) > 0 {
+			return ConstValue{}, fmt.Errorf("number literal '%s' exceeds uint256 range", e.Value)
+		}
+		return numberConst(n), nil
+	case "string":
+		s, err := strconv.Unquote(strings.TrimSpace(e.Value))
+		if err != nil {
+			return ConstValue{}, fmt.Errorf("invalid string literal %s", e.Value)
+		}
+		return ConstValue{Kind: "string", Value: s}, nil
+	case "ident":
+		switch strings.TrimSpace(e.Value) {
+		case "true", "false":
+			return ConstValue{Kind: "bool", Value: strings.TrimSpace(e.Value)}, nil
+		}
+		return ev.evalNamed(strings.TrimSpace(e.Value))
+	case "call":
+		if isSelectorBuiltinCallExpr(e) && len(e.Args) == 1 && isSelectorSignatureLiteralExpr(e.Args[0]) {
+			sig, _ := strconv.Unquote(strings.TrimSpace(stripParens(e.Args[0]).Value))
+			return ConstValue{Kind: "string", Value: selectorHexFromSignature(sig)}, nil
+		}
+		return ConstValue{}, fmt.Errorf("function calls are not allowed in constant expressions")
+	case "unary":
+		return ev.evalUnary(e)
+	case "binary":
+		return ev.evalBinary(e)
+	default:
+		return ConstValue{}, fmt.Errorf("%s expression is not a compile-time constant", e.Kind)
+	}
+}
+
+func (ev *constEvaluator) evalUnary(e *ast.Expr) (ConstValue, error) {
+	v, err := ev.eval(e.Right)
+	if err != nil {
+		return ConstValue{}, err
+	}
+	switch e.Op {
+	case "!":
+		if v.Kind != "bool" {
+			return ConstValue{}, fmt.Errorf("operator '!' requires a bool operand")
+		}
+		return boolConst(v.Value != "true"), nil
+	case "+", "-", "~":
+		if v.Kind != "number" {
+			return ConstValue{}, fmt.Errorf("operator '%s' requires a numeric operand", e.Op)
+		}
+		n := constBig(v)
+		switch e.Op {
+		case "-":
+			n.Neg(n)
+		case "~":
+			n.Xor(n, constUint256Max)
+		}
+		return numberConst(n), nil
+	default:
+		return ConstValue{}, fmt.Errorf("unsupported unary operator '%s'", e.Op)
+	}
+}
+
+func (ev *constEvaluator) evalBinary(e *ast.Expr) (ConstValue, error) {
+	l, err := ev.eval(e.Left)
+	if err != nil {
+		return ConstValue{}, err
+	}
+	r, err := ev.eval(e.Right)
+	if err != nil {
+		return ConstValue{}, err
+	}
+	switch e.Op {
+	case "&&", "||":
+		if l.Kind != "bool" || r.Kind != "bool" {
+			return ConstValue{}, fmt.Errorf("operator '%s' requires bool operands", e.Op)
+		}
+		if e.Op == "&&" {
+			return boolConst(l.Value == "true" && r.Value == "true"), nil
+		}
+		return boolConst(l.Value == "true" || r.Value == "true"), nil
+	case "==", "!=":
+		if l.Kind != r.Kind {
+			return ConstValue{}, fmt.Errorf("operator '%s' requires operands of the same kind (got %s and %s)", e.Op, l.Kind, r.Kind)
+		}
+		eq := l.Value == r.Value
+		if l.Kind == "number" {
+			eq = constBig(l).Cmp(constBig(r)) == 0
+		}
+		if e.Op == "!=" {
+			eq = !eq
+		}
+		return boolConst(eq), nil
+	}
+
+	if l.Kind != "number" || r.Kind != "number" {
+		return ConstValue{}, fmt.Errorf("operator '%s' requires numeric operands", e.Op)
+	}
+	a, b := constBig(l), constBig(r)
+	switch e.Op {
+	case "<":
+		return boolConst(a.Cmp(b) < 0), nil
+	case "<=":
+		return boolConst(a.Cmp(b) <= 0), nil
+	case ">":
+		return boolConst(a.Cmp(b) > 0), nil
+	case ">=":
+		return boolConst(a.Cmp(b) >= 0), nil
+	case "+":
+		return numberConst(a.Add(a, b)), nil
+	case "-":
+		return numberConst(a.Sub(a, b)), nil
+	case "*":
+		return numberConst(a.Mul(a, b)), nil
+	case "/", "%":
+		if b.Sign() == 0 {
+			return ConstValue{}, fmt.Errorf("division by zero")
+		}
+		if e.Op == "/" {
+			return numberConst(a.Quo(a, b)), nil
+		}
+		return numberConst(a.Mod(a, b)), nil
+	case "^":
+		// Lowered to the VM power opcode, so fold it the same way.
+		return numberConst(a.Exp(a, b, constUint256Mod)), nil
+	case "&":
+		return numberConst(a.And(a, b)), nil
+	case "|":
+		return numberConst(a.Or(a, b)), nil
+	case "<<", ">>":
+		if !b.IsUint64() || b.Uint64() >= 256 {
+			return numberConst(new(big.Int)), nil
+		}
+		if e.Op == "<<" {
+			return numberConst(a.Lsh(a, uint(b.Uint64()))), nil
+		}
+		return numberConst(a.Rsh(a, uint(b.Uint64()))), nil
+	default:
+		return ConstValue{}, fmt.Errorf("unsupported binary operator '%s'", e.Op)
+	}
+}
+
+// coerceConstValue checks a folded value against the declared constant type.
+func coerceConstValue(typeName string, v ConstValue) (ConstValue, error) {
+	t := normalizeSelectorType(typeName)
+	switch {
+	case t == "bool":
+		if v.Kind != "bool" {
+			return ConstValue{}, fmt.Errorf("type 'bool' requires a bool value, got %s", v.Kind)
+		}
+	case t == "string":
+		if v.Kind != "string" {
+			return ConstValue{}, fmt.Errorf("type 'string' requires a string value, got %s", v.Kind)
+		}
+	case strings.HasPrefix(t, "u"):
+		bits, ok := integerTypeBits(t[1:])
+		if !ok {
+			return ConstValue{}, fmt.Errorf("unsupported constant type '%s'", t)
+		}
+		if v.Kind != "number" {
+			return ConstValue{}, fmt.Errorf("type '%s' requires a numeric value, got %s", t, v.Kind)
+		}
+		if constBig(v).BitLen() > bits {
+			return ConstValue{}, fmt.Errorf("value %s does not fit in type '%s'", v.Value, t)
+		}
+	case strings.HasPrefix(t, "i"):
+		bits, ok := integerTypeBits(t[1:])
+		if !ok {
+			return ConstValue{}, fmt.Errorf("unsupported constant type '%s'", t)
+		}
+		if v.Kind != "number" {
+			return ConstValue{}, fmt.Errorf("type '%s' requires a numeric value, got %s", t, v.Kind)
+		}
+		// Folded values are two's complement words; read them back signed.
+		n := constBig(v)
+		if n.Cmp(constInt256Max) > 0 {
+			n.Sub(n, constUint256Mod)
+		}
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return ConstValue{}, fmt.Errorf("value %s does not fit in type '%s'", n.Text(10), t)
+		}
+	case t == "address" || t == "bytes32" || t == "bytes4":
+		size := 32
+		if t == "bytes4" {
+			size = 4
+		}
+		if v.Kind != "string" || !isHexLiteral(v.Value, size) {
+			return ConstValue{}, fmt.Errorf("type '%s' requires a 0x-prefixed literal of %d hex digits", t, 2*size)
+		}
+	default:
+		return ConstValue{}, fmt.Errorf("unsupported constant type '%s'", t)
+	}
+	return v, nil
+}
+
+// isHexLiteral reports whether s is "0x" followed by exactly size bytes of
+// hex digits.
+func isHexLiteral(s string, size int) bool {
+	if !strings.HasPrefix(s, "0x") || len(s) != 2+2*size {
+		return false
+	}
+	for _, ch := range s[2:] {
+		if (ch < '0' || ch > '9') && (ch < 'a' || ch > 'f') && (ch < 'A' || ch > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func integerTypeBits(s string) (int, bool) {
+	bits, err := strconv.Atoi(s)
+	if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+		return 0, false
+	}
+	return bits, true
+}
+
+func isValueTypeName(typeName string) bool {
+	return classifyStorageKind(typeName) == storageKindScalar
+}
+
+func numberConst(n *big.Int) ConstValue {
+	n.Mod(n, constUint256Mod)
+	return ConstValue{Kind: "number", Value: n.Text(10)}
+}
+
+func boolConst(b bool) ConstValue {
+	if b {
+		return ConstValue{Kind: "bool", Value: "true"}
+	}
+	return ConstValue{Kind: "bool", Value: "false"}
+}
+
+func constBig(v ConstValue) *big.Int {
+	n, _ := new(big.Int).SetString(v.Value, 10)
+	if n == nil {
+		return new(big.Int)
+	}
+	return n
+}
+
+// bindingCheckCtx tracks local shadowing while validating writes to
+// contract-level constants and immutables.
+type bindingCheckCtx struct {
+	consts     map[string]ConstValue
+	immutables map[string]ast.ImmutableDecl
+	scopes     []map[string]struct{}
+}
+
+func (c *bindingCheckCtx) pushScope() {
+	c.scopes = append(c.scopes, map[string]struct{}{})
+}
+
+func (c *bindingCheckCtx) popScope() {
+	if len(c.scopes) == 0 {
+		return
+	}
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *bindingCheckCtx) declareLocal(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return
+	}
+	if len(c.scopes) == 0 {
+		c.pushScope()
+	}
+	c.scopes[len(c.scopes)-1][name] = struct{}{}
+}
+
+func (c *bindingCheckCtx) isLocal(name string) bool {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if _, ok := c.scopes[i][name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyBinding reports the binding kind ("constant"/"immutable") written by target.
+func (c *bindingCheckCtx) readOnlyBinding(target *ast.Expr) (string, string, bool) {
+	root := stripParens(target)
+	for root != nil && (root.Kind == "member" || root.Kind == "index") {
+		root = stripParens(root.Object)
+	}
+	if root == nil || root.Kind != "ident" {
+		return "", "", false
+	}
+	name := strings.TrimSpace(root.Value)
+	if c.isLocal(name) {
+		return "", "", false
+	}
+	if _, ok := c.consts[name]; ok {
+		return name, "constant", true
+	}
+	if _, ok := c.immutables[name]; ok {
+		return name, "immutable", true
+	}
+	return "", "", false
+}
+
+// checkReadOnlyBindingWrites rejects any write to a constant or immutable in
+// function and fallback bodies. Constructor bodies use checkConstructorImmutables.
+func checkReadOnlyBindingWrites(filename string, consts map[string]ConstValue, immutables map[string]ast.ImmutableDecl, params []ast.FieldDecl, body []ast.Statement, diags *diag.Diagnostics) {
+	if len(consts) == 0 && len(immutables) == 0 {
+		return
+	}
+	ctx := &bindingCheckCtx{consts: consts, immutables: immutables}
+	ctx.pushScope()
+	for _, p := range params {
+		ctx.declareLocal(p.Name)
+	}
+	checkReadOnlyWritesInStmts(filename, ctx, body, nil, diags)
+}
+
+// immutableAssignFn is invoked for a write to an immutable at statement level.
+// It returns true when the write is accepted.
+type immutableAssignFn func(name string, s ast.Statement) bool
+
+func checkReadOnlyWritesInStmts(filename string, ctx *bindingCheckCtx, stmts []ast.Statement, onImmutable immutableAssignFn, diags *diag.Diagnostics) {
+	ctx.pushScope()
+	defer ctx.popScope()
+	for _, s := range stmts {
+		switch s.Kind {
+		case "let":
+			checkReadOnlyWritesInExpr(filename, ctx, s.Expr, diags)
+			ctx.declareLocal(s.Name)
+			continue
+		case "set":
+			checkReadOnlyWriteTarget(filename, ctx, s.Target, s, onImmutable, diags)
+		case "expr":
+			if root := stripParens(s.Expr); root != nil && root.Kind == "assign" {
+				checkReadOnlyWriteTarget(filename, ctx, root.Left, s, onImmutable, diags)
+				checkReadOnlyWritesInExpr(filename, ctx, root.Right, diags)
+				continue
+			}
+		case "for":
+			ctx.pushScope()
+			if s.Init != nil {
+				checkReadOnlyWritesInStmts(filename, ctx, []ast.Statement{*s.Init}, nil, diags)
+				if s.Init.Kind == "let" {
+					ctx.declareLocal(s.Init.Name)
+				}
+			}
+			checkReadOnlyWritesInExpr(filename, ctx, s.Cond, diags)
+			checkReadOnlyWritesInExpr(filename, ctx, s.Post, diags)
+			checkReadOnlyWritesInStmts(filename, ctx, s.Body, nil, diags)
+			ctx.popScope()
+			continue
+		}
+		checkReadOnlyWritesInExpr(filename, ctx, s.Expr, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, s.Cond, diags)
+		checkReadOnlyWritesInStmts(filename, ctx, s.Then, nil, diags)
+		checkReadOnlyWritesInStmts(filename, ctx, s.Else, nil, diags)
+		checkReadOnlyWritesInStmts(filename, ctx, s.Body, nil, diags)
+	}
+}
+
+func checkReadOnlyWriteTarget(filename string, ctx *bindingCheckCtx, target *ast.Expr, s ast.Statement, onImmutable immutableAssignFn, diags *diag.Diagnostics) {
+	name, kind, ok := ctx.readOnlyBinding(target)
+	if !ok {
+		return
+	}
+	if kind == "immutable" && onImmutable != nil && stripParens(target).Kind == "ident" && onImmutable(name, s) {
+		return
+	}
+	msg := fmt.Sprintf("cannot assign to constant '%s'", name)
+	if kind == "immutable" {
+		msg = fmt.Sprintf("immutable '%s' can only be assigned at the top level of the constructor", name)
+	}
+	*diags = append(*diags, diag.Diagnostic{
+		Code:    diag.CodeSemaReadOnlyBinding,
+		Message: msg,
+		Span:    defaultSpan(filename),
+	})
+}
+
+// checkReadOnlyWritesInExpr catches assignment expressions nested in values
+// (for example a for-loop post expression).
+func checkReadOnlyWritesInExpr(filename string, ctx *bindingCheckCtx, e *ast.Expr, diags *diag.Diagnostics) {
+	if e == nil {
+		return
+	}
+	switch e.Kind {
+	case "assign":
+		checkReadOnlyWriteTarget(filename, ctx, e.Left, ast.Statement{}, nil, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, e.Right, diags)
+	case "paren":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Left, diags)
+	case "call":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Callee, diags)
+		for _, a := range e.Args {
+			checkReadOnlyWritesInExpr(filename, ctx, a, diags)
+		}
+	case "binary":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Left, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, e.Right, diags)
+	case "unary":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Right, diags)
+	case "member":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Object, diags)
+	case "index":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Object, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, e.Index, diags)
+	case "slice":
+		checkReadOnlyWritesInExpr(filename, ctx, e.Object, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, e.Left, diags)
+		checkReadOnlyWritesInExpr(filename, ctx, e.Right, diags)
+	}
+}
+
+// checkConstructorImmutables validates that every immutable is assigned exactly
+// once, by a top-level statement of the constructor body.
+func checkConstructorImmutables(filename string, consts map[string]ConstValue, immutables []ast.ImmutableDecl, ctor *ast.ConstructorDecl, diags *diag.Diagnostics) {
+	byName := map[string]ast.ImmutableDecl{}
+	for _, im := range immutables {
+		byName[strings.TrimSpace(im.Name)] = im
+	}
+	if ctor == nil {
+		for _, im := range immutables {
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaImmutableInit,
+				Message: fmt.Sprintf("immutable '%s' must be assigned in a constructor", im.Name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		return
+	}
+	if len(consts) == 0 && len(byName) == 0 {
+		return
+	}
+
+	ctx := &bindingCheckCtx{consts: consts, immutables: byName}
+	ctx.pushScope()
+	for _, p := range ctor.Params {
+		ctx.declareLocal(p.Name)
+	}
+	assigned := map[string]struct{}{}
+	// Only top-level statements receive the callback; nested writes are rejected.
+	onImmutable := func(name string, _ ast.Statement) bool {
+		if _, dup := assigned[name]; dup {
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaImmutableInit,
+				Message: fmt.Sprintf("immutable '%s' is assigned more than once in constructor", name),
+				Span:    defaultSpan(filename),
+			})
+			return true
+		}
+		assigned[name] = struct{}{}
+		return true
+	}
+	checkReadOnlyWritesInStmts(filename, ctx, ctor.Body, onImmutable, diags)
+	for _, im := range immutables {
+		if _, ok := assigned[strings.TrimSpace(im.Name)]; !ok {
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaImmutableInit,
+				Message: fmt.Sprintf("immutable '%s' must be assigned in constructor", im.Name),
+				Span:    defaultSpan(filename),
+			})
+		}
+	}
+}
+
+// checkBindingDecls validates names and types of contract constants and immutables.
+func checkBindingDecls(filename string, c *ast.ContractDecl, slots map[string]storageSlotInfo, funcs map[string]int, events map[string]int) (map[string]ast.ImmutableDecl, diag.Diagnostics) {
+	var out diag.Diagnostics
+	seen := map[string]string{}
+	immutables := map[string]ast.ImmutableDecl{}
+	check := func(kind, name string) bool {
+		if name == "selector" || name == "this" {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaReservedName,
+				Message: fmt.Sprintf("%s name '%s' is reserved and cannot be declared", kind, name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if strings.HasPrefix(name, "__tol_") {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaReservedName,
+				Message: fmt.Sprintf("%s name '%s' uses reserved internal prefix '__tol_'", kind, name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if _, builtin := pureBuiltins[name]; builtin {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaReservedName,
+				Message: fmt.Sprintf("%s name '%s' is reserved for a builtin and cannot be declared", kind, name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if prev, exists := seen[name]; exists {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaNameCollision,
+				Message: fmt.Sprintf("name collision: %s '%s' conflicts with %s '%s'", kind, name, prev, name),
+				Span:    defaultSpan(filename),
+			})
+			return false
+		}
+		seen[name] = kind
+		collides := func(other string) {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaNameCollision,
+				Message: fmt.Sprintf("name collision: %s '%s' conflicts with %s '%s'", kind, name, other, name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if _, exists := slots[name]; exists {
+			collides("storage slot")
+		}
+		if _, exists := funcs[name]; exists {
+			collides("function")
+		}
+		if _, exists := events[name]; exists {
+			collides("event")
+		}
+		return true
+	}
+	for _, k := range c.Constants {
+		check("constant", strings.TrimSpace(k.Name))
+	}
+	for _, im := range c.Immutables {
+		name := strings.TrimSpace(im.Name)
+		if !check("immutable", name) {
+			continue
+		}
+		if !isValueTypeName(im.Type) {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaImmutableInit,
+				Message: fmt.Sprintf("immutable '%s' must have a value type (got '%s')", name, normalizeSelectorType(im.Type)),
+				Span:    defaultSpan(filename),
+			})
+		}
+		immutables[name] = im
+	}
+	return immutables, out
+}
@@ -0,0 +1,295 @@
+package sema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// effectKind classifies an observable side effect of a function body.
+type effectKind int
+
+const (
+	effectStorageWrite effectKind = iota
+	effectEmit
+	effectStateCall
+	effectStorageRead
+	effectStaticCall
+	effectEnvRead
+)
+
+// viewForbidden and pureForbidden list, in reporting order, the effects
+// that `view` and `pure` functions may not have (spec §9).
+var (
+	viewForbidden = []effectKind{effectStorageWrite, effectEmit, effectStateCall}
+	pureForbidden = []effectKind{effectStorageWrite, effectEmit, effectStateCall, effectStorageRead, effectStaticCall, effectEnvRead}
+)
+
+// stateCallBuiltins are host calls that may change state or carry value.
+var stateCallBuiltins = map[string]struct{}{
+	"call":         {},
+	"delegatecall": {},
+	"create":       {},
+	"create2":      {},
+	"transfer":     {},
+}
+
+// envObjects are read-only execution-context objects (spec §10).
+var envObjects = map[string]struct{}{
+	"msg":   {},
+	"tx":    {},
+	"block": {},
+	"gas":   {},
+}
+
+// fnEffects records the direct effects of one function (first occurrence of
+// each kind, as a description) and the contract functions it calls.
+type fnEffects struct {
+	direct  map[effectKind]string
+	callees []string
+}
+
+type effectCtx struct {
+	*storageCheckCtx
+	contractName string
+	immutables   map[string]ast.ImmutableDecl
+	funcs        map[string]int
+	out          *fnEffects
+}
+
+// checkFunctionEffects rejects `view` functions that write storage, emit
+// events or make state-changing calls, and `pure` functions that
+// additionally read storage, immutables or the execution environment.
+// Effects are followed transitively through internal calls.
+func checkFunctionEffects(filename string, c *ast.ContractDecl, slots map[string]storageSlotInfo, immutables map[string]ast.ImmutableDecl, funcs map[string]int, diags *diag.Diagnostics) {
+	effects := map[string]*fnEffects{}
+	for _, fn := range c.Functions {
+		if _, done := effects[fn.Name]; done {
+			continue
+		}
+		ctx := &effectCtx{
+			storageCheckCtx: newStorageCheckCtx(slots, fn.Params),
+			contractName:    c.Name,
+			immutables:      immutables,
+			funcs:           funcs,
+			out:             &fnEffects{direct: map[effectKind]string{}},
+		}
+		collectEffectStmts(ctx, fn.Body)
+		effects[fn.Name] = ctx.out
+	}
+
+	for _, fn := range c.Functions {
+		mutability, forbidden := "", []effectKind(nil)
+		for _, m := range fn.Modifiers {
+			switch m {
+			case "view":
+				mutability, forbidden = m, viewForbidden
+			case "pure":
+				mutability, forbidden = m, pureForbidden
+			}
+		}
+		if forbidden == nil {
+			continue
+		}
+		for _, kind := range forbidden {
+			desc, path, ok := findEffect(effects, fn.Name, kind)
+			if !ok {
+				continue
+			}
+			msg := fmt.Sprintf("%s function '%s' %s", mutability, fn.Name, desc)
+			if len(path) > 0 {
+				msg += " via call to '" + strings.Join(path, "' -> '") + "'"
+			}
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaEffectViolation,
+				Message: msg,
+				Span:    defaultSpan(filename),
+			})
+		}
+	}
+}
+
+// findEffect searches the call graph breadth-first from root for a function
+// with a direct effect of the given kind, returning its description and the
+// call path from root (empty when root itself has the effect).
+func findEffect(effects map[string]*fnEffects, root string, kind effectKind) (string, []string, bool) {
+	type node struct {
+		name string
+		path []string
+	}
+	seen := map[string]struct{}{root: {}}
+	queue := []node{{name: root}}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		fx := effects[cur.name]
+		if fx == nil {
+			continue
+		}
+		if desc, ok := fx.direct[kind]; ok {
+			return desc, cur.path, true
+		}
+		for _, callee := range fx.callees {
+			if _, ok := seen[callee]; ok {
+				continue
+			}
+			seen[callee] = struct{}{}
+			path := append(append([]string(nil), cur.path...), callee)
+			queue = append(queue, node{name: callee, path: path})
+		}
+	}
+	return "", nil, false
+}
+
+func (c *effectCtx) note(kind effectKind, desc string) {
+	if _, exists := c.out.direct[kind]; !exists {
+		c.out.direct[kind] = desc
+	}
+}
+
+func (c *effectCtx) call(name string) {
+	for _, existing := range c.out.callees {
+		if existing == name {
+			return
+		}
+	}
+	c.out.callees = append(c.out.callees, name)
+}
+
+func (c *effectCtx) isImmutable(name string) bool {
+	_, ok := c.immutables[name]
+	return ok && !c.isLocal(name)
+}
+
+func collectEffectStmts(ctx *effectCtx, stmts []ast.Statement) {
+	for _, s := range stmts {
+		switch s.Kind {
+		case "let":
+			collectEffectExpr(ctx, s.Expr)
+			ctx.declareLocal(s.Name)
+			continue
+		case "set":
+			collectEffectWrite(ctx, s.Target)
+			collectEffectExpr(ctx, s.Expr)
+			continue
+		case "emit":
+			name := ""
+			if s.Expr != nil && s.Expr.Kind == "call" && s.Expr.Callee != nil {
+				name = strings.TrimSpace(s.Expr.Callee.Value)
+				for _, a := range s.Expr.Args {
+					collectEffectExpr(ctx, a)
+				}
+			}
+			ctx.note(effectEmit, fmt.Sprintf("emits event '%s'", name))
+			continue
+		}
+		collectEffectExpr(ctx, s.Expr)
+		collectEffectExpr(ctx, s.Target)
+		collectEffectExpr(ctx, s.Cond)
+		ctx.pushScope()
+		if s.Init != nil {
+			collectEffectStmts(ctx, []ast.Statement{*s.Init})
+		}
+		collectEffectExpr(ctx, s.Post)
+		for _, block := range [][]ast.Statement{s.Then, s.Else, s.Body} {
+			ctx.pushScope()
+			collectEffectStmts(ctx, block)
+			ctx.popScope()
+		}
+		ctx.popScope()
+	}
+}
+
+func collectEffectWrite(ctx *effectCtx, target *ast.Expr) {
+	if target == nil {
+		return
+	}
+	if slotName, keys, ok := ctx.storagePathFromExpr(target); ok {
+		ctx.note(effectStorageWrite, fmt.Sprintf("writes storage slot '%s'", slotName))
+		for _, k := range keys {
+			collectEffectExpr(ctx, k)
+		}
+		return
+	}
+	if root := stripParens(target); root != nil && root.Kind == "ident" && ctx.isImmutable(strings.TrimSpace(root.Value)) {
+		ctx.note(effectStorageWrite, fmt.Sprintf("writes immutable '%s'", strings.TrimSpace(root.Value)))
+		return
+	}
+	collectEffectExpr(ctx, target)
+}
+
+func collectEffectExpr(ctx *effectCtx, e *ast.Expr) {
+	if e == nil {
+		return
+	}
+	if slotName, keys, ok := ctx.storagePathFromExpr(e); ok {
+		ctx.note(effectStorageRead, fmt.Sprintf("reads storage slot '%s'", slotName))
+		for _, k := range keys {
+			collectEffectExpr(ctx, k)
+		}
+		return
+	}
+	switch e.Kind {
+	case "ident":
+		name := strings.TrimSpace(e.Value)
+		if ctx.isImmutable(name) {
+			ctx.note(effectStorageRead, fmt.Sprintf("reads immutable '%s'", name))
+		}
+	case "call":
+		callee := stripParens(e.Callee)
+		if callee != nil && callee.Kind == "member" && callee.Member == "push" {
+			if slotName, keys, ok := ctx.storagePathFromExpr(callee.Object); ok {
+				ctx.note(effectStorageWrite, fmt.Sprintf("writes storage slot '%s'", slotName))
+				for _, k := range keys {
+					collectEffectExpr(ctx, k)
+				}
+				for _, a := range e.Args {
+					collectEffectExpr(ctx, a)
+				}
+				return
+			}
+		}
+		if name, ok := localContractCallName(ctx.contractName, e.Callee); ok && !(callee.Kind == "ident" && ctx.isLocal(name)) {
+			if _, isFn := ctx.funcs[name]; isFn {
+				ctx.call(name)
+			} else if callee.Kind == "ident" {
+				if _, isState := stateCallBuiltins[name]; isState {
+					ctx.note(effectStateCall, fmt.Sprintf("performs state-changing call '%s'", name))
+				} else if name == "staticcall" {
+					ctx.note(effectStaticCall, "performs external read 'staticcall'")
+				}
+			}
+		}
+		collectEffectExpr(ctx, e.Callee)
+		for _, a := range e.Args {
+			collectEffectExpr(ctx, a)
+		}
+	case "member":
+		if obj := stripParens(e.Object); obj != nil && obj.Kind == "ident" {
+			name := strings.TrimSpace(obj.Value)
+			if _, isEnv := envObjects[name]; isEnv && !ctx.isLocal(name) {
+				ctx.note(effectEnvRead, fmt.Sprintf("reads environment '%s.%s'", name, e.Member))
+			}
+		}
+		collectEffectExpr(ctx, e.Object)
+	case "index":
+		collectEffectExpr(ctx, e.Object)
+		collectEffectExpr(ctx, e.Index)
+	case "slice":
+		collectEffectExpr(ctx, e.Object)
+		collectEffectExpr(ctx, e.Left)
+		collectEffectExpr(ctx, e.Right)
+	case "assign":
+		collectEffectWrite(ctx, e.Left)
+		collectEffectExpr(ctx, e.Right)
+	case "binary":
+		collectEffectExpr(ctx, e.Left)
+		collectEffectExpr(ctx, e.Right)
+	case "unary":
+		collectEffectExpr(ctx, e.Right)
+	case "paren":
+		collectEffectExpr(ctx, e.Left)
+	}
+}
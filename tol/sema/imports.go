@@ -0,0 +1,110 @@
+package sema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// checkImportDecls validates top-level imports and registers imported
+// symbols in topSeen so they collide with local top-level names.
+// Imports must have been resolved (Kind set) by an import resolver;
+// single-buffer compilation leaves them unresolved and is rejected here.
+func checkImportDecls(filename string, m *ast.Module, topSeen map[string]string) diag.Diagnostics {
+	var out diag.Diagnostics
+	for _, imp := range m.Imports {
+		name := strings.TrimSpace(imp.Name)
+		if name == "" {
+			continue
+		}
+		if name == "this" || name == "selector" {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaReservedName,
+				Message: fmt.Sprintf("imported name '%s' is reserved and cannot be declared", name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if strings.HasPrefix(name, "__tol_") {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaReservedName,
+				Message: fmt.Sprintf("imported name '%s' uses reserved internal prefix '__tol_'", name),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if strings.TrimSpace(imp.Kind) == "" {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaUnresolvedImport,
+				Message: fmt.Sprintf("import '%s' from %q is not resolved (compile with a source loader)", name, imp.Path),
+				Span:    defaultSpan(filename),
+			})
+		}
+		if prev, exists := topSeen[name]; exists {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaNameCollision,
+				Message: fmt.Sprintf("duplicate top-level declaration name '%s' between %s and import", name, prev),
+				Span:    defaultSpan(filename),
+			})
+			continue
+		}
+		topSeen[name] = "import"
+	}
+	return out
+}
+
+// checkContractBases validates the `is` list of the deployable contract.
+// Every base must name an imported contract; members of resolved bases are
+// already merged into the contract by the import resolver.
+func checkContractBases(filename string, m *ast.Module) diag.Diagnostics {
+	var out diag.Diagnostics
+	if m.Contract == nil {
+		return out
+	}
+	importKind := map[string]string{}
+	for _, imp := range m.Imports {
+		name := strings.TrimSpace(imp.Name)
+		if _, exists := importKind[name]; !exists {
+			importKind[name] = strings.TrimSpace(imp.Kind)
+		}
+	}
+	contractName := strings.TrimSpace(m.Contract.Name)
+	seen := map[string]struct{}{}
+	for _, base := range m.Contract.Bases {
+		base = strings.TrimSpace(base)
+		if _, dup := seen[base]; dup {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaUnknownBase,
+				Message: fmt.Sprintf("duplicate base contract '%s'", base),
+				Span:    defaultSpan(filename),
+			})
+			continue
+		}
+		seen[base] = struct{}{}
+		if base == contractName {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaUnknownBase,
+				Message: fmt.Sprintf("contract '%s' cannot inherit from itself", base),
+				Span:    defaultSpan(filename),
+			})
+			continue
+		}
+		kind, imported := importKind[base]
+		if !imported {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaUnknownBase,
+				Message: fmt.Sprintf("unknown base contract '%s' (base contracts must be imported)", base),
+				Span:    defaultSpan(filename),
+			})
+			continue
+		}
+		if kind != "" && kind != "contract" {
+			out = append(out, diag.Diagnostic{
+				Code:    diag.CodeSemaUnknownBase,
+				Message: fmt.Sprintf("base '%s' is an imported %s, not a contract", base, kind),
+				Span:    defaultSpan(filename),
+			})
+		}
+	}
+	return out
+}
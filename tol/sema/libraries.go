@@ -0,0 +1,351 @@
+package sema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// libraryInfo is the call surface of a library linked into the contract.
+type libraryInfo struct {
+	vis   map[string]string
+	arity map[string]int
+}
+
+// linkedLibraries returns the libraries declared in m followed by the
+// resolved library imports, in declaration order.
+func linkedLibraries(m *ast.Module) []*ast.LibraryDecl {
+	var out []*ast.LibraryDecl
+	for i := range m.Libraries {
+		out = append(out, &m.Libraries[i])
+	}
+	for _, imp := range m.Imports {
+		if imp.Library != nil {
+			out = append(out, imp.Library)
+		}
+	}
+	return out
+}
+
+// checkLibraryDecls validates every linked library and returns their call
+// surfaces keyed by library name. Library functions are storage-free: they
+// may be internal or private, are implicitly pure, and may call only
+// functions of their own library.
+func checkLibraryDecls(filename string, libs []*ast.LibraryDecl, slots map[string]storageSlotInfo, contractFuncs map[string]int, diags *diag.Diagnostics) map[string]libraryInfo {
+	out := map[string]libraryInfo{}
+	for _, lib := range libs {
+		info := libraryInfo{vis: map[string]string{}, arity: map[string]int{}}
+		for _, fn := range lib.Functions {
+			label := lib.Name + "." + fn.Name
+			name := strings.TrimSpace(fn.Name)
+			if name == "selector" || name == "this" {
+				*diags = append(*diags, diag.Diagnostic{
+					Code:    diag.CodeSemaReservedName,
+					Message: fmt.Sprintf("library function name '%s' is reserved and cannot be declared", label),
+					Span:    defaultSpan(filename),
+				})
+			}
+			if strings.HasPrefix(name, "__tol_") {
+				*diags = append(*diags, diag.Diagnostic{
+					Code:    diag.CodeSemaReservedName,
+					Message: fmt.Sprintf("library function name '%s' uses reserved internal prefix '__tol_'", label),
+					Span:    defaultSpan(filename),
+				})
+			}
+			if _, exists := info.arity[name]; exists {
+				*diags = append(*diags, diag.Diagnostic{
+					Code:    diag.CodeSemaDuplicateFunction,
+					Message: fmt.Sprintf("duplicate library function '%s'", label),
+					Span:    defaultSpan(filename),
+				})
+				continue
+			}
+			vis, modDiags := validateFunctionModifiers(filename, label, fn.Modifiers)
+			*diags = append(*diags, modDiags...)
+			for _, mod := range fn.Modifiers {
+				switch mod {
+				case "public", "external":
+					*diags = append(*diags, diag.Diagnostic{
+						Code:    diag.CodeSemaLibraryVisibility,
+						Message: fmt.Sprintf("library function '%s' cannot be %s (library functions are linked, not dispatched; use internal or private)", label, mod),
+						Span:    defaultSpan(filename),
+					})
+				case "view", "payable":
+					*diags = append(*diags, diag.Diagnostic{
+						Code:    diag.CodeSemaLibraryPurity,
+						Message: fmt.Sprintf("library function '%s' cannot be %s (library functions are pure)", label, mod),
+						Span:    defaultSpan(filename),
+					})
+				}
+			}
+			if vis == "" {
+				vis = "internal"
+			}
+			info.vis[name] = vis
+			info.arity[name] = len(fn.Params)
+		}
+		out[lib.Name] = info
+	}
+
+	for _, lib := range libs {
+		info := out[lib.Name]
+		for _, fn := range lib.Functions {
+			label := lib.Name + "." + fn.Name
+			*diags = append(*diags, duplicateParamDiagnostics(filename, "function", label, fn.Params)...)
+			*diags = append(*diags, duplicateParamDiagnostics(filename, "returns", label, fn.Returns)...)
+			*diags = append(*diags, checkParamReturnNameCollisions(filename, label, fn.Params, fn.Returns)...)
+			checkStatements(filename, "", info.vis, info.arity, nil, fn.Body, 0, diags)
+			checkReturnStatements(filename, "function", label, len(fn.Returns) > 0, fn.Body, diags)
+			checkUnreachableStatements(filename, fn.Body, 0, diags)
+			checkDuplicateLocals(filename, "function", label, fn.Params, fn.Body, diags)
+			if len(fn.Returns) > 0 && !guaranteesValueReturnOrRevert(fn.Body) {
+				*diags = append(*diags, diag.Diagnostic{
+					Code:    diag.CodeSemaInvalidReturn,
+					Message: fmt.Sprintf("function '%s' requires all paths to end in return value or revert in current verifier stage", label),
+					Span:    defaultSpan(filename),
+				})
+			}
+			ctx := &libraryPurityCtx{
+				storageCheckCtx: newStorageCheckCtx(slots, fn.Params),
+				label:           label,
+				libFuncs:        info.arity,
+				contractFuncs:   contractFuncs,
+			}
+			checkLibraryPurityStmts(filename, ctx, fn.Body, diags)
+			checkLibraryCalls(filename, out, lib.Name, fn.Body, diags)
+		}
+	}
+	return out
+}
+
+// libraryPurityCtx tracks locals of a library function body so that free
+// names resolving to contract state can be rejected.
+type libraryPurityCtx struct {
+	*storageCheckCtx
+	label         string
+	libFuncs      map[string]int
+	contractFuncs map[string]int
+}
+
+func checkLibraryPurityStmts(filename string, ctx *libraryPurityCtx, stmts []ast.Statement, diags *diag.Diagnostics) {
+	for _, s := range stmts {
+		switch s.Kind {
+		case "let":
+			checkLibraryPurityExpr(filename, ctx, s.Expr, diags)
+			ctx.declareLocal(s.Name)
+			continue
+		case "set":
+			if root := assignTargetRoot(s.Target); root != "" && !ctx.isLocal(root) {
+				reportLibraryPurity(filename, fmt.Sprintf("library function '%s' cannot write non-local '%s' (libraries have no storage)", ctx.label, root), diags)
+			}
+		case "emit":
+			reportLibraryPurity(filename, fmt.Sprintf("library function '%s' cannot emit events", ctx.label), diags)
+		}
+		checkLibraryPurityExpr(filename, ctx, s.Expr, diags)
+		checkLibraryPurityExpr(filename, ctx, s.Target, diags)
+		checkLibraryPurityExpr(filename, ctx, s.Cond, diags)
+		ctx.pushScope()
+		if s.Init != nil {
+			checkLibraryPurityStmts(filename, ctx, []ast.Statement{*s.Init}, diags)
+		}
+		checkLibraryPurityExpr(filename, ctx, s.Post, diags)
+		for _, block := range [][]ast.Statement{s.Then, s.Else, s.Body} {
+			ctx.pushScope()
+			checkLibraryPurityStmts(filename, ctx, block, diags)
+			ctx.popScope()
+		}
+		ctx.popScope()
+	}
+}
+
+func checkLibraryPurityExpr(filename string, ctx *libraryPurityCtx, e *ast.Expr, diags *diag.Diagnostics) {
+	if e == nil {
+		return
+	}
+	if slotName, _, ok := ctx.storagePathFromExpr(e); ok {
+		reportLibraryPurity(filename, fmt.Sprintf("library function '%s' cannot access contract storage slot '%s'", ctx.label, slotName), diags)
+		return
+	}
+	switch e.Kind {
+	case "ident":
+		if strings.TrimSpace(e.Value) == "this" {
+			reportLibraryPurity(filename, fmt.Sprintf("library function '%s' cannot reference 'this'", ctx.label), diags)
+		}
+	case "call":
+		callee := stripParens(e.Callee)
+		if callee != nil && callee.Kind == "ident" {
+			name := strings.TrimSpace(callee.Value)
+			_, own := ctx.libFuncs[name]
+			if _, isContractFn := ctx.contractFuncs[name]; isContractFn && !own && !ctx.isLocal(name) {
+				reportLibraryPurity(filename, fmt.Sprintf("library function '%s' cannot call contract function '%s'", ctx.label, name), diags)
+			}
+		}
+		checkLibraryPurityExpr(filename, ctx, e.Callee, diags)
+		for _, a := range e.Args {
+			checkLibraryPurityExpr(filename, ctx, a, diags)
+		}
+	case "member":
+		checkLibraryPurityExpr(filename, ctx, e.Object, diags)
+	case "index":
+		checkLibraryPurityExpr(filename, ctx, e.Object, diags)
+		checkLibraryPurityExpr(filename, ctx, e.Index, diags)
+	case "slice":
+		checkLibraryPurityExpr(filename, ctx, e.Object, diags)
+		checkLibraryPurityExpr(filename, ctx, e.Left, diags)
+		checkLibraryPurityExpr(filename, ctx, e.Right, diags)
+	case "binary", "assign":
+		checkLibraryPurityExpr(filename, ctx, e.Left, diags)
+		checkLibraryPurityExpr(filename, ctx, e.Right, diags)
+	case "unary":
+		checkLibraryPurityExpr(filename, ctx, e.Right, diags)
+	case "paren":
+		checkLibraryPurityExpr(filename, ctx, e.Left, diags)
+	}
+}
+
+func assignTargetRoot(e *ast.Expr) string {
+	for e != nil {
+		switch e.Kind {
+		case "ident":
+			return strings.TrimSpace(e.Value)
+		case "paren":
+			e = e.Left
+		case "index", "member":
+			e = e.Object
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func reportLibraryPurity(filename, msg string, diags *diag.Diagnostics) {
+	*diags = append(*diags, diag.Diagnostic{
+		Code:    diag.CodeSemaLibraryPurity,
+		Message: msg,
+		Span:    defaultSpan(filename),
+	})
+}
+
+// checkLibraryCalls validates `Lib.fn(...)` calls in stmts. self names the
+// enclosing library, or is empty for contract bodies; private library
+// functions are callable only from their own library.
+func checkLibraryCalls(filename string, libs map[string]libraryInfo, self string, stmts []ast.Statement, diags *diag.Diagnostics) {
+	if len(libs) == 0 {
+		return
+	}
+	for _, s := range stmts {
+		for _, e := range []*ast.Expr{s.Expr, s.Target, s.Cond, s.Post} {
+			checkLibraryCallExpr(filename, libs, self, e, diags)
+		}
+		if s.Init != nil {
+			checkLibraryCalls(filename, libs, self, []ast.Statement{*s.Init}, diags)
+		}
+		checkLibraryCalls(filename, libs, self, s.Then, diags)
+		checkLibraryCalls(filename, libs, self, s.Else, diags)
+		checkLibraryCalls(filename, libs, self, s.Body, diags)
+	}
+}
+
+func checkLibraryCallExpr(filename string, libs map[string]libraryInfo, self string, e *ast.Expr, diags *diag.Diagnostics) {
+	if e == nil {
+		return
+	}
+	switch e.Kind {
+	case "call":
+		if lib, fn, ok := libraryMemberRef(libs, e.Callee); ok {
+			checkLibraryCallTarget(filename, libs, self, lib, fn, len(e.Args), diags)
+		} else {
+			checkLibraryCallExpr(filename, libs, self, e.Callee, diags)
+		}
+		for _, a := range e.Args {
+			checkLibraryCallExpr(filename, libs, self, a, diags)
+		}
+	case "member":
+		if lib, fn, ok := libraryMemberRef(libs, e); ok {
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaLibraryCall,
+				Message: fmt.Sprintf("library function '%s.%s' can only be called", lib, fn),
+				Span:    defaultSpan(filename),
+			})
+			return
+		}
+		checkLibraryCallExpr(filename, libs, self, e.Object, diags)
+	case "ident":
+		if _, ok := libs[strings.TrimSpace(e.Value)]; ok {
+			*diags = append(*diags, diag.Diagnostic{
+				Code:    diag.CodeSemaLibraryCall,
+				Message: fmt.Sprintf("library '%s' is not a value; call its functions as '%s.fn(...)'", e.Value, e.Value),
+				Span:    defaultSpan(filename),
+			})
+		}
+	case "index":
+		checkLibraryCallExpr(filename, libs, self, e.Object, diags)
+		checkLibraryCallExpr(filename, libs, self, e.Index, diags)
+	case "slice":
+		checkLibraryCallExpr(filename, libs, self, e.Object, diags)
+		checkLibraryCallExpr(filename, libs, self, e.Left, diags)
+		checkLibraryCallExpr(filename, libs, self, e.Right, diags)
+	case "binary", "assign":
+		checkLibraryCallExpr(filename, libs, self, e.Left, diags)
+		checkLibraryCallExpr(filename, libs, self, e.Right, diags)
+	case "unary":
+		checkLibraryCallExpr(filename, libs, self, e.Right, diags)
+	case "paren":
+		checkLibraryCallExpr(filename, libs, self, e.Left, diags)
+	}
+}
+
+func checkLibraryCallTarget(filename string, libs map[string]libraryInfo, self, lib, fn string, argc int, diags *diag.Diagnostics) {
+	if self != "" && lib != self {
+		*diags = append(*diags, diag.Diagnostic{
+			Code:    diag.CodeSemaLibraryCall,
+			Message: fmt.Sprintf("library '%s' cannot call library '%s' (cross-library calls are not supported)", self, lib),
+			Span:    defaultSpan(filename),
+		})
+		return
+	}
+	info := libs[lib]
+	want, exists := info.arity[fn]
+	if !exists {
+		*diags = append(*diags, diag.Diagnostic{
+			Code:    diag.CodeSemaUnknownCallTarget,
+			Message: fmt.Sprintf("library call target function '%s.%s' not found", lib, fn),
+			Span:    defaultSpan(filename),
+		})
+		return
+	}
+	if info.vis[fn] == "private" && self != lib {
+		*diags = append(*diags, diag.Diagnostic{
+			Code:    diag.CodeSemaCallVisibility,
+			Message: fmt.Sprintf("library function '%s.%s' is private", lib, fn),
+			Span:    defaultSpan(filename),
+		})
+	}
+	if argc != want {
+		*diags = append(*diags, diag.Diagnostic{
+			Code:    diag.CodeSemaCallArity,
+			Message: fmt.Sprintf("function '%s.%s' expects %d argument(s), got %d", lib, fn, want, argc),
+			Span:    defaultSpan(filename),
+		})
+	}
+}
+
+// libraryMemberRef reports whether e is `Lib.fn` for a linked library.
+func libraryMemberRef(libs map[string]libraryInfo, e *ast.Expr) (string, string, bool) {
+	root := stripParens(e)
+	if root == nil || root.Kind != "member" {
+		return "", "", false
+	}
+	obj := stripParens(root.Object)
+	if obj == nil || obj.Kind != "ident" {
+		return "", "", false
+	}
+	lib := strings.TrimSpace(obj.Value)
+	if _, ok := libs[lib]; !ok {
+		return "", "", false
+	}
+	return lib, strings.TrimSpace(root.Member), true
+}
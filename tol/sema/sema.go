@@ -14,6 +14,11 @@ import (
 // TypedModule is the semantic-checked representation used by lowering.
 type TypedModule struct {
 	AST *ast.Module
+	// Constants holds folded values of contract-level const declarations.
+	Constants map[string]ConstValue
+	// Libraries lists the local and imported libraries linked into the
+	// contract.
+	Libraries []*ast.LibraryDecl
 }
 
 type storageSlotKind string
@@ -41,6 +46,8 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 	if m == nil {
 		return nil, diags
 	}
+	var consts map[string]ConstValue
+	var linked []*ast.LibraryDecl
 
 	if m.Version != "0.2" {
 		diags = append(diags, diag.Diagnostic{
@@ -111,6 +118,8 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 			}
 			topSeen[name] = kind
 		}
+		diags = append(diags, checkImportDecls(filename, m, topSeen)...)
+		diags = append(diags, checkContractBases(filename, m)...)
 		if prev, exists := topSeen[contractName]; exists {
 			diags = append(diags, diag.Diagnostic{
 				Code:    diag.CodeSemaNameCollision,
@@ -212,6 +221,11 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 			}
 		}
 		diags = append(diags, checkContractNameCollisions(filename, slotInfos, funcArity, eventArity)...)
+		immutables, bindingDiags := checkBindingDecls(filename, m.Contract, slotInfos, funcArity, eventArity)
+		diags = append(diags, bindingDiags...)
+		consts = foldContractConstants(filename, m.Contract.Constants, &diags)
+		linked = linkedLibraries(m)
+		libs := checkLibraryDecls(filename, linked, slotInfos, funcArity, &diags)
 
 		funcSeen := map[string]struct{}{}
 		selectorSeen := map[string]string{}
@@ -231,6 +245,13 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 					Span:    defaultSpan(filename),
 				})
 			}
+			if _, builtin := pureBuiltins[name]; builtin {
+				diags = append(diags, diag.Diagnostic{
+					Code:    diag.CodeSemaReservedName,
+					Message: fmt.Sprintf("function name '%s' is reserved for a builtin and cannot be declared", name),
+					Span:    defaultSpan(filename),
+				})
+			}
 			diags = append(diags, duplicateParamDiagnostics(filename, "function", fn.Name, fn.Params)...)
 			diags = append(diags, duplicateParamDiagnostics(filename, "returns", fn.Name, fn.Returns)...)
 			diags = append(diags, checkParamReturnNameCollisions(filename, fn.Name, fn.Params, fn.Returns)...)
@@ -293,7 +314,10 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 				})
 			}
 			checkStorageFunctionBody(filename, slotInfos, fn.Params, fn.Body, &diags)
+			checkReadOnlyBindingWrites(filename, consts, immutables, fn.Params, fn.Body, &diags)
+			checkLibraryCalls(filename, libs, "", fn.Body, &diags)
 		}
+		checkFunctionEffects(filename, m.Contract, slotInfos, immutables, funcArity, &diags)
 
 		if m.Contract.Constructor != nil {
 			diags = append(diags, validateConstructorModifiers(filename, m.Contract.Constructor.Modifiers)...)
@@ -303,20 +327,25 @@ func Check(filename string, m *ast.Module) (*TypedModule, diag.Diagnostics) {
 			checkUnreachableStatements(filename, m.Contract.Constructor.Body, 0, &diags)
 			checkDuplicateLocals(filename, "constructor", "", m.Contract.Constructor.Params, m.Contract.Constructor.Body, &diags)
 			checkStorageFunctionBody(filename, slotInfos, m.Contract.Constructor.Params, m.Contract.Constructor.Body, &diags)
+			checkLibraryCalls(filename, libs, "", m.Contract.Constructor.Body, &diags)
 		}
+		checkConstructorImmutables(filename, consts, m.Contract.Immutables, m.Contract.Constructor, &diags)
 		if m.Contract.Fallback != nil {
+			diags = append(diags, validateFallbackModifiers(filename, m.Contract.Fallback.Modifiers)...)
 			checkStatements(filename, m.Contract.Name, funcVis, funcArity, eventArity, m.Contract.Fallback.Body, 0, &diags)
 			checkReturnStatements(filename, "fallback", "", false, m.Contract.Fallback.Body, &diags)
 			checkUnreachableStatements(filename, m.Contract.Fallback.Body, 0, &diags)
 			checkDuplicateLocals(filename, "fallback", "", nil, m.Contract.Fallback.Body, &diags)
 			checkStorageFunctionBody(filename, slotInfos, nil, m.Contract.Fallback.Body, &diags)
+			checkReadOnlyBindingWrites(filename, consts, immutables, nil, m.Contract.Fallback.Body, &diags)
+			checkLibraryCalls(filename, libs, "", m.Contract.Fallback.Body, &diags)
 		}
 	}
 
 	if diags.HasErrors() {
 		return nil, diags
 	}
-	return &TypedModule{AST: m}, nil
+	return &TypedModule{AST: m, Constants: consts, Libraries: linked}, nil
 }
 
 func checkStatements(filename string, contractName string, funcVis map[string]string, funcArity map[string]int, eventArity map[string]int, stmts []ast.Statement, loopDepth int, diags *diag.Diagnostics) {
@@ -757,6 +786,8 @@ func containsAssignExpr(e *ast.Expr) bool {
 		return containsAssignExpr(e.Object)
 	case "index":
 		return containsAssignExpr(e.Object) || containsAssignExpr(e.Index)
+	case "slice":
+		return containsAssignExpr(e.Object) || containsAssignExpr(e.Left) || containsAssignExpr(e.Right)
 	case "binary":
 		return containsAssignExpr(e.Left) || containsAssignExpr(e.Right)
 	case "unary":
@@ -1290,6 +1321,10 @@ func checkStorageExpr(filename string, ctx *storageCheckCtx, e *ast.Expr, use st
 	case "index":
 		checkStorageExpr(filename, ctx, e.Object, storageUseIndexObject, diags)
 		checkStorageExpr(filename, ctx, e.Index, storageUseValue, diags)
+	case "slice":
+		checkStorageExpr(filename, ctx, e.Object, storageUseValue, diags)
+		checkStorageExpr(filename, ctx, e.Left, storageUseValue, diags)
+		checkStorageExpr(filename, ctx, e.Right, storageUseValue, diags)
 	case "binary", "assign":
 		checkStorageExpr(filename, ctx, e.Left, storageUseValue, diags)
 		checkStorageExpr(filename, ctx, e.Right, storageUseValue, diags)
@@ -1456,14 +1491,16 @@ func checkExpr(contractName string, funcVis map[string]string, funcArity map[str
 			}
 		}
 		if name, ok := localContractCallName(contractName, e.Callee); ok {
+			root := stripParens(e.Callee)
 			if want, exists := funcArity[name]; exists && len(e.Args) != want {
 				*diags = append(*diags, diag.Diagnostic{
 					Code:    diag.CodeSemaCallArity,
 					Message: fmt.Sprintf("function '%s' expects %d argument(s), got %d", name, want, len(e.Args)),
 					Span:    defaultSpan(filename),
 				})
+			} else if !exists && root.Kind == "ident" {
+				checkBuiltinCall(filename, name, e, diags)
 			}
-			root := stripParens(e.Callee)
 			if root != nil && root.Kind == "ident" {
 				if vis, exists := funcVis[name]; exists && vis == "external" {
 					*diags = append(*diags, diag.Diagnostic{
@@ -1474,6 +1511,7 @@ func checkExpr(contractName string, funcVis map[string]string, funcArity map[str
 				}
 			}
 		}
+		checkMathBuiltinCall(filename, e, diags)
 		if name, ok := scopedContractMemberCallName(contractName, e.Callee); ok {
 			if _, exists := funcArity[name]; !exists {
 				*diags = append(*diags, diag.Diagnostic{
@@ -1530,6 +1568,10 @@ func checkExpr(contractName string, funcVis map[string]string, funcArity map[str
 	case "index":
 		checkExpr(contractName, funcVis, funcArity, filename, e.Object, diags)
 		checkExpr(contractName, funcVis, funcArity, filename, e.Index, diags)
+	case "slice":
+		checkExpr(contractName, funcVis, funcArity, filename, e.Object, diags)
+		checkExpr(contractName, funcVis, funcArity, filename, e.Left, diags)
+		checkExpr(contractName, funcVis, funcArity, filename, e.Right, diags)
 	case "binary":
 		checkExpr(contractName, funcVis, funcArity, filename, e.Left, diags)
 		checkExpr(contractName, funcVis, funcArity, filename, e.Right, diags)
@@ -1758,6 +1800,30 @@ func validateFunctionModifiers(filename string, fnName string, modifiers []strin
 	return vis, diags
 }
 
+func validateFallbackModifiers(filename string, modifiers []string) diag.Diagnostics {
+	var diags diag.Diagnostics
+	hasPayable := false
+	for _, m := range modifiers {
+		if m != "payable" {
+			diags = append(diags, diag.Diagnostic{
+				Code:    diag.CodeSemaInvalidFnModifier,
+				Message: fmt.Sprintf("unsupported fallback modifier '%s'", m),
+				Span:    defaultSpan(filename),
+			})
+			continue
+		}
+		if hasPayable {
+			diags = append(diags, diag.Diagnostic{
+				Code:    diag.CodeSemaConflictingModifier,
+				Message: "duplicate fallback modifier 'payable'",
+				Span:    defaultSpan(filename),
+			})
+		}
+		hasPayable = true
+	}
+	return diags
+}
+
 func validateConstructorModifiers(filename string, modifiers []string) diag.Diagnostics {
 	var diags diag.Diagnostics
 	vis := ""
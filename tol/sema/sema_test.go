@@ -3841,3 +3841,435 @@ func TestCheckRejectsNestedAssignInForPostCallArg(t *testing.T) {
 		t.Fatalf("expected TOL2020, got: %v", diags)
 	}
 }
+
+func TestCheckFoldsContractConstants(t *testing.T) {
+	m := &ast.Module{
+		Version: "0.2",
+		Contract: &ast.ContractDecl{
+			Name: "Demo",
+			Constants: []ast.ConstantDecl{
+				{
+					Name: "HALF",
+					Type: "u256",
+					Value: &ast.Expr{
+						Kind:  "binary",
+						Op:    "/",
+						Left:  &ast.Expr{Kind: "ident", Value: "ONE"},
+						Right: &ast.Expr{Kind: "number", Value: "2"},
+					},
+				},
+				{
+					Name: "ONE",
+					Type: "u256",
+					Value: &ast.Expr{
+						Kind:  "binary",
+						Op:    "^",
+						Left:  &ast.Expr{Kind: "number", Value: "10"},
+						Right: &ast.Expr{Kind: "number", Value: "18"},
+					},
+				},
+				{
+					Name: "BIG",
+					Type: "bool",
+					Value: &ast.Expr{
+						Kind:  "binary",
+						Op:    ">",
+						Left:  &ast.Expr{Kind: "ident", Value: "HALF"},
+						Right: &ast.Expr{Kind: "number", Value: "1"},
+					},
+				},
+				{Name: "TAG", Type: "string", Value: &ast.Expr{Kind: "string", Value: `"tol"`}},
+				{Name: "LOW", Type: "i8", Value: &ast.Expr{
+					Kind: "unary", Op: "-", Right: &ast.Expr{Kind: "number", Value: "128"},
+				}},
+				{Name: "SEL", Type: "bytes4", Value: &ast.Expr{Kind: "string", Value: `"0xa9059cbb"`}},
+			},
+		},
+	}
+	typed, diags := Check("<test>", m)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	want := map[string]ConstValue{
+		"ONE":  {Kind: "number", Value: "1000000000000000000"},
+		"HALF": {Kind: "number", Value: "500000000000000000"},
+		"BIG":  {Kind: "bool", Value: "true"},
+		"TAG":  {Kind: "string", Value: "tol"},
+		"SEL":  {Kind: "string", Value: "0xa9059cbb"},
+	}
+	for name, v := range want {
+		if got := typed.Constants[name]; got != v {
+			t.Fatalf("unexpected folded value for %s: got=%#v want=%#v", name, got, v)
+		}
+	}
+}
+
+func TestCheckRejectsInvalidConstantExpressions(t *testing.T) {
+	cases := []struct {
+		name string
+		decl ast.ConstantDecl
+		msg  string
+	}{
+		{
+			name: "division by zero",
+			decl: ast.ConstantDecl{Name: "X", Type: "u256", Value: &ast.Expr{
+				Kind: "binary", Op: "/",
+				Left:  &ast.Expr{Kind: "number", Value: "1"},
+				Right: &ast.Expr{Kind: "number", Value: "0"},
+			}},
+			msg: "division by zero",
+		},
+		{
+			name: "self reference",
+			decl: ast.ConstantDecl{Name: "X", Type: "u256", Value: &ast.Expr{Kind: "ident", Value: "X"}},
+			msg:  "cyclic",
+		},
+		{
+			name: "type range",
+			decl: ast.ConstantDecl{Name: "X", Type: "u8", Value: &ast.Expr{Kind: "number", Value: "256"}},
+			msg:  "does not fit",
+		},
+		{
+			name: "signed type range",
+			decl: ast.ConstantDecl{Name: "X", Type: "i8", Value: &ast.Expr{Kind: "number", Value: "1000"}},
+			msg:  "does not fit",
+		},
+		{
+			name: "signed type lower bound",
+			decl: ast.ConstantDecl{Name: "X", Type: "i8", Value: &ast.Expr{
+				Kind: "unary", Op: "-", Right: &ast.Expr{Kind: "number", Value: "129"},
+			}},
+			msg: "does not fit",
+		},
+		{
+			name: "address literal",
+			decl: ast.ConstantDecl{Name: "X", Type: "address", Value: &ast.Expr{Kind: "string", Value: `"hello"`}},
+			msg:  "0x-prefixed literal of 64 hex digits",
+		},
+		{
+			name: "bytes4 length",
+			decl: ast.ConstantDecl{Name: "X", Type: "bytes4", Value: &ast.Expr{Kind: "string", Value: `"0x123456"`}},
+			msg:  "0x-prefixed literal of 8 hex digits",
+		},
+		{
+			name: "runtime call",
+			decl: ast.ConstantDecl{Name: "X", Type: "u256", Value: &ast.Expr{
+				Kind:   "call",
+				Callee: &ast.Expr{Kind: "ident", Value: "now"},
+			}},
+			msg: "not allowed in constant expressions",
+		},
+	}
+	for _, tc := range cases {
+		m := &ast.Module{
+			Version: "0.2",
+			Contract: &ast.ContractDecl{
+				Name:      "Demo",
+				Constants: []ast.ConstantDecl{tc.decl},
+			},
+		}
+		_, diags := Check("<test>", m)
+		if !diags.HasErrors() {
+			t.Fatalf("%s: expected diagnostics", tc.name)
+		}
+		if !strings.Contains(diags.Error(), "TOL2034") || !strings.Contains(diags.Error(), tc.msg) {
+			t.Fatalf("%s: unexpected diagnostics: %v", tc.name, diags)
+		}
+	}
+}
+
+func TestCheckRejectsWriteToConstant(t *testing.T) {
+	m := &ast.Module{
+		Version: "0.2",
+		Contract: &ast.ContractDecl{
+			Name: "Demo",
+			Constants: []ast.ConstantDecl{
+				{Name: "ONE", Type: "u256", Value: &ast.Expr{Kind: "number", Value: "1"}},
+			},
+			Functions: []ast.FunctionDecl{
+				{
+					Name: "f",
+					Body: []ast.Statement{
+						{
+							Kind:   "set",
+							Target: &ast.Expr{Kind: "ident", Value: "ONE"},
+							Expr:   &ast.Expr{Kind: "number", Value: "2"},
+						},
+					},
+				},
+			},
+		},
+	}
+	_, diags := Check("<test>", m)
+	if !diags.HasErrors() {
+		t.Fatalf("expected diagnostics")
+	}
+	if !strings.Contains(diags.Error(), "TOL2035") || !strings.Contains(diags.Error(), "cannot assign to constant 'ONE'") {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestCheckAllowsLocalShadowingConstant(t *testing.T) {
+	m := &ast.Module{
+		Version: "0.2",
+		Contract: &ast.ContractDecl{
+			Name: "Demo",
+			Constants: []ast.ConstantDecl{
+				{Name: "ONE", Type: "u256", Value: &ast.Expr{Kind: "number", Value: "1"}},
+			},
+			Functions: []ast.FunctionDecl{
+				{
+					Name:   "f",
+					Params: []ast.FieldDecl{{Name: "ONE", Type: "u256"}},
+					Body: []ast.Statement{
+						{
+							Kind:   "set",
+							Target: &ast.Expr{Kind: "ident", Value: "ONE"},
+							Expr:   &ast.Expr{Kind: "number", Value: "2"},
+						},
+					},
+				},
+			},
+		},
+	}
+	if _, diags := Check("<test>", m); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestCheckImmutableAssignmentRules(t *testing.T) {
+	setOwner := ast.Statement{
+		Kind:   "set",
+		Target: &ast.Expr{Kind: "ident", Value: "owner"},
+		Expr:   &ast.Expr{Kind: "ident", Value: "o"},
+	}
+	cases := []struct {
+		name  string
+		ctor  *ast.ConstructorDecl
+		fns   []ast.FunctionDecl
+		code  string
+		msg   string
+		valid bool
+	}{
+		{
+			name:  "assigned once",
+			ctor:  &ast.ConstructorDecl{Params: []ast.FieldDecl{{Name: "o", Type: "address"}}, Body: []ast.Statement{setOwner}},
+			valid: true,
+		},
+		{
+			name: "missing constructor",
+			code: "TOL2036",
+			msg:  "must be assigned in a constructor",
+		},
+		{
+			name: "not assigned",
+			ctor: &ast.ConstructorDecl{},
+			code: "TOL2036",
+			msg:  "must be assigned in constructor",
+		},
+		{
+			name: "assigned twice",
+			ctor: &ast.ConstructorDecl{Params: []ast.FieldDecl{{Name: "o", Type: "address"}}, Body: []ast.Statement{setOwner, setOwner}},
+			code: "TOL2036",
+			msg:  "more than once",
+		},
+		{
+			name: "conditional assignment",
+			ctor: &ast.ConstructorDecl{
+				Params: []ast.FieldDecl{{Name: "o", Type: "address"}},
+				Body: []ast.Statement{
+					{Kind: "if", Cond: &ast.Expr{Kind: "ident", Value: "true"}, Then: []ast.Statement{setOwner}},
+				},
+			},
+			code: "TOL2035",
+			msg:  "top level of the constructor",
+		},
+		{
+			name: "write in function",
+			ctor: &ast.ConstructorDecl{Params: []ast.FieldDecl{{Name: "o", Type: "address"}}, Body: []ast.Statement{setOwner}},
+			fns: []ast.FunctionDecl{
+				{Name: "f", Params: []ast.FieldDecl{{Name: "o", Type: "address"}}, Body: []ast.Statement{setOwner}},
+			},
+			code: "TOL2035",
+			msg:  "immutable 'owner'",
+		},
+	}
+	for _, tc := range cases {
+		m := &ast.Module{
+			Version: "0.2",
+			Contract: &ast.ContractDecl{
+				Name:        "Demo",
+				Immutables:  []ast.ImmutableDecl{{Name: "owner", Type: "address"}},
+				Functions:   tc.fns,
+				Constructor: tc.ctor,
+			},
+		}
+		_, diags := Check("<test>", m)
+		if tc.valid {
+			if diags.HasErrors() {
+				t.Fatalf("%s: unexpected diagnostics: %v", tc.name, diags)
+			}
+			continue
+		}
+		if !diags.HasErrors() {
+			t.Fatalf("%s: expected diagnostics", tc.name)
+		}
+		if !strings.Contains(diags.Error(), tc.code) || !strings.Contains(diags.Error(), tc.msg) {
+			t.Fatalf("%s: unexpected diagnostics: %v", tc.name, diags)
+		}
+	}
+}
+
+func TestCheckRejectsConstantNameCollisions(t *testing.T) {
+	m := &ast.Module{
+		Version: "0.2",
+		Contract: &ast.ContractDecl{
+			Name: "Demo",
+			Storage: &ast.StorageDecl{
+				Slots: []ast.StorageSlot{{Name: "total", Type: "u256"}},
+			},
+			Constants: []ast.ConstantDecl{
+				{Name: "total", Type: "u256", Value: &ast.Expr{Kind: "number", Value: "1"}},
+			},
+		},
+	}
+	_, diags := Check("<test>", m)
+	if !diags.HasErrors() {
+		t.Fatalf("expected diagnostics")
+	}
+	if !strings.Contains(diags.Error(), "TOL2026") || !strings.Contains(diags.Error(), "conflicts with storage slot") {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestCheckImportCollisionsAndBases(t *testing.T) {
+	cases := []struct {
+		name string
+		mod  *ast.Module
+		want string
+	}{
+		{
+			name: "unresolved import",
+			mod: &ast.Module{
+				Version:  "0.2",
+				Imports:  []ast.ImportDecl{{Name: "ITRC20", Path: "./itrc20.tol"}},
+				Contract: &ast.ContractDecl{Name: "Demo"},
+			},
+			want: "TOL2037",
+		},
+		{
+			name: "import collides with interface",
+			mod: &ast.Module{
+				Version:         "0.2",
+				Imports:         []ast.ImportDecl{{Name: "ITRC20", Path: "./itrc20.tol", Kind: "interface"}},
+				SkippedTopDecls: []ast.SkippedTopDecl{{Kind: "interface", Name: "ITRC20"}},
+				Contract:        &ast.ContractDecl{Name: "Demo"},
+			},
+			want: "TOL2026",
+		},
+		{
+			name: "import collides with contract",
+			mod: &ast.Module{
+				Version:  "0.2",
+				Imports:  []ast.ImportDecl{{Name: "Demo", Path: "./demo.tol", Kind: "contract"}},
+				Contract: &ast.ContractDecl{Name: "Demo"},
+			},
+			want: "TOL2026",
+		},
+		{
+			name: "base not imported",
+			mod: &ast.Module{
+				Version:  "0.2",
+				Contract: &ast.ContractDecl{Name: "Demo", Bases: []string{"Ownable"}},
+			},
+			want: "TOL2038",
+		},
+		{
+			name: "base is an interface",
+			mod: &ast.Module{
+				Version:  "0.2",
+				Imports:  []ast.ImportDecl{{Name: "IHook", Path: "./hook.tol", Kind: "interface"}},
+				Contract: &ast.ContractDecl{Name: "Demo", Bases: []string{"IHook"}},
+			},
+			want: "TOL2038",
+		},
+	}
+	for _, tc := range cases {
+		_, diags := Check("<test>", tc.mod)
+		if !diags.HasErrors() || !strings.Contains(diags.Error(), tc.want) {
+			t.Fatalf("%s: expected %s, got %v", tc.name, tc.want, diags)
+		}
+	}
+
+	ok := &ast.Module{
+		Version:  "0.2",
+		Imports:  []ast.ImportDecl{{Name: "Ownable", Path: "./ownable.tol", Kind: "contract", Origin: "ownable.tol"}},
+		Contract: &ast.ContractDecl{Name: "Demo", Bases: []string{"Ownable"}},
+	}
+	if _, diags := Check("<test>", ok); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestCheckLibraryRules(t *testing.T) {
+	ident := func(v string) *ast.Expr { return &ast.Expr{Kind: "ident", Value: v} }
+	ret := func(e *ast.Expr) ast.Statement { return ast.Statement{Kind: "return", Expr: e} }
+	libFn := func(name string, mods []string, body ...ast.Statement) ast.FunctionDecl {
+		if len(body) == 0 || body[len(body)-1].Kind != "return" {
+			body = append(body, ret(ident("a")))
+		}
+		return ast.FunctionDecl{
+			Name:      name,
+			Params:    []ast.FieldDecl{{Name: "a", Type: "u256"}},
+			Returns:   []ast.FieldDecl{{Name: "r", Type: "u256"}},
+			Modifiers: mods,
+			Body:      body,
+		}
+	}
+	call := func(lib, fn string, args ...*ast.Expr) *ast.Expr {
+		return &ast.Expr{Kind: "call", Callee: &ast.Expr{Kind: "member", Object: ident(lib), Member: fn}, Args: args}
+	}
+	module := func(lib ast.FunctionDecl, callExpr *ast.Expr) *ast.Module {
+		return &ast.Module{
+			Version:         "0.2",
+			Libraries:       []ast.LibraryDecl{{Name: "M", Functions: []ast.FunctionDecl{lib}}},
+			SkippedTopDecls: []ast.SkippedTopDecl{{Kind: "library", Name: "M"}},
+			Contract: &ast.ContractDecl{
+				Name:    "Demo",
+				Storage: &ast.StorageDecl{Slots: []ast.StorageSlot{{Name: "total", Type: "u256"}}},
+				Functions: []ast.FunctionDecl{{
+					Name:      "run",
+					Modifiers: []string{"public"},
+					Body:      []ast.Statement{{Kind: "expr", Expr: callExpr}},
+				}},
+			},
+		}
+	}
+	cases := []struct {
+		name string
+		mod  *ast.Module
+		want string
+	}{
+		{"public library function", module(libFn("f", []string{"public"}), call("M", "f", ident("x"))), "TOL2039"},
+		{"view library function", module(libFn("f", []string{"view"}), call("M", "f", ident("x"))), "TOL2040"},
+		{"storage read", module(libFn("f", nil, ret(ident("total"))), call("M", "f", ident("x"))), "TOL2040"},
+		{"storage write", module(libFn("f", nil, ast.Statement{Kind: "set", Target: ident("total"), Expr: ident("a")}), call("M", "f", ident("x"))), "TOL2040"},
+		{"unknown function", module(libFn("f", nil), call("M", "g", ident("x"))), "TOL2031"},
+		{"private function", module(libFn("f", []string{"private"}), call("M", "f", ident("x"))), "TOL2032"},
+		{"arity", module(libFn("f", nil), call("M", "f")), "TOL2019"},
+	}
+	for _, tc := range cases {
+		_, diags := Check("<test>", tc.mod)
+		if !diags.HasErrors() || !strings.Contains(diags.Error(), tc.want) {
+			t.Fatalf("%s: expected %s, got %v", tc.name, tc.want, diags)
+		}
+	}
+
+	typed, diags := Check("<test>", module(libFn("f", []string{"internal", "pure"}, ast.Statement{Kind: "let", Name: "total", Expr: ident("a")}, ret(ident("total"))), call("M", "f", ident("x"))))
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(typed.Libraries) != 1 || typed.Libraries[0].Name != "M" {
+		t.Fatalf("expected linked library, got %+v", typed.Libraries)
+	}
+}
@@ -22,11 +22,21 @@ func BuildIRFromTOL(source []byte, name string) (*IRProgram, error) {
 	if err != nil {
 		return nil, err
 	}
-	typed, diags := sema.Check(name, mod)
-	if diags.HasErrors() {
-		return nil, diags
+	return buildIRFromTOLModule(mod, name)
+}
+
+// BuildIRFromTOLWithLoader is BuildIRFromTOL for a multi-file program whose
+// entry file at path is read, together with its imports, through loader.
+func BuildIRFromTOLWithLoader(loader SourceLoader, path string) (*IRProgram, error) {
+	mod, err := ParseTOLModuleWithLoader(loader, path)
+	if err != nil {
+		return nil, err
 	}
-	prog, err := lower.FromTyped(typed)
+	return buildIRFromTOLModule(mod, path)
+}
+
+func buildIRFromTOLModule(mod *ast.Module, name string) (*IRProgram, error) {
+	prog, err := buildLoweredTOLModule(mod, name)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +49,20 @@ func CompileTOLToBytecode(source []byte, name string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return compileIRToBytecode(irp)
+}
+
+// CompileTOLToBytecodeWithLoader compiles a multi-file TOL program into
+// deterministic bytecode.
+func CompileTOLToBytecodeWithLoader(loader SourceLoader, path string) ([]byte, error) {
+	irp, err := BuildIRFromTOLWithLoader(loader, path)
+	if err != nil {
+		return nil, err
+	}
+	return compileIRToBytecode(irp)
+}
+
+func compileIRToBytecode(irp *IRProgram) ([]byte, error) {
 	proto, err := CompileIR(irp)
 	if err != nil {
 		return nil, err
@@ -57,11 +81,7 @@ func CompileLoweredTOLToBytecode(prog *lower.Program, name string) ([]byte, erro
 	if err != nil {
 		return nil, err
 	}
-	proto, err := CompileIR(irp)
-	if err != nil {
-		return nil, err
-	}
-	return EncodeFunctionProto(proto)
+	return compileIRToBytecode(irp)
 }
 
 // BuildLoweredTOL builds typed and lowered TOL program for diagnostics/testing.
@@ -70,6 +90,10 @@ func BuildLoweredTOL(source []byte, name string) (*lower.Program, error) {
 	if err != nil {
 		return nil, err
 	}
+	return buildLoweredTOLModule(mod, name)
+}
+
+func buildLoweredTOLModule(mod *ast.Module, name string) (*lower.Program, error) {
 	typed, diags := sema.Check(name, mod)
 	if diags.HasErrors() {
 		return nil, diags
@@ -1,6 +1,7 @@
 package lua
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -1338,7 +1339,7 @@ contract Demo {
 		t.Fatalf("oninvoke call failed: %v", err)
 	}
 	want := selectorHexFromSignature("transfer(address,u256)")
-	if got := LVAsString(L.GetGlobal("sel")); got != want {
+	if got, _ := L.GetGlobal("sel").(LBytes); got.String() != want {
 		t.Fatalf("unexpected selector result: got=%s want=%s", got, want)
 	}
 }
@@ -1375,7 +1376,7 @@ contract Demo {
 		t.Fatalf("oninvoke call failed: %v", err)
 	}
 	want := selectorHexFromSignature("transfer(address,u256)")
-	if got := LVAsString(L.GetGlobal("sel")); got != want {
+	if got, _ := L.GetGlobal("sel").(LBytes); got.String() != want {
 		t.Fatalf("unexpected selector result: got=%s want=%s", got, want)
 	}
 }
@@ -1527,10 +1528,10 @@ contract Demo {
 		t.Fatalf("oninvoke call failed: %v", err)
 	}
 	want := selectorHexFromSignature("mark()")
-	if got := LVAsString(L.GetGlobal("s1")); got != want {
+	if got, _ := L.GetGlobal("s1").(LBytes); got.String() != want {
 		t.Fatalf("unexpected s1 selector: got=%s want=%s", got, want)
 	}
-	if got := LVAsString(L.GetGlobal("s2")); got != want {
+	if got, _ := L.GetGlobal("s2").(LBytes); got.String() != want {
 		t.Fatalf("unexpected s2 selector: got=%s want=%s", got, want)
 	}
 }
@@ -1567,7 +1568,7 @@ contract Demo {
 	if err := L.PCall(1, 0, nil); err != nil {
 		t.Fatalf("oninvoke call failed: %v", err)
 	}
-	if got := LVAsString(L.GetGlobal("sel")); got != "0xfeedbeef" {
+	if got, _ := L.GetGlobal("sel").(LBytes); got.String() != "0xfeedbeef" {
 		t.Fatalf("unexpected selector override: got=%s want=0xfeedbeef", got)
 	}
 }
@@ -1852,3 +1853,415 @@ contract Demo {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestCompileTOLToBytecodeConstantsAndImmutables(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  const ONE: u256 = 10 ^ 18;
+  const HALF: u256 = ONE / 2;
+  const TAG: string = "demo";
+  immutable scale: u256;
+  constructor(s: u256) {
+    set scale = s * HALF;
+  }
+  fn read() public {
+    set got_one = ONE;
+    set got_scale = scale;
+    set got_tag = TAG;
+    return;
+  }
+}
+`)
+	bc, err := CompileTOLToBytecode(src, "<tol>")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+
+	tos := L.GetGlobal("tos")
+	L.Push(L.GetField(tos, "oncreate"))
+	L.Push(lNumberFromInt(3))
+	if err := L.PCall(1, 0, nil); err != nil {
+		t.Fatalf("oncreate call failed: %v", err)
+	}
+	L.Push(L.GetField(tos, "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("read()")))
+	if err := L.PCall(1, 0, nil); err != nil {
+		t.Fatalf("oninvoke call failed: %v", err)
+	}
+	if got := LVAsString(L.GetGlobal("got_one")); got != "1000000000000000000" {
+		t.Fatalf("unexpected constant value: got=%s", got)
+	}
+	if got := LVAsString(L.GetGlobal("got_scale")); got != "1500000000000000000" {
+		t.Fatalf("unexpected immutable value: got=%s", got)
+	}
+	if got := LVAsString(L.GetGlobal("got_tag")); got != "demo" {
+		t.Fatalf("unexpected string constant: got=%s", got)
+	}
+	storage, ok := L.GetGlobal("__tol_storage").(*LTable)
+	if !ok {
+		t.Fatalf("expected __tol_storage table")
+	}
+	slot := computeImmutableSlotHash("Demo", "scale")
+	if got := LVAsString(storage.RawGetString(slot)); got != "1500000000000000000" {
+		t.Fatalf("unexpected immutable slot %s value: got=%s", slot, got)
+	}
+}
+
+func TestCompileTOLToBytecodeRejectsImmutableWriteOutsideConstructor(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  immutable owner: u256;
+  constructor(o: u256) {
+    set owner = o;
+  }
+  fn steal(o: u256) public {
+    set owner = o;
+    return;
+  }
+}
+`)
+	_, err := CompileTOLToBytecode(src, "<tol>")
+	if err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if !strings.Contains(err.Error(), "TOL2035") {
+		t.Fatalf("expected TOL2035 error, got: %v", err)
+	}
+}
+
+func TestCompileTOLToBytecodeLinksLibraryFunctions(t *testing.T) {
+	src := []byte(`
+tol 0.2
+library SafeMath {
+  fn add(a: u256, b: u256) -> (c: u256) internal pure {
+    return a + b;
+  }
+  fn twice(a: u256) -> (c: u256) {
+    return SafeMath.add(a, double(a)) - a;
+  }
+  fn double(a: u256) -> (c: u256) private {
+    return a * 2;
+  }
+}
+contract Demo {
+  storage {
+    slot total: u256;
+  }
+  fn bump(v: u256) public {
+    set total = SafeMath.add(total, v);
+    set got_twice = SafeMath.twice(v);
+    return;
+  }
+}
+`)
+	bc, err := CompileTOLToBytecode(src, "<tol>")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	tos := L.GetGlobal("tos")
+	for i := 0; i < 2; i++ {
+		L.Push(L.GetField(tos, "oninvoke"))
+		L.Push(LString(selectorHexFromSignature("bump(u256)")))
+		L.Push(lNumberFromInt(5))
+		if err := L.PCall(2, 0, nil); err != nil {
+			t.Fatalf("oninvoke call failed: %v", err)
+		}
+	}
+	storage := L.GetGlobal("__tol_storage").(*LTable)
+	if got := LVAsString(storage.RawGetString(computeBaseSlotHash("Demo", "total"))); got != "10" {
+		t.Fatalf("unexpected total: got=%s", got)
+	}
+	if got := LVAsString(L.GetGlobal("got_twice")); got != "10" {
+		t.Fatalf("unexpected library result: got=%s", got)
+	}
+	if L.GetGlobal("SafeMath") != LNil || L.GetGlobal("add") != LNil {
+		t.Fatalf("library functions must only be linked under internal names")
+	}
+}
+
+func TestCompileTOLToBytecodeRejectsImpureLibrary(t *testing.T) {
+	src := []byte(`
+tol 0.2
+library Leaky {
+  fn peek() -> (v: u256) {
+    return total;
+  }
+}
+contract Demo {
+  storage {
+    slot total: u256;
+  }
+  fn run() public {
+    set got = Leaky.peek();
+    return;
+  }
+}
+`)
+	_, err := CompileTOLToBytecode(src, "<tol>")
+	if err == nil || !strings.Contains(err.Error(), "TOL2040") {
+		t.Fatalf("expected TOL2040 error, got: %v", err)
+	}
+}
+
+func TestCompileTOLToBytecodeRejectsViewPureEffects(t *testing.T) {
+	cases := []struct {
+		name string
+		fns  string
+		want string
+	}{
+		{"view writes storage", `fn f() public view { set total = 1; return; }`, "view function 'f' writes storage slot 'total'"},
+		{"view emits", `fn f() public view { emit Moved(1); return; }`, "view function 'f' emits event 'Moved'"},
+		{"view value call", `fn f(to: address) public view { transfer(to, 1); return; }`, "view function 'f' performs state-changing call 'transfer'"},
+		{"view pushes", `fn f() public view { items.push(1); return; }`, "view function 'f' writes storage slot 'items'"},
+		{"pure reads storage", `fn f() -> (v: u256) public pure { return total; }`, "pure function 'f' reads storage slot 'total'"},
+		{"pure reads env", `fn f() -> (v: address) public pure { return msg.sender; }`, "pure function 'f' reads environment 'msg.sender'"},
+		{
+			"view writes transitively",
+			`fn f() public view { g(); return; }
+  fn g() internal { h(); return; }
+  fn h() internal { set total = 2; return; }`,
+			"view function 'f' writes storage slot 'total' via call to 'g' -> 'h'",
+		},
+		{
+			"pure reads transitively",
+			`fn f() -> (v: u256) public pure { return this.g(); }
+  fn g() -> (v: u256) public view { return total; }`,
+			"pure function 'f' reads storage slot 'total' via call to 'g'",
+		},
+	}
+	for _, tc := range cases {
+		src := []byte(`
+tol 0.2
+contract Demo {
+  storage {
+    slot total: u256;
+    slot items: u256[];
+  }
+  event Moved(v: u256)
+  ` + tc.fns + `
+}
+`)
+		_, err := CompileTOLToBytecode(src, "<tol>")
+		if err == nil || !strings.Contains(err.Error(), "TOL2042") || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected TOL2042 %q, got: %v", tc.name, tc.want, err)
+		}
+	}
+
+	ok := []byte(`
+tol 0.2
+contract Demo {
+  storage {
+    slot total: u256;
+  }
+  const SCALE: u256 = 10;
+  fn get() -> (v: u256) public view { return scaled(total); }
+  fn scaled(x: u256) -> (v: u256) internal pure { let total = x; return total * SCALE; }
+}
+`)
+	if _, err := CompileTOLToBytecode(ok, "<tol>"); err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+}
+
+func TestStaticPCallRejectsStorageWritesAndEmit(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  storage {
+    slot total: u256;
+  }
+  event Bumped(v: u256)
+  fn bump() public {
+    set total = total + 1;
+    return;
+  }
+  fn ping() public {
+    emit Bumped(1);
+    return;
+  }
+  fn read() -> (v: u256) public view {
+    return total;
+  }
+}
+`)
+	bc, err := CompileTOLToBytecode(src, "<tol>")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	L := NewState()
+	defer L.Close()
+	emitted := 0
+	L.SetGlobal("emit", L.NewFunction(func(L *LState) int {
+		emitted++
+		return 0
+	}))
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	invoke := func(sig string, static bool) error {
+		L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+		L.Push(LString(selectorHexFromSignature(sig)))
+		if static {
+			return L.StaticPCall(1, 0, nil)
+		}
+		return L.PCall(1, 0, nil)
+	}
+
+	if err := invoke("bump()", false); err != nil {
+		t.Fatalf("bump failed: %v", err)
+	}
+	if err := invoke("read()", true); err != nil {
+		t.Fatalf("static view call failed: %v", err)
+	}
+	for _, sig := range []string{"bump()", "ping()"} {
+		err := invoke(sig, true)
+		if err == nil || !strings.Contains(err.Error(), "STATIC_CALL_VIOLATION") {
+			t.Fatalf("%s: expected static violation, got %v", sig, err)
+		}
+	}
+	if L.StaticMode() {
+		t.Fatalf("static mode must be restored after StaticPCall")
+	}
+	storage := L.GetGlobal("__tol_storage").(*LTable)
+	if got := LVAsString(storage.RawGetString(computeBaseSlotHash("Demo", "total"))); got != "1" {
+		t.Fatalf("static call must not change storage: total=%s", got)
+	}
+	if emitted != 0 {
+		t.Fatalf("static call must not emit, got %d emits", emitted)
+	}
+	if err := invoke("ping()", false); err != nil || emitted != 1 {
+		t.Fatalf("non-static emit failed: err=%v emitted=%d", err, emitted)
+	}
+}
+
+func TestCompileTOLToBytecodeEnforcesPayable(t *testing.T) {
+	compile := func(ctorMods, fallbackMods string) []byte {
+		src := []byte(`
+tol 0.2
+contract Vault {
+  constructor() ` + ctorMods + ` {
+    set created = 1;
+  }
+  fn deposit() public payable {
+    set deposited = 1;
+    return;
+  }
+  fn poke() public {
+    set poked = 1;
+    return;
+  }
+  fallback ` + fallbackMods + ` {
+    set fell = 1;
+  }
+}
+`)
+		bc, err := CompileTOLToBytecode(src, "<tol>")
+		if err != nil {
+			t.Fatalf("unexpected compile error: %v", err)
+		}
+		return bc
+	}
+	run := func(bc []byte, value LValue, entry string, args ...LValue) (*LState, error) {
+		L := NewState()
+		if err := L.DoBytecode(bc); err != nil {
+			t.Fatalf("DoBytecode failed: %v", err)
+		}
+		msg := L.NewTable()
+		msg.RawSetString("value", value)
+		L.SetGlobal("msg", msg)
+		L.Push(L.GetField(L.GetGlobal("tos"), entry))
+		for _, a := range args {
+			L.Push(a)
+		}
+		return L, L.PCall(len(args), 0, nil)
+	}
+	nonPayable := compile("", "")
+	payable := compile("payable", "payable")
+
+	cases := []struct {
+		name   string
+		bc     []byte
+		value  LValue
+		entry  string
+		args   []LValue
+		global string
+		revert bool
+	}{
+		{"payable fn with value", nonPayable, LNumber("5"), "oninvoke", []LValue{LString(selectorHexFromSignature("deposit()"))}, "deposited", false},
+		{"non-payable fn with value", nonPayable, LNumber("5"), "oninvoke", []LValue{LString(selectorHexFromSignature("poke()"))}, "poked", true},
+		{"non-payable fn without value", nonPayable, LNumber("0"), "oninvoke", []LValue{LString(selectorHexFromSignature("poke()"))}, "poked", false},
+		{"non-payable ctor with value", nonPayable, LString("7"), "oncreate", nil, "created", true},
+		{"payable ctor with value", payable, LString("7"), "oncreate", nil, "created", false},
+		{"non-payable fallback with value", nonPayable, LNumber("1"), "oninvoke", []LValue{LString("0xdeadbeef")}, "fell", true},
+		{"payable fallback with value", payable, LNumber("1"), "oninvoke", []LValue{LString("0xdeadbeef")}, "fell", false},
+		{"non-payable fallback without context value", nonPayable, LNil, "oninvoke", []LValue{LString("0xdeadbeef")}, "fell", false},
+	}
+	for _, tc := range cases {
+		L, err := run(tc.bc, tc.value, tc.entry, tc.args...)
+		ran := L.GetGlobal(tc.global) != LNil
+		L.Close()
+		if tc.revert {
+			var rerr *RevertError
+			if !errors.As(err, &rerr) || rerr.Reason != "NON_PAYABLE" || ran {
+				t.Fatalf("%s: expected NON_PAYABLE revert before body, got err=%v ran=%v", tc.name, err, ran)
+			}
+			continue
+		}
+		if err != nil || !ran {
+			t.Fatalf("%s: expected success, got err=%v ran=%v", tc.name, err, ran)
+		}
+	}
+
+	_, err := CompileTOLToBytecode([]byte("tol 0.2\ncontract Vault {\n  fallback view {\n  }\n}\n"), "<tol>")
+	if err == nil || !strings.Contains(err.Error(), "unsupported fallback modifier 'view'") {
+		t.Fatalf("expected fallback modifier error, got: %v", err)
+	}
+}
+
+func TestTOLModuleSealsRuntimeHelpers(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(hostCounterSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	for _, script := range []string{
+		`__tol_sstore = function() end`,
+		`rawset(_G, "__tol_sload", nil)`,
+		`__tol_arr_elem = nil`,
+		`tos.oninvoke = function() return 1 end`,
+		`rawset(tos, "oncreate", nil)`,
+		`tos = {}`,
+	} {
+		errorIfScriptNotFail(t, L, script, `attempt to modify (sealed field|a frozen table)`)
+	}
+	// Storage is rebound per frame by hosts and stays writable.
+	errorIfScriptFail(t, L, `__tol_storage = {}`)
+	h := NewMemoryContractHost()
+	h.Attach(L, hostCounterAddr)
+
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("bump(u256)")))
+	L.Push(LNumber("3"))
+	if err := L.PCall(2, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := L.Get(-1); got != LNumber("3") {
+		t.Fatalf("unexpected bump result %v", got)
+	}
+}
@@ -0,0 +1,431 @@
+package lua
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tolast "github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+	"github.com/tos-network/tolang/tol/parser"
+)
+
+// SourceLoader loads TOL source files for import resolution.
+// Paths are slash-separated; relative imports are joined against the
+// directory of the importing file before they reach the loader.
+type SourceLoader interface {
+	LoadSource(path string) ([]byte, error)
+}
+
+// DirSourceLoader loads TOL sources from the filesystem under Root.
+// An empty Root resolves paths against the process working directory.
+type DirSourceLoader struct {
+	Root string
+}
+
+// LoadSource implements SourceLoader.
+func (d DirSourceLoader) LoadSource(p string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.Root, filepath.FromSlash(p)))
+}
+
+// MapSourceLoader serves in-memory TOL sources keyed by slash path.
+type MapSourceLoader map[string][]byte
+
+// LoadSource implements SourceLoader.
+func (m MapSourceLoader) LoadSource(p string) ([]byte, error) {
+	src, ok := m[path.Clean(p)]
+	if !ok {
+		return nil, fmt.Errorf("open %s: %w", p, os.ErrNotExist)
+	}
+	return src, nil
+}
+
+// ParseTOLModuleWithLoader parses the TOL file at path and resolves its
+// imports through loader. Imported symbols are annotated on the returned
+// module, and members of imported base contracts are merged into the
+// contract in C3 linearization order.
+func ParseTOLModuleWithLoader(loader SourceLoader, path string) (*tolast.Module, error) {
+	if loader == nil {
+		return nil, fmt.Errorf("tol import: nil source loader")
+	}
+	r := &tolImportResolver{
+		loader:  loader,
+		modules: map[string]*tolResolvedModule{},
+		active:  map[string]bool{},
+	}
+	resolved, err := r.resolve(cleanImportPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return resolved.mod, nil
+}
+
+type tolImportResolver struct {
+	loader  SourceLoader
+	modules map[string]*tolResolvedModule
+	stack   []string
+	active  map[string]bool
+}
+
+type tolResolvedModule struct {
+	path     string
+	mod      *tolast.Module
+	contract *tolContractUnit
+}
+
+// tolContractUnit is a contract declaration together with its C3
+// linearization (the contract itself first, most-base last).
+type tolContractUnit struct {
+	key  string
+	decl *tolast.ContractDecl
+	lin  []*tolContractUnit
+}
+
+func cleanImportPath(p string) string {
+	return path.Clean(filepath.ToSlash(strings.TrimSpace(p)))
+}
+
+func importDiag(code, msg string, args ...any) diag.Diagnostics {
+	return diag.Diagnostics{{Code: code, Message: fmt.Sprintf(msg, args...)}}
+}
+
+func (r *tolImportResolver) resolve(p string) (*tolResolvedModule, error) {
+	if r.active[p] {
+		chain := append([]string{}, r.stack...)
+		for len(chain) > 0 && chain[0] != p {
+			chain = chain[1:]
+		}
+		chain = append(chain, p)
+		return nil, importDiag(diag.CodeImportCycle, "import cycle: %s", strings.Join(chain, " -> "))
+	}
+	if done, ok := r.modules[p]; ok {
+		return done, nil
+	}
+
+	src, err := r.loader.LoadSource(p)
+	if err != nil {
+		if len(r.stack) == 0 {
+			return nil, err
+		}
+		return nil, importDiag(diag.CodeImportNotFound, "%s: cannot load import %q: %v", r.stack[len(r.stack)-1], p, err)
+	}
+	mod, diags := parser.ParseFile(p, src)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	r.active[p] = true
+	r.stack = append(r.stack, p)
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+		delete(r.active, p)
+	}()
+
+	bases := map[string]*tolContractUnit{}
+	for i := range mod.Imports {
+		imp := &mod.Imports[i]
+		if isPackageImportSpec(strings.TrimSpace(imp.Path)) {
+			if err := r.resolvePackageImport(p, imp); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		target, err := resolveImportPath(p, imp.Path)
+		if err != nil {
+			return nil, err
+		}
+		dep, err := r.resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		kind := lookupImportedSymbol(dep, imp.Name)
+		if kind == "" {
+			return nil, importDiag(diag.CodeImportUnknownSymbol, "%s: symbol '%s' is not declared in %q", p, imp.Name, target)
+		}
+		imp.Kind = kind
+		imp.Origin = target
+		imp.Interface = lookupImportedInterface(dep, imp.Name)
+		imp.Library = lookupImportedLibrary(dep, imp.Name)
+		if kind == "contract" {
+			bases[imp.Name] = dep.contract
+		}
+	}
+
+	out := &tolResolvedModule{path: p, mod: mod}
+	if mod.Contract != nil {
+		unit, err := linearizeContract(p, mod.Contract, bases)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := flattenContract(p, unit)
+		if err != nil {
+			return nil, err
+		}
+		mod.Contract = merged
+		out.contract = unit
+	}
+	r.modules[p] = out
+	return out, nil
+}
+
+// resolvePackageImport resolves a `tor://` or `toc://` import through a
+// package-aware loader. Package imports expose interfaces only; no bytecode
+// is linked into the importer.
+func (r *tolImportResolver) resolvePackageImport(importer string, imp *tolast.ImportDecl) error {
+	pr, ok := r.loader.(PackageImportResolver)
+	if !ok {
+		return importDiag(diag.CodeImportUnsupported, "%s: package import %q requires a package-aware source loader", importer, imp.Path)
+	}
+	pkg, err := pr.ResolvePackageImport(strings.TrimSpace(imp.Path))
+	if err != nil {
+		return err
+	}
+	base, symbol := splitPackageImportSymbol(strings.TrimSpace(imp.Path), imp.Name)
+	iface := pkg.Symbols[symbol]
+	if iface == nil {
+		return importDiag(diag.CodeImportUnknownSymbol, "%s: symbol '%s' is not declared in package %s@%s", importer, symbol, pkg.Name, pkg.Version)
+	}
+	imp.Kind = "interface"
+	imp.Origin = base
+	imp.Interface = iface
+	return nil
+}
+
+// resolveImportPath resolves an import path relative to the importing file.
+func resolveImportPath(importer, spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.Contains(spec, "://") {
+		return "", importDiag(diag.CodeImportUnsupported, "%s: unsupported import path %q (expected ./, ../, tor:// or toc://)", importer, spec)
+	}
+	if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+		return "", importDiag(diag.CodeImportUnsupported, "%s: import path %q must be relative (start with ./ or ../)", importer, spec)
+	}
+	if path.Ext(spec) != ".tol" {
+		return "", importDiag(diag.CodeImportUnsupported, "%s: import path %q must name a .tol source", importer, spec)
+	}
+	return path.Join(path.Dir(importer), spec), nil
+}
+
+// lookupImportedSymbol returns the kind of a top-level symbol declared in
+// dep: "interface", "library" or "contract". Symbols that dep itself
+// imports are not re-exported.
+func lookupImportedSymbol(dep *tolResolvedModule, name string) string {
+	for _, decl := range dep.mod.SkippedTopDecls {
+		if decl.Name == name {
+			return decl.Kind
+		}
+	}
+	if dep.mod.Contract != nil && dep.mod.Contract.Name == name {
+		return "contract"
+	}
+	return ""
+}
+
+func lookupImportedInterface(dep *tolResolvedModule, name string) *tolast.InterfaceDecl {
+	for i := range dep.mod.Interfaces {
+		if dep.mod.Interfaces[i].Name == name {
+			return &dep.mod.Interfaces[i]
+		}
+	}
+	return nil
+}
+
+func lookupImportedLibrary(dep *tolResolvedModule, name string) *tolast.LibraryDecl {
+	for i := range dep.mod.Libraries {
+		if dep.mod.Libraries[i].Name == name {
+			return &dep.mod.Libraries[i]
+		}
+	}
+	return nil
+}
+
+// linearizeContract computes the C3 linearization of decl over its imported
+// bases.
+func linearizeContract(file string, decl *tolast.ContractDecl, bases map[string]*tolContractUnit) (*tolContractUnit, error) {
+	unit := &tolContractUnit{key: file + "::" + decl.Name, decl: decl}
+	var seqs [][]*tolContractUnit
+	var direct []*tolContractUnit
+	for _, name := range decl.Bases {
+		base, ok := bases[name]
+		if !ok {
+			return nil, importDiag(diag.CodeImportInheritance, "%s: base '%s' of contract '%s' is not an imported contract", file, name, decl.Name)
+		}
+		seqs = append(seqs, base.lin)
+		direct = append(direct, base)
+	}
+	seqs = append(seqs, direct)
+
+	lin := []*tolContractUnit{unit}
+	for {
+		seqs = dropEmptyLinSeqs(seqs)
+		if len(seqs) == 0 {
+			break
+		}
+		var next *tolContractUnit
+		for _, seq := range seqs {
+			cand := seq[0]
+			if !linTailContains(seqs, cand.key) {
+				next = cand
+				break
+			}
+		}
+		if next == nil {
+			return nil, importDiag(diag.CodeImportInheritance, "%s: cannot linearize base contracts of '%s'", file, decl.Name)
+		}
+		lin = append(lin, next)
+		for i, seq := range seqs {
+			if seq[0].key == next.key {
+				seqs[i] = seq[1:]
+			}
+		}
+	}
+	unit.lin = lin
+	return unit, nil
+}
+
+// overrideMismatch describes how fn differs from the base function it
+// overrides, or returns "" when it keeps the base's parameter and return
+// types, selector, visibility and mutability. Custom modifiers may differ.
+func overrideMismatch(base, fn tolast.FunctionDecl) string {
+	if !sameFieldTypes(base.Params, fn.Params) {
+		return "different parameter types"
+	}
+	if !sameFieldTypes(base.Returns, fn.Returns) {
+		return "different return types"
+	}
+	if base.SelectorOverride != fn.SelectorOverride {
+		return "a different selector"
+	}
+	if b, f := modifierOf(base.Modifiers, tolVisibilities), modifierOf(fn.Modifiers, tolVisibilities); b != f {
+		return fmt.Sprintf("visibility %s instead of %s", quoteModifier(f), quoteModifier(b))
+	}
+	if b, f := modifierOf(base.Modifiers, tolMutabilities), modifierOf(fn.Modifiers, tolMutabilities); b != f {
+		return fmt.Sprintf("mutability %s instead of %s", quoteModifier(f), quoteModifier(b))
+	}
+	return ""
+}
+
+func quoteModifier(m string) string {
+	if m == "" {
+		return "none"
+	}
+	return "'" + m + "'"
+}
+
+var (
+	tolVisibilities = []string{"public", "external", "internal", "private"}
+	tolMutabilities = []string{"view", "pure", "payable"}
+)
+
+// modifierOf returns the first of mods that is one of kinds, or "".
+func modifierOf(mods, kinds []string) string {
+	for _, m := range mods {
+		for _, k := range kinds {
+			if m == k {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+func sameFieldTypes(a, b []tolast.FieldDecl) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.Join(strings.Fields(a[i].Type), "") != strings.Join(strings.Fields(b[i].Type), "") {
+			return false
+		}
+	}
+	return true
+}
+
+func dropEmptyLinSeqs(seqs [][]*tolContractUnit) [][]*tolContractUnit {
+	out := seqs[:0]
+	for _, seq := range seqs {
+		if len(seq) > 0 {
+			out = append(out, seq)
+		}
+	}
+	return out
+}
+
+func linTailContains(seqs [][]*tolContractUnit, key string) bool {
+	for _, seq := range seqs {
+		for _, u := range seq[1:] {
+			if u.key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flattenContract merges the members of every contract in unit's
+// linearization, most-base first. Functions and the fallback of more
+// derived contracts override same-named base members, keeping their
+// signature, visibility and mutability; base constructors (which must be
+// parameterless) run before the derived constructor body.
+func flattenContract(file string, unit *tolContractUnit) (*tolast.ContractDecl, error) {
+	self := unit.decl
+	if len(unit.lin) == 1 {
+		return self, nil
+	}
+	out := &tolast.ContractDecl{
+		Name:  self.Name,
+		Bases: append([]string(nil), self.Bases...),
+	}
+	var slots []tolast.StorageSlot
+	var ctorBody []tolast.Statement
+	hasCtor := false
+	for i := len(unit.lin) - 1; i >= 0; i-- {
+		c := unit.lin[i].decl
+		if c.Storage != nil {
+			slots = append(slots, c.Storage.Slots...)
+		}
+		out.Constants = append(out.Constants, c.Constants...)
+		out.Immutables = append(out.Immutables, c.Immutables...)
+		out.Events = append(out.Events, c.Events...)
+		out.SkippedDecls = append(out.SkippedDecls, c.SkippedDecls...)
+		for _, fn := range c.Functions {
+			replaced := false
+			for j := range out.Functions {
+				if base := out.Functions[j]; base.Name == fn.Name {
+					if why := overrideMismatch(base, fn); why != "" {
+						return nil, importDiag(diag.CodeImportInheritance, "%s: function '%s' of contract '%s' overrides a base function with %s", file, fn.Name, c.Name, why)
+					}
+					out.Functions[j] = fn
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				out.Functions = append(out.Functions, fn)
+			}
+		}
+		if c.Fallback != nil {
+			out.Fallback = c.Fallback
+		}
+		if c.Constructor != nil {
+			hasCtor = true
+			if c != self && len(c.Constructor.Params) > 0 {
+				return nil, importDiag(diag.CodeImportInheritance, "%s: base contract '%s' constructor parameters are not supported", file, c.Name)
+			}
+			ctorBody = append(ctorBody, c.Constructor.Body...)
+		}
+	}
+	if len(slots) > 0 {
+		out.Storage = &tolast.StorageDecl{Slots: slots}
+	}
+	if hasCtor {
+		out.Constructor = &tolast.ConstructorDecl{Body: ctorBody}
+		if self.Constructor != nil {
+			out.Constructor.Params = self.Constructor.Params
+			out.Constructor.Modifiers = self.Constructor.Modifiers
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,305 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileTOLWithLoaderInheritsImportedBaseContract(t *testing.T) {
+	loader := MapSourceLoader{
+		"contracts/token.tol": []byte(`
+tol 0.2
+import ITRC20 from "./lib/itrc20.tol";
+import Ownable from "./lib/ownable.tol";
+contract Token is Ownable {
+  storage {
+    slot supply: u256;
+  }
+  constructor() {
+    set supply = 7;
+  }
+  fn read() public {
+    set got_owner = owner_value();
+    set got_supply = supply;
+    return;
+  }
+}
+`),
+		"contracts/lib/itrc20.tol": []byte(`
+tol 0.2
+interface ITRC20 {
+  fn totalSupply() -> (supply: u256) public view;
+}
+`),
+		"contracts/lib/ownable.tol": []byte(`
+tol 0.2
+contract Ownable {
+  storage {
+    slot owner: u256;
+  }
+  constructor() {
+    set owner = 42;
+  }
+  fn owner_value() -> (v: u256) public view {
+    return owner;
+  }
+}
+`),
+	}
+
+	mod, err := ParseTOLModuleWithLoader(loader, "contracts/token.tol")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if len(mod.Imports) != 2 || mod.Imports[0].Kind != "interface" || mod.Imports[1].Kind != "contract" {
+		t.Fatalf("unexpected resolved imports: %+v", mod.Imports)
+	}
+	if mod.Imports[1].Origin != "contracts/lib/ownable.tol" {
+		t.Fatalf("unexpected import origin: %q", mod.Imports[1].Origin)
+	}
+	if mod.Contract.Storage == nil || len(mod.Contract.Storage.Slots) != 2 || mod.Contract.Storage.Slots[0].Name != "owner" {
+		t.Fatalf("expected base storage slots first, got %+v", mod.Contract.Storage)
+	}
+
+	bc, err := CompileTOLToBytecodeWithLoader(loader, "contracts/token.tol")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	tos := L.GetGlobal("tos")
+	L.Push(L.GetField(tos, "oncreate"))
+	if err := L.PCall(0, 0, nil); err != nil {
+		t.Fatalf("oncreate call failed: %v", err)
+	}
+	L.Push(L.GetField(tos, "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("read()")))
+	if err := L.PCall(1, 0, nil); err != nil {
+		t.Fatalf("oninvoke call failed: %v", err)
+	}
+	if got := LVAsString(L.GetGlobal("got_owner")); got != "42" {
+		t.Fatalf("unexpected inherited value: got=%s", got)
+	}
+	if got := LVAsString(L.GetGlobal("got_supply")); got != "7" {
+		t.Fatalf("unexpected derived value: got=%s", got)
+	}
+}
+
+func TestCompileTOLWithLoaderLinearizesDiamondBases(t *testing.T) {
+	loader := MapSourceLoader{
+		"root.tol": []byte(`
+tol 0.2
+contract Root {
+  storage {
+    slot counter: u256;
+  }
+  fn tag() -> (v: u256) public view {
+    return 1;
+  }
+}
+`),
+		"left.tol": []byte(`
+tol 0.2
+import Root from "./root.tol";
+contract Left is Root {
+  fn tag() -> (v: u256) public view {
+    return 2;
+  }
+}
+`),
+		"right.tol": []byte(`
+tol 0.2
+import Root from "./root.tol";
+contract Right is Root {
+  fn tag() -> (v: u256) public view {
+    return 3;
+  }
+}
+`),
+		"main.tol": []byte(`
+tol 0.2
+import Left from "./left.tol";
+import Right from "./right.tol";
+contract Main is Left, Right {
+}
+`),
+	}
+	mod, err := ParseTOLModuleWithLoader(loader, "main.tol")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if got := len(mod.Contract.Storage.Slots); got != 1 {
+		t.Fatalf("diamond base storage should be merged once, got %d slots", got)
+	}
+	if len(mod.Contract.Functions) != 1 || mod.Contract.Functions[0].Body[0].Expr.Value != "2" {
+		t.Fatalf("expected Left.tag to win the linearization, got %+v", mod.Contract.Functions)
+	}
+	if _, err := CompileTOLToBytecodeWithLoader(loader, "main.tol"); err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+}
+
+func TestParseTOLModuleWithLoaderRejectsImportCycle(t *testing.T) {
+	loader := MapSourceLoader{
+		"a.tol": []byte("tol 0.2\nimport B from \"./b.tol\";\ncontract A {}\n"),
+		"b.tol": []byte("tol 0.2\nimport A from \"./a.tol\";\ncontract B {}\n"),
+	}
+	_, err := ParseTOLModuleWithLoader(loader, "a.tol")
+	if err == nil {
+		t.Fatalf("expected import cycle error")
+	}
+	if !strings.Contains(err.Error(), "TOL5002") || !strings.Contains(err.Error(), "a.tol -> b.tol -> a.tol") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseTOLModuleWithLoaderRejectsBadImports(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		code string
+	}{
+		{"missing file", "tol 0.2\nimport X from \"./missing.tol\";\ncontract C {}\n", "TOL5001"},
+		{"unknown symbol", "tol 0.2\nimport Nope from \"./lib.tol\";\ncontract C {}\n", "TOL5003"},
+		{"registry path", "tol 0.2\nimport X from \"tor://x@1.0.0\";\ncontract C {}\n", "TOL5004"},
+		{"bare path", "tol 0.2\nimport X from \"lib.tol\";\ncontract C {}\n", "TOL5004"},
+		{"interface base", "tol 0.2\nimport ILib from \"./lib.tol\";\ncontract C is ILib {}\n", "TOL5005"},
+	}
+	for _, tc := range cases {
+		loader := MapSourceLoader{
+			"main.tol": []byte(tc.src),
+			"lib.tol":  []byte("tol 0.2\ninterface ILib {\n  fn f() public;\n}\n"),
+		}
+		_, err := ParseTOLModuleWithLoader(loader, "main.tol")
+		if err == nil || !strings.Contains(err.Error(), tc.code) {
+			t.Fatalf("%s: expected %s, got %v", tc.name, tc.code, err)
+		}
+	}
+}
+
+func TestParseTOLModuleWithLoaderRejectsIncompatibleOverrides(t *testing.T) {
+	base := "tol 0.2\ncontract Base {\n  fn f(a: u256) -> (r: u256) external payable {\n    return a;\n  }\n}\n"
+	cases := []struct {
+		name string
+		fn   string
+		want string
+	}{
+		{"ok", "fn f(b: u256) -> (r: u256) external payable", ""},
+		{"params", "fn f(a: u128) -> (r: u256) external payable", "different parameter types"},
+		{"returns", "fn f(a: u256) external payable", "different return types"},
+		{"visibility", "fn f(a: u256) -> (r: u256) internal payable", "visibility 'internal' instead of 'external'"},
+		{"mutability", "fn f(a: u256) -> (r: u256) external", "mutability none instead of 'payable'"},
+	}
+	for _, tc := range cases {
+		loader := MapSourceLoader{
+			"base.tol": []byte(base),
+			"main.tol": []byte("tol 0.2\nimport Base from \"./base.tol\";\ncontract Main is Base {\n  " + tc.fn + " {\n    return 1;\n  }\n}\n"),
+		}
+		_, err := ParseTOLModuleWithLoader(loader, "main.tol")
+		if tc.want == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "TOL5005") || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected TOL5005 with %q, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestBuildIRFromTOLRejectsUnresolvedImport(t *testing.T) {
+	src := []byte("tol 0.2\nimport X from \"./x.tol\";\ncontract C {}\n")
+	_, err := BuildIRFromTOL(src, "<tol>")
+	if err == nil || !strings.Contains(err.Error(), "TOL2037") {
+		t.Fatalf("expected unresolved import error, got %v", err)
+	}
+}
+
+func TestCompileTOLToTOCWithDirSourceLoader(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "base"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"token.tol":     "tol 0.2\nimport Base from \"./base/base.tol\";\ncontract Token is Base {\n  fn mint() public {\n    return;\n  }\n}\n",
+		"base/base.tol": "tol 0.2\ncontract Base {\n  fn ping() public {\n    return;\n  }\n}\n",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	toc, err := CompileTOLToTOCWithLoader(DirSourceLoader{Root: dir}, "token.tol")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	art, err := DecodeTOC(toc)
+	if err != nil {
+		t.Fatalf("decode toc: %v", err)
+	}
+	if art.ContractName != "Token" {
+		t.Fatalf("unexpected contract name: %q", art.ContractName)
+	}
+	if !strings.Contains(string(art.ABIJSON), `"ping"`) || !strings.Contains(string(art.ABIJSON), `"mint"`) {
+		t.Fatalf("expected inherited and local functions in ABI, got %s", art.ABIJSON)
+	}
+	if err := VerifyTOCSourceHash(art, []byte(files["token.tol"])); err != nil {
+		t.Fatalf("source hash should cover entry file: %v", err)
+	}
+}
+
+func TestCompileTOLWithLoaderLinksImportedLibrary(t *testing.T) {
+	loader := MapSourceLoader{
+		"lib/math.tol": []byte(`
+tol 0.2
+library Math {
+  fn max(a: u256, b: u256) -> (m: u256) {
+    if (a > b) {
+      return a;
+    }
+    return b;
+  }
+}
+`),
+		"main.tol": []byte(`
+tol 0.2
+import Math from "./lib/math.tol";
+contract Main {
+  fn run() public {
+    set got_max = Math.max(3, 9);
+    return;
+  }
+}
+`),
+	}
+	mod, err := ParseTOLModuleWithLoader(loader, "main.tol")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if mod.Imports[0].Kind != "library" || mod.Imports[0].Library == nil {
+		t.Fatalf("expected resolved library import, got %+v", mod.Imports[0])
+	}
+	bc, err := CompileTOLToBytecodeWithLoader(loader, "main.tol")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	L := NewState()
+	defer L.Close()
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatalf("DoBytecode failed: %v", err)
+	}
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("run()")))
+	if err := L.PCall(1, 0, nil); err != nil {
+		t.Fatalf("oninvoke call failed: %v", err)
+	}
+	if got := LVAsString(L.GetGlobal("got_max")); got != "9" {
+		t.Fatalf("unexpected library result: got=%s", got)
+	}
+}
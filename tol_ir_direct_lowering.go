@@ -21,27 +21,40 @@ import (
 // 1) empty contracts
 // 2) function/fallback/constructor wrappers with a restricted statement/expression subset
 func buildDirectIRFromLowered(p *lower.Program, sourceName string) (*IRProgram, error) {
+	irp, _, err := buildDirectIRWithSourceMap(p, sourceName)
+	return irp, err
+}
+
+// buildDirectIRWithSourceMap is buildDirectIRFromLowered also returning the
+// source map linking the IR's instructions to the TOL statements they were
+// lowered from. Its fingerprints are filled in by compileTOLSourceMapped.
+func buildDirectIRWithSourceMap(p *lower.Program, sourceName string) (*IRProgram, *SourceMap, error) {
 	if p == nil {
-		return nil, fmt.Errorf("[%s] nil lowered program", diag.CodeLowerNotImplemented)
+		return nil, nil, fmt.Errorf("[%s] nil lowered program", diag.CodeLowerNotImplemented)
 	}
 
 	if sourceName == "" {
 		sourceName = p.ContractName
 	}
 
+	marks := &tolSourceMarks{}
+	// An empty contract is a trivial return-only program.
+	chunk := []luast.Stmt{}
 	if p.HasConstructor || p.HasFallback || len(p.Functions) > 0 {
-		chunk, err := buildBootstrapChunkFromLowered(p)
+		var err error
+		chunk, err = buildBootstrapChunkFromLowered(p, marks)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return BuildIR(chunk, sourceName)
 	}
-
-	// Empty contract: emit a trivial return-only program.
-	return BuildIR([]luast.Stmt{}, sourceName)
+	irp, err := BuildIR(chunk, sourceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return irp, marks.apply(irp.Root), nil
 }
 
-func buildBootstrapChunkFromLowered(p *lower.Program) ([]luast.Stmt, error) {
+func buildBootstrapChunkFromLowered(p *lower.Program, marks *tolSourceMarks) ([]luast.Stmt, error) {
 	if p == nil {
 		return nil, fmt.Errorf("[%s] nil lowered program", diag.CodeLowerNotImplemented)
 	}
@@ -57,15 +70,32 @@ func buildBootstrapChunkFromLowered(p *lower.Program) ([]luast.Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := addConstantsToLoweringEnv(env, p.Constants, p.Immutables); err != nil {
+		return nil, err
+	}
+
+	env.libraryFuncs = collectLibraryFuncs(p.Libraries)
+	env.marks = marks
 
 	chunk := make([]luast.Stmt, 0, len(p.Functions)+16)
-	if len(p.StorageSlots) > 0 {
+	if len(env.storageByName) > 0 {
 		prelude, err := buildStoragePreludeFromLowered(env)
 		if err != nil {
 			return nil, err
 		}
 		chunk = append(chunk, prelude...)
 	}
+	for _, lib := range p.Libraries {
+		// Library bodies see no contract storage or constants.
+		libEnv := &loweringEnv{library: lib.Name, libraryFuncs: env.libraryFuncs, marks: marks}
+		for _, fn := range lib.Functions {
+			st, err := lowerFunctionToLua(fn, libEnv)
+			if err != nil {
+				return nil, err
+			}
+			chunk = append(chunk, st)
+		}
+	}
 	for _, fn := range p.Functions {
 		st, err := lowerFunctionToLua(fn, env)
 		if err != nil {
@@ -74,14 +104,14 @@ func buildBootstrapChunkFromLowered(p *lower.Program) ([]luast.Stmt, error) {
 		chunk = append(chunk, st)
 	}
 	if p.HasConstructor {
-		st, err := lowerConstructorToLua(p.ConstructorParams, p.ConstructorBody, env)
+		st, err := lowerConstructorToLua(p.ConstructorPos, p.ConstructorParams, p.ConstructorBody, env)
 		if err != nil {
 			return nil, err
 		}
 		chunk = append(chunk, st)
 	}
 	if p.HasFallback {
-		st, err := lowerFallbackToLua(p.FallbackBody, env)
+		st, err := lowerFallbackToLua(p.FallbackPos, p.FallbackBody, env)
 		if err != nil {
 			return nil, err
 		}
@@ -92,23 +122,81 @@ func buildBootstrapChunkFromLowered(p *lower.Program) ([]luast.Stmt, error) {
 		chunk = append(chunk, buildTosInitStmt())
 	}
 	if p.HasConstructor {
-		chunk = append(chunk, buildOnCreateAssignStmt())
+		chunk = append(chunk, buildOnCreateAssignStmt(hasModifier(p.ConstructorModifiers, "payable")))
 	}
 	if p.HasFallback || len(dispatchFns) > 0 {
-		chunk = append(chunk, buildOnInvokeAssignStmt(dispatchFns, p.HasFallback))
+		chunk = append(chunk, buildOnInvokeAssignStmt(dispatchFns, p.HasFallback, hasModifier(p.FallbackModifiers, "payable")))
 	}
+	// Runtime helpers and the entry table are final once the module is set up.
+	chunk = append(chunk, withLineStmt(&luast.FuncCallStmt{
+		Expr: withLineExpr(&luast.FuncCallExpr{
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_seal"}),
+			Args:      []luast.Expr{},
+			AdjustRet: true,
+		}),
+	}))
 	return chunk, nil
 }
 
 type dispatchFunc struct {
 	Name      string
 	Signature string
+	Payable   bool
+}
+
+func hasModifier(mods []string, want string) bool {
+	for _, m := range mods {
+		if m == want {
+			return true
+		}
+	}
+	return false
+}
+
+// buildNonPayableGuardStmt emits `__tol_nonpayable()`, which reverts when the
+// execution context carries a non-zero msg.value (spec §9).
+func buildNonPayableGuardStmt() luast.Stmt {
+	return withLineStmt(&luast.FuncCallStmt{
+		Expr: withLineExpr(&luast.FuncCallExpr{
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_nonpayable"}),
+			Args:      []luast.Expr{},
+			AdjustRet: true,
+		}),
+	})
 }
 
 type loweringEnv struct {
 	contractName       string
 	selectorByFunction map[string]string
 	storageByName      map[string]storageSlotInfo
+	constByName        map[string]lower.Constant
+	// library is the enclosing library when lowering library functions.
+	library      string
+	libraryFuncs map[string]map[string]struct{}
+	// marks collects the source positions of lowered statements.
+	marks *tolSourceMarks
+}
+
+// collectLibraryFuncs indexes linked library functions by library name.
+func collectLibraryFuncs(libs []lower.Library) map[string]map[string]struct{} {
+	if len(libs) == 0 {
+		return nil
+	}
+	out := make(map[string]map[string]struct{}, len(libs))
+	for _, lib := range libs {
+		fns := make(map[string]struct{}, len(lib.Functions))
+		for _, fn := range lib.Functions {
+			fns[fn.Name] = struct{}{}
+		}
+		out[lib.Name] = fns
+	}
+	return out
+}
+
+// libraryFunctionLuaName returns the global a linked library function is
+// emitted as: "__tol_lib_<Library>_<fn>".
+func libraryFunctionLuaName(lib, fn string) string {
+	return "__tol_lib_" + lib + "_" + fn
 }
 
 type storageSlotKind string
@@ -167,6 +255,47 @@ func buildLoweringEnv(contractName string, dispatchFns []dispatchFunc, storageSl
 	}, nil
 }
 
+// computeImmutableSlotHash returns the reserved slot holding an immutable value:
+// keccak256("tol.immutable.<contractName>.<name>").
+func computeImmutableSlotHash(contractName, name string) string {
+	h := sha3.NewLegacyKeccak256()
+	_, _ = h.Write([]byte("tol.immutable." + contractName + "." + name))
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
+
+// addConstantsToLoweringEnv registers folded constants for inline substitution
+// and maps immutables onto reserved scalar slots. Sema guarantees immutables
+// are only written by the constructor, so they reuse the scalar load/store path.
+func addConstantsToLoweringEnv(env *loweringEnv, consts []lower.Constant, immutables []lower.Immutable) error {
+	env.constByName = make(map[string]lower.Constant, len(consts))
+	for _, c := range consts {
+		name := strings.TrimSpace(c.Name)
+		if _, exists := env.constByName[name]; exists {
+			return fmt.Errorf("[%s] duplicate constant '%s' in lowered program", diag.CodeLowerUnsupportedFeature, name)
+		}
+		switch c.Kind {
+		case "number", "string", "bool":
+		default:
+			return fmt.Errorf("[%s] unsupported constant kind '%s' for '%s'", diag.CodeLowerUnsupportedFeature, c.Kind, name)
+		}
+		env.constByName[name] = c
+	}
+	for _, im := range immutables {
+		name := strings.TrimSpace(im.Name)
+		if _, exists := env.storageByName[name]; exists {
+			return fmt.Errorf("[%s] immutable '%s' collides with storage slot in lowered program", diag.CodeLowerUnsupportedFeature, name)
+		}
+		env.storageByName[name] = storageSlotInfo{
+			name:         name,
+			kind:         storageKindScalar,
+			typ:          strings.TrimSpace(im.Type),
+			baseSlotHash: computeImmutableSlotHash(env.contractName, name),
+			luaConstName: "__tol_i_" + name,
+		}
+	}
+	return nil
+}
+
 func classifyStorageSlotKind(t string) storageSlotKind {
 	norm := normalizeSelectorType(t)
 	compact := strings.ReplaceAll(norm, " ", "")
@@ -218,19 +347,17 @@ function __tol_sload(slot_hash)
   return v
 end
 
--- Write a slot by its final derived hash key.
+-- Write a slot by its final derived hash key. Reverts in static mode;
+-- the previous value is journaled so a failed frame can undo the write.
 function __tol_sstore(slot_hash, value)
+  __tol_static_guard("sstore")
+  __tol_journal_write(__tol_storage, slot_hash)
   __tol_storage[slot_hash] = value
   return value
 end
 
--- Derive a mapping slot key: keccak256(encode(key) ++ base_hash).
--- Matches spec §8.3: h_n = H(encode(k_n) ++ h_{n-1}).
-function __tol_mkey(key, base)
-  local base_hex = base:sub(3)       -- strip leading "0x"
-  local key_hex  = __tol_enc(key)    -- 64 hex chars, no 0x prefix
-  return keccak256("0x" .. key_hex .. base_hex)
-end
+-- Mapping slot keys come from the native __tol_mkey(key, base_hash):
+-- keccak256(encode(key) ++ base_hash), spec §8.3 h_n = H(encode(k_n) ++ h_{n-1}).
 
 -- Compute element slot for a storage array: H(base_slot) + index.
 -- Matches spec §8.4: element i at keccak256(base_slot) + i.
@@ -277,6 +404,7 @@ func collectDispatchFuncs(funcs []lower.Function) ([]dispatchFunc, error) {
 		out = append(out, dispatchFunc{
 			Name:      fn.Name,
 			Signature: sig,
+			Payable:   hasModifier(fn.Modifiers, "payable"),
 		})
 	}
 	sort.Slice(out, func(i, j int) bool {
@@ -326,7 +454,7 @@ func buildTosInitStmt() luast.Stmt {
 	})
 }
 
-func buildOnCreateAssignStmt() luast.Stmt {
+func buildOnCreateAssignStmt(payable bool) luast.Stmt {
 	call := withLineExpr(&luast.FuncCallExpr{
 		Func: withLineExpr(&luast.IdentExpr{Value: "__tol_constructor"}),
 		Args: []luast.Expr{
@@ -335,14 +463,17 @@ func buildOnCreateAssignStmt() luast.Stmt {
 		// Keep return arity unchanged when constructor returns values.
 		AdjustRet: false,
 	})
+	var stmts []luast.Stmt
+	if !payable {
+		stmts = append(stmts, buildNonPayableGuardStmt())
+	}
+	stmts = append(stmts, withLineStmt(&luast.ReturnStmt{Exprs: []luast.Expr{call}}))
 	fn := withLineExpr(&luast.FunctionExpr{
 		ParList: &luast.ParList{
 			HasVargs: true,
 			Names:    []string{},
 		},
-		Stmts: []luast.Stmt{
-			withLineStmt(&luast.ReturnStmt{Exprs: []luast.Expr{call}}),
-		},
+		Stmts: stmts,
 	})
 	return withLineStmt(&luast.AssignStmt{
 		Lhs: []luast.Expr{
@@ -355,7 +486,7 @@ func buildOnCreateAssignStmt() luast.Stmt {
 	})
 }
 
-func buildOnInvokeAssignStmt(dispatchFns []dispatchFunc, hasFallback bool) luast.Stmt {
+func buildOnInvokeAssignStmt(dispatchFns []dispatchFunc, hasFallback, fallbackPayable bool) luast.Stmt {
 	body := make([]luast.Stmt, 0, len(dispatchFns)+2)
 	for _, fn := range dispatchFns {
 		cond := withLineExpr(&luast.RelationalOpExpr{
@@ -370,12 +501,15 @@ func buildOnInvokeAssignStmt(dispatchFns []dispatchFunc, hasFallback bool) luast
 			},
 			AdjustRet: false,
 		})
+		var then []luast.Stmt
+		if !fn.Payable {
+			then = append(then, buildNonPayableGuardStmt())
+		}
+		then = append(then, withLineStmt(&luast.ReturnStmt{Exprs: []luast.Expr{call}}))
 		body = append(body, withLineStmt(&luast.IfStmt{
 			Condition: cond,
-			Then: []luast.Stmt{
-				withLineStmt(&luast.ReturnStmt{Exprs: []luast.Expr{call}}),
-			},
-			Else: []luast.Stmt{},
+			Then:      then,
+			Else:      []luast.Stmt{},
 		}))
 	}
 	if hasFallback {
@@ -384,6 +518,9 @@ func buildOnInvokeAssignStmt(dispatchFns []dispatchFunc, hasFallback bool) luast
 			Args:      []luast.Expr{},
 			AdjustRet: false,
 		})
+		if !fallbackPayable {
+			body = append(body, buildNonPayableGuardStmt())
+		}
 		body = append(body, withLineStmt(&luast.ReturnStmt{Exprs: []luast.Expr{call}}))
 	} else {
 		body = append(body, withLineStmt(&luast.FuncCallStmt{
@@ -434,6 +571,7 @@ func normalizeSelectorType(t string) string {
 	repl := strings.NewReplacer(
 		"( ", "(",
 		" )", ")",
+		" [", "[",
 		"[ ", "[",
 		" ]", "]",
 		" ,", ",",
@@ -463,6 +601,7 @@ func lowerFunctionToLua(fn lower.Function, env *loweringEnv) (luast.Stmt, error)
 	}
 
 	ctx := newLoweringCtx(env)
+	ctx.function = fn.Name
 	for _, name := range parNames {
 		ctx.declareLocal(name)
 	}
@@ -471,7 +610,11 @@ func lowerFunctionToLua(fn lower.Function, env *loweringEnv) (luast.Stmt, error)
 		return nil, err
 	}
 
-	nameExpr := withLineExpr(&luast.IdentExpr{Value: fn.Name})
+	luaName := fn.Name
+	if env != nil && env.library != "" {
+		luaName = libraryFunctionLuaName(env.library, fn.Name)
+	}
+	nameExpr := withLineExpr(&luast.IdentExpr{Value: luaName})
 	fnExpr := withLineExpr(&luast.FunctionExpr{
 		ParList: &luast.ParList{
 			HasVargs: false,
@@ -482,13 +625,13 @@ func lowerFunctionToLua(fn lower.Function, env *loweringEnv) (luast.Stmt, error)
 	name := &luast.FuncName{
 		Func: nameExpr,
 	}
-	return withLineStmt(&luast.FuncDefStmt{
+	return ctx.stampLines(fn.Pos, withLineStmt(&luast.FuncDefStmt{
 		Name: name,
 		Func: fnExpr,
-	}), nil
+	})), nil
 }
 
-func lowerConstructorToLua(params []tolast.FieldDecl, body []tolast.Statement, env *loweringEnv) (luast.Stmt, error) {
+func lowerConstructorToLua(pos tolast.Pos, params []tolast.FieldDecl, body []tolast.Statement, env *loweringEnv) (luast.Stmt, error) {
 	parNames := make([]string, 0, len(params))
 	for _, p := range params {
 		name := strings.TrimSpace(p.Name)
@@ -499,6 +642,7 @@ func lowerConstructorToLua(params []tolast.FieldDecl, body []tolast.Statement, e
 	}
 
 	ctx := newLoweringCtx(env)
+	ctx.function = "constructor"
 	for _, name := range parNames {
 		ctx.declareLocal(name)
 	}
@@ -517,10 +661,10 @@ func lowerConstructorToLua(params []tolast.FieldDecl, body []tolast.Statement, e
 	name := &luast.FuncName{
 		Func: nameExpr,
 	}
-	return withLineStmt(&luast.FuncDefStmt{
+	return ctx.stampLines(pos, withLineStmt(&luast.FuncDefStmt{
 		Name: name,
 		Func: fnExpr,
-	}), nil
+	})), nil
 }
 
 func classifyDirectIRFnModifiers(mods []string) (string, error) {
@@ -549,8 +693,10 @@ func isAllowedDirectIRFnModifier(m string) bool {
 	}
 }
 
-func lowerFallbackToLua(body []tolast.Statement, env *loweringEnv) (luast.Stmt, error) {
-	stmts, err := tolStmtsToLuaWithCtx(newLoweringCtx(env), body)
+func lowerFallbackToLua(pos tolast.Pos, body []tolast.Statement, env *loweringEnv) (luast.Stmt, error) {
+	ctx := newLoweringCtx(env)
+	ctx.function = "fallback"
+	stmts, err := tolStmtsToLuaWithCtx(ctx, body)
 	if err != nil {
 		return nil, err
 	}
@@ -565,10 +711,10 @@ func lowerFallbackToLua(body []tolast.Statement, env *loweringEnv) (luast.Stmt,
 	name := &luast.FuncName{
 		Func: nameExpr,
 	}
-	return withLineStmt(&luast.FuncDefStmt{
+	return ctx.stampLines(pos, withLineStmt(&luast.FuncDefStmt{
 		Name: name,
 		Func: fnExpr,
-	}), nil
+	})), nil
 }
 
 type loweringLoop struct {
@@ -580,6 +726,8 @@ type loweringCtx struct {
 	loops    []loweringLoop
 	env      *loweringEnv
 	scopes   []map[string]struct{}
+	// function names the function being lowered, for revert locations.
+	function string
 }
 
 func newLoweringCtx(env *loweringEnv) *loweringCtx {
@@ -659,6 +807,64 @@ func (c *loweringCtx) storageInfoByName(name string) (storageSlotInfo, bool) {
 	return info, ok
 }
 
+// libraryCallTarget resolves a call callee naming a linked library
+// function: `Lib.fn`, or a bare `fn` of the enclosing library.
+func (c *loweringCtx) libraryCallTarget(callee *tolast.Expr) (string, bool) {
+	if c == nil || c.env == nil || len(c.env.libraryFuncs) == 0 {
+		return "", false
+	}
+	root := stripTolParens(callee)
+	if root == nil {
+		return "", false
+	}
+	lib, fn := "", ""
+	switch root.Kind {
+	case "ident":
+		lib, fn = c.env.library, strings.TrimSpace(root.Value)
+	case "member":
+		obj := stripTolParens(root.Object)
+		if obj == nil || obj.Kind != "ident" {
+			return "", false
+		}
+		lib, fn = strings.TrimSpace(obj.Value), strings.TrimSpace(root.Member)
+		if c.isLocalName(lib) {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	if lib == "" || (root.Kind == "ident" && c.isLocalName(fn)) {
+		return "", false
+	}
+	if _, ok := c.env.libraryFuncs[lib][fn]; !ok {
+		return "", false
+	}
+	return libraryFunctionLuaName(lib, fn), true
+}
+
+func (c *loweringCtx) constantByName(name string) (lower.Constant, bool) {
+	if c == nil || c.env == nil || len(c.env.constByName) == 0 || c.isLocalName(name) {
+		return lower.Constant{}, false
+	}
+	k, ok := c.env.constByName[strings.TrimSpace(name)]
+	return k, ok
+}
+
+// lowerConstantExpr inlines a folded constant as a literal.
+func lowerConstantExpr(c lower.Constant) luast.Expr {
+	switch c.Kind {
+	case "string":
+		return tolStringConstExpr(c.Value)
+	case "bool":
+		if c.Value == "true" {
+			return withLineExpr(&luast.TrueExpr{})
+		}
+		return withLineExpr(&luast.FalseExpr{})
+	default:
+		return withLineExpr(&luast.NumberExpr{Value: c.Value})
+	}
+}
+
 func (c *loweringCtx) storagePathFromExpr(e *tolast.Expr) (string, []*tolast.Expr, bool) {
 	if c == nil || e == nil {
 		return "", nil, false
@@ -690,6 +896,14 @@ func (c *loweringCtx) storagePathFromExpr(e *tolast.Expr) (string, []*tolast.Exp
 }
 
 func tolStmtToLua(ctx *loweringCtx, stmt tolast.Statement) (luast.Stmt, error) {
+	out, err := tolStmtKindToLua(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.stampLines(stmt.Pos, out), nil
+}
+
+func tolStmtKindToLua(ctx *loweringCtx, stmt tolast.Statement) (luast.Stmt, error) {
 	switch stmt.Kind {
 	case "let":
 		exprs := []luast.Expr{}
@@ -858,9 +1072,17 @@ func tolStmtToLua(ctx *loweringCtx, stmt tolast.Statement) (luast.Stmt, error) {
 			Args:      args,
 			AdjustRet: true,
 		})
-		return withLineStmt(&luast.FuncCallStmt{Expr: call}), nil
-	case "require", "assert":
-		// require(cond, "msg") → assert(cond, "msg")
+		// Log emission reverts in static mode.
+		guard := withLineExpr(&luast.FuncCallExpr{
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_static_guard"}),
+			Args:      []luast.Expr{withLineExpr(&luast.StringExpr{Value: "emit"})},
+			AdjustRet: true,
+		})
+		return withLineStmt(&luast.DoBlockStmt{Stmts: []luast.Stmt{
+			withLineStmt(&luast.FuncCallStmt{Expr: guard}),
+			withLineStmt(&luast.FuncCallStmt{Expr: call}),
+		}}), nil
+	case "assert":
 		// assert(cond, "msg") → assert(cond, "msg")
 		// Lua's assert(v, msg) raises an error with msg if v is falsy.
 		args := []luast.Expr{}
@@ -880,27 +1102,85 @@ func tolStmtToLua(ctx *loweringCtx, stmt tolast.Statement) (luast.Stmt, error) {
 			AdjustRet: true,
 		})
 		return withLineStmt(&luast.FuncCallStmt{Expr: call}), nil
-	case "revert":
-		// revert "msg" → error("msg")
-		args := []luast.Expr{}
+	case "require":
+		// require(cond, "msg") → __tol_require(cond, "msg", "<Contract>", "<fn>")
+		// which raises a structured revert (see RevertError) if cond is falsy.
+		cond := luast.Expr(withLineExpr(&luast.TrueExpr{}))
 		if stmt.Expr != nil {
 			ex, err := tolExprToLua(ctx, stmt.Expr)
 			if err != nil {
 				return nil, err
 			}
-			args = append(args, ex)
+			cond = ex
+		}
+		reason := luast.Expr(withLineExpr(&luast.StringExpr{Value: ""}))
+		if stmt.Text != "" {
+			reason = withLineExpr(&luast.StringExpr{Value: unquoteIfNeeded(stmt.Text)})
 		}
+		args := append([]luast.Expr{cond}, revertArgs(ctx, reason)...)
 		call := withLineExpr(&luast.FuncCallExpr{
-			Func:      withLineExpr(&luast.IdentExpr{Value: "error"}),
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_require"}),
 			Args:      args,
 			AdjustRet: true,
 		})
 		return withLineStmt(&luast.FuncCallStmt{Expr: call}), nil
+	case "revert":
+		// revert "msg" → __tol_revert("msg", "<Contract>", "<fn>")
+		reason := luast.Expr(withLineExpr(&luast.StringExpr{Value: ""}))
+		if stmt.Expr != nil {
+			ex, err := tolExprToLua(ctx, stmt.Expr)
+			if err != nil {
+				return nil, err
+			}
+			reason = ex
+		}
+		call := withLineExpr(&luast.FuncCallExpr{
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_revert"}),
+			Args:      revertArgs(ctx, reason),
+			AdjustRet: true,
+		})
+		return withLineStmt(&luast.FuncCallStmt{Expr: call}), nil
 	default:
 		return nil, fmt.Errorf("[%s] unsupported statement kind '%s'", diag.CodeLowerUnsupportedFeature, stmt.Kind)
 	}
 }
 
+// revertArgs returns the arguments of __tol_revert/__tol_require after the
+// condition: the reason and the contract and function being lowered.
+func revertArgs(ctx *loweringCtx, reason luast.Expr) []luast.Expr {
+	return []luast.Expr{
+		reason,
+		withLineExpr(&luast.StringExpr{Value: ctx.owner()}),
+		withLineExpr(&luast.StringExpr{Value: ctx.function}),
+	}
+}
+
+// owner names the contract or library being lowered.
+func (c *loweringCtx) owner() string {
+	if c.env == nil {
+		return ""
+	}
+	if c.env.library != "" {
+		return c.env.library
+	}
+	return c.env.contractName
+}
+
+// stampLines gives the lowered nodes of s that carry no TOL position yet
+// the synthetic line standing for pos, the position of the TOL statement
+// or declaration s was lowered from.
+func (c *loweringCtx) stampLines(pos tolast.Pos, s luast.Stmt) luast.Stmt {
+	if c.env == nil || c.env.marks == nil || !pos.IsValid() {
+		return s
+	}
+	fn := c.function
+	if owner := c.owner(); owner != "" {
+		fn = owner + "." + fn
+	}
+	stampLuaStmt(s, c.env.marks.add(pos, fn))
+	return s
+}
+
 func tolStmtsToLua(in []tolast.Statement) ([]luast.Stmt, error) {
 	return tolStmtsToLuaWithCtx(newLoweringCtx(nil), in)
 }
@@ -966,6 +1246,9 @@ func tolExprToLua(ctx *loweringCtx, e *tolast.Expr) (luast.Expr, error) {
 		if slotName, keys, ok := ctx.storagePathFromExpr(e); ok {
 			return lowerStorageLoadExpr(ctx, slotName, keys)
 		}
+		if c, ok := ctx.constantByName(e.Value); ok {
+			return lowerConstantExpr(c), nil
+		}
 		switch e.Value {
 		case "true":
 			return withLineExpr(&luast.TrueExpr{}), nil
@@ -979,7 +1262,7 @@ func tolExprToLua(ctx *loweringCtx, e *tolast.Expr) (luast.Expr, error) {
 	case "number":
 		return withLineExpr(&luast.NumberExpr{Value: e.Value}), nil
 	case "string":
-		return withLineExpr(&luast.StringExpr{Value: unquoteIfNeeded(e.Value)}), nil
+		return tolStringConstExpr(unquoteIfNeeded(e.Value)), nil
 	case "paren":
 		return tolExprToLua(ctx, e.Left)
 	case "unary":
@@ -1039,9 +1322,15 @@ func tolExprToLua(ctx *loweringCtx, e *tolast.Expr) (luast.Expr, error) {
 			}
 			return storageExpr, nil
 		}
-		callee, err := tolExprToLua(ctx, e.Callee)
-		if err != nil {
-			return nil, err
+		var callee luast.Expr
+		if luaName, ok := ctx.libraryCallTarget(e.Callee); ok {
+			callee = withLineExpr(&luast.IdentExpr{Value: luaName})
+		} else {
+			var err error
+			callee, err = tolExprToLua(ctx, e.Callee)
+			if err != nil {
+				return nil, err
+			}
 		}
 		args := make([]luast.Expr, 0, len(e.Args))
 		for _, a := range e.Args {
@@ -1093,6 +1382,25 @@ func tolExprToLua(ctx *loweringCtx, e *tolast.Expr) (luast.Expr, error) {
 			Object: obj,
 			Key:    idx,
 		}), nil
+	case "slice":
+		// x[start:end] → __tol_slice(x, start, end); a missing bound is nil.
+		args := make([]luast.Expr, 0, 3)
+		for _, part := range []*tolast.Expr{e.Object, e.Left, e.Right} {
+			if part == nil {
+				args = append(args, withLineExpr(&luast.NilExpr{}))
+				continue
+			}
+			arg, err := tolExprToLua(ctx, part)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return withLineExpr(&luast.FuncCallExpr{
+			Func:      withLineExpr(&luast.IdentExpr{Value: "__tol_slice"}),
+			Args:      args,
+			AdjustRet: true,
+		}), nil
 	default:
 		return nil, fmt.Errorf("[%s] unsupported expression kind '%s'", diag.CodeLowerUnsupportedFeature, e.Kind)
 	}
@@ -1114,7 +1422,7 @@ func lowerSelectorBuiltinExpr(e *tolast.Expr) (luast.Expr, bool, error) {
 		return nil, true, fmt.Errorf("[%s] selector(...) argument must be a string literal", diag.CodeLowerUnsupportedFeature)
 	}
 	sig := unquoteIfNeeded(arg.Value)
-	return withLineExpr(&luast.StringExpr{Value: selectorHexFromSignature(sig)}), true, nil
+	return tolStringConstExpr(selectorHexFromSignature(sig)), true, nil
 }
 
 func stripTolParens(e *tolast.Expr) *tolast.Expr {
@@ -1154,7 +1462,7 @@ func lowerSelectorMemberExpr(ctx *loweringCtx, e *tolast.Expr) (luast.Expr, bool
 	if !ok {
 		return nil, true, fmt.Errorf("[%s] selector target '%s' is not externally dispatchable in current stage", diag.CodeLowerUnsupportedFeature, fnName)
 	}
-	return withLineExpr(&luast.StringExpr{Value: sel}), true, nil
+	return tolStringConstExpr(sel), true, nil
 }
 
 // buildHashSlotExpr builds the final Lua expression for a storage slot access.
@@ -1331,6 +1639,19 @@ func withLineStmt[T luast.Stmt](s T) T {
 	return s
 }
 
+// tolStringConstExpr lowers the text of a string literal or folded
+// constant. "0x" literals with an even number of hex digits are bytes
+// literals and become bytes constants, so they compare equal to the bytes
+// values of msg.data, slices and the hash builtins.
+func tolStringConstExpr(s string) luast.Expr {
+	if strings.HasPrefix(s, "0x") && len(s)%2 == 0 {
+		if b, err := hex.DecodeString(s[2:]); err == nil {
+			return withLineExpr(&constLValueExpr{Value: LBytes(b)})
+		}
+	}
+	return withLineExpr(&luast.StringExpr{Value: s})
+}
+
 func unquoteIfNeeded(s string) string {
 	s = strings.TrimSpace(s)
 	if len(s) >= 2 && ((s[0] == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'')) {
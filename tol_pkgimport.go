@@ -0,0 +1,446 @@
+package lua
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tolast "github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/diag"
+)
+
+// TORLockFileName is the conventional lockfile name next to the entry source.
+const TORLockFileName = "tor.lock"
+
+// TORLock pins package imports to content hashes (TOL_PKG.md §6.5).
+type TORLock struct {
+	Imports []TORLockEntry `json:"imports"`
+}
+
+// TORLockEntry pins one name@version package to its archive hash.
+type TORLockEntry struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Registry    string `json:"registry,omitempty"`
+	PackageHash string `json:"package_hash"`
+	ResolvedAt  string `json:"resolved_at,omitempty"`
+}
+
+// DecodeTORLock parses and validates tor.lock content.
+func DecodeTORLock(data []byte) (*TORLock, error) {
+	var lock TORLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("tor.lock decode error: %w", err)
+	}
+	seen := map[string]struct{}{}
+	for _, e := range lock.Imports {
+		if strings.TrimSpace(e.Name) == "" || strings.TrimSpace(e.Version) == "" {
+			return nil, fmt.Errorf("tor.lock entry requires non-empty 'name' and 'version'")
+		}
+		key := e.Name + "@" + e.Version
+		if _, dup := seen[key]; dup {
+			return nil, fmt.Errorf("tor.lock has duplicate entry %q", key)
+		}
+		seen[key] = struct{}{}
+		if !isHash32Hex(e.PackageHash) {
+			return nil, fmt.Errorf("tor.lock entry %q has invalid package_hash %q", key, e.PackageHash)
+		}
+	}
+	return &lock, nil
+}
+
+// EncodeTORLock serializes a lockfile with entries sorted by name and version.
+func EncodeTORLock(lock *TORLock) ([]byte, error) {
+	out := TORLock{Imports: []TORLockEntry{}}
+	if lock != nil {
+		out.Imports = append(out.Imports, lock.Imports...)
+	}
+	sort.Slice(out.Imports, func(i, j int) bool {
+		if out.Imports[i].Name != out.Imports[j].Name {
+			return out.Imports[i].Name < out.Imports[j].Name
+		}
+		return out.Imports[i].Version < out.Imports[j].Version
+	})
+	body, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
+
+// Pin returns the lock entry for name@version, if any.
+func (l *TORLock) Pin(name, version string) (TORLockEntry, bool) {
+	if l == nil {
+		return TORLockEntry{}, false
+	}
+	for _, e := range l.Imports {
+		if e.Name == name && e.Version == version {
+			return e, true
+		}
+	}
+	return TORLockEntry{}, false
+}
+
+// PackageImportResolver is implemented by source loaders that can also
+// resolve `tor://name@version` and `toc://0x<hash>` package imports.
+type PackageImportResolver interface {
+	ResolvePackageImport(spec string) (*TORPackageImport, error)
+}
+
+// TORPackageImport is a verified package resolved for an import.
+// Symbols maps interface names (and the names of contracts that ship a
+// .toi) to the interface surface a caller may type-check against.
+type TORPackageImport struct {
+	Name        string
+	Version     string
+	PackageHash string
+	Symbols     map[string]*tolast.InterfaceDecl
+}
+
+// TORPackageLoader resolves relative source imports through SourceLoader and
+// package imports from CacheDir, a local directory of .tor archives.
+// Resolved packages are checked against Lock; new pins are recorded in Lock
+// unless Frozen is set, in which case unpinned packages are rejected.
+type TORPackageLoader struct {
+	SourceLoader
+	CacheDir string
+	Lock     *TORLock
+	Frozen   bool
+
+	indexed bool
+	byName  map[string]string // name@version -> archive path
+	byHash  map[string]string // package hash -> archive path
+	byTOC   map[string]string // .toc bytecode hash -> archive path
+}
+
+// ResolvePackageImport implements PackageImportResolver. The archive hash
+// must match the requested content hash or the tor.lock pin; every embedded
+// .toc must match its bytecode hash, and every .toi must agree with the ABI
+// of the contract bytecode it describes.
+func (l *TORPackageLoader) ResolvePackageImport(spec string) (*TORPackageImport, error) {
+	ref, err := parsePackageImportSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	var archivePath string
+	switch ref.scheme {
+	case "tor":
+		archivePath = l.byName[ref.name+"@"+ref.version]
+	case "toc":
+		archivePath = l.byHash[ref.hash]
+		if archivePath == "" {
+			archivePath = l.byTOC[ref.hash]
+		}
+	}
+	if archivePath == "" {
+		return nil, importDiag(diag.CodeImportNotFound, "package %q not found in cache %q", ref.base, l.CacheDir)
+	}
+
+	body, err := os.ReadFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	pkgHash := TORPackageHash(body)
+	art, err := DecodeTOR(body)
+	if err != nil {
+		return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: %v", ref.base, err)
+	}
+	manifest, err := decodeTORImportManifest(art.ManifestJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ref.scheme {
+	case "tor":
+		if manifest.Name != ref.name || manifest.Version != ref.version {
+			return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: archive manifest declares %s@%s", ref.base, manifest.Name, manifest.Version)
+		}
+	case "toc":
+		if pkgHash != ref.hash && !torContainsTOCHash(art, ref.hash) {
+			return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: content hash mismatch (archive hash %s)", ref.base, pkgHash)
+		}
+	}
+
+	symbols, err := typeCheckTORInterfaces(ref.base, art, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.pin(manifest.Name, manifest.Version, pkgHash); err != nil {
+		return nil, err
+	}
+	return &TORPackageImport{
+		Name:        manifest.Name,
+		Version:     manifest.Version,
+		PackageHash: pkgHash,
+		Symbols:     symbols,
+	}, nil
+}
+
+func (l *TORPackageLoader) pin(name, version, pkgHash string) error {
+	if l.Lock == nil {
+		if l.Frozen {
+			return importDiag(diag.CodeImportLockMismatch, "package %s@%s is not pinned (no tor.lock)", name, version)
+		}
+		return nil
+	}
+	if e, ok := l.Lock.Pin(name, version); ok {
+		if e.PackageHash != pkgHash {
+			return importDiag(diag.CodeImportLockMismatch, "package %s@%s hash %s does not match tor.lock pin %s", name, version, pkgHash, e.PackageHash)
+		}
+		return nil
+	}
+	if l.Frozen {
+		return importDiag(diag.CodeImportLockMismatch, "package %s@%s is not pinned in tor.lock", name, version)
+	}
+	l.Lock.Imports = append(l.Lock.Imports, TORLockEntry{
+		Name:        name,
+		Version:     version,
+		PackageHash: pkgHash,
+		ResolvedAt:  time.Now().UTC().Format("2006-01-02"),
+	})
+	return nil
+}
+
+// buildIndex scans CacheDir once. Archives that fail to decode are skipped
+// so that a single corrupt file cannot satisfy (or block) other imports.
+func (l *TORPackageLoader) buildIndex() error {
+	if l.indexed {
+		return nil
+	}
+	if strings.TrimSpace(l.CacheDir) == "" {
+		return importDiag(diag.CodeImportUnsupported, "package imports require a package cache directory")
+	}
+	entries, err := os.ReadDir(l.CacheDir)
+	if err != nil {
+		return err
+	}
+	l.byName = map[string]string{}
+	l.byHash = map[string]string{}
+	l.byTOC = map[string]string{}
+	for _, ent := range entries {
+		if ent.IsDir() || !strings.EqualFold(filepath.Ext(ent.Name()), ".tor") {
+			continue
+		}
+		full := filepath.Join(l.CacheDir, ent.Name())
+		body, err := os.ReadFile(full)
+		if err != nil {
+			continue
+		}
+		art, err := DecodeTOR(body)
+		if err != nil {
+			continue
+		}
+		manifest, err := decodeTORImportManifest(art.ManifestJSON)
+		if err != nil {
+			continue
+		}
+		key := manifest.Name + "@" + manifest.Version
+		if _, exists := l.byName[key]; !exists {
+			l.byName[key] = full
+		}
+		l.byHash[TORPackageHash(body)] = full
+		for _, c := range manifest.Contracts {
+			if toc, err := DecodeTOC(art.Files[c.TOC]); err == nil {
+				l.byTOC[strings.ToLower(toc.BytecodeHash)] = full
+			}
+		}
+	}
+	l.indexed = true
+	return nil
+}
+
+type packageImportRef struct {
+	scheme  string // "tor" or "toc"
+	base    string // spec without the ::Symbol suffix
+	name    string
+	version string
+	hash    string
+}
+
+func isPackageImportSpec(spec string) bool {
+	return strings.HasPrefix(spec, "tor://") || strings.HasPrefix(spec, "toc://")
+}
+
+// splitPackageImportSymbol splits `base::Symbol`; the symbol defaults to the
+// imported name.
+func splitPackageImportSymbol(spec, importName string) (string, string) {
+	if idx := strings.Index(spec, "::"); idx >= 0 {
+		return spec[:idx], strings.TrimSpace(spec[idx+2:])
+	}
+	return spec, importName
+}
+
+func parsePackageImportSpec(spec string) (*packageImportRef, error) {
+	base, _ := splitPackageImportSymbol(strings.TrimSpace(spec), "")
+	switch {
+	case strings.HasPrefix(base, "tor://"):
+		nameVer := strings.TrimPrefix(base, "tor://")
+		at := strings.LastIndex(nameVer, "@")
+		if at <= 0 || at == len(nameVer)-1 {
+			return nil, importDiag(diag.CodeImportUnsupported, "package import %q must have the form tor://name@version", spec)
+		}
+		return &packageImportRef{scheme: "tor", base: base, name: nameVer[:at], version: nameVer[at+1:]}, nil
+	case strings.HasPrefix(base, "toc://"):
+		hash := strings.ToLower(strings.TrimPrefix(base, "toc://"))
+		if !isHash32Hex(hash) {
+			return nil, importDiag(diag.CodeImportUnsupported, "package import %q must have the form toc://0x<64 hex digits>", spec)
+		}
+		return &packageImportRef{scheme: "toc", base: base, hash: hash}, nil
+	}
+	return nil, importDiag(diag.CodeImportUnsupported, "unsupported package import %q", spec)
+}
+
+func isHash32Hex(v string) bool {
+	if !strings.HasPrefix(v, "0x") || len(v) != 66 {
+		return false
+	}
+	_, err := hex.DecodeString(v[2:])
+	return err == nil
+}
+
+type torImportManifest struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Contracts []struct {
+		Name string `json:"name"`
+		TOC  string `json:"toc"`
+		TOI  string `json:"toi"`
+	} `json:"contracts"`
+}
+
+func decodeTORImportManifest(manifestJSON []byte) (*torImportManifest, error) {
+	var m torImportManifest
+	if err := json.Unmarshal(manifestJSON, &m); err != nil {
+		return nil, fmt.Errorf("tor manifest decode error: %w", err)
+	}
+	for i := range m.Contracts {
+		if m.Contracts[i].TOC != "" {
+			if p, err := normalizeTORPath(m.Contracts[i].TOC); err == nil {
+				m.Contracts[i].TOC = p
+			}
+		}
+		if m.Contracts[i].TOI != "" {
+			if p, err := normalizeTORPath(m.Contracts[i].TOI); err == nil {
+				m.Contracts[i].TOI = p
+			}
+		}
+	}
+	return &m, nil
+}
+
+func torContainsTOCHash(art *TORArtifact, hash string) bool {
+	for name, body := range art.Files {
+		if !strings.HasSuffix(strings.ToLower(name), ".toc") {
+			continue
+		}
+		if toc, err := DecodeTOC(body); err == nil && strings.ToLower(toc.BytecodeHash) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// typeCheckTORInterfaces parses every manifest .toi and checks that each
+// declared function and event exists, with identical types, in the ABI of
+// the contract's .toc.
+func typeCheckTORInterfaces(pkg string, art *TORArtifact, manifest *torImportManifest) (map[string]*tolast.InterfaceDecl, error) {
+	symbols := map[string]*tolast.InterfaceDecl{}
+	for _, c := range manifest.Contracts {
+		if c.TOI == "" {
+			continue
+		}
+		iface, err := parseTOIInterface(art.Files[c.TOI], c.TOI)
+		if err != nil {
+			return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: invalid interface %q: %v", pkg, c.TOI, err)
+		}
+		if c.TOC != "" {
+			toc, err := DecodeTOC(art.Files[c.TOC])
+			if err != nil {
+				return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: invalid bytecode %q: %v", pkg, c.TOC, err)
+			}
+			var abi tocABI
+			if err := json.Unmarshal(toc.ABIJSON, &abi); err != nil {
+				return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: invalid abi in %q: %v", pkg, c.TOC, err)
+			}
+			if err := checkInterfaceAgainstABI(iface, &abi); err != nil {
+				return nil, importDiag(diag.CodeImportPackageIntegrity, "package %q: interface %s does not match contract %s: %v", pkg, iface.Name, c.Name, err)
+			}
+		}
+		if _, exists := symbols[iface.Name]; !exists {
+			symbols[iface.Name] = iface
+		}
+		if _, exists := symbols[c.Name]; !exists {
+			symbols[c.Name] = iface
+		}
+	}
+	return symbols, nil
+}
+
+func checkInterfaceAgainstABI(iface *tolast.InterfaceDecl, abi *tocABI) error {
+	for _, fn := range iface.Functions {
+		params := make([]string, 0, len(fn.Params))
+		for _, p := range fn.Params {
+			params = append(params, normalizeTOCType(p.Type))
+		}
+		returns := make([]string, 0, len(fn.Returns))
+		for _, r := range fn.Returns {
+			returns = append(returns, normalizeTOCType(r.Type))
+		}
+		selector := strings.ToLower(strings.TrimSpace(fn.SelectorOverride))
+		if selector == "" {
+			selector = selectorHexFromSignatureForTOC(fn.Name, params)
+		}
+		found := false
+		for _, af := range abi.Functions {
+			if af.Selector != selector {
+				continue
+			}
+			if af.Name != fn.Name || !equalStrings(af.Params, params) || !equalStrings(af.Returns, returns) {
+				return fmt.Errorf("function %s (selector %s) has a different signature in bytecode", fn.Name, selector)
+			}
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("function %s (selector %s) is missing from bytecode", fn.Name, selector)
+		}
+	}
+	for _, ev := range iface.Events {
+		params := make([]string, 0, len(ev.Params))
+		for _, p := range ev.Params {
+			params = append(params, normalizeTOCType(p.Type))
+		}
+		found := false
+		for _, ae := range abi.Events {
+			if ae.Name == ev.Name && equalStrings(ae.Params, params) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("event %s is missing from bytecode", ev.Name)
+		}
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pkgImportTokenSource = `
+tol 0.2
+contract Token {
+  storage {
+    slot supply: u256;
+  }
+  event Transfer(from: address indexed, to: address indexed, value: u256)
+  fn totalSupply() -> (s: u256) public view {
+    return supply;
+  }
+  fn transfer(to: address, amount: u256) -> (ok: bool) public {
+    return true;
+  }
+}
+`
+
+func writeTestPackageCache(t *testing.T) (string, []byte) {
+	t.Helper()
+	tor, err := CompileTOLToTOR([]byte(pkgImportTokenSource), "token.tol", &TORCompileOptions{
+		PackageName:    "trc20-base",
+		PackageVersion: "1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("build test package: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "trc20-base-1.0.0.tor"), tor, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, tor
+}
+
+func TestParseTOLModuleWithLoaderResolvesTORImportAndPinsLock(t *testing.T) {
+	cache, tor := writeTestPackageCache(t)
+	loader := &TORPackageLoader{
+		SourceLoader: MapSourceLoader{
+			"main.tol": []byte("tol 0.2\nimport IToken from \"tor://trc20-base@1.0.0\";\ncontract Main {}\n"),
+		},
+		CacheDir: cache,
+		Lock:     &TORLock{},
+	}
+	mod, err := ParseTOLModuleWithLoader(loader, "main.tol")
+	if err != nil {
+		t.Fatalf("unexpected resolve error: %v", err)
+	}
+	imp := mod.Imports[0]
+	if imp.Kind != "interface" || imp.Origin != "tor://trc20-base@1.0.0" || imp.Interface == nil {
+		t.Fatalf("unexpected resolved import: %+v", imp)
+	}
+	if len(imp.Interface.Functions) != 2 || len(imp.Interface.Events) != 1 {
+		t.Fatalf("unexpected interface surface: %+v", imp.Interface)
+	}
+	pin, ok := loader.Lock.Pin("trc20-base", "1.0.0")
+	if !ok || pin.PackageHash != TORPackageHash(tor) {
+		t.Fatalf("expected lock pin for package hash %s, got %+v", TORPackageHash(tor), loader.Lock)
+	}
+	if _, err := CompileTOLToBytecodeWithLoader(loader, "main.tol"); err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+}
+
+func TestParseTOLModuleWithLoaderResolvesTOCContentHashImports(t *testing.T) {
+	cache, tor := writeTestPackageCache(t)
+	art, err := DecodeTOR(tor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toc, err := DecodeTOC(art.Files["bytecode/Token.toc"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{TORPackageHash(tor), toc.BytecodeHash} {
+		loader := &TORPackageLoader{
+			SourceLoader: MapSourceLoader{
+				"main.tol": []byte("tol 0.2\nimport T from \"toc://" + hash + "::Token\";\ncontract Main {}\n"),
+			},
+			CacheDir: cache,
+		}
+		mod, err := ParseTOLModuleWithLoader(loader, "main.tol")
+		if err != nil {
+			t.Fatalf("hash %s: unexpected resolve error: %v", hash, err)
+		}
+		if mod.Imports[0].Interface == nil || mod.Imports[0].Interface.Name != "IToken" {
+			t.Fatalf("hash %s: unexpected import: %+v", hash, mod.Imports[0])
+		}
+	}
+}
+
+func TestParseTOLModuleWithLoaderRejectsPackageImportFailures(t *testing.T) {
+	cache, _ := writeTestPackageCache(t)
+	otherHash := "0x" + strings.Repeat("ab", 32)
+	cases := []struct {
+		name   string
+		spec   string
+		lock   *TORLock
+		frozen bool
+		code   string
+	}{
+		{"unknown version", "tor://trc20-base@2.0.0", nil, false, "TOL5001"},
+		{"unknown hash", "toc://" + otherHash, nil, false, "TOL5001"},
+		{"unknown symbol", "tor://trc20-base@1.0.0::IMissing", nil, false, "TOL5003"},
+		{"malformed hash", "toc://0x1234", nil, false, "TOL5004"},
+		{"pin mismatch", "tor://trc20-base@1.0.0", &TORLock{Imports: []TORLockEntry{{Name: "trc20-base", Version: "1.0.0", PackageHash: otherHash}}}, false, "TOL5007"},
+		{"frozen unpinned", "tor://trc20-base@1.0.0", &TORLock{}, true, "TOL5007"},
+	}
+	for _, tc := range cases {
+		loader := &TORPackageLoader{
+			SourceLoader: MapSourceLoader{
+				"main.tol": []byte("tol 0.2\nimport IToken from \"" + tc.spec + "\";\ncontract Main {}\n"),
+			},
+			CacheDir: cache,
+			Lock:     tc.lock,
+			Frozen:   tc.frozen,
+		}
+		_, err := ParseTOLModuleWithLoader(loader, "main.tol")
+		if err == nil || !strings.Contains(err.Error(), tc.code) {
+			t.Fatalf("%s: expected %s, got %v", tc.name, tc.code, err)
+		}
+	}
+}
+
+func TestParseTOLModuleWithLoaderRejectsInterfaceBytecodeMismatch(t *testing.T) {
+	tor, err := CompileTOLToTOR([]byte(pkgImportTokenSource), "token.tol", &TORCompileOptions{
+		PackageName:    "trc20-base",
+		PackageVersion: "1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	art, err := DecodeTOR(tor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	art.Files["interfaces/IToken.toi"] = []byte("tol 0.2\n\ninterface IToken {\n  fn mint(to: address) public;\n}\n")
+	tampered, err := EncodeTOR(art.ManifestJSON, art.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cache, "tampered.tor"), tampered, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loader := &TORPackageLoader{
+		SourceLoader: MapSourceLoader{
+			"main.tol": []byte("tol 0.2\nimport IToken from \"tor://trc20-base@1.0.0\";\ncontract Main {}\n"),
+		},
+		CacheDir: cache,
+	}
+	_, err = ParseTOLModuleWithLoader(loader, "main.tol")
+	if err == nil || !strings.Contains(err.Error(), "TOL5006") || !strings.Contains(err.Error(), "mint") {
+		t.Fatalf("expected interface/bytecode mismatch, got %v", err)
+	}
+}
+
+func TestTORLockRoundTrip(t *testing.T) {
+	hash := "0x" + strings.Repeat("01", 32)
+	lock := &TORLock{Imports: []TORLockEntry{
+		{Name: "zeta", Version: "1.0.0", PackageHash: hash},
+		{Name: "alpha", Version: "2.0.0", PackageHash: hash, ResolvedAt: "2026-03-01"},
+	}}
+	body, err := EncodeTORLock(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeTORLock(body)
+	if err != nil {
+		t.Fatalf("decode lock: %v", err)
+	}
+	if len(decoded.Imports) != 2 || decoded.Imports[0].Name != "alpha" {
+		t.Fatalf("expected sorted lock entries, got %+v", decoded.Imports)
+	}
+	if _, err := DecodeTORLock([]byte(`{"imports":[{"name":"a","version":"1","package_hash":"0x12"}]}`)); err == nil {
+		t.Fatalf("expected invalid package_hash error")
+	}
+	dup := `{"imports":[{"name":"a","version":"1","package_hash":"` + hash + `"},{"name":"a","version":"1","package_hash":"` + hash + `"}]}`
+	if _, err := DecodeTORLock([]byte(dup)); err == nil {
+		t.Fatalf("expected duplicate entry error")
+	}
+}
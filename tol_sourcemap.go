@@ -0,0 +1,377 @@
+package lua
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	luast "github.com/tos-network/tolang/ast"
+	tolast "github.com/tos-network/tolang/tol/ast"
+)
+
+// SourceMap links the instructions of bytecode compiled from TOL to the TOL
+// statements they were lowered from. It implements PositionResolver, e.g.
+// for GasProfiler.Positions.
+//
+// Bytecode compiled from TOL carries the TOL line of each instruction in its
+// line information, but not the file, column or enclosing TOL function, and
+// a line alone is ambiguous once imports or libraries are linked in.
+type SourceMap struct {
+	// Positions holds each distinct TOL position once.
+	Positions []SourcePosition `json:"positions"`
+	// Functions holds one entry per function proto, in depth-first order
+	// starting with the main chunk.
+	Functions []SourceMapFunction `json:"functions"`
+
+	index   sync.Once
+	byPrint map[string]*SourceMapFunction
+	byProto sync.Map // *FunctionProto -> *SourceMapFunction
+}
+
+// SourceMapFunction maps the instructions of one function proto.
+type SourceMapFunction struct {
+	// Fingerprint identifies the proto by its code and line information,
+	// so that decoded copies of the bytecode resolve as well.
+	Fingerprint string `json:"fingerprint"`
+	// Pcs holds, for each instruction, one plus the index of its position
+	// in Positions; zero marks instructions lowered from no TOL statement,
+	// such as the generated dispatch.
+	Pcs []int `json:"pcs"`
+}
+
+// ResolvePosition returns the TOL position of instruction pc of proto, and
+// false when proto is not part of the mapped bytecode or the instruction
+// has no position.
+func (m *SourceMap) ResolvePosition(proto *FunctionProto, pc int) (SourcePosition, bool) {
+	fn := m.function(proto)
+	if fn == nil || pc < 0 || pc >= len(fn.Pcs) || fn.Pcs[pc] == 0 {
+		return SourcePosition{}, false
+	}
+	return m.Positions[fn.Pcs[pc]-1], true
+}
+
+func (m *SourceMap) function(proto *FunctionProto) *SourceMapFunction {
+	if m == nil || proto == nil {
+		return nil
+	}
+	if fn, ok := m.byProto.Load(proto); ok {
+		return fn.(*SourceMapFunction)
+	}
+	m.index.Do(func() {
+		m.byPrint = make(map[string]*SourceMapFunction, len(m.Functions))
+		for i := range m.Functions {
+			fn := &m.Functions[i]
+			if _, dup := m.byPrint[fn.Fingerprint]; !dup {
+				m.byPrint[fn.Fingerprint] = fn
+			}
+		}
+	})
+	fn := m.byPrint[protoFingerprint(proto)]
+	if fn != nil {
+		m.byProto.Store(proto, fn)
+	}
+	return fn
+}
+
+// EncodeSourceMap serializes a source map as JSON.
+func EncodeSourceMap(m *SourceMap) ([]byte, error) {
+	if m == nil {
+		return nil, fmt.Errorf("nil source map")
+	}
+	return json.Marshal(m)
+}
+
+// DecodeSourceMap parses a source map encoded by EncodeSourceMap.
+func DecodeSourceMap(data []byte) (*SourceMap, error) {
+	m := &SourceMap{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	for i, fn := range m.Functions {
+		if fn.Fingerprint == "" {
+			return nil, fmt.Errorf("invalid source map: function %d has no fingerprint", i)
+		}
+		for pc, p := range fn.Pcs {
+			if p < 0 || p > len(m.Positions) {
+				return nil, fmt.Errorf("invalid source map: function %d pc %d references position %d", i, pc, p)
+			}
+		}
+	}
+	return m, nil
+}
+
+// VerifySourceMap checks that m maps the function protos of proto.
+func VerifySourceMap(m *SourceMap, proto *FunctionProto) error {
+	if m == nil {
+		return fmt.Errorf("nil source map")
+	}
+	protos := flattenProtos(proto, nil)
+	if len(protos) != len(m.Functions) {
+		return fmt.Errorf("source map covers %d functions, bytecode has %d", len(m.Functions), len(protos))
+	}
+	for i, p := range protos {
+		fn := m.Functions[i]
+		if fn.Fingerprint != protoFingerprint(p) {
+			return fmt.Errorf("source map fingerprint mismatch for function %d", i)
+		}
+		if len(fn.Pcs) != len(p.Code) {
+			return fmt.Errorf("source map covers %d instructions of function %d, bytecode has %d", len(fn.Pcs), i, len(p.Code))
+		}
+	}
+	return nil
+}
+
+// CompileTOLToBytecodeWithSourceMap is CompileTOLToBytecode also returning
+// the source map of the bytecode.
+func CompileTOLToBytecodeWithSourceMap(source []byte, name string) ([]byte, *SourceMap, error) {
+	mod, err := ParseTOLModule(source, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	prog, err := buildLoweredTOLModule(mod, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	irp, sm, err := buildDirectIRWithSourceMap(prog, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	bytecode, err := compileTOLSourceMapped(irp, sm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytecode, sm, nil
+}
+
+// compileTOLSourceMapped compiles irp to bytecode and fingerprints the
+// function protos of its source map.
+func compileTOLSourceMapped(irp *IRProgram, sm *SourceMap) ([]byte, error) {
+	proto, err := CompileIR(irp)
+	if err != nil {
+		return nil, err
+	}
+	protos := flattenProtos(proto, nil)
+	if len(protos) != len(sm.Functions) {
+		return nil, fmt.Errorf("source map covers %d functions, bytecode has %d", len(sm.Functions), len(protos))
+	}
+	for i, p := range protos {
+		sm.Functions[i].Fingerprint = protoFingerprint(p)
+	}
+	return EncodeFunctionProto(proto)
+}
+
+// flattenProtos appends proto and its nested protos in depth-first order.
+func flattenProtos(proto *FunctionProto, out []*FunctionProto) []*FunctionProto {
+	if proto == nil {
+		return out
+	}
+	out = append(out, proto)
+	for _, child := range proto.FunctionPrototypes {
+		out = flattenProtos(child, out)
+	}
+	return out
+}
+
+// protoFingerprint hashes the code and line information of proto, without
+// its nested protos.
+func protoFingerprint(proto *FunctionProto) string {
+	buf := make([]byte, 0, 12+4*len(proto.Code)+4*len(proto.DbgSourcePositions))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(proto.LineDefined))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(proto.LastLineDefined))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(proto.Code)))
+	for _, inst := range proto.Code {
+		buf = binary.LittleEndian.AppendUint32(buf, inst)
+	}
+	for _, line := range proto.DbgSourcePositions {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(line))
+	}
+	return keccak256Hex(buf)
+}
+
+// firstSourceMark is the synthetic line of the first source mark. Lines
+// below it are the placeholders the lowering gives to new Lua nodes, or
+// lines of the Lua runtime preludes parsed into the chunk.
+const firstSourceMark = 1 << 24
+
+// tolSourceMarks collects the TOL positions of lowered statements. Each
+// distinct position stands on the Lua AST as a synthetic line, which the
+// compiler carries into the line information of the instructions generated
+// for it; apply then swaps it for the TOL line.
+type tolSourceMarks struct {
+	positions []SourcePosition
+	index     map[SourcePosition]int
+}
+
+// add returns the synthetic line standing for pos within function fn.
+func (m *tolSourceMarks) add(pos tolast.Pos, fn string) int {
+	sp := SourcePosition{File: pos.File, Line: pos.Line, Column: pos.Column, Function: fn}
+	if i, ok := m.index[sp]; ok {
+		return i + firstSourceMark
+	}
+	if m.index == nil {
+		m.index = map[SourcePosition]int{}
+	}
+	m.index[sp] = len(m.positions)
+	m.positions = append(m.positions, sp)
+	return len(m.positions) - 1 + firstSourceMark
+}
+
+// apply replaces the synthetic lines of root and its nested functions by
+// TOL lines and returns the source map of their instructions. Unmarked
+// lines are left as they are. The root chunk only declares the contract
+// functions, once per load; its instructions are left out of the map so
+// that positions resolve in the functions a call runs.
+func (m *tolSourceMarks) apply(root *IRFunction) *SourceMap {
+	sm := &SourceMap{Positions: append([]SourcePosition{}, m.positions...)}
+	var walk func(f *IRFunction)
+	walk = func(f *IRFunction) {
+		if f == nil {
+			return
+		}
+		pcs := make([]int, len(f.DbgSourcePositions))
+		for pc, line := range f.DbgSourcePositions {
+			if i := m.mark(line); i >= 0 {
+				if f != root {
+					pcs[pc] = i + 1
+				}
+				f.DbgSourcePositions[pc] = m.positions[i].Line
+			}
+		}
+		if i := m.mark(f.LineDefined); i >= 0 {
+			f.LineDefined = m.positions[i].Line
+		}
+		if i := m.mark(f.LastLineDefined); i >= 0 {
+			f.LastLineDefined = m.positions[i].Line
+		}
+		sm.Functions = append(sm.Functions, SourceMapFunction{Pcs: pcs})
+		for _, child := range f.Functions {
+			walk(child)
+		}
+	}
+	walk(root)
+	return sm
+}
+
+// mark returns the index of the position a synthetic line stands for, or
+// -1 for other lines.
+func (m *tolSourceMarks) mark(line int) int {
+	i := line - firstSourceMark
+	if i < 0 || i >= len(m.positions) {
+		return -1
+	}
+	return i
+}
+
+// stampLuaStmt gives line to the nodes of s not carrying a source mark yet.
+// Subtrees stamped already, by the statements nested in s, are kept.
+func stampLuaStmt(s luast.Stmt, line int) {
+	if s == nil || !stampLuaNode(s, line) {
+		return
+	}
+	switch s := s.(type) {
+	case *luast.AssignStmt:
+		stampLuaExprs(s.Lhs, line)
+		stampLuaExprs(s.Rhs, line)
+	case *luast.LocalAssignStmt:
+		stampLuaExprs(s.Exprs, line)
+	case *luast.FuncCallStmt:
+		stampLuaExpr(s.Expr, line)
+	case *luast.DoBlockStmt:
+		stampLuaStmts(s.Stmts, line)
+	case *luast.WhileStmt:
+		stampLuaExpr(s.Condition, line)
+		stampLuaStmts(s.Stmts, line)
+	case *luast.RepeatStmt:
+		stampLuaExpr(s.Condition, line)
+		stampLuaStmts(s.Stmts, line)
+	case *luast.IfStmt:
+		stampLuaExpr(s.Condition, line)
+		stampLuaStmts(s.Then, line)
+		stampLuaStmts(s.Else, line)
+	case *luast.NumberForStmt:
+		stampLuaExpr(s.Init, line)
+		stampLuaExpr(s.Limit, line)
+		stampLuaExpr(s.Step, line)
+		stampLuaStmts(s.Stmts, line)
+	case *luast.GenericForStmt:
+		stampLuaExprs(s.Exprs, line)
+		stampLuaStmts(s.Stmts, line)
+	case *luast.FuncDefStmt:
+		if s.Name != nil {
+			stampLuaExpr(s.Name.Func, line)
+			stampLuaExpr(s.Name.Receiver, line)
+		}
+		if s.Func != nil {
+			stampLuaExpr(s.Func, line)
+		}
+	case *luast.ReturnStmt:
+		stampLuaExprs(s.Exprs, line)
+	}
+}
+
+func stampLuaStmts(in []luast.Stmt, line int) {
+	for _, s := range in {
+		stampLuaStmt(s, line)
+	}
+}
+
+func stampLuaExpr(e luast.Expr, line int) {
+	if e == nil || !stampLuaNode(e, line) {
+		return
+	}
+	switch e := e.(type) {
+	case *luast.AttrGetExpr:
+		stampLuaExpr(e.Object, line)
+		stampLuaExpr(e.Key, line)
+	case *luast.TableExpr:
+		for _, f := range e.Fields {
+			if f != nil {
+				stampLuaExpr(f.Key, line)
+				stampLuaExpr(f.Value, line)
+			}
+		}
+	case *luast.FuncCallExpr:
+		stampLuaExpr(e.Func, line)
+		stampLuaExpr(e.Receiver, line)
+		stampLuaExprs(e.Args, line)
+	case *luast.LogicalOpExpr:
+		stampLuaExpr(e.Lhs, line)
+		stampLuaExpr(e.Rhs, line)
+	case *luast.RelationalOpExpr:
+		stampLuaExpr(e.Lhs, line)
+		stampLuaExpr(e.Rhs, line)
+	case *luast.StringConcatOpExpr:
+		stampLuaExpr(e.Lhs, line)
+		stampLuaExpr(e.Rhs, line)
+	case *luast.ArithmeticOpExpr:
+		stampLuaExpr(e.Lhs, line)
+		stampLuaExpr(e.Rhs, line)
+	case *luast.UnaryMinusOpExpr:
+		stampLuaExpr(e.Expr, line)
+	case *luast.UnaryNotOpExpr:
+		stampLuaExpr(e.Expr, line)
+	case *luast.UnaryLenOpExpr:
+		stampLuaExpr(e.Expr, line)
+	case *luast.UnaryBitNotOpExpr:
+		stampLuaExpr(e.Expr, line)
+	case *luast.FunctionExpr:
+		stampLuaStmts(e.Stmts, line)
+	}
+}
+
+func stampLuaExprs(in []luast.Expr, line int) {
+	for _, e := range in {
+		stampLuaExpr(e, line)
+	}
+}
+
+// stampLuaNode stamps a node without a source mark and reports whether it did.
+func stampLuaNode(n luast.PositionHolder, line int) bool {
+	if n.Line() >= firstSourceMark {
+		return false
+	}
+	n.SetLine(line)
+	n.SetLastLine(line)
+	return true
+}
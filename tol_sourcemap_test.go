@@ -0,0 +1,175 @@
+package lua
+
+import (
+	"strings"
+	"testing"
+)
+
+type positionRecorder struct {
+	NopTracer
+	sm    *SourceMap
+	lines map[int]string
+}
+
+func (r *positionRecorder) OnStep(L *LState, step *TraceStep) {
+	if pos, ok := r.sm.ResolvePosition(step.Proto, step.Pc); ok {
+		if pos.Line != step.Line {
+			panic("instruction line differs from its source map position")
+		}
+		r.lines[pos.Line] = pos.Function
+	}
+}
+
+func TestSourceMapResolvesTOLPositions(t *testing.T) {
+	bc, sm, err := CompileTOLToBytecodeWithSourceMap([]byte(revertGuardSource), "guard.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source map identifies decoded copies of the bytecode.
+	proto, err := DecodeFunctionProto(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySourceMap(sm, proto); err != nil {
+		t.Fatal(err)
+	}
+	// The main chunk runs on every load and is left unmapped.
+	for pc := range proto.Code {
+		if pos, ok := sm.ResolvePosition(proto, pc); ok {
+			t.Fatalf("main chunk instruction %d resolves to %+v", pc, pos)
+		}
+	}
+
+	L := NewState()
+	defer L.Close()
+	L.SetContractFrame(hostCounterAddr, 0)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	rec := &positionRecorder{sm: sm, lines: map[int]string{}}
+	L.SetTracer(rec)
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("check(u256)")))
+	L.Push(LNumber("5"))
+	if err := L.PCall(2, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	for line, fn := range map[int]string{8: "Guard.check", 9: "Guard.check", 10: "Guard.check"} {
+		if rec.lines[line] != fn {
+			t.Fatalf("line %d: got function %q, want %q (%v)", line, rec.lines[line], fn, rec.lines)
+		}
+	}
+	if _, ok := rec.lines[13]; ok {
+		t.Fatalf("stop() was not called, yet line 13 executed")
+	}
+
+	var file string
+	for _, p := range sm.Positions {
+		if p.Line == 9 {
+			file = p.File
+			if p.Column != 5 {
+				t.Fatalf("unexpected column for line 9: %+v", p)
+			}
+		}
+	}
+	if file != "guard.tol" {
+		t.Fatalf("unexpected source map positions: %+v", sm.Positions)
+	}
+}
+
+func TestSourceMapLeavesRuntimePreludeUnmapped(t *testing.T) {
+	// Enough statements for source marks to reach the line numbers of the
+	// storage prelude parsed into the chunk.
+	var sb strings.Builder
+	sb.WriteString("tol 0.2\ncontract Pile {\n  storage {\n    slot total: u256;\n  }\n  fn bump() public {\n")
+	for i := 0; i < 64; i++ {
+		sb.WriteString("    set total = total + 1;\n")
+	}
+	sb.WriteString("    return;\n  }\n}\n")
+	bc, sm, err := CompileTOLToBytecodeWithSourceMap([]byte(sb.String()), "pile.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto, err := DecodeFunctionProto(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range flattenProtos(proto, nil) {
+		prelude := false
+		for _, li := range p.DbgLocals {
+			prelude = prelude || li.Name == "slot_hash"
+		}
+		for pc := range p.Code {
+			if _, ok := sm.ResolvePosition(p, pc); ok && prelude {
+				t.Fatalf("storage prelude instruction %d of line %d has a TOL position", pc, p.DbgSourcePositions[pc])
+			}
+		}
+	}
+}
+
+func TestSourceMapPointsRuntimeErrorsAtTOLLines(t *testing.T) {
+	bc, err := CompileTOLToBytecode([]byte(revertGuardSource), "guard.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	L := NewState()
+	defer L.Close()
+	L.SetContractFrame(hostCounterAddr, 0)
+	if err := L.DoBytecode(bc); err != nil {
+		t.Fatal(err)
+	}
+	L.SetGasLimit(L.GasUsed() + 5000)
+	L.Push(L.GetField(L.GetGlobal("tos"), "oninvoke"))
+	L.Push(LString(selectorHexFromSignature("spin()")))
+	err = L.PCall(1, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "gas limit exceeded") {
+		t.Fatalf("expected gas exhaustion, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "guard.tol:16:") && !strings.Contains(err.Error(), "guard.tol:17:") {
+		t.Fatalf("expected the error to point into the loop, got %v", err)
+	}
+}
+
+func TestTOCEmbedsSourceMap(t *testing.T) {
+	plain, err := CompileTOLToTOC([]byte(revertGuardSource), "guard.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := CompileTOLToTOCWithOptions([]byte(revertGuardSource), "guard.tol", &TOCCompileOptions{SourceMap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := DecodeTOC(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := DecodeTOC(mapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.SourceMapJSON) != 0 || string(a.Bytecode) != string(b.Bytecode) {
+		t.Fatal("the source map section must be optional and leave the bytecode unchanged")
+	}
+	sm, err := b.SourceMap()
+	if err != nil || sm == nil || len(sm.Functions) == 0 {
+		t.Fatalf("unexpected embedded source map: %v %v", sm, err)
+	}
+
+	// Source maps of other bytecode are rejected.
+	other, _, err := CompileTOLToBytecodeWithSourceMap([]byte(hostCounterSource), "counter.tol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Bytecode = other
+	b.BytecodeHash = keccak256Hex(other)
+	bad, err := EncodeTOC(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeTOC(bad); err == nil || !strings.Contains(err.Error(), "source map") {
+		t.Fatalf("expected a source map mismatch, got %v", err)
+	}
+	if _, err := DecodeTOC(append(mapped, 0)); err == nil {
+		t.Fatal("expected trailing bytes to be rejected")
+	}
+}
@@ -27,8 +27,22 @@ type TOCArtifact struct {
 	StorageLayoutJSON []byte
 	SourceHash        string
 	BytecodeHash      string
+	// SourceMapJSON is the optional source map of Bytecode (see SourceMap).
+	SourceMapJSON []byte
 }
 
+// TOCCompileOptions controls optional .toc sections.
+type TOCCompileOptions struct {
+	// SourceMap embeds the source map of the bytecode.
+	SourceMap bool
+}
+
+// Optional sections follow the fixed .toc fields as a tag byte and a
+// length-prefixed payload, in increasing tag order.
+const (
+	tocSectionSourceMap uint8 = 1
+)
+
 type tocABI struct {
 	Functions []tocABIFunction `json:"functions"`
 	Events    []tocABIEvent    `json:"events"`
@@ -48,7 +62,8 @@ type tocABIEvent struct {
 }
 
 type tocStorageLayout struct {
-	Slots []tocStorageSlot `json:"slots"`
+	Slots      []tocStorageSlot `json:"slots"`
+	Immutables []tocStorageSlot `json:"immutables,omitempty"`
 }
 
 type tocStorageSlot struct {
@@ -72,14 +87,56 @@ func IsTOC(data []byte) bool {
 
 // CompileTOLToTOC compiles TOL source into a .toc artifact.
 func CompileTOLToTOC(source []byte, name string) ([]byte, error) {
-	bytecode, err := CompileTOLToBytecode(source, name)
+	return CompileTOLToTOCWithOptions(source, name, nil)
+}
+
+// CompileTOLToTOCWithOptions compiles TOL source into a .toc artifact with options.
+func CompileTOLToTOCWithOptions(source []byte, name string, opts *TOCCompileOptions) ([]byte, error) {
+	mod, err := ParseTOLModule(source, name)
 	if err != nil {
 		return nil, err
 	}
-	mod, err := ParseTOLModule(source, name)
+	return compileTOCFromModule(mod, source, name, opts)
+}
+
+// CompileTOLToTOCWithLoader compiles a multi-file TOL program into a .toc
+// artifact. The source hash covers the entry file only.
+func CompileTOLToTOCWithLoader(loader SourceLoader, path string) ([]byte, error) {
+	return CompileTOLToTOCWithLoaderOptions(loader, path, nil)
+}
+
+// CompileTOLToTOCWithLoaderOptions is CompileTOLToTOCWithLoader with options.
+func CompileTOLToTOCWithLoaderOptions(loader SourceLoader, path string, opts *TOCCompileOptions) ([]byte, error) {
+	mod, err := ParseTOLModuleWithLoader(loader, path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := loader.LoadSource(cleanImportPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return compileTOCFromModule(mod, source, path, opts)
+}
+
+func compileTOCFromModule(mod *tolast.Module, source []byte, name string, opts *TOCCompileOptions) ([]byte, error) {
+	prog, err := buildLoweredTOLModule(mod, name)
+	if err != nil {
+		return nil, err
+	}
+	irp, sm, err := buildDirectIRWithSourceMap(prog, name)
 	if err != nil {
 		return nil, err
 	}
+	bytecode, err := compileTOLSourceMapped(irp, sm)
+	if err != nil {
+		return nil, err
+	}
+	var sourceMapJSON []byte
+	if opts != nil && opts.SourceMap {
+		if sourceMapJSON, err = EncodeSourceMap(sm); err != nil {
+			return nil, err
+		}
+	}
 	contractName, abiJSON, storageJSON, err := buildTOCMetadata(mod)
 	if err != nil {
 		return nil, err
@@ -93,6 +150,7 @@ func CompileTOLToTOC(source []byte, name string) ([]byte, error) {
 		StorageLayoutJSON: storageJSON,
 		SourceHash:        keccak256Hex(source),
 		BytecodeHash:      keccak256Hex(bytecode),
+		SourceMapJSON:     sourceMapJSON,
 	})
 }
 
@@ -149,6 +207,14 @@ func EncodeTOC(a *TOCArtifact) ([]byte, error) {
 	if _, err := buf.Write(bytecodeHash); err != nil {
 		return nil, err
 	}
+	if len(a.SourceMapJSON) > 0 {
+		if err := writeU8(&buf, tocSectionSourceMap); err != nil {
+			return nil, err
+		}
+		if err := writeLenBytes(&buf, a.SourceMapJSON); err != nil {
+			return nil, err
+		}
+	}
 	return buf.Bytes(), nil
 }
 
@@ -197,8 +263,27 @@ func DecodeTOC(data []byte) (*TOCArtifact, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid toc bytecode hash: %w", err)
 	}
-	if r.n != len(data) {
-		return nil, fmt.Errorf("trailing bytes in toc payload")
+	var sourceMapJSON []byte
+	var lastSection uint8
+	for r.n < len(data) {
+		tag, err := readU8(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid toc section: %w", err)
+		}
+		if tag <= lastSection {
+			return nil, fmt.Errorf("trailing bytes in toc payload")
+		}
+		lastSection = tag
+		payload, err := readLenBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid toc section %d: %w", tag, err)
+		}
+		switch tag {
+		case tocSectionSourceMap:
+			sourceMapJSON = payload
+		default:
+			return nil, fmt.Errorf("unknown toc section %d", tag)
+		}
 	}
 	if strings.TrimSpace(contractName) == "" {
 		return nil, fmt.Errorf("toc contract name is empty")
@@ -210,7 +295,8 @@ func DecodeTOC(data []byte) (*TOCArtifact, error) {
 	if !bytes.Equal(gotBytecodeHash, bytecodeHash) {
 		return nil, fmt.Errorf("toc bytecode hash mismatch")
 	}
-	if _, err := DecodeFunctionProto(bytecode); err != nil {
+	proto, err := DecodeFunctionProto(bytecode)
+	if err != nil {
 		return nil, fmt.Errorf("toc embedded bytecode decode failed: %w", err)
 	}
 	if len(abiJSON) > 0 && !json.Valid(abiJSON) {
@@ -219,6 +305,15 @@ func DecodeTOC(data []byte) (*TOCArtifact, error) {
 	if len(storageJSON) > 0 && !json.Valid(storageJSON) {
 		return nil, fmt.Errorf("toc storage payload is not valid json")
 	}
+	if len(sourceMapJSON) > 0 {
+		sm, err := DecodeSourceMap(sourceMapJSON)
+		if err != nil {
+			return nil, fmt.Errorf("toc source map: %w", err)
+		}
+		if err := VerifySourceMap(sm, proto); err != nil {
+			return nil, fmt.Errorf("toc source map: %w", err)
+		}
+	}
 	return &TOCArtifact{
 		Version:           version,
 		Compiler:          compiler,
@@ -228,9 +323,19 @@ func DecodeTOC(data []byte) (*TOCArtifact, error) {
 		StorageLayoutJSON: storageJSON,
 		SourceHash:        "0x" + hex.EncodeToString(sourceHash),
 		BytecodeHash:      "0x" + hex.EncodeToString(bytecodeHash),
+		SourceMapJSON:     sourceMapJSON,
 	}, nil
 }
 
+// SourceMap decodes the embedded source map, or returns nil when the
+// artifact has none.
+func (a *TOCArtifact) SourceMap() (*SourceMap, error) {
+	if a == nil || len(a.SourceMapJSON) == 0 {
+		return nil, nil
+	}
+	return DecodeSourceMap(a.SourceMapJSON)
+}
+
 // VerifyTOCSourceHash checks whether a decoded TOC artifact matches the given source bytes.
 func VerifyTOCSourceHash(toc *TOCArtifact, source []byte) error {
 	if toc == nil {
@@ -308,6 +413,15 @@ func buildTOCMetadata(mod *tolast.Module) (string, []byte, []byte, error) {
 		}
 	}
 
+	for _, im := range mod.Contract.Immutables {
+		name := strings.TrimSpace(im.Name)
+		storage.Immutables = append(storage.Immutables, tocStorageSlot{
+			Name:          name,
+			Type:          normalizeTOCType(im.Type),
+			CanonicalHash: keccak256Hex([]byte(fmt.Sprintf("tol.immutable.%s.%s", contractName, name))),
+		})
+	}
+
 	abiJSON, err := json.Marshal(abi)
 	if err != nil {
 		return "", nil, nil, err
@@ -335,6 +449,7 @@ func normalizeTOCType(t string) string {
 	repl := strings.NewReplacer(
 		"( ", "(",
 		" )", ")",
+		" [", "[",
 		"[ ", "[",
 		" ]", "]",
 		" ,", ",",
@@ -100,6 +100,42 @@ contract Demo {
 	}
 }
 
+func TestCompileTOLToTOCStorageLayoutListsImmutables(t *testing.T) {
+	src := []byte(`
+tol 0.2
+contract Demo {
+  immutable owner: address;
+  constructor(o: address) {
+    set owner = o;
+  }
+}
+`)
+	out, err := CompileTOLToTOC(src, "<tol>")
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	art, err := DecodeTOC(out)
+	if err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	var storage struct {
+		Immutables []struct {
+			Name          string `json:"name"`
+			Type          string `json:"type"`
+			CanonicalHash string `json:"canonical_hash"`
+		} `json:"immutables"`
+	}
+	if err := json.Unmarshal(art.StorageLayoutJSON, &storage); err != nil {
+		t.Fatalf("invalid storage json: %v", err)
+	}
+	if len(storage.Immutables) != 1 || storage.Immutables[0].Name != "owner" || storage.Immutables[0].Type != "address" {
+		t.Fatalf("unexpected immutables: %+v", storage.Immutables)
+	}
+	if want := computeImmutableSlotHash("Demo", "owner"); storage.Immutables[0].CanonicalHash != want {
+		t.Fatalf("unexpected immutable hash: got=%s want=%s", storage.Immutables[0].CanonicalHash, want)
+	}
+}
+
 func TestCompileTOLToTOCDeterministic(t *testing.T) {
 	src := []byte(`
 tol 0.2
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	tolast "github.com/tos-network/tolang/tol/ast"
+	"github.com/tos-network/tolang/tol/parser"
 )
 
 // TOICompileOptions configures .toi textual generation.
@@ -26,6 +27,16 @@ func CompileTOLToTOIWithOptions(source []byte, name string, opts *TOICompileOpti
 	return BuildTOIFromModuleWithOptions(mod, opts)
 }
 
+// CompileTOLToTOIWithLoader compiles a multi-file TOL program into textual
+// .toi, including functions and events inherited from imported bases.
+func CompileTOLToTOIWithLoader(loader SourceLoader, path string, opts *TOICompileOptions) ([]byte, error) {
+	mod, err := ParseTOLModuleWithLoader(loader, path)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTOIFromModuleWithOptions(mod, opts)
+}
+
 // BuildTOIFromModule renders a parsed module into a textual interface declaration.
 func BuildTOIFromModule(mod *tolast.Module) ([]byte, error) {
 	return BuildTOIFromModuleWithOptions(mod, nil)
@@ -261,6 +272,26 @@ func parseTOIInfo(data []byte) (*TOIInfo, error) {
 	return info, nil
 }
 
+// parseTOIInterface parses textual .toi content into an interface declaration
+// so imported package surfaces can be type-checked.
+func parseTOIInterface(data []byte, name string) (*tolast.InterfaceDecl, error) {
+	if err := ValidateTOIText(data); err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, raw := range lines {
+		lines[i] = normalizeTOILine(raw)
+	}
+	mod, diags := parser.ParseFile(name, []byte(strings.Join(lines, "\n")))
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if len(mod.Interfaces) != 1 {
+		return nil, fmt.Errorf("toi text must contain exactly one interface declaration")
+	}
+	return &mod.Interfaces[0], nil
+}
+
 func normalizeTOILine(raw string) string {
 	line := strings.TrimSpace(raw)
 	if line == "" {
@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	tolast "github.com/tos-network/tolang/tol/ast"
 )
 
 var torZipMagic = [4]byte{'P', 'K', 0x03, 0x04}
@@ -60,12 +62,30 @@ func CompileTOLToTOR(source []byte, name string, opts *TORCompileOptions) ([]byt
 	if err != nil {
 		return nil, err
 	}
+	return compileTORFromModule(mod, source, name, opts)
+}
+
+// CompileTOLToTORWithLoader compiles a multi-file TOL program into a minimal
+// .tor package. IncludeSource embeds the entry file only.
+func CompileTOLToTORWithLoader(loader SourceLoader, path string, opts *TORCompileOptions) ([]byte, error) {
+	mod, err := ParseTOLModuleWithLoader(loader, path)
+	if err != nil {
+		return nil, err
+	}
+	source, err := loader.LoadSource(cleanImportPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return compileTORFromModule(mod, source, path, opts)
+}
+
+func compileTORFromModule(mod *tolast.Module, source []byte, name string, opts *TORCompileOptions) ([]byte, error) {
 	if mod == nil || mod.Contract == nil || strings.TrimSpace(mod.Contract.Name) == "" {
 		return nil, fmt.Errorf("tor compile requires contract declaration")
 	}
 	contractName := strings.TrimSpace(mod.Contract.Name)
 
-	toc, err := CompileTOLToTOC(source, name)
+	toc, err := compileTOCFromModule(mod, source, name, nil)
 	if err != nil {
 		return nil, err
 	}
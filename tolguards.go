@@ -0,0 +1,69 @@
+package lua
+
+import (
+	"strings"
+)
+
+// openTOLGuards registers the runtime guards called by TOL-generated code.
+func openTOLGuards(L *LState) {
+	L.SetGlobal("__tol_static_guard", L.NewFunction(tolStaticGuard))
+	L.SetGlobal("__tol_nonpayable", L.NewFunction(tolNonPayable))
+	L.SetGlobal("__tol_seal", L.NewFunction(tolSeal))
+}
+
+// tolSeal implements __tol_seal(), called at the end of a TOL module's
+// initialization: it seals every reserved `__tol_` global except the
+// storage table, which hosts rebind per frame, and freezes the `tos` entry
+// table. It acts on the environment of the module calling it.
+func tolSeal(L *LState) int {
+	globals := L.callerEnv()
+	globals.ForEach(func(k, _ LValue) {
+		if name, ok := k.(LString); ok && strings.HasPrefix(string(name), "__tol_") && name != "__tol_storage" {
+			globals.SealField(string(name))
+		}
+	})
+	if tos, ok := globals.RawGetString("tos").(*LTable); ok {
+		tos.Freeze()
+		globals.SealField("tos")
+	}
+	return 0
+}
+
+// tolStaticGuard implements __tol_static_guard(op): it raises
+// STATIC_CALL_VIOLATION when a state-changing op runs in static mode.
+func tolStaticGuard(L *LState) int {
+	if L.StaticMode() {
+		L.RaiseError("STATIC_CALL_VIOLATION: %s", L.OptString(1, "state change"))
+	}
+	return 0
+}
+
+// tolNonPayable implements __tol_nonpayable(): it reverts with reason
+// NON_PAYABLE when the execution context (the global `msg` table) carries a
+// non-zero value. A missing context or missing msg.value counts as zero; a
+// malformed msg.value is a host error and raises a plain error.
+func tolNonPayable(L *LState) int {
+	msg, ok := L.callerGlobal("msg").(*LTable)
+	if !ok {
+		return 0
+	}
+	var value LNumber
+	switch v := msg.RawGetString("value").(type) {
+	case *LNilType:
+		return 0
+	case LNumber:
+		value = v
+	case LString:
+		n, err := parseNumber(string(v))
+		if err != nil {
+			L.RaiseError("NON_PAYABLE: invalid msg.value %q", string(v))
+		}
+		value = n
+	default:
+		L.RaiseError("NON_PAYABLE: invalid msg.value of type %s", v.Type().String())
+	}
+	if value != LNumberZero {
+		L.raiseRevert(newRevertError(L, "NON_PAYABLE", "", ""))
+	}
+	return 0
+}
@@ -0,0 +1,300 @@
+package lua
+
+// Tracer observes the execution of a state, in the style of EVM structLog
+// tracers. Attach one with SetTracer; hosts propagate it to the frames of
+// nested contract calls through ContractCall.Tracer and
+// ContractCreate.Tracer and report those frames with OnEnter and OnExit.
+//
+// Callbacks run synchronously on the executing goroutine and must not
+// modify the state. Values passed to them (the step included) are only
+// valid for the duration of the callback.
+type Tracer interface {
+	// OnStep is called before each VM instruction is executed.
+	OnStep(L *LState, step *TraceStep)
+	// OnEnter is called when a contract frame starts, OnExit when it ends.
+	OnEnter(call *TraceCall)
+	OnExit(call *TraceCall, res *TraceResult)
+	// OnStorageRead and OnStorageWrite report accesses to the contract's
+	// TOL storage table (`__tol_storage`). Unset slots read as zero.
+	OnStorageRead(L *LState, slot, value LValue)
+	OnStorageWrite(L *LState, slot, prev, value LValue)
+	// OnLog reports an event emitted with `emit`.
+	OnLog(L *LState, log LogEntry)
+	// OnRevert reports a TOL `revert` or failed `require` before the error
+	// unwinds the stack.
+	OnRevert(L *LState, rerr *RevertError)
+}
+
+// NopTracer implements Tracer with callbacks that do nothing. Embed it to
+// implement only the callbacks of interest.
+type NopTracer struct{}
+
+func (NopTracer) OnStep(*LState, *TraceStep)                     {}
+func (NopTracer) OnEnter(*TraceCall)                             {}
+func (NopTracer) OnExit(*TraceCall, *TraceResult)                {}
+func (NopTracer) OnStorageRead(*LState, LValue, LValue)          {}
+func (NopTracer) OnStorageWrite(*LState, LValue, LValue, LValue) {}
+func (NopTracer) OnLog(*LState, LogEntry)                        {}
+func (NopTracer) OnRevert(*LState, *RevertError)                 {}
+
+// TraceStep describes the instruction about to be executed.
+type TraceStep struct {
+	// Pc is the index of the instruction in Proto.Code.
+	Pc    int
+	Op    int
+	Proto *FunctionProto
+	// Line is the source line of the instruction, or zero when the proto
+	// carries no line information.
+	Line int
+	// Gas is the gas left before the instruction; zero for unmetered
+	// states. GasUsed is the gas used so far. The cost of an instruction
+	// is the difference to the GasUsed of the next step of the same state.
+	Gas     uint64
+	GasUsed uint64
+	// Depth is the contract frame depth (see CallDepth) and Frames the
+	// number of active function calls in the state.
+	Depth  int
+	Frames int
+
+	ls    *LState
+	frame *callFrame
+}
+
+// OpName returns the name of the opcode, e.g. "GETTABLE".
+func (s *TraceStep) OpName() string {
+	if s.Op < 0 || s.Op >= len(opProps) {
+		return "UNKNOWN"
+	}
+	return opProps[s.Op].Name
+}
+
+// Registers returns a copy of the registers of the executing function.
+func (s *TraceStep) Registers() []LValue {
+	base := s.frame.LocalBase
+	top := base + int(s.Proto.NumUsedRegisters)
+	if rtop := s.ls.reg.Top(); top > rtop {
+		top = rtop
+	}
+	if top < base {
+		return nil
+	}
+	out := make([]LValue, top-base)
+	for i := range out {
+		if v := s.ls.reg.array[base+i]; v != nil {
+			out[i] = v
+		} else {
+			out[i] = LNil
+		}
+	}
+	return out
+}
+
+// TraceCall describes a contract frame reported to OnEnter and OnExit.
+type TraceCall struct {
+	Kind CallKind
+	From LAddress
+	// To is the callee, or the new account for deployments.
+	To    LAddress
+	Value LNumber
+	// Input is the hex calldata, or the hex init code for deployments.
+	Input string
+	Gas   uint64
+	Depth int
+}
+
+// TraceResult is the outcome of a traced contract frame.
+type TraceResult struct {
+	OK bool
+	// Output is the hex return data, or the revert payload.
+	Output  string
+	GasUsed uint64
+	Err     error
+}
+
+// SetTracer attaches t to the state; nil detaches the current tracer.
+// Without a tracer the VM runs its regular, untraced loop.
+func (ls *LState) SetTracer(t Tracer) {
+	ls.tracer = t
+	if t != nil {
+		ls.mainLoop = mainLoopWithTrace
+	} else {
+		ls.mainLoop = mainLoop
+	}
+}
+
+// Tracer returns the attached tracer, or nil.
+func (ls *LState) Tracer() Tracer { return ls.tracer }
+
+// mainLoopWithTrace is mainLoop reporting every step, and every storage
+// access made by an instruction, to the attached tracer.
+func mainLoopWithTrace(L *LState, baseframe *callFrame) {
+	var inst uint32
+	var cf *callFrame
+
+	if L.stack.IsEmpty() {
+		return
+	}
+
+	L.currentFrame = L.stack.Last()
+	if L.currentFrame.Fn.IsG {
+		callGFunction(L, false)
+		return
+	}
+
+	step := &TraceStep{ls: L}
+	for {
+		cf = L.currentFrame
+		inst = cf.Fn.Proto.Code[cf.Pc]
+		tracer := L.tracer
+		var access storageAccess
+		if tracer != nil {
+			L.fillTraceStep(step, cf, inst)
+			tracer.OnStep(L, step)
+			access = L.traceStorageAccess(cf, inst)
+		}
+		cf.Pc++
+		if L.gasLimit > 0 {
+			L.gasUsed++
+			if L.gasUsed > L.gasLimit {
+				L.RaiseError("lua: gas limit exceeded")
+				return
+			}
+		}
+		ret := jumpTable[int(inst>>26)](L, inst, baseframe)
+		if access.storage != nil {
+			access.report(L, tracer, cf, inst)
+		}
+		if ret == 1 {
+			return
+		}
+	}
+}
+
+func (ls *LState) fillTraceStep(step *TraceStep, cf *callFrame, inst uint32) {
+	proto := cf.Fn.Proto
+	step.Pc = cf.Pc
+	step.Op = int(inst >> 26)
+	step.Proto = proto
+	step.Line = 0
+	if cf.Pc < len(proto.DbgSourcePositions) {
+		step.Line = proto.DbgSourcePositions[cf.Pc]
+	}
+	step.GasUsed = ls.gasUsed
+	step.Gas = 0
+	if ls.gasLimit > ls.gasUsed {
+		step.Gas = ls.gasLimit - ls.gasUsed
+	}
+	step.Depth = ls.callDepth
+	step.Frames = ls.stack.Sp()
+	step.frame = cf
+}
+
+// storageAccess is a table instruction operating on the storage table,
+// recorded before it executes.
+type storageAccess struct {
+	storage *LTable
+	key     LValue
+	prev    LValue
+	write   bool
+}
+
+// traceStorageAccess returns the storage access made by inst, if any: a
+// table read or write whose table is the frame's `__tol_storage`.
+func (ls *LState) traceStorageAccess(cf *callFrame, inst uint32) storageAccess {
+	lbase := cf.LocalBase
+	B := int(inst & 0x1ff)
+	C := int(inst>>9) & 0x1ff
+	switch int(inst >> 26) {
+	case OP_GETTABLE, OP_GETTABLEKS:
+		if tb, ok := ls.reg.Get(lbase + B).(*LTable); ok && tb == ls.frameStorage(cf) {
+			return storageAccess{storage: tb, key: ls.rkValue(C)}
+		}
+	case OP_SETTABLE, OP_SETTABLEKS:
+		A := int(inst>>18) & 0xff
+		if tb, ok := ls.reg.Get(lbase + A).(*LTable); ok && tb == ls.frameStorage(cf) {
+			key := ls.rkValue(B)
+			return storageAccess{storage: tb, key: key, prev: tb.RawGet(key), write: true}
+		}
+	}
+	return storageAccess{}
+}
+
+// report passes the executed access to tracer.
+func (a *storageAccess) report(L *LState, tracer Tracer, cf *callFrame, inst uint32) {
+	if a.write {
+		tracer.OnStorageWrite(L, a.key, storageValue(a.prev), storageValue(a.storage.RawGet(a.key)))
+		return
+	}
+	A := int(inst>>18) & 0xff
+	tracer.OnStorageRead(L, a.key, storageValue(L.reg.Get(cf.LocalBase+A)))
+}
+
+// frameStorage returns the storage table visible to the function running
+// in cf, or nil.
+func (ls *LState) frameStorage(cf *callFrame) *LTable {
+	if env := cf.Fn.Env; env != nil {
+		if tb, ok := env.RawGetString("__tol_storage").(*LTable); ok {
+			return tb
+		}
+	}
+	tb, _ := ls.G.Global.RawGetString("__tol_storage").(*LTable)
+	return tb
+}
+
+// storageValue maps an unset slot to zero, as `__tol_sload` does.
+func storageValue(v LValue) LValue {
+	if v == nil || v == LNil {
+		return LNumberZero
+	}
+	return v
+}
+
+// MultiTracer returns a tracer forwarding every event to each of tracers,
+// in order.
+func MultiTracer(tracers ...Tracer) Tracer {
+	return multiTracer(append([]Tracer(nil), tracers...))
+}
+
+type multiTracer []Tracer
+
+func (m multiTracer) OnStep(L *LState, step *TraceStep) {
+	for _, t := range m {
+		t.OnStep(L, step)
+	}
+}
+
+func (m multiTracer) OnEnter(call *TraceCall) {
+	for _, t := range m {
+		t.OnEnter(call)
+	}
+}
+
+func (m multiTracer) OnExit(call *TraceCall, res *TraceResult) {
+	for _, t := range m {
+		t.OnExit(call, res)
+	}
+}
+
+func (m multiTracer) OnStorageRead(L *LState, slot, value LValue) {
+	for _, t := range m {
+		t.OnStorageRead(L, slot, value)
+	}
+}
+
+func (m multiTracer) OnStorageWrite(L *LState, slot, prev, value LValue) {
+	for _, t := range m {
+		t.OnStorageWrite(L, slot, prev, value)
+	}
+}
+
+func (m multiTracer) OnLog(L *LState, log LogEntry) {
+	for _, t := range m {
+		t.OnLog(L, log)
+	}
+}
+
+func (m multiTracer) OnRevert(L *LState, rerr *RevertError) {
+	for _, t := range m {
+		t.OnRevert(L, rerr)
+	}
+}
@@ -0,0 +1,107 @@
+package lua
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// CallFrame is a node of the call tree built by CallTracer.
+type CallFrame struct {
+	Type         string       `json:"type"`
+	From         LAddress     `json:"from"`
+	To           LAddress     `json:"to"`
+	Value        LNumber      `json:"value"`
+	Gas          uint64       `json:"gas"`
+	GasUsed      uint64       `json:"gasUsed"`
+	Input        string       `json:"input"`
+	Output       string       `json:"output"`
+	Error        string       `json:"error,omitempty"`
+	RevertReason string       `json:"revertReason,omitempty"`
+	Logs         []CallLog    `json:"logs,omitempty"`
+	Calls        []*CallFrame `json:"calls,omitempty"`
+}
+
+// CallLog is an event emitted directly by a CallFrame.
+type CallLog struct {
+	Address LAddress `json:"address"`
+	Event   string   `json:"event"`
+	Args    []string `json:"args"`
+}
+
+// CallTracer is a Tracer building the tree of contract frames, with the
+// logs each frame emitted. Completed top-level frames are written to the
+// tracer's writer as one JSON line each or, without a writer, kept in Calls.
+type CallTracer struct {
+	NopTracer
+
+	enc   *json.Encoder
+	err   error
+	stack []*CallFrame
+	calls []*CallFrame
+}
+
+// NewCallTracer returns a call-tree tracer writing completed top-level
+// frames to w, or keeping them if w is nil.
+func NewCallTracer(w io.Writer) *CallTracer {
+	t := &CallTracer{}
+	if w != nil {
+		t.enc = json.NewEncoder(w)
+		t.enc.SetEscapeHTML(false)
+	}
+	return t
+}
+
+// Calls returns the completed top-level frames in completion order.
+func (t *CallTracer) Calls() []*CallFrame { return t.calls }
+
+// Reset drops the recorded frames.
+func (t *CallTracer) Reset() {
+	t.stack = nil
+	t.calls = nil
+}
+
+// Err returns the first error returned by the writer.
+func (t *CallTracer) Err() error { return t.err }
+
+func (t *CallTracer) OnEnter(call *TraceCall) {
+	frame := &CallFrame{
+		Type:  call.Kind.String(),
+		From:  call.From,
+		To:    call.To,
+		Value: call.Value,
+		Gas:   call.Gas,
+		Input: call.Input,
+	}
+	if n := len(t.stack); n > 0 {
+		parent := t.stack[n-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.stack = append(t.stack, frame)
+}
+
+func (t *CallTracer) OnExit(call *TraceCall, res *TraceResult) {
+	n := len(t.stack)
+	if n == 0 {
+		return
+	}
+	frame := t.stack[n-1]
+	t.stack = t.stack[:n-1]
+	frame.GasUsed = res.GasUsed
+	frame.Output = res.Output
+	frame.Error, frame.RevertReason = traceErrorStrings(res.Err)
+	if n > 1 {
+		return
+	}
+	if t.enc == nil {
+		t.calls = append(t.calls, frame)
+	} else if t.err == nil {
+		t.err = t.enc.Encode(frame)
+	}
+}
+
+func (t *CallTracer) OnLog(L *LState, log LogEntry) {
+	if n := len(t.stack); n > 0 {
+		frame := t.stack[n-1]
+		frame.Logs = append(frame.Logs, CallLog{Address: log.Address, Event: log.Event, Args: traceValueStrings(log.Args)})
+	}
+}
@@ -0,0 +1,189 @@
+package lua
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// JSONTracer is a Tracer writing one JSON object per event to a writer,
+// in the style of EVM structLog traces. Every record has a "type" field:
+// "step", "enter", "exit", "sload", "sstore", "log" or "revert". Values are
+// rendered as strings.
+type JSONTracer struct {
+	// DisableStack omits the register snapshot from step records.
+	DisableStack bool
+
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONTracer returns a tracer writing JSON lines to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONTracer{enc: enc}
+}
+
+// Err returns the first error returned by the writer. Records are dropped
+// after a write error.
+func (t *JSONTracer) Err() error { return t.err }
+
+func (t *JSONTracer) write(v any) {
+	if t.err == nil {
+		t.err = t.enc.Encode(v)
+	}
+}
+
+type jsonTraceStep struct {
+	Type    string   `json:"type"`
+	Pc      int      `json:"pc"`
+	Op      string   `json:"op"`
+	Gas     uint64   `json:"gas"`
+	GasUsed uint64   `json:"gasUsed"`
+	Depth   int      `json:"depth"`
+	Frames  int      `json:"frames"`
+	Source  string   `json:"source,omitempty"`
+	Line    int      `json:"line,omitempty"`
+	Stack   []string `json:"stack,omitempty"`
+}
+
+func (t *JSONTracer) OnStep(L *LState, step *TraceStep) {
+	rec := jsonTraceStep{
+		Type:    "step",
+		Pc:      step.Pc,
+		Op:      step.OpName(),
+		Gas:     step.Gas,
+		GasUsed: step.GasUsed,
+		Depth:   step.Depth,
+		Frames:  step.Frames,
+		Source:  step.Proto.SourceName,
+		Line:    step.Line,
+	}
+	if !t.DisableStack {
+		rec.Stack = traceValueStrings(step.Registers())
+	}
+	t.write(&rec)
+}
+
+type jsonTraceEnter struct {
+	Type  string   `json:"type"`
+	Kind  string   `json:"kind"`
+	From  LAddress `json:"from"`
+	To    LAddress `json:"to"`
+	Value LNumber  `json:"value"`
+	Input string   `json:"input"`
+	Gas   uint64   `json:"gas"`
+	Depth int      `json:"depth"`
+}
+
+func (t *JSONTracer) OnEnter(call *TraceCall) {
+	t.write(&jsonTraceEnter{
+		Type:  "enter",
+		Kind:  call.Kind.String(),
+		From:  call.From,
+		To:    call.To,
+		Value: call.Value,
+		Input: call.Input,
+		Gas:   call.Gas,
+		Depth: call.Depth,
+	})
+}
+
+type jsonTraceExit struct {
+	Type         string   `json:"type"`
+	Kind         string   `json:"kind"`
+	To           LAddress `json:"to"`
+	Depth        int      `json:"depth"`
+	OK           bool     `json:"ok"`
+	Output       string   `json:"output"`
+	GasUsed      uint64   `json:"gasUsed"`
+	Error        string   `json:"error,omitempty"`
+	RevertReason string   `json:"revertReason,omitempty"`
+}
+
+func (t *JSONTracer) OnExit(call *TraceCall, res *TraceResult) {
+	rec := jsonTraceExit{
+		Type:    "exit",
+		Kind:    call.Kind.String(),
+		To:      call.To,
+		Depth:   call.Depth,
+		OK:      res.OK,
+		Output:  res.Output,
+		GasUsed: res.GasUsed,
+	}
+	rec.Error, rec.RevertReason = traceErrorStrings(res.Err)
+	t.write(&rec)
+}
+
+type jsonTraceStorage struct {
+	Type    string   `json:"type"`
+	Address LAddress `json:"address"`
+	Slot    string   `json:"slot"`
+	Prev    *string  `json:"prev,omitempty"`
+	Value   string   `json:"value"`
+}
+
+func (t *JSONTracer) OnStorageRead(L *LState, slot, value LValue) {
+	t.write(&jsonTraceStorage{Type: "sload", Address: L.contractAddr, Slot: slot.String(), Value: value.String()})
+}
+
+func (t *JSONTracer) OnStorageWrite(L *LState, slot, prev, value LValue) {
+	p := prev.String()
+	t.write(&jsonTraceStorage{Type: "sstore", Address: L.contractAddr, Slot: slot.String(), Prev: &p, Value: value.String()})
+}
+
+type jsonTraceLog struct {
+	Type    string   `json:"type"`
+	Address LAddress `json:"address"`
+	Event   string   `json:"event"`
+	Args    []string `json:"args"`
+}
+
+func (t *JSONTracer) OnLog(L *LState, log LogEntry) {
+	t.write(&jsonTraceLog{Type: "log", Address: log.Address, Event: log.Event, Args: traceValueStrings(log.Args)})
+}
+
+type jsonTraceRevert struct {
+	Type     string   `json:"type"`
+	Address  LAddress `json:"address"`
+	Location string   `json:"location,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+	Payload  string   `json:"payload"`
+}
+
+func (t *JSONTracer) OnRevert(L *LState, rerr *RevertError) {
+	t.write(&jsonTraceRevert{
+		Type:     "revert",
+		Address:  rerr.Address,
+		Location: rerr.Location(),
+		Reason:   rerr.Reason,
+		Selector: rerr.Selector,
+		Payload:  rerr.Payload,
+	})
+}
+
+func traceValueStrings(values []LValue) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = v.String()
+	}
+	return out
+}
+
+// traceErrorStrings renders the error of a failed frame: the raised value
+// without traceback, and the reason of a revert.
+func traceErrorStrings(err error) (msg, reason string) {
+	if err == nil {
+		return "", ""
+	}
+	if rerr, ok := AsRevertError(err); ok {
+		return "execution reverted", rerr.Reason
+	}
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) && apiErr.Object != nil {
+		return apiErr.Object.String(), ""
+	}
+	return err.Error(), ""
+}
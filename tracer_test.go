@@ -0,0 +1,186 @@
+package lua
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recordingTracer struct {
+	*CallTracer
+	steps  int
+	events []string
+}
+
+func (r *recordingTracer) OnStep(L *LState, step *TraceStep) { r.steps++ }
+
+func (r *recordingTracer) OnStorageRead(L *LState, slot, value LValue) {
+	r.events = append(r.events, fmt.Sprintf("sload %s", value))
+}
+
+func (r *recordingTracer) OnStorageWrite(L *LState, slot, prev, value LValue) {
+	r.events = append(r.events, fmt.Sprintf("sstore %s->%s", prev, value))
+}
+
+func (r *recordingTracer) OnLog(L *LState, log LogEntry) {
+	r.CallTracer.OnLog(L, log)
+	r.events = append(r.events, fmt.Sprintf("log %s %v", log.Event, log.Args))
+}
+
+func (r *recordingTracer) OnRevert(L *LState, rerr *RevertError) {
+	r.events = append(r.events, "revert "+rerr.Reason)
+}
+
+func newTracerTestHost(t *testing.T) *MemoryContractHost {
+	t.Helper()
+	h := newTestContractHost(t)
+	bc, err := CompileTOLToBytecode([]byte(journalVaultSource), "<tol>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetCode(hostCounterAddr, bc)
+	return h
+}
+
+// tracedCall calls the vault from a traced top-level frame of the caller
+// contract and returns the call's ok flag.
+func tracedCall(t *testing.T, h *MemoryContractHost, tracer Tracer, data LString) LValue {
+	t.Helper()
+	L := NewState()
+	defer L.Close()
+	L.SetTracer(tracer)
+	L.SetGasLimit(1_000_000)
+	h.Attach(L, hostCallerAddr)
+	L.SetGlobal("target", hostCounterAddr)
+	L.SetGlobal("data", data)
+	if err := L.DoString(`ok = call(target, 0, data)`); err != nil {
+		t.Fatal(err)
+	}
+	return L.GetGlobal("ok")
+}
+
+func TestTracerReportsFramesStorageLogsAndReverts(t *testing.T) {
+	h := newTracerTestHost(t)
+	rec := &recordingTracer{CallTracer: NewCallTracer(nil)}
+	if ok := tracedCall(t, h, rec, mustCallData(t, "add(u256)", LNumber("2"))); ok != LTrue {
+		t.Fatal("expected add to succeed")
+	}
+	if ok := tracedCall(t, h, rec, mustCallData(t, "addThenFail(u256)", LNumber("3"))); ok != LFalse {
+		t.Fatal("expected addThenFail to fail")
+	}
+	want := []string{
+		"sload 0", "sstore 0->2", "log Added [2]",
+		"sload 2", "sstore 2->5", "log Added [3]", "revert nope",
+	}
+	if strings.Join(rec.events, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("unexpected events:\n got %v\nwant %v", rec.events, want)
+	}
+	if rec.steps == 0 {
+		t.Fatal("expected steps to be traced")
+	}
+
+	calls := rec.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected two frames, got %d", len(calls))
+	}
+	for i, reason := range []string{"", "nope"} {
+		frame := calls[i]
+		if frame.Type != "call" || frame.From != hostCallerAddr || frame.To != hostCounterAddr || frame.GasUsed == 0 {
+			t.Fatalf("unexpected frame %+v", frame)
+		}
+		if frame.RevertReason != reason || len(frame.Logs) != 1 || len(frame.Calls) != 0 {
+			t.Fatalf("unexpected frame outcome %+v", frame)
+		}
+	}
+	if calls[1].Error != "execution reverted" || calls[1].Output != EncodeRevertReason("nope") {
+		t.Fatalf("unexpected reverted frame %+v", calls[1])
+	}
+
+	var buf bytes.Buffer
+	ct := NewCallTracer(&buf)
+	tracedCall(t, h, ct, mustCallData(t, "add(u256)", LNumber("1")))
+	var frame CallFrame
+	if err := json.Unmarshal(buf.Bytes(), &frame); err != nil || len(frame.Logs) != 1 || frame.Logs[0].Args[0] != "1" {
+		t.Fatalf("unexpected call tree JSON %s: %v", buf.String(), err)
+	}
+}
+
+func TestJSONTracerWritesStructLogs(t *testing.T) {
+	h := newTracerTestHost(t)
+	var buf bytes.Buffer
+	jt := NewJSONTracer(&buf)
+	tracedCall(t, h, jt, mustCallData(t, "add(u256)", LNumber("2")))
+	if jt.Err() != nil {
+		t.Fatal(jt.Err())
+	}
+	types := map[string]int{}
+	var firstStep map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		typ, _ := rec["type"].(string)
+		types[typ]++
+		if typ == "step" && firstStep == nil {
+			firstStep = rec
+		}
+	}
+	for typ, n := range map[string]int{"enter": 1, "exit": 1, "sload": 1, "sstore": 1, "log": 1} {
+		if types[typ] != n {
+			t.Fatalf("expected %d %s records, got %v", n, typ, types)
+		}
+	}
+	if firstStep == nil || firstStep["op"] == "" || firstStep["stack"] == nil || firstStep["gas"].(float64) == 0 {
+		t.Fatalf("unexpected step record %v", firstStep)
+	}
+
+	L := NewState()
+	defer L.Close()
+	buf.Reset()
+	jt = NewJSONTracer(&buf)
+	jt.DisableStack = true
+	L.SetTracer(jt)
+	if err := L.DoString("local a = 1\nlocal b = a + 2"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `"stack"`) || !strings.Contains(buf.String(), `"op":"ADD"`) || !strings.Contains(buf.String(), `"line":2`) {
+		t.Fatalf("unexpected trace:\n%s", buf.String())
+	}
+}
+
+func TestTracerDoesNotChangeExecution(t *testing.T) {
+	const src = `
+		local t = {}
+		for i = 1, 50 do t[i] = i * 2 end
+		local ok = pcall(error, "x")
+		assert(not ok and #t == 50)
+	`
+	run := func(tracer Tracer) uint64 {
+		L := NewState()
+		defer L.Close()
+		L.SetTracer(tracer)
+		L.SetGasLimit(1_000_000)
+		if err := L.DoString(src); err != nil {
+			t.Fatal(err)
+		}
+		return L.GasUsed()
+	}
+	rec := &recordingTracer{CallTracer: NewCallTracer(nil)}
+	if plain, traced := run(nil), run(rec); plain != traced {
+		t.Fatalf("tracing changed gas: %d vs %d", plain, traced)
+	}
+	if uint64(rec.steps) != run(nil) {
+		t.Fatalf("expected one step per charged instruction, got %d", rec.steps)
+	}
+
+	L := NewState()
+	defer L.Close()
+	L.SetTracer(rec)
+	L.SetTracer(nil)
+	if L.Tracer() != nil {
+		t.Fatal("expected the tracer to be detached")
+	}
+}
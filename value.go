@@ -1,6 +1,7 @@
 package lua
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/big"
 )
@@ -16,9 +17,10 @@ const (
 	LTFunction
 	LTUserData
 	LTTable
+	LTBytes
 )
 
-var lValueNames = [8]string{"nil", "boolean", "number", "string", "address", "function", "userdata", "table"}
+var lValueNames = [9]string{"nil", "boolean", "number", "string", "address", "function", "userdata", "table", "bytes"}
 
 func (vt LValueType) String() string {
 	return lValueNames[int(vt)]
@@ -134,6 +136,19 @@ func (ad LAddress) Format(f fmt.State, c rune) {
 	defaultFormat(string(ad), f, c)
 }
 
+// LBytes is a raw byte string: TOL bytes, bytesN and calldata values. It
+// is immutable, so slicing shares the underlying memory, and comparable,
+// so == and table keys compare contents. String returns the "0x" hex form.
+type LBytes string
+
+func (bt LBytes) String() string   { return "0x" + hex.EncodeToString(bt.readOnly()) }
+func (bt LBytes) Type() LValueType { return LTBytes }
+
+// fmt.Formatter interface
+func (bt LBytes) Format(f fmt.State, c rune) {
+	defaultFormat(bt.String(), f, c)
+}
+
 func (nm LNumber) String() string   { return string(nm) }
 func (nm LNumber) Type() LValueType { return LTNumber }
 
@@ -162,6 +177,11 @@ type LTable struct {
 	strdict map[string]LValue
 	keys    []LValue
 	k2i     map[LValue]int
+
+	// frozen rejects every write; sealed lists string keys whose values
+	// cannot be changed. See Freeze and SealField.
+	frozen bool
+	sealed map[string]struct{}
 }
 
 func (tb *LTable) String() string   { return "table" }
@@ -207,6 +227,22 @@ type LState struct {
 	// Gas metering: set via SetGasLimit before execution.
 	gasLimit uint64
 	gasUsed  uint64
+
+	// Static mode: set during StaticPCall; TOL storage writes and event
+	// emission raise STATIC_CALL_VIOLATION while it is on.
+	static bool
+
+	// Contract frame: the host serving call/staticcall/delegatecall, the
+	// address of the executing contract and its nesting depth.
+	contractHost ContractHost
+	contractAddr LAddress
+	callDepth    int
+
+	// Journal recording storage writes and logs for revert; see SetJournal.
+	journal *StorageJournal
+
+	// Execution tracer; see SetTracer.
+	tracer Tracer
 }
 
 // SetGasLimit configures the maximum number of VM instructions this LState
@@ -216,9 +252,39 @@ func (ls *LState) SetGasLimit(limit uint64) {
 	ls.gasUsed = 0
 }
 
-// GasUsed returns the number of VM instructions executed so far.
+// GasUsed returns the gas consumed so far: one unit per VM instruction plus
+// the price of priced builtins and of nested contract calls.
 func (ls *LState) GasUsed() uint64 { return ls.gasUsed }
 
+// chargeGas adds the cost of a priced builtin to the gas used, raising
+// "lua: gas limit exceeded" past the limit. Unmetered states are not charged.
+func (ls *LState) chargeGas(n uint64) {
+	if ls.gasLimit == 0 {
+		return
+	}
+	ls.gasUsed += n
+	if ls.gasUsed > ls.gasLimit {
+		ls.RaiseError("lua: gas limit exceeded")
+	}
+}
+
+// SetStaticMode enables or disables static execution. While static, the
+// TOL runtime rejects storage writes (`__tol_sstore`) and event emission.
+func (ls *LState) SetStaticMode(on bool) { ls.static = on }
+
+// StaticMode reports whether the state is executing in static mode.
+func (ls *LState) StaticMode() bool { return ls.static }
+
+// StaticPCall is PCall with static mode enabled for the duration of the
+// call, as used for `staticcall`. The previous mode is restored afterwards,
+// so nested static calls stay static.
+func (ls *LState) StaticPCall(nargs, nret int, errfunc *LFunction) error {
+	prev := ls.static
+	ls.static = true
+	defer func() { ls.static = prev }()
+	return ls.PCall(nargs, nret, errfunc)
+}
+
 type LUserData struct {
 	Value     interface{}
 	Env       *LTable